@@ -9,9 +9,14 @@ package client
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 
@@ -31,18 +36,57 @@ type AlertmanagerClient interface {
 
 	// ModifyNetworkRoute updates an existing routing tree for the given
 	// tenant, or creates one if it already exists. Ensures that the base
-	// route matches all alerts with label "tenantID" = <tenantID>.
+	// route matches all alerts with label "tenantID" = <tenantID>. In
+	// single-tenant mode the route replaces the whole routing tree.
 	ModifyTenantRoute(tenantID string, route *config.Route) error
+	// ValidateTenantRoute checks the route as ModifyTenantRoute would apply
+	// it, without writing the config
+	ValidateTenantRoute(tenantID string, route *config.Route) error
 
 	// GetRoute returns the routing tree for the given tenantID
 	GetRoute(tenantID string) (*config.Route, error)
 
-	// GetTenants returns a list of tenants configured in the system
-	GetTenants() ([]string, error)
+	// SimulateRoute returns the receivers, in order, that an alert with the
+	// given labels would be sent to by the tenant's routing tree
+	SimulateRoute(tenantID string, labels map[string]string) ([]string, error)
+
+	// GetTenants returns the sorted tenants configured in the system,
+	// filtered and paged by opts
+	GetTenants(opts alert.TenantListOptions) ([]string, error)
+
+	// GetTenantConfigPreview returns a config containing only the given
+	// tenant's routing tree and receivers, with names unsecured
+	GetTenantConfigPreview(tenantID string) (*config.Config, error)
+
+	// ProvisionTenantDefaults creates the configured set of default receivers
+	// and a base route for a new tenant in a single config write
+	ProvisionTenantDefaults(tenantID string) error
 
 	GetGlobalConfig() (*config.GlobalConfig, error)
 	SetGlobalConfig(globalConfig config.GlobalConfig) error
 
+	// GetGlobalRoute returns the top-level route of the routing tree, whose
+	// grouping and timings every route below it inherits, without its child
+	// routes
+	GetGlobalRoute() (*config.Route, error)
+	// SetGlobalRoute replaces the top-level route, keeping its child routes,
+	// such as the tenant base routes, as they are
+	SetGlobalRoute(route config.Route) error
+
+	// GetConfigHash returns a hash of the current contents of the config
+	// file, used to detect concurrent modifications
+	GetConfigHash() (string, error)
+
+	// CheckConfigIntegrity returns a description of each problem found in
+	// the config file: receivers sharing a name, routes sending to a
+	// receiver that isn't defined, and template files that don't exist
+	CheckConfigIntegrity() ([]string, error)
+
+	// IfMatch returns a client whose modifications fail with
+	// ErrConfigModified unless the config file still hashes to configHash
+	// when they are made
+	IfMatch(configHash string) AlertmanagerClient
+
 	GetTemplateFileList() ([]string, error)
 	AddTemplateFile(path string) error
 	RemoveTemplateFile(path string) error
@@ -52,30 +96,117 @@ type AlertmanagerClient interface {
 	ReloadAlertmanager() error
 
 	Tenancy() *alert.TenancyConfig
+
+	// Close waits for any config write in progress to finish. It is safe to
+	// call more than once.
+	Close() error
 }
 
 type ClientConfig struct {
 	ConfigPath      string
 	AlertmanagerURL string
-	FsClient        fsclient.FSClient
-	Tenancy         *alert.TenancyConfig
-	DeleteRoutes    bool
+	// AlertmanagerURLs are the peers of an alertmanager cluster, all of which
+	// are reloaded after a change. Overrides AlertmanagerURL if set.
+	AlertmanagerURLs []string
+	FsClient         fsclient.FSClient
+	Tenancy          *alert.TenancyConfig
+	DeleteRoutes     bool
+	// DefaultsPath is the path to a file containing the receivers and route
+	// that new tenants are provisioned with. Optional.
+	DefaultsPath string
+	// FileMode is the permission the config file is written with. Defaults
+	// to DefaultConfigFileMode if zero.
+	FileMode os.FileMode
+	// DeniedGroupByLabels are high-cardinality labels that tenant routes may
+	// not group alerts by. Optional.
+	DeniedGroupByLabels []string
+	// BaseRouteTimings are the group_wait, group_interval and repeat_interval
+	// that tenant base routes are created with, unless the route sets them.
+	// Optional.
+	BaseRouteTimings config.RouteTimings
+	// BaseRouteGroupBy is the group_by that tenant base routes are given
+	// when they're modified without one. Optional.
+	BaseRouteGroupBy []string
+	// BaseRouteFallbackReceiver is a receiver shared by all tenants that new
+	// tenant base routes send the alerts none of their routes match to,
+	// rather than dropping them. Optional.
+	BaseRouteFallbackReceiver string
+	// ScrubSecrets hides secret fields of receivers and the global config
+	// that are read back, replacing them with common.SecretPlaceholder.
+	// Updates that omit a secret keep the stored value as well as those that
+	// leave it as the placeholder, which are kept regardless.
+	ScrubSecrets bool
+	// FileLocks are the locks shared with the template client, which template
+	// files are read under by their full on-disk path. Optional.
+	FileLocks *alert.FileLocker
+	// ReloadPath is the path alertmanager's reload endpoint is served at.
+	// Defaults to DefaultReloadPath if empty.
+	ReloadPath string
+}
+
+// DefaultConfigFileMode is the permission the config file is written with
+// unless ClientConfig.FileMode is set
+const DefaultConfigFileMode os.FileMode = 0660
+
+// DefaultReloadPath is the path of alertmanager's reload endpoint unless
+// ClientConfig.ReloadPath is set
+const DefaultReloadPath = "/-/reload"
+
+// ErrConfigModified is returned by modifications made through a client from
+// IfMatch when the config file has changed since the expected hash was read
+var ErrConfigModified = errors.New("Config has been modified since it was last read")
+
+// ErrRouteNotFound is returned by GetRoute when the tenant has no base route
+var ErrRouteNotFound = errors.New("route does not exist")
+
+// ReceiverReferencedError is returned by DeleteReceiver when routes still
+// send to the receiver and DeleteRoutes is off. Paths locates each of those
+// routes in the config file's routing tree.
+type ReceiverReferencedError struct {
+	Receiver string
+	Paths    []string
+}
+
+func (e ReceiverReferencedError) Error() string {
+	return fmt.Sprintf("receiver '%s' referenced in route at %s. Update routing tree and remove references before deleting this receiver", e.Receiver, strings.Join(e.Paths, ", "))
 }
 
 // Client provides methods to create and read receiver configurations
 type client struct {
 	conf ClientConfig
-	sync.RWMutex
+	*sync.RWMutex
+	// expectedHash, if set, must match the hash of the config file for a
+	// write to go ahead
+	expectedHash string
 }
 
 func NewClient(conf ClientConfig) AlertmanagerClient {
+	fileMode := conf.FileMode
+	if fileMode == 0 {
+		fileMode = DefaultConfigFileMode
+	}
+	reloadPath := conf.ReloadPath
+	if reloadPath == "" {
+		reloadPath = DefaultReloadPath
+	}
 	return &client{
+		RWMutex: &sync.RWMutex{},
 		conf: ClientConfig{
-			ConfigPath:      conf.ConfigPath,
-			AlertmanagerURL: conf.AlertmanagerURL,
-			FsClient:        conf.FsClient,
-			Tenancy:         conf.Tenancy,
-			DeleteRoutes:    conf.DeleteRoutes,
+			ConfigPath:                conf.ConfigPath,
+			AlertmanagerURL:           conf.AlertmanagerURL,
+			AlertmanagerURLs:          conf.AlertmanagerURLs,
+			FsClient:                  conf.FsClient,
+			Tenancy:                   conf.Tenancy,
+			DeleteRoutes:              conf.DeleteRoutes,
+			DefaultsPath:              conf.DefaultsPath,
+			FileMode:                  fileMode,
+			DeniedGroupByLabels:       conf.DeniedGroupByLabels,
+			BaseRouteTimings:          conf.BaseRouteTimings,
+			BaseRouteGroupBy:          conf.BaseRouteGroupBy,
+			BaseRouteFallbackReceiver: conf.BaseRouteFallbackReceiver,
+			ScrubSecrets:              conf.ScrubSecrets,
+			FileLocks:                 conf.FileLocks,
+			ReloadPath:                reloadPath,
 		},
 	}
 }
@@ -91,12 +222,12 @@ func (c *client) CreateReceiver(tenantID string, rec config.Receiver) error {
 	}
 
 	rec.Secure(tenantID)
-
-	conf.Receivers = append(conf.Receivers, &rec)
-	err = conf.Validate()
+	err = checkReceiverNameUnused(conf, rec.Name, nil)
 	if err != nil {
 		return err
 	}
+
+	conf.Receivers = append(conf.Receivers, &rec)
 	return c.writeConfigFile(conf)
 }
 
@@ -106,7 +237,7 @@ func (c *client) GetReceivers(tenantID string) ([]config.Receiver, error) {
 	defer c.RUnlock()
 	conf, err := c.readConfigFile()
 	if err != nil {
-		return []config.Receiver{}, nil
+		return []config.Receiver{}, err
 	}
 
 	recs := make([]config.Receiver, 0)
@@ -116,6 +247,9 @@ func (c *client) GetReceivers(tenantID string) ([]config.Receiver, error) {
 				continue
 			}
 			rec.Unsecure(tenantID)
+			if c.conf.ScrubSecrets {
+				rec.ScrubSecrets()
+			}
 			recs = append(recs, *rec)
 		}
 	}
@@ -144,6 +278,13 @@ func (c *client) UpdateReceiver(tenantID, receiverName string, newRec *config.Re
 	if receiverIdx < 0 {
 		return fmt.Errorf("Receiver '%s' not found", newRec.Name)
 	}
+	err = checkReceiverNameUnused(conf, newRec.Name, conf.Receivers[receiverIdx])
+	if err != nil {
+		return err
+	}
+	// Secrets submitted as the placeholder they're read back as are kept,
+	// so a receiver can be edited without entering its secrets again
+	newRec.RestoreSecrets(conf.Receivers[receiverIdx], c.conf.ScrubSecrets)
 
 	conf.Receivers[receiverIdx] = newRec
 	err = conf.Validate()
@@ -179,8 +320,8 @@ func (c *client) DeleteReceiver(tenantID, receiverName string) error {
 	if c.conf.DeleteRoutes {
 		conf.RemoveReceiverFromRoute(receiverToDelete)
 	} else {
-		if conf.SearchRoutesForReceiver(receiverToDelete) {
-			return fmt.Errorf("reciever '%s' referenced in route. Update routing tree and remove references before deleting this receiver", receiverName)
+		if paths := conf.FindRoutePathsForReceiver(receiverToDelete); len(paths) > 0 {
+			return ReceiverReferencedError{Receiver: receiverName, Paths: paths}
 		}
 	}
 
@@ -198,6 +339,42 @@ func (c *client) ModifyTenantRoute(tenantID string, route *config.Route) error {
 	if err != nil {
 		return err
 	}
+	err = c.applyTenantRoute(conf, tenantID, route)
+	if err != nil {
+		return err
+	}
+	return c.writeConfigFile(conf)
+}
+
+// ValidateTenantRoute secures the route and merges it into the config the
+// same way as ModifyTenantRoute, and validates the result without writing it
+func (c *client) ValidateTenantRoute(tenantID string, route *config.Route) error {
+	c.RLock()
+	defer c.RUnlock()
+	conf, err := c.readConfigFile()
+	if err != nil {
+		return err
+	}
+	err = c.applyTenantRoute(conf, tenantID, route)
+	if err != nil {
+		return err
+	}
+	return conf.Validate()
+}
+
+// applyTenantRoute secures the tenant's route and replaces the tenant's base
+// route in conf with it
+func (c *client) applyTenantRoute(conf *config.Config, tenantID string, route *config.Route) error {
+	// Single-tenant configs have no per-tenant base routes, so the route
+	// replaces the whole routing tree
+	if !c.isMultiTenant() {
+		err := c.checkGroupByAllowed(route)
+		if err != nil {
+			return err
+		}
+		conf.Route = route
+		return nil
+	}
 
 	// ensure base route is valid base route for this tenant
 	baseRoute := c.getBaseRouteForTenant(tenantID, conf)
@@ -206,6 +383,15 @@ func (c *client) ModifyTenantRoute(tenantID string, route *config.Route) error {
 			"The base node should match nothing, then add routes as children of the base node", baseRoute.Receiver)
 	}
 
+	err := c.checkGroupByAllowed(route)
+	if err != nil {
+		return err
+	}
+	err = c.resolveGroupBy(conf, route)
+	if err != nil {
+		return err
+	}
+
 	if route.Match == nil {
 		route.Match = map[string]string{}
 	}
@@ -214,6 +400,12 @@ func (c *client) ModifyTenantRoute(tenantID string, route *config.Route) error {
 		route.Match[c.conf.Tenancy.RestrictorLabel] = tenantID
 	}
 
+	tenantRouteIdx := conf.GetRouteIdx(config.MakeBaseRouteName(tenantID))
+	var fallbackRoute *config.Route
+	if tenantRouteIdx >= 0 {
+		fallbackRoute = c.takeFallbackRoute(conf.Route.Routes[tenantRouteIdx], route)
+	}
+
 	for _, childRoute := range route.Routes {
 		if childRoute == nil {
 			continue
@@ -221,24 +413,46 @@ func (c *client) ModifyTenantRoute(tenantID string, route *config.Route) error {
 		secureRoute(tenantID, childRoute)
 	}
 
-	tenantRouteIdx := conf.GetRouteIdx(config.MakeBaseRouteName(tenantID))
 	if tenantRouteIdx < 0 {
-		err := conf.InitializeNetworkBaseRoute(route, c.conf.Tenancy.RestrictorLabel, tenantID)
-		if err != nil {
-			return err
-		}
-	} else {
-		conf.Route.Routes[tenantRouteIdx] = route
+		route.ApplyDefaultTimings(c.conf.BaseRouteTimings)
+		return conf.InitializeNetworkBaseRoute(route, c.conf.Tenancy.RestrictorLabel, tenantID, c.conf.BaseRouteFallbackReceiver)
 	}
+	if fallbackRoute != nil {
+		route.Routes = append(route.Routes, fallbackRoute)
+	}
+	conf.Route.Routes[tenantRouteIdx] = route
+	return nil
+}
 
-	err = conf.Validate()
-	if err != nil {
-		return err
+// takeFallbackRoute returns the catch-all route to the shared fallback
+// receiver that InitializeNetworkBaseRoute ended the tenant's existing base
+// route with, or nil if it has none. The fallback route is kept by every
+// modification of the base route, so the copy of it that route ends with, as
+// read from GetRoute, is removed rather than secured like a tenant's route.
+func (c *client) takeFallbackRoute(existingRoute, route *config.Route) *config.Route {
+	if len(existingRoute.Routes) == 0 {
+		return nil
 	}
-	return c.writeConfigFile(conf)
+	fallbackRoute := existingRoute.Routes[len(existingRoute.Routes)-1]
+	if !c.isFallbackRoute(fallbackRoute) {
+		return nil
+	}
+	if len(route.Routes) > 0 && c.isFallbackRoute(route.Routes[len(route.Routes)-1]) {
+		route.Routes = route.Routes[:len(route.Routes)-1]
+	}
+	return fallbackRoute
 }
 
-// GetRoute returns the base route for the given tenantID
+// isFallbackRoute reports whether the route is a catch-all route to the
+// shared fallback receiver, as created by InitializeNetworkBaseRoute
+func (c *client) isFallbackRoute(route *config.Route) bool {
+	return c.conf.BaseRouteFallbackReceiver != "" && route != nil &&
+		route.Receiver == c.conf.BaseRouteFallbackReceiver &&
+		len(route.Match) == 0 && len(route.MatchRE) == 0 && len(route.Routes) == 0
+}
+
+// GetRoute returns the base route for the given tenantID, or the whole
+// routing tree if the client is single-tenant
 func (c *client) GetRoute(tenantID string) (*config.Route, error) {
 	c.RLock()
 	defer c.RUnlock()
@@ -247,16 +461,88 @@ func (c *client) GetRoute(tenantID string) (*config.Route, error) {
 		return &config.Route{}, err
 	}
 
+	// Single-tenant configs have no per-tenant base routes
+	if !c.isMultiTenant() {
+		return conf.Route, nil
+	}
+
 	routeIdx := conf.GetRouteIdx(config.MakeBaseRouteName(tenantID))
 	if routeIdx >= 0 {
 		route := conf.Route.Routes[routeIdx]
 		unsecureRoute(tenantID, route)
 		return route, nil
 	}
-	return nil, fmt.Errorf("Route for tenant %s does not exist", tenantID)
+	return nil, fmt.Errorf("tenant %s: %w", tenantID, ErrRouteNotFound)
+}
+
+// SimulateRoute routes the labels through the tenant's routing tree the way
+// alertmanager would, honoring match, match_re and continue. In multi-tenant
+// mode the alert is given the tenant label, which it needs to reach the
+// tenant's routing tree at all.
+func (c *client) SimulateRoute(tenantID string, labels map[string]string) ([]string, error) {
+	route, err := c.GetRoute(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	alertLabels := make(map[string]string, len(labels)+1)
+	for name, value := range labels {
+		alertLabels[name] = value
+	}
+	if c.isMultiTenant() {
+		alertLabels[c.conf.Tenancy.RestrictorLabel] = tenantID
+	}
+	return route.Receivers(alertLabels), nil
+}
+
+// GetTenantConfigPreview returns the part of the config that belongs to the
+// given tenant. The tenant's base route receiver keeps its name so the
+// returned routing tree still references a receiver in the config.
+func (c *client) GetTenantConfigPreview(tenantID string) (*config.Config, error) {
+	c.RLock()
+	defer c.RUnlock()
+	conf, err := c.readConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	// Single-tenant configs belong entirely to the one tenant
+	if !c.isMultiTenant() {
+		if c.conf.ScrubSecrets {
+			scrubConfigSecrets(conf)
+		}
+		return conf, nil
+	}
+
+	preview := &config.Config{Receivers: make([]*config.Receiver, 0)}
+	routeIdx := conf.GetRouteIdx(config.MakeBaseRouteName(tenantID))
+	if routeIdx >= 0 {
+		preview.Route = conf.Route.Routes[routeIdx]
+		unsecureRoute(tenantID, preview.Route)
+	}
+	for _, rec := range conf.Receivers {
+		if rec.Name == config.MakeBaseRouteName(tenantID) {
+			preview.Receivers = append(preview.Receivers, rec)
+		} else if strings.HasPrefix(rec.Name, config.ReceiverTenantPrefix(tenantID)) {
+			rec.Unsecure(tenantID)
+			preview.Receivers = append(preview.Receivers, rec)
+		}
+	}
+	if c.conf.ScrubSecrets {
+		scrubConfigSecrets(preview)
+	}
+	return preview, nil
+}
+
+func scrubConfigSecrets(conf *config.Config) {
+	if conf.Global != nil {
+		conf.Global.ScrubSecrets()
+	}
+	for _, rec := range conf.Receivers {
+		rec.ScrubSecrets()
+	}
 }
 
-func (c *client) GetTenants() ([]string, error) {
+func (c *client) GetTenants(opts alert.TenantListOptions) ([]string, error) {
 	c.RLock()
 	defer c.RUnlock()
 	conf, err := c.readConfigFile()
@@ -270,7 +556,57 @@ func (c *client) GetTenants() ([]string, error) {
 			tenants = append(tenants, rec.Name[0:strings.Index(rec.Name, config.TenantBaseRoutePostfix)-1])
 		}
 	}
-	return tenants, nil
+	return opts.Apply(tenants), nil
+}
+
+// ProvisionTenantDefaults reads the tenant defaults file and adds each
+// default receiver, secured for the given tenant, along with a base route for
+// the tenant built from the default routing tree
+func (c *client) ProvisionTenantDefaults(tenantID string) error {
+	if !c.isMultiTenant() {
+		return fmt.Errorf("tenants can't be provisioned without multitenancy")
+	}
+	if c.conf.DefaultsPath == "" {
+		return fmt.Errorf("no tenant defaults file configured")
+	}
+	defaults, err := c.readTenantDefaults()
+	if err != nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	conf, err := c.readConfigFile()
+	if err != nil {
+		return err
+	}
+
+	if conf.GetReceiver(config.MakeBaseRouteName(tenantID)) != nil {
+		return fmt.Errorf("tenant %s has already been provisioned", tenantID)
+	}
+
+	for _, rec := range defaults.Receivers {
+		rec.Secure(tenantID)
+		conf.Receivers = append(conf.Receivers, rec)
+	}
+
+	route := defaults.Route
+	if route == nil {
+		route = &config.Route{}
+	}
+	for _, childRoute := range route.Routes {
+		if childRoute == nil {
+			continue
+		}
+		secureRoute(tenantID, childRoute)
+	}
+	route.ApplyDefaultTimings(c.conf.BaseRouteTimings)
+
+	err = conf.InitializeNetworkBaseRoute(route, c.conf.Tenancy.RestrictorLabel, tenantID, c.conf.BaseRouteFallbackReceiver)
+	if err != nil {
+		return err
+	}
+	return c.writeConfigFile(conf)
 }
 
 func (c *client) GetTemplateFileList() ([]string, error) {
@@ -307,7 +643,7 @@ func (c *client) RemoveTemplateFile(path string) error {
 
 	tmplIdx := -1
 	for idx, tmpl := range conf.Templates {
-		if tmpl == path {
+		if SameTemplatePath(tmpl, path) {
 			tmplIdx = idx
 			break
 		}
@@ -321,14 +657,53 @@ func (c *client) RemoveTemplateFile(path string) error {
 	return c.writeConfigFile(conf)
 }
 
+// Close takes the config lock so that it returns only once no write is in
+// progress. The client holds no other resources.
+func (c *client) Close() error {
+	c.Lock()
+	defer c.Unlock()
+	return nil
+}
+
+// ReloadAlertmanager reloads every configured alertmanager concurrently and
+// returns an error listing each instance that failed
 func (c *client) ReloadAlertmanager() error {
-	resp, err := http.Post(fmt.Sprintf("http://%s%s", c.conf.AlertmanagerURL, "/-/reload"), "text/plain", &bytes.Buffer{})
+	urls := c.conf.AlertmanagerURLs
+	if len(urls) == 0 {
+		urls = []string{c.conf.AlertmanagerURL}
+	}
+	errs := make([]error, len(urls))
+	var wg sync.WaitGroup
+	for i, instance := range urls {
+		wg.Add(1)
+		go func(i int, instance string) {
+			defer wg.Done()
+			errs[i] = reloadAlertmanagerInstance(instance, c.conf.ReloadPath)
+		}(i, instance)
+	}
+	wg.Wait()
+
+	var failures []string
+	for i, err := range errs {
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", urls[i], err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("error reloading alertmanager: %d of %d instances failed: %s", len(failures), len(urls), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func reloadAlertmanagerInstance(alertmanagerURL, reloadPath string) error {
+	resp, err := http.Post(fmt.Sprintf("http://%s%s", alertmanagerURL, reloadPath), "text/plain", &bytes.Buffer{})
 	if err != nil {
-		return fmt.Errorf("error reloading alertmanager: %v", err)
+		return err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		msg, _ := ioutil.ReadAll(resp.Body)
-		return fmt.Errorf("code: %d error reloading alertmanager: %s", resp.StatusCode, msg)
+		return fmt.Errorf("code: %d: %s", resp.StatusCode, msg)
 	}
 	return nil
 }
@@ -341,6 +716,9 @@ func (c *client) GetGlobalConfig() (*config.GlobalConfig, error) {
 		return nil, err
 	}
 
+	if c.conf.ScrubSecrets && conf.Global != nil {
+		conf.Global.ScrubSecrets()
+	}
 	return conf.Global, nil
 }
 
@@ -352,19 +730,153 @@ func (c *client) SetGlobalConfig(globalConfig config.GlobalConfig) error {
 		return err
 	}
 
+	if conf.Global != nil {
+		globalConfig.RestoreSecrets(conf.Global, c.conf.ScrubSecrets)
+	}
 	conf.Global = &globalConfig
-	err = conf.Validate()
+	return c.writeConfigFile(conf)
+}
+
+func (c *client) GetGlobalRoute() (*config.Route, error) {
+	c.RLock()
+	defer c.RUnlock()
+	conf, err := c.readConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	if conf.Route == nil {
+		return &config.Route{}, nil
+	}
+
+	route := *conf.Route
+	route.Routes = nil
+	return &route, nil
+}
+
+func (c *client) SetGlobalRoute(route config.Route) error {
+	if len(route.Routes) > 0 {
+		return errors.New("global route can't set child routes. Modify them through their tenant's route")
+	}
+	c.Lock()
+	defer c.Unlock()
+	conf, err := c.readConfigFile()
 	if err != nil {
 		return err
 	}
 
+	if conf.Route != nil {
+		route.Routes = conf.Route.Routes
+	}
+	conf.Route = &route
 	return c.writeConfigFile(conf)
 }
 
+func (c *client) GetConfigHash() (string, error) {
+	c.RLock()
+	defer c.RUnlock()
+	return c.readConfigHash()
+}
+
+// checkGroupByAllowed returns an error if the route or any of its children
+// group alerts by a denied label. Grouping by all labels ('...') is denied as
+// well, since it includes every denied label.
+func (c *client) checkGroupByAllowed(route *config.Route) error {
+	if route == nil || len(c.conf.DeniedGroupByLabels) == 0 {
+		return nil
+	}
+	for _, label := range route.GroupByStr {
+		if label == "..." {
+			return fmt.Errorf("route cannot group by all labels, since it includes high-cardinality labels: %s", strings.Join(c.conf.DeniedGroupByLabels, ", "))
+		}
+		for _, denied := range c.conf.DeniedGroupByLabels {
+			if label == denied {
+				return fmt.Errorf("route cannot group by high-cardinality label %s", label)
+			}
+		}
+	}
+	for _, childRoute := range route.Routes {
+		err := c.checkGroupByAllowed(childRoute)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveGroupBy gives the tenant's base route the configured default
+// group_by if it has none, and checks that every route of the tenant then
+// sets group_by or inherits it, from the base route or the root route
+func (c *client) resolveGroupBy(conf *config.Config, route *config.Route) error {
+	if len(route.GroupByStr) == 0 && len(c.conf.BaseRouteGroupBy) > 0 {
+		route.GroupByStr = append([]string{}, c.conf.BaseRouteGroupBy...)
+	}
+	inherited := conf.Route != nil && len(conf.Route.GroupByStr) > 0
+	paths := route.RoutesWithoutGroupBy("route", inherited)
+	if len(paths) > 0 {
+		return fmt.Errorf("%s has no group_by and inherits none. Set group_by on the base route", paths[0])
+	}
+	return nil
+}
+
+// IfMatch shares the config lock with c, so the hash is checked under the
+// same lock that the modification is made with
+func (c *client) IfMatch(configHash string) AlertmanagerClient {
+	return &client{
+		conf:         c.conf,
+		RWMutex:      c.RWMutex,
+		expectedHash: configHash,
+	}
+}
+
+// CheckConfigIntegrity reports duplicate receivers, routes whose receiver
+// doesn't exist, and orphaned templates, i.e. template files listed in the
+// config that don't exist. Glob patterns aren't checked, since they may
+// match no files.
+func (c *client) CheckConfigIntegrity() ([]string, error) {
+	c.RLock()
+	defer c.RUnlock()
+	conf, err := c.readConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	problems := conf.CheckIntegrity()
+	for _, tmpl := range conf.Templates {
+		// Templates given as glob patterns may match no files
+		if strings.ContainsAny(tmpl, "*?[") {
+			continue
+		}
+		if !c.templateFileExists(tmpl) {
+			problems = append(problems, fmt.Sprintf("template file does not exist: %s", tmpl))
+		}
+	}
+	return problems, nil
+}
+
+// templateFileExists reports whether the template file at path, as listed in
+// the config, exists. Like alertmanager, relative paths are resolved against
+// the directory of the config file.
+func (c *client) templateFileExists(path string) bool {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(c.conf.ConfigPath), path)
+	}
+	if c.conf.FileLocks != nil {
+		lockKey := fileLockKey(filepath.Join(c.conf.FsClient.Root(), path))
+		c.conf.FileLocks.RLock(lockKey)
+		defer c.conf.FileLocks.RUnlock(lockKey)
+	}
+	_, err := c.conf.FsClient.Stat(path)
+	return err == nil
+}
+
 func (c *client) Tenancy() *alert.TenancyConfig {
 	return c.conf.Tenancy
 }
 
+func (c *client) isMultiTenant() bool {
+	return c.conf.Tenancy != nil && c.conf.Tenancy.RestrictorLabel != ""
+}
+
 func (c *client) readConfigFile() (*config.Config, error) {
 	configFile := config.Config{}
 	file, err := c.conf.FsClient.ReadFile(c.conf.ConfigPath)
@@ -376,18 +888,69 @@ func (c *client) readConfigFile() (*config.Config, error) {
 	return &configFile, err
 }
 
+func (c *client) readTenantDefaults() (*config.TenantDefaults, error) {
+	defaults := config.TenantDefaults{}
+	file, err := c.conf.FsClient.ReadFile(c.conf.DefaultsPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading tenant defaults file: %v", err)
+	}
+	err = yaml.Unmarshal(file, &defaults)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling tenant defaults file: %v", err)
+	}
+	return &defaults, nil
+}
+
+func (c *client) readConfigHash() (string, error) {
+	file, err := c.conf.FsClient.ReadFile(c.conf.ConfigPath)
+	if err != nil {
+		return "", fmt.Errorf("error reading config files: %v", err)
+	}
+	hash := sha256.Sum256(file)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// writeConfigFile validates conf and writes it to the config file. Every
+// modification goes through here, so an invalid config is never persisted.
+// Lists such as receivers keep their order and maps are marshaled with sorted
+// keys, so an unchanged config is written back identically.
 func (c *client) writeConfigFile(conf *config.Config) error {
+	err := conf.Validate()
+	if err != nil {
+		return err
+	}
+	if c.expectedHash != "" {
+		hash, err := c.readConfigHash()
+		if err != nil {
+			return err
+		}
+		if hash != c.expectedHash {
+			return ErrConfigModified
+		}
+	}
 	yamlFile, err := yaml.Marshal(conf)
 	if err != nil {
 		return fmt.Errorf("error marshaling config file: %v", err)
 	}
-	err = c.conf.FsClient.WriteFile(c.conf.ConfigPath, yamlFile, 0660)
+	err = c.conf.FsClient.WriteFile(c.conf.ConfigPath, yamlFile, c.conf.FileMode)
 	if err != nil {
 		return fmt.Errorf("error writing config file: %v", err)
 	}
 	return nil
 }
 
+// checkReceiverNameUnused returns an error if securedName is already used by a
+// receiver other than replacing. Tenant prefixes drop underscores, so a name
+// chosen by one tenant can come out identical to another tenant's receiver
+// once secured.
+func checkReceiverNameUnused(conf *config.Config, securedName string, replacing *config.Receiver) error {
+	existing := conf.GetReceiver(securedName)
+	if existing != nil && existing != replacing {
+		return fmt.Errorf("receiver name %s conflicts with an existing receiver", securedName)
+	}
+	return nil
+}
+
 // secureRoute ensure that all receivers in the route have the
 // proper tenantID-prefixed receiver name
 func secureRoute(tenantID string, route *config.Route) {
@@ -8,7 +8,15 @@
 package client
 
 import (
-	"regexp"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"gopkg.in/yaml.v2"
@@ -78,6 +86,15 @@ templates:
 - "path/to/file1"
 - "path/to/file2"
 - "path/to/file3"
+`
+	testDefaultsPath = "test/defaults.yml"
+	testDefaultsFile = `receivers:
+- name: incident_webhook
+  webhook_configs:
+  - url: http://incidents.com/hook
+route:
+  routes:
+  - receiver: incident_webhook
 `
 )
 
@@ -100,7 +117,16 @@ func TestClient_CreateReceiver(t *testing.T) {
 
 	// create duplicate receiver
 	err = client.CreateReceiver(testNID, config.Receiver{Name: "receiver"})
-	assert.Regexp(t, regexp.MustCompile("notification config name \".*receiver\" is not unique"), err.Error())
+	assert.EqualError(t, err, "receiver name test_receiver conflicts with an existing receiver")
+
+	// "te_st" is prefixed as "test_" so this would take over test's receiver
+	err = client.CreateReceiver("te_st", config.Receiver{Name: "slack"})
+	assert.EqualError(t, err, "receiver name test_slack conflicts with an existing receiver")
+
+	// or another tenant's base route receiver
+	err = client.CreateReceiver("sam_ple", config.Receiver{Name: "tenant_base_route"})
+	assert.EqualError(t, err, "receiver name sample_tenant_base_route conflicts with an existing receiver")
+	fsClient.AssertNumberOfCalls(t, "WriteFile", 3)
 }
 
 func TestClient_GetReceivers(t *testing.T) {
@@ -120,6 +146,49 @@ func TestClient_GetReceivers(t *testing.T) {
 	recs, err = client.GetReceivers("bad_nid")
 	assert.NoError(t, err)
 	assert.Equal(t, 0, len(recs))
+
+	// error reading config file
+	client, _ = newReadErrTestClient(errors.New("read err"))
+	recs, err = client.GetReceivers(testNID)
+	assert.EqualError(t, err, "error reading config files: read err")
+	assert.Equal(t, 0, len(recs))
+}
+
+func TestClient_ConcurrentReceiverAccess(t *testing.T) {
+	// FSClient backed by an in-memory file so that writes are visible to
+	// subsequent reads
+	fsClient := &mocks.FSClient{}
+	file := []byte(testAlertmanagerFile)
+	fsClient.On("ReadFile", mock.Anything).Return(func(string) []byte { return file }, nil)
+	fsClient.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil).
+		Run(func(args mock.Arguments) { file = args[1].([]byte) })
+	client := NewClient(ClientConfig{
+		ConfigPath: "test/alertmanager.yml",
+		FsClient:   fsClient,
+		Tenancy:    &alert.TenancyConfig{RestrictorLabel: "tenantID"},
+	})
+
+	const numWriters = 20
+	wg := sync.WaitGroup{}
+	for i := 0; i < numWriters; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			err := client.CreateReceiver(testNID, config.Receiver{Name: fmt.Sprintf("concurrent_%d", i)})
+			assert.NoError(t, err)
+		}(i)
+		go func() {
+			defer wg.Done()
+			_, err := client.GetReceivers(testNID)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	recs, err := client.GetReceivers(testNID)
+	assert.NoError(t, err)
+	assert.Equal(t, 4+numWriters, len(recs))
 }
 
 func TestClient_UpdateReceiver(t *testing.T) {
@@ -131,6 +200,43 @@ func TestClient_UpdateReceiver(t *testing.T) {
 	err = client.UpdateReceiver(testNID, "nonexistent", &config.Receiver{Name: "nonexistent"})
 	fsClient.AssertNumberOfCalls(t, "WriteFile", 1)
 	assert.Error(t, err)
+
+	// renaming onto another receiver's secured name
+	err = client.UpdateReceiver("te_st", "receiver", &config.Receiver{Name: "slack"})
+	assert.EqualError(t, err, "receiver name test_slack conflicts with an existing receiver")
+	fsClient.AssertNumberOfCalls(t, "WriteFile", 1)
+}
+
+func TestClient_DeterministicConfigFile(t *testing.T) {
+	file := []byte(testAlertmanagerFile)
+	fsClient := &mocks.FSClient{}
+	fsClient.On("ReadFile", mock.Anything).Return(func(string) []byte { return file }, nil)
+	fsClient.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil).
+		Run(func(args mock.Arguments) { file = args[1].([]byte) })
+	client := NewClient(ClientConfig{
+		ConfigPath: "test/alertmanager.yml",
+		FsClient:   fsClient,
+		Tenancy:    &alert.TenancyConfig{RestrictorLabel: "tenantID"},
+	})
+
+	// Writing the same receiver back leaves the file unchanged every time
+	slack := config.Receiver{Name: "slack", SlackConfigs: []*config.SlackConfig{{APIURL: "http://slack.com/12345", Channel: "string", Username: "string"}}}
+	var written []string
+	for i := 0; i < 3; i++ {
+		receiver := slack
+		assert.NoError(t, client.UpdateReceiver(testNID, "slack", &receiver))
+		written = append(written, string(file))
+	}
+	assert.Equal(t, written[0], written[1])
+	assert.Equal(t, written[1], written[2])
+
+	// Map keys are sorted and receivers keep their order
+	assert.Less(t, strings.Index(written[0], "foo: bar"), strings.Index(written[0], "name: value"))
+	receiverOrder := []string{"null_receiver", "test_receiver", "other_tenant_base_route", "test_slack", "other_receiver", "test_webhook", "test_email"}
+	for i := 1; i < len(receiverOrder); i++ {
+		assert.Less(t, strings.Index(written[0], "- name: "+receiverOrder[i-1]), strings.Index(written[0], "- name: "+receiverOrder[i]))
+	}
 }
 
 func TestClient_DeleteReceiver(t *testing.T) {
@@ -144,6 +250,40 @@ func TestClient_DeleteReceiver(t *testing.T) {
 	fsClient.AssertNumberOfCalls(t, "WriteFile", 1)
 }
 
+func TestClient_DeleteReceiver_Referenced(t *testing.T) {
+	fsClient := &mocks.FSClient{}
+	fsClient.On("ReadFile", mock.Anything).Return([]byte(`route:
+  receiver: null_receiver
+  routes:
+  - receiver: test_tenant_base_route
+    match:
+      tenantID: test
+    routes:
+    - receiver: test_slack
+    - receiver: test_receiver
+      routes:
+      - receiver: test_slack
+receivers:
+- name: null_receiver
+- name: test_tenant_base_route
+- name: test_receiver
+- name: test_slack
+`), nil)
+	client := NewClient(ClientConfig{
+		ConfigPath: "test/alertmanager.yml",
+		FsClient:   fsClient,
+		Tenancy:    &alert.TenancyConfig{RestrictorLabel: "tenantID"},
+	})
+
+	err := client.DeleteReceiver(testNID, "slack")
+	assert.Equal(t, ReceiverReferencedError{
+		Receiver: "slack",
+		Paths:    []string{"route.routes[0].routes[0]", "route.routes[0].routes[1].routes[0]"},
+	}, err)
+	assert.EqualError(t, err, "receiver 'slack' referenced in route at route.routes[0].routes[0], route.routes[0].routes[1].routes[0]. Update routing tree and remove references before deleting this receiver")
+	fsClient.AssertNotCalled(t, "WriteFile", mock.Anything, mock.Anything, mock.Anything)
+}
+
 func TestClient_ModifyTenantRoute(t *testing.T) {
 	client, fsClient, _ := newTestClient()
 	err := client.ModifyTenantRoute(testNID, &config.Route{
@@ -173,6 +313,305 @@ func TestClient_ModifyTenantRoute(t *testing.T) {
 	fsClient.AssertNumberOfCalls(t, "WriteFile", 1)
 }
 
+func TestClient_ValidateTenantRoute(t *testing.T) {
+	client, fsClient, _ := newTestClient()
+	err := client.ValidateTenantRoute(testNID, &config.Route{
+		Receiver: "test_tenant_base_route",
+		Routes: []*config.Route{
+			{Receiver: "slack"},
+		},
+	})
+	assert.NoError(t, err)
+
+	err = client.ValidateTenantRoute(testNID, &config.Route{
+		Receiver: "invalid_base_route",
+		Routes: []*config.Route{
+			{Receiver: "slack"},
+		},
+	})
+	assert.EqualError(t, err, "route base receiver is incorrect (should be \"test_tenant_base_route\"). The base node should match nothing, then add routes as children of the base node")
+
+	// Routes to undefined receivers fail validation of the merged config
+	err = client.ValidateTenantRoute(testNID, &config.Route{
+		Receiver: "test_tenant_base_route",
+		Routes: []*config.Route{
+			{Receiver: "nonexistent"},
+		},
+	})
+	assert.Error(t, err)
+	fsClient.AssertNotCalled(t, "WriteFile", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestClient_DeniedGroupByLabels(t *testing.T) {
+	fsClient := &mocks.FSClient{}
+	fsClient.On("ReadFile", mock.Anything).Return([]byte(testAlertmanagerFile), nil)
+	fsClient.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	client := NewClient(ClientConfig{
+		ConfigPath:          "test/alertmanager.yml",
+		FsClient:            fsClient,
+		Tenancy:             &alert.TenancyConfig{RestrictorLabel: "tenantID"},
+		DeniedGroupByLabels: []string{"instance", "pod"},
+	})
+
+	err := client.ModifyTenantRoute(testNID, &config.Route{
+		Receiver: "test_tenant_base_route",
+		Routes: []*config.Route{
+			{Receiver: "slack", GroupByStr: []string{"alertname", "pod"}},
+		},
+	})
+	assert.EqualError(t, err, "route cannot group by high-cardinality label pod")
+
+	err = client.ModifyTenantRoute(testNID, &config.Route{
+		Receiver:   "test_tenant_base_route",
+		GroupByStr: []string{"..."},
+	})
+	assert.EqualError(t, err, "route cannot group by all labels, since it includes high-cardinality labels: instance, pod")
+	fsClient.AssertNotCalled(t, "WriteFile", mock.Anything, mock.Anything, mock.Anything)
+
+	err = client.ModifyTenantRoute(testNID, &config.Route{
+		Receiver:   "test_tenant_base_route",
+		GroupByStr: []string{"alertname"},
+		Routes: []*config.Route{
+			{Receiver: "slack", GroupByStr: []string{"alertname", "severity"}},
+		},
+	})
+	assert.NoError(t, err)
+	fsClient.AssertNumberOfCalls(t, "WriteFile", 1)
+}
+
+func TestClient_BaseRouteTimings(t *testing.T) {
+	fsClient := &mocks.FSClient{}
+	fsClient.On("ReadFile", mock.Anything).Return([]byte(testAlertmanagerFile), nil)
+	var out []byte
+	fsClient.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil).
+		Run(func(args mock.Arguments) { out = args[1].([]byte) })
+	client := NewClient(ClientConfig{
+		ConfigPath: "test/alertmanager.yml",
+		FsClient:   fsClient,
+		Tenancy:    &alert.TenancyConfig{RestrictorLabel: "tenantID"},
+		BaseRouteTimings: config.RouteTimings{
+			GroupWait:      "30s",
+			GroupInterval:  "5m",
+			RepeatInterval: "4h",
+		},
+	})
+
+	// Created base route carries the configured timings
+	err := client.ModifyTenantRoute(testNID, &config.Route{Receiver: "test_tenant_base_route"})
+	assert.NoError(t, err)
+	conf, err := byteToConfig(out)
+	assert.NoError(t, err)
+	baseRoute := conf.Route.Routes[conf.GetRouteIdx("test_tenant_base_route")]
+	assert.Equal(t, "30s", baseRoute.GroupWait)
+	assert.Equal(t, "5m", baseRoute.GroupInterval)
+	assert.Equal(t, "4h", baseRoute.RepeatInterval)
+
+	// Timings set on the route take precedence
+	err = client.ModifyTenantRoute(testNID, &config.Route{Receiver: "test_tenant_base_route", GroupWait: "1m"})
+	assert.NoError(t, err)
+	conf, err = byteToConfig(out)
+	assert.NoError(t, err)
+	baseRoute = conf.Route.Routes[conf.GetRouteIdx("test_tenant_base_route")]
+	assert.Equal(t, "1m", baseRoute.GroupWait)
+	assert.Equal(t, "5m", baseRoute.GroupInterval)
+
+	// Existing base routes are left as they are
+	err = client.ModifyTenantRoute(otherNID, &config.Route{Receiver: "other_tenant_base_route"})
+	assert.NoError(t, err)
+	conf, err = byteToConfig(out)
+	assert.NoError(t, err)
+	baseRoute = conf.Route.Routes[conf.GetRouteIdx("other_tenant_base_route")]
+	assert.Equal(t, "", baseRoute.GroupWait)
+}
+
+func TestClient_BaseRouteFallbackReceiver(t *testing.T) {
+	fsClient := &mocks.FSClient{}
+	fsClient.On("ReadFile", mock.Anything).Return([]byte(testAlertmanagerFile), nil)
+	var out []byte
+	fsClient.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil).
+		Run(func(args mock.Arguments) { out = args[1].([]byte) })
+	client := NewClient(ClientConfig{
+		ConfigPath:                "test/alertmanager.yml",
+		FsClient:                  fsClient,
+		Tenancy:                   &alert.TenancyConfig{RestrictorLabel: "tenantID"},
+		BaseRouteFallbackReceiver: "receiver",
+	})
+
+	// Created base route ends in a catch-all route to the fallback
+	err := client.ModifyTenantRoute(testNID, &config.Route{
+		Receiver: "test_tenant_base_route",
+		Routes:   []*config.Route{{Receiver: "slack", Match: map[string]string{"severity": "critical"}}},
+	})
+	assert.NoError(t, err)
+	conf, err := byteToConfig(out)
+	assert.NoError(t, err)
+	baseRoute := conf.Route.Routes[conf.GetRouteIdx("test_tenant_base_route")]
+	assert.Len(t, baseRoute.Routes, 2)
+	assert.Equal(t, "test_slack", baseRoute.Routes[0].Receiver)
+	assert.Equal(t, "receiver", baseRoute.Routes[1].Receiver)
+	assert.Equal(t, []string{"receiver"}, baseRoute.Receivers(map[string]string{"tenantID": testNID, "severity": "minor"}))
+
+	// Existing base routes are left as they are
+	err = client.ModifyTenantRoute(otherNID, &config.Route{Receiver: "other_tenant_base_route"})
+	assert.NoError(t, err)
+	conf, err = byteToConfig(out)
+	assert.NoError(t, err)
+	assert.Empty(t, conf.Route.Routes[conf.GetRouteIdx("other_tenant_base_route")].Routes)
+}
+
+func TestClient_BaseRouteFallbackReceiverName(t *testing.T) {
+	fsClient := &mocks.FSClient{}
+	file := []byte(testAlertmanagerFile)
+	fsClient.On("ReadFile", mock.Anything).Return(func(string) []byte { return file }, nil)
+	fsClient.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil).
+		Run(func(args mock.Arguments) { file = args[1].([]byte) })
+	client := NewClient(ClientConfig{
+		ConfigPath:                "test/alertmanager.yml",
+		FsClient:                  fsClient,
+		Tenancy:                   &alert.TenancyConfig{RestrictorLabel: "tenantID"},
+		BaseRouteFallbackReceiver: "receiver",
+	})
+
+	// The tenant's own "receiver", stored as test_receiver, shares the
+	// fallback's name, but its routes are still secured
+	err := client.ModifyTenantRoute(testNID, &config.Route{
+		Receiver: "test_tenant_base_route",
+		Routes:   []*config.Route{{Receiver: "receiver", Match: map[string]string{"severity": "critical"}}},
+	})
+	assert.NoError(t, err)
+	conf, err := byteToConfig(file)
+	assert.NoError(t, err)
+	baseRoute := conf.Route.Routes[conf.GetRouteIdx("test_tenant_base_route")]
+	assert.Equal(t, []*config.Route{
+		{Receiver: "test_receiver", Match: map[string]string{"severity": "critical"}},
+		{Receiver: "receiver"},
+	}, baseRoute.Routes)
+
+	// Writing back the route as read keeps the fallback route shared
+	route, err := client.GetRoute(testNID)
+	assert.NoError(t, err)
+	err = client.ModifyTenantRoute(testNID, route)
+	assert.NoError(t, err)
+	conf, err = byteToConfig(file)
+	assert.NoError(t, err)
+	baseRoute = conf.Route.Routes[conf.GetRouteIdx("test_tenant_base_route")]
+	assert.Equal(t, []*config.Route{
+		{Receiver: "test_receiver", Match: map[string]string{"severity": "critical"}},
+		{Receiver: "receiver"},
+	}, baseRoute.Routes)
+
+	// A route to the tenant's "receiver" is secured anywhere else in the
+	// tree, and the fallback route is kept after the tenant's routes
+	err = client.ModifyTenantRoute(testNID, &config.Route{
+		Receiver: "test_tenant_base_route",
+		Routes: []*config.Route{{
+			Receiver: "slack",
+			Match:    map[string]string{"severity": "minor"},
+			Routes:   []*config.Route{{Receiver: "receiver"}},
+		}},
+	})
+	assert.NoError(t, err)
+	conf, err = byteToConfig(file)
+	assert.NoError(t, err)
+	baseRoute = conf.Route.Routes[conf.GetRouteIdx("test_tenant_base_route")]
+	assert.Equal(t, []*config.Route{
+		{
+			Receiver: "test_slack",
+			Match:    map[string]string{"severity": "minor"},
+			Routes:   []*config.Route{{Receiver: "test_receiver"}},
+		},
+		{Receiver: "receiver"},
+	}, baseRoute.Routes)
+}
+
+func TestClient_BaseRouteGroupBy(t *testing.T) {
+	noGroupByFile := strings.Replace(testAlertmanagerFile, "  group_by:\n  - alertname\n", "", 1)
+	newClient := func(groupBy []string) (AlertmanagerClient, *[]byte) {
+		fsClient := &mocks.FSClient{}
+		fsClient.On("ReadFile", mock.Anything).Return([]byte(noGroupByFile), nil)
+		var out []byte
+		fsClient.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).
+			Return(nil).
+			Run(func(args mock.Arguments) { out = args[1].([]byte) })
+		client := NewClient(ClientConfig{
+			ConfigPath:       "test/alertmanager.yml",
+			FsClient:         fsClient,
+			Tenancy:          &alert.TenancyConfig{RestrictorLabel: "tenantID"},
+			BaseRouteGroupBy: groupBy,
+		})
+		return client, &out
+	}
+
+	// Base route without group_by is given the configured default
+	client, out := newClient([]string{"alertname"})
+	err := client.ModifyTenantRoute(testNID, &config.Route{
+		Receiver: "test_tenant_base_route",
+		Routes:   []*config.Route{{Receiver: "slack"}},
+	})
+	assert.NoError(t, err)
+	conf, err := byteToConfig(*out)
+	assert.NoError(t, err)
+	baseRoute := conf.Route.Routes[conf.GetRouteIdx("test_tenant_base_route")]
+	assert.Equal(t, []string{"alertname"}, baseRoute.GroupByStr)
+	assert.Empty(t, baseRoute.Routes[0].GroupByStr)
+
+	// group_by set on the route takes precedence
+	err = client.ModifyTenantRoute(testNID, &config.Route{Receiver: "test_tenant_base_route", GroupByStr: []string{"severity"}})
+	assert.NoError(t, err)
+	conf, err = byteToConfig(*out)
+	assert.NoError(t, err)
+	baseRoute = conf.Route.Routes[conf.GetRouteIdx("test_tenant_base_route")]
+	assert.Equal(t, []string{"severity"}, baseRoute.GroupByStr)
+
+	// Without a default, group_by has to be set somewhere in the chain
+	client, _ = newClient(nil)
+	err = client.ModifyTenantRoute(testNID, &config.Route{Receiver: "test_tenant_base_route"})
+	assert.EqualError(t, err, "route has no group_by and inherits none. Set group_by on the base route")
+
+	err = client.ModifyTenantRoute(testNID, &config.Route{
+		Receiver: "test_tenant_base_route",
+		Routes:   []*config.Route{{Receiver: "slack", GroupByStr: []string{"alertname"}}},
+	})
+	assert.EqualError(t, err, "route has no group_by and inherits none. Set group_by on the base route")
+
+	err = client.ValidateTenantRoute(testNID, &config.Route{Receiver: "test_tenant_base_route"})
+	assert.EqualError(t, err, "route has no group_by and inherits none. Set group_by on the base route")
+
+	err = client.ModifyTenantRoute(testNID, &config.Route{Receiver: "test_tenant_base_route", GroupByStr: []string{"alertname"}})
+	assert.NoError(t, err)
+}
+
+func TestClient_RouteTimeIntervals(t *testing.T) {
+	client, _, out := newTestClient()
+	err := client.ModifyTenantRoute(testNID, &config.Route{
+		Receiver: "test_tenant_base_route",
+		Routes: []*config.Route{{
+			Receiver:            "slack",
+			MuteTimeIntervals:   []string{"weekends"},
+			ActiveTimeIntervals: []string{"business_hours"},
+		}},
+	})
+	assert.NoError(t, err)
+
+	// Read back the written config
+	fsClient := &mocks.FSClient{}
+	fsClient.On("ReadFile", mock.Anything).Return(*out, nil)
+	client = NewClient(ClientConfig{
+		ConfigPath: "test/alertmanager.yml",
+		FsClient:   fsClient,
+		Tenancy:    &alert.TenancyConfig{RestrictorLabel: "tenantID"},
+	})
+	route, err := client.GetRoute(testNID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(route.Routes))
+	assert.Equal(t, "slack", route.Routes[0].Receiver)
+	assert.Equal(t, []string{"weekends"}, route.Routes[0].MuteTimeIntervals)
+	assert.Equal(t, []string{"business_hours"}, route.Routes[0].ActiveTimeIntervals)
+}
+
 func TestClient_GetRoute(t *testing.T) {
 	client, _, _ := newTestClient()
 
@@ -181,15 +620,300 @@ func TestClient_GetRoute(t *testing.T) {
 	assert.Equal(t, config.Route{Receiver: "other_tenant_base_route", Match: map[string]string{"tenantID": "other"}}, *route)
 
 	_, err = client.GetRoute("no-network")
+	assert.True(t, errors.Is(err, ErrRouteNotFound))
+	assert.EqualError(t, err, "tenant no-network: route does not exist")
+
+	client, _ = newReadErrTestClient(errors.New("read err"))
+	_, err = client.GetRoute(otherNID)
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrRouteNotFound))
+}
+
+func TestClient_GetRouteSingleTenant(t *testing.T) {
+	fsClient := &mocks.FSClient{}
+	fsClient.On("ReadFile", mock.Anything).Return([]byte(testAlertmanagerFile), nil)
+	expectedConf, _ := byteToConfig([]byte(testAlertmanagerFile))
+
+	for _, tenancy := range []*alert.TenancyConfig{nil, {RestrictorLabel: ""}} {
+		client := NewClient(ClientConfig{
+			ConfigPath: "test/alertmanager.yml",
+			FsClient:   fsClient,
+			Tenancy:    tenancy,
+		})
+		route, err := client.GetRoute("")
+		assert.NoError(t, err)
+		assert.Equal(t, expectedConf.Route, route)
+		assert.Equal(t, "null_receiver", route.Receiver)
+	}
+}
+
+func TestClient_GlobalRoute(t *testing.T) {
+	client, _, out := newTestClient()
+
+	// Tenant routes aren't part of the global route
+	route, err := client.GetGlobalRoute()
+	assert.NoError(t, err)
+	assert.Equal(t, &config.Route{
+		Receiver:       "null_receiver",
+		GroupByStr:     []string{"alertname"},
+		GroupWait:      "10s",
+		GroupInterval:  "10s",
+		RepeatInterval: "1h",
+	}, route)
+
+	// Changing the global route leaves the tenant routes as they are
+	route.GroupWait = "30s"
+	err = client.SetGlobalRoute(*route)
+	assert.NoError(t, err)
+	conf, err := byteToConfig(*out)
+	assert.NoError(t, err)
+	assert.Equal(t, "30s", conf.Route.GroupWait)
+	assert.Equal(t, "10s", conf.Route.GroupInterval)
+	assert.Equal(t, []*config.Route{{Receiver: "other_tenant_base_route", Match: map[string]string{"tenantID": "other"}}}, conf.Route.Routes)
+
+	err = client.SetGlobalRoute(config.Route{Receiver: "null_receiver", Routes: []*config.Route{{Receiver: "receiver"}}})
+	assert.EqualError(t, err, "global route can't set child routes. Modify them through their tenant's route")
+
+	// The result must be a valid config
+	err = client.SetGlobalRoute(config.Route{Receiver: "nonexistent"})
 	assert.Error(t, err)
 }
 
+func TestClient_SimulateRoute(t *testing.T) {
+	routedFile := strings.Replace(testAlertmanagerFile, `    match:
+      tenantID: other
+`, `    match:
+      tenantID: other
+    routes:
+    - receiver: other_other_receiver
+      match:
+        severity: critical
+      continue: true
+    - receiver: other_test_slack
+      match_re:
+        service: db|cache
+    - receiver: other_test_webhook
+`, 1)
+	fsClient := &mocks.FSClient{}
+	fsClient.On("ReadFile", mock.Anything).Return([]byte(routedFile), nil)
+	client := NewClient(ClientConfig{
+		ConfigPath: "test/alertmanager.yml",
+		FsClient:   fsClient,
+		Tenancy:    &alert.TenancyConfig{RestrictorLabel: "tenantID"},
+	})
+
+	// continue fans the alert out to the next matching route
+	receivers, err := client.SimulateRoute(otherNID, map[string]string{"severity": "critical", "service": "db"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"other_receiver", "test_slack"}, receivers)
+
+	receivers, err = client.SimulateRoute(otherNID, map[string]string{"severity": "critical"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"other_receiver", "test_webhook"}, receivers)
+
+	// match_re is anchored, as in alertmanager
+	receivers, err = client.SimulateRoute(otherNID, map[string]string{"service": "dbproxy"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"test_webhook"}, receivers)
+
+	_, err = client.SimulateRoute(testNID, map[string]string{"severity": "critical"})
+	assert.True(t, errors.Is(err, ErrRouteNotFound))
+}
+
+func TestClient_SingleTenant(t *testing.T) {
+	fsClient := &mocks.FSClient{}
+	file := []byte(testAlertmanagerFile)
+	fsClient.On("ReadFile", mock.Anything).Return(func(string) []byte { return file }, nil)
+	fsClient.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil).
+		Run(func(args mock.Arguments) { file = args[1].([]byte) })
+	client := NewClient(ClientConfig{
+		ConfigPath: "test/alertmanager.yml",
+		FsClient:   fsClient,
+	})
+
+	// Receivers are created and listed without a tenant prefix
+	err := client.CreateReceiver("", config.Receiver{Name: "slack"})
+	assert.NoError(t, err)
+	conf, _ := byteToConfig(file)
+	assert.NotNil(t, conf.GetReceiver("slack"))
+
+	recs, err := client.GetReceivers("")
+	assert.NoError(t, err)
+	names := make([]string, 0, len(recs))
+	for _, rec := range recs {
+		names = append(names, rec.Name)
+	}
+	assert.Contains(t, names, "slack")
+	assert.Contains(t, names, "null_receiver")
+
+	err = client.UpdateReceiver("", "slack", &config.Receiver{Name: "slack", SlackConfigs: []*config.SlackConfig{{APIURL: "http://slack.com/1"}}})
+	assert.NoError(t, err)
+	conf, _ = byteToConfig(file)
+	assert.Equal(t, 1, len(conf.GetReceiver("slack").SlackConfigs))
+
+	// The route replaces the whole routing tree
+	err = client.ModifyTenantRoute("", &config.Route{Receiver: "slack"})
+	assert.NoError(t, err)
+	route, err := client.GetRoute("")
+	assert.NoError(t, err)
+	assert.Equal(t, &config.Route{Receiver: "slack"}, route)
+
+	err = client.DeleteReceiver("", "null_receiver")
+	assert.NoError(t, err)
+	conf, _ = byteToConfig(file)
+	assert.Nil(t, conf.GetReceiver("null_receiver"))
+
+	err = client.ProvisionTenantDefaults("new")
+	assert.EqualError(t, err, "tenants can't be provisioned without multitenancy")
+}
+
 func TestClient_GetTenants(t *testing.T) {
 	client, _, _ := newTestClient()
 
-	tenants, err := client.GetTenants()
+	tenants, err := client.GetTenants(alert.TenantListOptions{})
 	assert.NoError(t, err)
 	assert.Equal(t, []string{"other", "sample"}, tenants)
+
+	tenants, err = client.GetTenants(alert.TenantListOptions{Prefix: "sa"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sample"}, tenants)
+
+	tenants, err = client.GetTenants(alert.TenantListOptions{Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"other"}, tenants)
+
+	tenants, err = client.GetTenants(alert.TenantListOptions{Offset: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sample"}, tenants)
+}
+
+func TestClient_GetTenantConfigPreview(t *testing.T) {
+	client, _, _ := newTestClient()
+
+	conf, err := client.GetTenantConfigPreview(otherNID)
+	assert.NoError(t, err)
+	assert.Equal(t, &config.Route{Receiver: "other_tenant_base_route", Match: map[string]string{"tenantID": "other"}}, conf.Route)
+	assert.Equal(t, 2, len(conf.Receivers))
+	assert.Equal(t, "other_tenant_base_route", conf.Receivers[0].Name)
+	assert.Equal(t, "receiver", conf.Receivers[1].Name)
+	assert.Equal(t, "http://slack.com/54321", conf.Receivers[1].SlackConfigs[0].APIURL)
+	assert.Nil(t, conf.Global)
+	assert.Empty(t, conf.Templates)
+
+	// Tenant without a base route only has its receivers
+	conf, err = client.GetTenantConfigPreview(testNID)
+	assert.NoError(t, err)
+	assert.Nil(t, conf.Route)
+	assert.Equal(t, 4, len(conf.Receivers))
+	for _, rec := range conf.Receivers {
+		assert.NotContains(t, rec.Name, "other")
+		assert.NotEqual(t, "null_receiver", rec.Name)
+	}
+
+	// error reading config file
+	client, _ = newReadErrTestClient(errors.New("read err"))
+	_, err = client.GetTenantConfigPreview(testNID)
+	assert.EqualError(t, err, "error reading config files: read err")
+}
+
+func TestClient_ProvisionTenantDefaults(t *testing.T) {
+	client, fsClient, out := newTestClientWithDefaults()
+
+	err := client.ProvisionTenantDefaults("new")
+	assert.NoError(t, err)
+	fsClient.AssertNumberOfCalls(t, "WriteFile", 1)
+
+	newConf, err := byteToConfig(*out)
+	assert.NoError(t, err)
+	assert.NotNil(t, newConf.GetReceiver("new_incident_webhook"))
+	assert.NotNil(t, newConf.GetReceiver("new_tenant_base_route"))
+
+	routeIdx := newConf.GetRouteIdx("new_tenant_base_route")
+	assert.True(t, routeIdx >= 0)
+	baseRoute := newConf.Route.Routes[routeIdx]
+	assert.Equal(t, map[string]string{"tenantID": "new"}, baseRoute.Match)
+	assert.Len(t, baseRoute.Routes, 1)
+	assert.Equal(t, "new_incident_webhook", baseRoute.Routes[0].Receiver)
+
+	// Tenant already has a base route
+	err = client.ProvisionTenantDefaults(otherNID)
+	assert.EqualError(t, err, "tenant other has already been provisioned")
+	fsClient.AssertNumberOfCalls(t, "WriteFile", 1)
+
+	// No defaults file configured
+	client, fsClient, _ = newTestClient()
+	err = client.ProvisionTenantDefaults("new")
+	assert.EqualError(t, err, "no tenant defaults file configured")
+	fsClient.AssertNotCalled(t, "WriteFile", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestClient_GetConfigHash(t *testing.T) {
+	client, fsClient, out := newTestClient()
+
+	hash, err := client.GetConfigHash()
+	assert.NoError(t, err)
+	assert.Len(t, hash, 64)
+
+	// Same contents give the same hash
+	sameHash, err := client.GetConfigHash()
+	assert.NoError(t, err)
+	assert.Equal(t, hash, sameHash)
+
+	// Modified contents give a different hash
+	assert.NoError(t, client.CreateReceiver(testNID, config.Receiver{Name: "new_receiver"}))
+	fsClient.ExpectedCalls = nil
+	fsClient.On("ReadFile", mock.Anything).Return(*out, nil)
+	newHash, err := client.GetConfigHash()
+	assert.NoError(t, err)
+	assert.NotEqual(t, hash, newHash)
+
+	client, _ = newReadErrTestClient(errors.New("read err"))
+	_, err = client.GetConfigHash()
+	assert.EqualError(t, err, "error reading config files: read err")
+}
+
+func TestClient_IfMatch(t *testing.T) {
+	client, fsClient, out := newTestClient()
+	hash, err := client.GetConfigHash()
+	assert.NoError(t, err)
+
+	// Matching hash lets the write through
+	err = client.IfMatch(hash).CreateReceiver(testNID, config.Receiver{Name: "new_receiver"})
+	assert.NoError(t, err)
+	assert.NotNil(t, *out)
+
+	// Once the config has changed the old hash no longer matches
+	fsClient.ExpectedCalls = nil
+	fsClient.On("ReadFile", mock.Anything).Return(*out, nil)
+	fsClient.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil).
+		Run(func(args mock.Arguments) { *out = args[1].([]byte) })
+	*out = nil
+	err = client.IfMatch(hash).CreateReceiver(testNID, config.Receiver{Name: "other_receiver"})
+	assert.Equal(t, ErrConfigModified, err)
+	assert.Nil(t, *out)
+	err = client.IfMatch(hash).AddTemplateFile("path/to/newFile")
+	assert.Equal(t, ErrConfigModified, err)
+	assert.Nil(t, *out)
+}
+
+func TestClient_FileMode(t *testing.T) {
+	client, fsClient, _ := newTestClient()
+	assert.NoError(t, client.CreateReceiver(testNID, tc.SampleSlackReceiver))
+	fsClient.AssertCalled(t, "WriteFile", "test/alertmanager.yml", mock.Anything, DefaultConfigFileMode)
+
+	fsClient = &mocks.FSClient{}
+	fsClient.On("ReadFile", mock.Anything).Return([]byte(testAlertmanagerFile), nil)
+	fsClient.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	client = NewClient(ClientConfig{
+		ConfigPath: "test/alertmanager.yml",
+		FsClient:   fsClient,
+		Tenancy:    &alert.TenancyConfig{RestrictorLabel: "tenantID"},
+		FileMode:   0640,
+	})
+	assert.NoError(t, client.CreateReceiver(testNID, tc.SampleSlackReceiver))
+	fsClient.AssertCalled(t, "WriteFile", "test/alertmanager.yml", mock.Anything, os.FileMode(0640))
 }
 
 func TestClient_GetTemplateFileList(t *testing.T) {
@@ -223,9 +947,276 @@ func TestClient_RemoveTemplateFile(t *testing.T) {
 	assert.Equal(t, len(newConf.Templates), 2)
 	fsClient.AssertNumberOfCalls(t, "WriteFile", 1)
 
+	// Paths with redundant separators refer to the same file
+	err = client.RemoveTemplateFile("path/to//file2/")
+	assert.NoError(t, err)
+	newConf, _ = byteToConfig(*out)
+	assert.Equal(t, []string{"path/to/file1", "path/to/file3"}, newConf.Templates)
+	fsClient.AssertNumberOfCalls(t, "WriteFile", 2)
+
 	// Remove non-existent path
 	err = client.RemoveTemplateFile("path/to/noFile")
 	assert.EqualError(t, err, "path not found: path/to/noFile")
+	fsClient.AssertNumberOfCalls(t, "WriteFile", 2)
+}
+
+func TestClient_AddTemplateFileInvalidConfig(t *testing.T) {
+	// The route sends to a receiver that doesn't exist, so the config is
+	// invalid no matter which template file is added
+	fsClient := &mocks.FSClient{}
+	fsClient.On("ReadFile", mock.Anything).Return([]byte(`route:
+  receiver: missing
+receivers:
+- name: other
+`), nil)
+	fsClient.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	client := NewClient(ClientConfig{
+		ConfigPath: "test/alertmanager.yml",
+		FsClient:   fsClient,
+		Tenancy:    &alert.TenancyConfig{RestrictorLabel: "tenantID"},
+	})
+
+	err := client.AddTemplateFile("path/to/newFile")
+	assert.EqualError(t, err, `undefined receiver "missing" used in route`)
+	fsClient.AssertNotCalled(t, "WriteFile", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestClient_CheckConfigIntegrity(t *testing.T) {
+	client, fsClient, _ := newTestClient()
+	fsClient.On("Stat", mock.Anything).Return(nil, nil)
+	problems, err := client.CheckConfigIntegrity()
+	assert.NoError(t, err)
+	assert.Empty(t, problems)
+
+	fsClient = &mocks.FSClient{}
+	fsClient.On("ReadFile", mock.Anything).Return([]byte(`route:
+  receiver: slack
+  routes:
+  - receiver: missing
+receivers:
+- name: slack
+- name: slack
+templates:
+- path/to/file1
+- path/to/missing
+- path/to/*.tmpl
+- /etc/templates/file2
+`), nil)
+	// relative paths are resolved against the config file's directory
+	fsClient.On("Stat", "test/path/to/file1").Return(nil, nil)
+	fsClient.On("Stat", "test/path/to/missing").Return(nil, os.ErrNotExist)
+	fsClient.On("Stat", "/etc/templates/file2").Return(nil, nil)
+	client = NewClient(ClientConfig{
+		ConfigPath: "test/alertmanager.yml",
+		FsClient:   fsClient,
+		Tenancy:    &alert.TenancyConfig{RestrictorLabel: "tenantID"},
+	})
+
+	problems, err = client.CheckConfigIntegrity()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"duplicate receiver name: slack",
+		"route.routes[0] sends to undefined receiver: missing",
+		"template file does not exist: path/to/missing",
+	}, problems)
+	fsClient.AssertNotCalled(t, "Stat", "test/path/to/*.tmpl")
+
+	client, _ = newReadErrTestClient(errors.New("read error"))
+	_, err = client.CheckConfigIntegrity()
+	assert.Error(t, err)
+}
+
+func TestFileLockKey(t *testing.T) {
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+
+	// template files are locked by the same key however their directory is
+	// given
+	key := fileLockKey(TemplateFilePath("./templates/", "slack"))
+	assert.Equal(t, filepath.Join(wd, "templates", "slack.tmpl"), key)
+	assert.Equal(t, key, fileLockKey(filepath.Join(wd, "templates//slack.tmpl")))
+	assert.Equal(t, key, fileLockKey("templates/slack.tmpl"))
+}
+
+func TestClient_ScrubSecrets(t *testing.T) {
+	secretsFile := `global:
+  resolve_timeout: 5m
+  smtp_auth_password: smtpPassword
+  http_config:
+    bearer_token: globalToken
+route:
+  receiver: null_receiver
+receivers:
+- name: null_receiver
+- name: test_slack
+  slack_configs:
+  - api_url: http://slack.com/12345
+    channel: string
+    username: string
+    http_config:
+      basic_auth:
+        username: user
+        password: slackPassword
+- name: test_email
+  email_configs:
+  - to: test@mail.com
+    from: alerts@mail.com
+    smarthost: mail-server.com:25
+    auth_password: emailPassword
+`
+	fsClient := &mocks.FSClient{}
+	fsClient.On("ReadFile", mock.Anything).Return([]byte(secretsFile), nil)
+	var outputFile []byte
+	fsClient.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil).
+		Run(func(args mock.Arguments) { outputFile = args[1].([]byte) })
+	client := NewClient(ClientConfig{
+		ConfigPath:   "test/alertmanager.yml",
+		FsClient:     fsClient,
+		Tenancy:      &alert.TenancyConfig{RestrictorLabel: "tenantID"},
+		ScrubSecrets: true,
+	})
+
+	recs, err := client.GetReceivers(testNID)
+	assert.NoError(t, err)
+	assert.Len(t, recs, 2)
+	assert.Equal(t, "<secret>", recs[0].SlackConfigs[0].APIURL)
+	assert.Equal(t, "<secret>", recs[0].SlackConfigs[0].HTTPConfig.BasicAuth.Password)
+	assert.Equal(t, "user", recs[0].SlackConfigs[0].HTTPConfig.BasicAuth.Username)
+	assert.Equal(t, "<secret>", recs[1].EmailConfigs[0].AuthPassword)
+	assert.Equal(t, "test@mail.com", recs[1].EmailConfigs[0].To)
+
+	global, err := client.GetGlobalConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "<secret>", global.SMTPAuthPassword)
+	assert.Equal(t, "<secret>", global.HTTPConfig.BearerToken)
+	assert.Equal(t, "", global.SMTPAuthSecret)
+
+	// Resubmitting scrubbed or omitted secrets keeps the stored values
+	slack := recs[0]
+	slack.SlackConfigs[0].Channel = "updated"
+	slack.SlackConfigs[0].HTTPConfig.BasicAuth.Password = ""
+	err = client.UpdateReceiver(testNID, "slack", &slack)
+	assert.NoError(t, err)
+	conf, err := byteToConfig(outputFile)
+	assert.NoError(t, err)
+	written := conf.GetReceiver("test_slack")
+	assert.Equal(t, "updated", written.SlackConfigs[0].Channel)
+	assert.Equal(t, "http://slack.com/12345", written.SlackConfigs[0].APIURL)
+	assert.Equal(t, "slackPassword", written.SlackConfigs[0].HTTPConfig.BasicAuth.Password)
+
+	// New values replace the stored ones
+	email := recs[1]
+	email.EmailConfigs[0].AuthPassword = "newPassword"
+	err = client.UpdateReceiver(testNID, "email", &email)
+	assert.NoError(t, err)
+	conf, err = byteToConfig(outputFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "newPassword", conf.GetReceiver("test_email").EmailConfigs[0].AuthPassword)
+
+	global.SMTPHello = "configmanager"
+	err = client.SetGlobalConfig(*global)
+	assert.NoError(t, err)
+	conf, err = byteToConfig(outputFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "configmanager", conf.Global.SMTPHello)
+	assert.Equal(t, "smtpPassword", conf.Global.SMTPAuthPassword)
+	assert.Equal(t, "globalToken", conf.Global.HTTPConfig.BearerToken)
+
+	// Without scrubbing secrets are read back as stored
+	client, _, _ = newTestClient()
+	recs, err = client.GetReceivers(testNID)
+	assert.NoError(t, err)
+	for _, rec := range recs {
+		if rec.Name == "slack" {
+			assert.Equal(t, "http://slack.com/12345", rec.SlackConfigs[0].APIURL)
+		}
+	}
+}
+
+func TestClient_UpdateReceiverSecretPlaceholder(t *testing.T) {
+	client, _, outputFile := newTestClient()
+
+	// The placeholder keeps the stored secret without scrubbing enabled
+	slack := config.Receiver{Name: "slack", SlackConfigs: []*config.SlackConfig{{
+		APIURL:   "<secret>",
+		Channel:  "updated",
+		Username: "string",
+	}}}
+	err := client.UpdateReceiver(testNID, "slack", &slack)
+	assert.NoError(t, err)
+	conf, err := byteToConfig(*outputFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://slack.com/12345", conf.GetReceiver("test_slack").SlackConfigs[0].APIURL)
+	assert.Equal(t, "updated", conf.GetReceiver("test_slack").SlackConfigs[0].Channel)
+
+	// Any other value replaces the stored secret
+	slack.Name = "slack"
+	slack.SlackConfigs[0].APIURL = "http://slack.com/67890"
+	err = client.UpdateReceiver(testNID, "slack", &slack)
+	assert.NoError(t, err)
+	conf, err = byteToConfig(*outputFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://slack.com/67890", conf.GetReceiver("test_slack").SlackConfigs[0].APIURL)
+}
+
+func TestClient_ReloadAlertmanager(t *testing.T) {
+	var reloads int32
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&reloads, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&reloads, 1)
+		http.Error(w, "reload failed", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	healthyURL := strings.TrimPrefix(healthy.URL, "http://")
+	failingURL := strings.TrimPrefix(failing.URL, "http://")
+
+	client := NewClient(ClientConfig{AlertmanagerURLs: []string{healthyURL, healthyURL, healthyURL}})
+	assert.NoError(t, client.ReloadAlertmanager())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&reloads))
+
+	atomic.StoreInt32(&reloads, 0)
+	client = NewClient(ClientConfig{AlertmanagerURLs: []string{healthyURL, failingURL, failingURL}})
+	err := client.ReloadAlertmanager()
+	assert.EqualError(t, err, fmt.Sprintf("error reloading alertmanager: 2 of 3 instances failed: %s: code: 500: reload failed\n; %s: code: 500: reload failed\n", failingURL, failingURL))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&reloads))
+
+	// AlertmanagerURL is used when no list is given
+	atomic.StoreInt32(&reloads, 0)
+	client = NewClient(ClientConfig{AlertmanagerURL: healthyURL})
+	assert.NoError(t, client.ReloadAlertmanager())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&reloads))
+}
+
+func TestClient_ReloadPath(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		paths = append(paths, r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	serverURL := strings.TrimPrefix(server.URL, "http://")
+
+	client := NewClient(ClientConfig{AlertmanagerURL: serverURL})
+	assert.NoError(t, client.ReloadAlertmanager())
+	client = NewClient(ClientConfig{AlertmanagerURL: serverURL, ReloadPath: "/alertmanager/-/reload"})
+	assert.NoError(t, client.ReloadAlertmanager())
+	assert.Equal(t, []string{"/-/reload", "/alertmanager/-/reload"}, paths)
+}
+
+func TestClient_Close(t *testing.T) {
+	client, fsClient, _ := newTestClient()
+	assert.NoError(t, client.Close())
+	assert.NoError(t, client.Close())
+
+	// The client can still be used after closing
+	err := client.DeleteReceiver(testNID, "slack")
+	assert.NoError(t, err)
 	fsClient.AssertNumberOfCalls(t, "WriteFile", 1)
 }
 
@@ -250,6 +1241,37 @@ func newTestClient() (AlertmanagerClient, *mocks.FSClient, *[]byte) {
 	return NewClient(conf), fsClient, &outputFile
 }
 
+func newReadErrTestClient(readErr error) (AlertmanagerClient, *mocks.FSClient) {
+	fsClient := &mocks.FSClient{}
+	fsClient.On("ReadFile", mock.Anything).Return(nil, readErr)
+	conf := ClientConfig{
+		ConfigPath:      "test/alertmanager.yml",
+		AlertmanagerURL: "alertmanager-host:9093",
+		FsClient:        fsClient,
+		Tenancy:         &alert.TenancyConfig{RestrictorLabel: "tenantID"},
+	}
+	return NewClient(conf), fsClient
+}
+
+func newTestClientWithDefaults() (AlertmanagerClient, *mocks.FSClient, *[]byte) {
+	fsClient := &mocks.FSClient{}
+	fsClient.On("ReadFile", testDefaultsPath).Return([]byte(testDefaultsFile), nil)
+	fsClient.On("ReadFile", mock.Anything).Return([]byte(testAlertmanagerFile), nil)
+
+	var outputFile []byte
+	fsClient.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil).
+		Run(func(args mock.Arguments) { outputFile = args[1].([]byte) })
+	conf := ClientConfig{
+		ConfigPath:      "test/alertmanager.yml",
+		AlertmanagerURL: "alertmanager-host:9093",
+		FsClient:        fsClient,
+		Tenancy:         &alert.TenancyConfig{RestrictorLabel: "tenantID"},
+		DefaultsPath:    testDefaultsPath,
+	}
+	return NewClient(conf), fsClient, &outputFile
+}
+
 func byteToConfig(in []byte) (config.Config, error) {
 	conf := config.Config{}
 	return conf, yaml.Unmarshal(in, &conf)
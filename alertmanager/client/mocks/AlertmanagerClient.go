@@ -12,6 +12,8 @@ package mocks
 import (
 	alert "github.com/facebookincubator/prometheus-configmanager/prometheus/alert"
 
+	client "github.com/facebookincubator/prometheus-configmanager/alertmanager/client"
+
 	config "github.com/facebookincubator/prometheus-configmanager/alertmanager/config"
 
 	mock "github.com/stretchr/testify/mock"
@@ -36,6 +38,43 @@ func (_m *AlertmanagerClient) AddTemplateFile(path string) error {
 	return r0
 }
 
+// CheckConfigIntegrity provides a mock function with given fields:
+func (_m *AlertmanagerClient) CheckConfigIntegrity() ([]string, error) {
+	ret := _m.Called()
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func() []string); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Close provides a mock function with given fields:
+func (_m *AlertmanagerClient) Close() error {
+	ret := _m.Called()
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func() error); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // CreateReceiver provides a mock function with given fields: tenantID, rec
 func (_m *AlertmanagerClient) CreateReceiver(tenantID string, rec config.Receiver) error {
 	ret := _m.Called(tenantID, rec)
@@ -64,6 +103,27 @@ func (_m *AlertmanagerClient) DeleteReceiver(tenantID string, receiverName strin
 	return r0
 }
 
+// GetConfigHash provides a mock function with given fields:
+func (_m *AlertmanagerClient) GetConfigHash() (string, error) {
+	ret := _m.Called()
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetGlobalConfig provides a mock function with given fields:
 func (_m *AlertmanagerClient) GetGlobalConfig() (*config.GlobalConfig, error) {
 	ret := _m.Called()
@@ -87,6 +147,29 @@ func (_m *AlertmanagerClient) GetGlobalConfig() (*config.GlobalConfig, error) {
 	return r0, r1
 }
 
+// GetGlobalRoute provides a mock function with given fields:
+func (_m *AlertmanagerClient) GetGlobalRoute() (*config.Route, error) {
+	ret := _m.Called()
+
+	var r0 *config.Route
+	if rf, ok := ret.Get(0).(func() *config.Route); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*config.Route)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetReceivers provides a mock function with given fields: tenantID
 func (_m *AlertmanagerClient) GetReceivers(tenantID string) ([]config.Receiver, error) {
 	ret := _m.Called(tenantID)
@@ -156,13 +239,36 @@ func (_m *AlertmanagerClient) GetTemplateFileList() ([]string, error) {
 	return r0, r1
 }
 
-// GetTenants provides a mock function with given fields:
-func (_m *AlertmanagerClient) GetTenants() ([]string, error) {
-	ret := _m.Called()
+// GetTenantConfigPreview provides a mock function with given fields: tenantID
+func (_m *AlertmanagerClient) GetTenantConfigPreview(tenantID string) (*config.Config, error) {
+	ret := _m.Called(tenantID)
+
+	var r0 *config.Config
+	if rf, ok := ret.Get(0).(func(string) *config.Config); ok {
+		r0 = rf(tenantID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*config.Config)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(tenantID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTenants provides a mock function with given fields: opts
+func (_m *AlertmanagerClient) GetTenants(opts alert.TenantListOptions) ([]string, error) {
+	ret := _m.Called(opts)
 
 	var r0 []string
-	if rf, ok := ret.Get(0).(func() []string); ok {
-		r0 = rf()
+	if rf, ok := ret.Get(0).(func(alert.TenantListOptions) []string); ok {
+		r0 = rf(opts)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]string)
@@ -170,8 +276,8 @@ func (_m *AlertmanagerClient) GetTenants() ([]string, error) {
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func() error); ok {
-		r1 = rf()
+	if rf, ok := ret.Get(1).(func(alert.TenantListOptions) error); ok {
+		r1 = rf(opts)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -179,6 +285,22 @@ func (_m *AlertmanagerClient) GetTenants() ([]string, error) {
 	return r0, r1
 }
 
+// IfMatch provides a mock function with given fields: configHash
+func (_m *AlertmanagerClient) IfMatch(configHash string) client.AlertmanagerClient {
+	ret := _m.Called(configHash)
+
+	var r0 client.AlertmanagerClient
+	if rf, ok := ret.Get(0).(func(string) client.AlertmanagerClient); ok {
+		r0 = rf(configHash)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(client.AlertmanagerClient)
+		}
+	}
+
+	return r0
+}
+
 // ModifyTenantRoute provides a mock function with given fields: tenantID, route
 func (_m *AlertmanagerClient) ModifyTenantRoute(tenantID string, route *config.Route) error {
 	ret := _m.Called(tenantID, route)
@@ -193,6 +315,20 @@ func (_m *AlertmanagerClient) ModifyTenantRoute(tenantID string, route *config.R
 	return r0
 }
 
+// ProvisionTenantDefaults provides a mock function with given fields: tenantID
+func (_m *AlertmanagerClient) ProvisionTenantDefaults(tenantID string) error {
+	ret := _m.Called(tenantID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(tenantID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // ReloadAlertmanager provides a mock function with given fields:
 func (_m *AlertmanagerClient) ReloadAlertmanager() error {
 	ret := _m.Called()
@@ -235,6 +371,43 @@ func (_m *AlertmanagerClient) SetGlobalConfig(globalConfig config.GlobalConfig)
 	return r0
 }
 
+// SetGlobalRoute provides a mock function with given fields: route
+func (_m *AlertmanagerClient) SetGlobalRoute(route config.Route) error {
+	ret := _m.Called(route)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(config.Route) error); ok {
+		r0 = rf(route)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SimulateRoute provides a mock function with given fields: tenantID, labels
+func (_m *AlertmanagerClient) SimulateRoute(tenantID string, labels map[string]string) ([]string, error) {
+	ret := _m.Called(tenantID, labels)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(string, map[string]string) []string); ok {
+		r0 = rf(tenantID, labels)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, map[string]string) error); ok {
+		r1 = rf(tenantID, labels)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Tenancy provides a mock function with given fields:
 func (_m *AlertmanagerClient) Tenancy() *alert.TenancyConfig {
 	ret := _m.Called()
@@ -264,3 +437,17 @@ func (_m *AlertmanagerClient) UpdateReceiver(tenantID string, receiverName strin
 
 	return r0
 }
+
+// ValidateTenantRoute provides a mock function with given fields: tenantID, route
+func (_m *AlertmanagerClient) ValidateTenantRoute(tenantID string, route *config.Route) error {
+	ret := _m.Called(tenantID, route)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, *config.Route) error); ok {
+		r0 = rf(tenantID, route)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
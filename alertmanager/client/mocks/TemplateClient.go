@@ -9,7 +9,13 @@
 
 package mocks
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	client "github.com/facebookincubator/prometheus-configmanager/alertmanager/client"
+
+	amtemplate "github.com/prometheus/alertmanager/template"
+
+	mock "github.com/stretchr/testify/mock"
+)
 
 // TemplateClient is an autogenerated mock type for the TemplateClient type
 type TemplateClient struct {
@@ -30,6 +36,27 @@ func (_m *TemplateClient) AddTemplate(filename string, tmplName string, tmplText
 	return r0
 }
 
+// BulkUpdateTemplates provides a mock function with given fields: filename, tmpls
+func (_m *TemplateClient) BulkUpdateTemplates(filename string, tmpls map[string]string) (client.BulkTemplateResults, error) {
+	ret := _m.Called(filename, tmpls)
+
+	var r0 client.BulkTemplateResults
+	if rf, ok := ret.Get(0).(func(string, map[string]string) client.BulkTemplateResults); ok {
+		r0 = rf(filename, tmpls)
+	} else {
+		r0 = ret.Get(0).(client.BulkTemplateResults)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, map[string]string) error); ok {
+		r1 = rf(filename, tmpls)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // CreateTemplateFile provides a mock function with given fields: filename, fileText
 func (_m *TemplateClient) CreateTemplateFile(filename string, fileText string) error {
 	ret := _m.Called(filename, fileText)
@@ -44,6 +71,20 @@ func (_m *TemplateClient) CreateTemplateFile(filename string, fileText string) e
 	return r0
 }
 
+// CreateTemplateFileWithTemplates provides a mock function with given fields: filename, tmpls
+func (_m *TemplateClient) CreateTemplateFileWithTemplates(filename string, tmpls map[string]string) error {
+	ret := _m.Called(filename, tmpls)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, map[string]string) error); ok {
+		r0 = rf(filename, tmpls)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // DeleteTemplate provides a mock function with given fields: filename, tmplName
 func (_m *TemplateClient) DeleteTemplate(filename string, tmplName string) error {
 	ret := _m.Called(filename, tmplName)
@@ -100,6 +141,43 @@ func (_m *TemplateClient) EditTemplateFile(filename string, fileText string) err
 	return r0
 }
 
+// ForTenant provides a mock function with given fields: tenantID
+func (_m *TemplateClient) ForTenant(tenantID string) client.TemplateClient {
+	ret := _m.Called(tenantID)
+
+	var r0 client.TemplateClient
+	if rf, ok := ret.Get(0).(func(string) client.TemplateClient); ok {
+		r0 = rf(tenantID)
+	} else {
+		r0 = ret.Get(0).(client.TemplateClient)
+	}
+
+	return r0
+}
+
+// GetAllTemplates provides a mock function with given fields:
+func (_m *TemplateClient) GetAllTemplates() (map[string]map[string]string, error) {
+	ret := _m.Called()
+
+	var r0 map[string]map[string]string
+	if rf, ok := ret.Get(0).(func() map[string]map[string]string); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]map[string]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetTemplate provides a mock function with given fields: filename, tmplName
 func (_m *TemplateClient) GetTemplate(filename string, tmplName string) (string, error) {
 	ret := _m.Called(filename, tmplName)
@@ -165,6 +243,27 @@ func (_m *TemplateClient) GetTemplates(filename string) (map[string]string, erro
 	return r0, r1
 }
 
+// RenderTemplate provides a mock function with given fields: filename, tmplName, data
+func (_m *TemplateClient) RenderTemplate(filename string, tmplName string, data *amtemplate.Data) (string, error) {
+	ret := _m.Called(filename, tmplName, data)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string, string, *amtemplate.Data) string); ok {
+		r0 = rf(filename, tmplName, data)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, *amtemplate.Data) error); ok {
+		r1 = rf(filename, tmplName, data)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Root provides a mock function with given fields:
 func (_m *TemplateClient) Root() string {
 	ret := _m.Called()
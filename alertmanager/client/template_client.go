@@ -8,7 +8,12 @@
 package client
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
@@ -18,44 +23,99 @@ import (
 
 	"github.com/facebookincubator/prometheus-configmanager/fsclient"
 	"github.com/facebookincubator/prometheus-configmanager/prometheus/alert"
-	"github.com/thoas/go-funk"
+
+	"github.com/prometheus/alertmanager/asset"
+	amtemplate "github.com/prometheus/alertmanager/template"
 )
 
 const TemplateFilePostfix = ".tmpl"
 
+// TemplateFilePath returns the path of the named template file in the root
+// directory, without redundant separators whether or not root ends in one
+func TemplateFilePath(root, filename string) string {
+	return filepath.Join(root, addFilePostfix(filename))
+}
+
+// SameTemplatePath reports whether the two paths name the same template file,
+// ignoring redundant and trailing separators
+func SameTemplatePath(a, b string) bool {
+	return filepath.Clean(a) == filepath.Clean(b)
+}
+
+// ErrTemplateNotFound is returned when getting, editing, or deleting a
+// template that isn't defined in its template file
+var ErrTemplateNotFound = errors.New("template does not exist")
+
 // TemplateClient interface provides methods for modifying template files
 // and individual templates within them
 type TemplateClient interface {
 	GetTemplateFile(filename string) (string, error)
 	CreateTemplateFile(filename, fileText string) error
+	// CreateTemplateFileWithTemplates creates a template file holding the
+	// given templates, keyed by name, in a single write
+	CreateTemplateFileWithTemplates(filename string, tmpls map[string]string) error
 	EditTemplateFile(filename, fileText string) error
 	DeleteTemplateFile(filename string) error
 
 	GetTemplates(filename string) (map[string]string, error)
+	// GetAllTemplates returns the templates of every template file in the
+	// root, keyed by file name and then template name
+	GetAllTemplates() (map[string]map[string]string, error)
 
 	GetTemplate(filename, tmplName string) (string, error)
 	AddTemplate(filename, tmplName, tmplText string) error
 	EditTemplate(filename, tmplName, tmplText string) error
 	DeleteTemplate(filename, tmplName string) error
 
+	BulkUpdateTemplates(filename string, tmpls map[string]string) (BulkTemplateResults, error)
+
+	// RenderTemplate executes the named template against data the same way
+	// alertmanager would when sending a notification
+	RenderTemplate(filename, tmplName string, data *amtemplate.Data) (string, error)
+
+	// ForTenant returns a client for tenantID's template files, which are
+	// kept in a directory of their own so tenants can't access each others'
+	ForTenant(tenantID string) TemplateClient
+
 	Root() string
 }
 
-func NewTemplateClient(fsClient fsclient.FSClient, fileLocks *alert.FileLocker) TemplateClient {
-	return &templateClient{
+// DefaultTemplateFileMode is the permission template files are written with
+// unless WithTemplateFileMode is given
+const DefaultTemplateFileMode os.FileMode = 0660
+
+// TemplateClientOption configures optional behavior of the template client
+type TemplateClientOption func(*templateClient)
+
+// WithTemplateFileMode sets the permission that template files are written with
+func WithTemplateFileMode(mode os.FileMode) TemplateClientOption {
+	return func(t *templateClient) {
+		t.fileMode = mode
+	}
+}
+
+func NewTemplateClient(fsClient fsclient.FSClient, fileLocks *alert.FileLocker, opts ...TemplateClientOption) TemplateClient {
+	t := &templateClient{
 		fsClient:  fsClient,
 		fileLocks: fileLocks,
+		fileMode:  DefaultTemplateFileMode,
 	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
 }
 
 type templateClient struct {
 	fsClient  fsclient.FSClient
 	fileLocks *alert.FileLocker
+	fileMode  os.FileMode
 }
 
 func (t *templateClient) GetTemplateFile(filename string) (string, error) {
-	t.fileLocks.RLock(filename)
-	defer t.fileLocks.RUnlock(filename)
+	lockKey := t.lockKey(filename)
+	t.fileLocks.RLock(lockKey)
+	defer t.fileLocks.RUnlock(lockKey)
 
 	file, err := t.fsClient.ReadFile(addFilePostfix(filename))
 	if err != nil {
@@ -66,31 +126,61 @@ func (t *templateClient) GetTemplateFile(filename string) (string, error) {
 }
 
 func (t *templateClient) CreateTemplateFile(filename, fileText string) error {
-	t.fileLocks.Lock(filename)
-	defer t.fileLocks.Unlock(filename)
+	lockKey := t.lockKey(filename)
+	t.fileLocks.Lock(lockKey)
+	defer t.fileLocks.Unlock(lockKey)
 
-	return t.fsClient.WriteFile(addFilePostfix(filename), []byte(fileText), 0660)
+	return t.fsClient.WriteFile(addFilePostfix(filename), []byte(fileText), t.fileMode)
+}
+
+// CreateTemplateFileWithTemplates defines each template in a new file, in
+// name order. Nothing is written if any of them fails to parse.
+func (t *templateClient) CreateTemplateFileWithTemplates(filename string, tmpls map[string]string) error {
+	names := make([]string, 0, len(tmpls))
+	for name := range tmpls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fileText := ""
+	for _, tmplName := range names {
+		parseTmpl := &template.Template{}
+		_, err := parseTmpl.Parse(tmpls[tmplName])
+		if err != nil {
+			return TemplateParseError{Err: fmt.Errorf("error parsing template %s: %v", tmplName, err)}
+		}
+		fileText = appendTmplDefinition(fileText, tmplName, tmpls[tmplName])
+	}
+
+	lockKey := t.lockKey(filename)
+	t.fileLocks.Lock(lockKey)
+	defer t.fileLocks.Unlock(lockKey)
+
+	return t.writeTmplFile(filename, fileText)
 }
 
 func (t *templateClient) EditTemplateFile(filename, fileText string) error {
-	t.fileLocks.Lock(filename)
-	defer t.fileLocks.Unlock(filename)
+	lockKey := t.lockKey(filename)
+	t.fileLocks.Lock(lockKey)
+	defer t.fileLocks.Unlock(lockKey)
 
-	return t.fsClient.WriteFile(addFilePostfix(filename), []byte(fileText), 0660)
+	return t.fsClient.WriteFile(addFilePostfix(filename), []byte(fileText), t.fileMode)
 }
 
 func (t *templateClient) DeleteTemplateFile(filename string) error {
-	t.fileLocks.Lock(filename)
-	defer t.fileLocks.Unlock(filename)
+	lockKey := t.lockKey(filename)
+	t.fileLocks.Lock(lockKey)
+	defer t.fileLocks.Unlock(lockKey)
 
 	return t.fsClient.DeleteFile(addFilePostfix(filename))
 }
 
 func (t *templateClient) GetTemplates(filename string) (map[string]string, error) {
-	t.fileLocks.RLock(filename)
-	defer t.fileLocks.RUnlock(filename)
+	lockKey := t.lockKey(filename)
+	t.fileLocks.RLock(lockKey)
+	defer t.fileLocks.RUnlock(lockKey)
 
-	tmpl, err := t.readTmplFile(filename)
+	tmpl, _, err := t.readTmplFile(filename)
 	if err != nil {
 		return nil, err
 	}
@@ -108,11 +198,34 @@ func (t *templateClient) GetTemplates(filename string) (map[string]string, error
 	return tmplTextMap, nil
 }
 
+func (t *templateClient) GetAllTemplates() (map[string]map[string]string, error) {
+	files, err := t.fsClient.ReadDir("")
+	if err != nil {
+		return nil, fmt.Errorf("error listing template files: %v", err)
+	}
+
+	allTmpls := make(map[string]map[string]string)
+	for _, file := range files {
+		// Tenants' template files are kept in directories of their own
+		if file.IsDir() || !strings.HasSuffix(file.Name(), TemplateFilePostfix) {
+			continue
+		}
+		filename := strings.TrimSuffix(file.Name(), TemplateFilePostfix)
+		tmpls, err := t.GetTemplates(filename)
+		if err != nil {
+			return nil, fmt.Errorf("error getting templates of %s: %v", file.Name(), err)
+		}
+		allTmpls[filename] = tmpls
+	}
+	return allTmpls, nil
+}
+
 func (t *templateClient) GetTemplate(filename, tmplName string) (string, error) {
-	t.fileLocks.RLock(filename)
-	defer t.fileLocks.RUnlock(filename)
+	lockKey := t.lockKey(filename)
+	t.fileLocks.RLock(lockKey)
+	defer t.fileLocks.RUnlock(lockKey)
 
-	tmplFile, err := t.readTmplFile(filename)
+	tmplFile, _, err := t.readTmplFile(filename)
 	if err != nil {
 		return "", err
 	}
@@ -120,17 +233,18 @@ func (t *templateClient) GetTemplate(filename, tmplName string) (string, error)
 
 	tmpl := tmplMap[tmplName]
 	if tmpl == nil {
-		return "", fmt.Errorf("template %s not found", tmplName)
+		return "", fmt.Errorf("template %s: %w", tmplName, ErrTemplateNotFound)
 	}
 
 	return writeTemplateText(tmpl), nil
 }
 
 func (t *templateClient) AddTemplate(filename, tmplName, tmplText string) error {
-	t.fileLocks.Lock(filename)
-	defer t.fileLocks.Unlock(filename)
+	lockKey := t.lockKey(filename)
+	t.fileLocks.Lock(lockKey)
+	defer t.fileLocks.Unlock(lockKey)
 
-	tmplFile, err := t.readTmplFile(filename)
+	tmplFile, fileText, err := t.readTmplFile(filename)
 	if err != nil {
 		return err
 	}
@@ -141,108 +255,332 @@ func (t *templateClient) AddTemplate(filename, tmplName, tmplText string) error
 	}
 
 	newTmpl := &template.Template{}
-	newTmplBody, err := newTmpl.Parse(tmplText)
+	_, err = newTmpl.Parse(tmplText)
 	if err != nil {
 		return fmt.Errorf("error parsing template: %v", err)
 	}
-	tmplMap[tmplName] = newTmplBody
 
-	return t.writeTmplFile(filename, writeTmplMapText(tmplMap))
+	return t.writeTmplFile(filename, appendTmplDefinition(fileText, tmplName, tmplText))
 }
 
 func (t *templateClient) EditTemplate(filename, tmplName, tmplText string) error {
-	t.fileLocks.Lock(filename)
-	defer t.fileLocks.Unlock(filename)
+	lockKey := t.lockKey(filename)
+	t.fileLocks.Lock(lockKey)
+	defer t.fileLocks.Unlock(lockKey)
 
-	tmplFile, err := t.readTmplFile(filename)
+	tmplFile, fileText, err := t.readTmplFile(filename)
 	if err != nil {
 		return err
 	}
 	tmplMap := getTemplatesByName(tmplFile)
 
 	if tmplMap[tmplName] == nil {
-		return fmt.Errorf("template %s does not exist", tmplName)
+		return fmt.Errorf("template %s: %w", tmplName, ErrTemplateNotFound)
 	}
 
 	parseTmpl := &template.Template{}
-	newTmpl, err := parseTmpl.Parse(tmplText)
+	_, err = parseTmpl.Parse(tmplText)
 	if err != nil {
 		return fmt.Errorf("error adding template: %v", err)
 	}
-	tmplMap[tmplName] = newTmpl
 
-	return t.writeTmplFile(filename, writeTmplMapText(tmplMap))
+	newFileText, err := replaceTmplDefinition(fileText, tmplName, tmplText)
+	if err != nil {
+		return err
+	}
+	return t.writeTmplFile(filename, newFileText)
 }
 
 func (t *templateClient) DeleteTemplate(filename, tmplName string) error {
-	t.fileLocks.Lock(filename)
-	defer t.fileLocks.Unlock(filename)
+	lockKey := t.lockKey(filename)
+	t.fileLocks.Lock(lockKey)
+	defer t.fileLocks.Unlock(lockKey)
 
-	tmplFile, err := t.readTmplFile(filename)
+	tmplFile, fileText, err := t.readTmplFile(filename)
 	if err != nil {
 		return err
 	}
 	tmplMap := getTemplatesByName(tmplFile)
 
 	if tmplMap[tmplName] == nil {
-		return fmt.Errorf("template %s does not exist", tmplName)
+		return fmt.Errorf("template %s: %w", tmplName, ErrTemplateNotFound)
+	}
+
+	newFileText, err := removeTmplDefinition(fileText, tmplName)
+	if err != nil {
+		return err
+	}
+	return t.writeTmplFile(filename, newFileText)
+}
+
+// BulkUpdateTemplates adds or edits every template in tmpls with a single
+// read and write of the template file. Templates that fail to parse are
+// reported in the results and left unchanged in the file.
+func (t *templateClient) BulkUpdateTemplates(filename string, tmpls map[string]string) (BulkTemplateResults, error) {
+	lockKey := t.lockKey(filename)
+	t.fileLocks.Lock(lockKey)
+	defer t.fileLocks.Unlock(lockKey)
+
+	tmplFile, fileText, err := t.readTmplFile(filename)
+	if err != nil {
+		return BulkTemplateResults{}, err
+	}
+	tmplMap := getTemplatesByName(tmplFile)
+
+	// Apply in a stable order so new templates are appended deterministically
+	names := make([]string, 0, len(tmpls))
+	for name := range tmpls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := NewBulkTemplateResults()
+	for _, tmplName := range names {
+		tmplText := tmpls[tmplName]
+
+		parseTmpl := &template.Template{}
+		_, err := parseTmpl.Parse(tmplText)
+		if err != nil {
+			results.Errors[tmplName] = fmt.Sprintf("error parsing template: %v", err)
+			continue
+		}
+
+		status := "created"
+		newFileText := appendTmplDefinition(fileText, tmplName, tmplText)
+		if tmplMap[tmplName] != nil {
+			status = "updated"
+			newFileText, err = replaceTmplDefinition(fileText, tmplName, tmplText)
+			if err != nil {
+				results.Errors[tmplName] = err.Error()
+				continue
+			}
+		}
+		// Check the file still parses so one bad body doesn't fail the rest
+		_, err = template.New(addFilePostfix(filename)).Parse(newFileText)
+		if err != nil {
+			results.Errors[tmplName] = fmt.Sprintf("error parsing template file: %v", err)
+			continue
+		}
+		fileText = newFileText
+		results.Statuses[tmplName] = status
+	}
+
+	if len(results.Statuses) == 0 {
+		return results, nil
+	}
+	return results, t.writeTmplFile(filename, fileText)
+}
+
+func (t *templateClient) RenderTemplate(filename, tmplName string, data *amtemplate.Data) (string, error) {
+	lockKey := t.lockKey(filename)
+	t.fileLocks.RLock(lockKey)
+	defer t.fileLocks.RUnlock(lockKey)
+
+	fileText, err := t.fsClient.ReadFile(addFilePostfix(filename))
+	if err != nil {
+		return "", fmt.Errorf("error reading template file: %v", err)
 	}
 
-	delete(tmplMap, tmplName)
+	// Parse with alertmanager's functions and default templates, so that
+	// templates can use them as they would in a real notification
+	tmpl := template.New(addFilePostfix(filename)).Option("missingkey=zero").Funcs(template.FuncMap(amtemplate.DefaultFuncs))
+	defaults, err := readDefaultTemplates()
+	if err != nil {
+		return "", err
+	}
+	tmpl, err = tmpl.Parse(defaults)
+	if err != nil {
+		return "", fmt.Errorf("error parsing default templates: %v", err)
+	}
+	tmpl, err = tmpl.Parse(string(fileText))
+	if err != nil {
+		return "", TemplateRenderError{Err: fmt.Errorf("error parsing template file: %v", err)}
+	}
+	if tmpl.Lookup(tmplName) == nil {
+		return "", TemplateRenderError{Err: fmt.Errorf("template %s not found", tmplName)}
+	}
 
-	return t.writeTmplFile(filename, writeTmplMapText(tmplMap))
+	completeTemplateData(data)
+	var out bytes.Buffer
+	err = tmpl.ExecuteTemplate(&out, tmplName, data)
+	if err != nil {
+		return "", TemplateRenderError{Err: fmt.Errorf("error executing template: %v", err)}
+	}
+	return out.String(), nil
+}
+
+func (t *templateClient) ForTenant(tenantID string) TemplateClient {
+	return &templateClient{
+		fsClient:  fsclient.Sub(t.fsClient, tenantID),
+		fileLocks: t.fileLocks,
+		fileMode:  t.fileMode,
+	}
 }
 
 func (t *templateClient) Root() string {
 	return t.fsClient.Root()
 }
 
+// lockKey returns the key a template file is locked by, which is its full
+// on-disk path. Other clients sharing the FileLocker lock the same file by
+// the same key, and tenants' files of the same name don't share a lock.
+func (t *templateClient) lockKey(filename string) string {
+	return fileLockKey(TemplateFilePath(t.fsClient.Root(), filename))
+}
+
+// fileLockKey returns the absolute form of path, so a file is locked by the
+// same key whether its directory was given as a relative or absolute path
+func fileLockKey(path string) string {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return absPath
+}
+
+// writeTmplFile writes the text of a template file after an individual
+// template has been changed. The whole file is parsed first, since a template
+// body that is valid on its own can still break the file it is spliced into.
 func (t *templateClient) writeTmplFile(filename, text string) error {
-	err := t.fsClient.WriteFile(addFilePostfix(filename), []byte(text), 0660)
+	_, err := template.New(addFilePostfix(filename)).Parse(text)
+	if err != nil {
+		return fmt.Errorf("error parsing template file: %v", err)
+	}
+	err = t.fsClient.WriteFile(addFilePostfix(filename), []byte(text), t.fileMode)
 	if err != nil {
 		return fmt.Errorf("error writing template file: %v", err)
 	}
 	return nil
 }
 
-func (t *templateClient) readTmplFile(filename string) (*template.Template, error) {
-	tmplFile, err := template.ParseFiles(t.Root() + addFilePostfix(filename))
+// readTmplFile returns both the parsed template file and its raw text, which
+// is needed to modify individual templates while preserving the rest of the file
+func (t *templateClient) readTmplFile(filename string) (*template.Template, string, error) {
+	fileText, err := t.fsClient.ReadFile(addFilePostfix(filename))
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading template file: %v", err)
+	}
+	tmplFile, err := template.New(addFilePostfix(filename)).Parse(string(fileText))
 	if err != nil {
-		return nil, fmt.Errorf("error parsing template files: %v", err)
+		return nil, "", fmt.Errorf("error parsing template files: %v", err)
 	}
-	return tmplFile, nil
+	return tmplFile, string(fileText), nil
 }
 
-func addFilePostfix(filename string) string {
-	return filename + TemplateFilePostfix
+// TemplateRenderError is returned when a template can't be rendered because
+// of its contents or the data it was given
+type TemplateRenderError struct {
+	Err error
 }
 
-func writeTemplateText(tmpl *template.Template) string {
-	return tmpl.Root.String()
+func (e TemplateRenderError) Error() string {
+	return e.Err.Error()
 }
 
-func writeTmplMapText(tmplMap map[string]*template.Template) string {
-	str := strings.Builder{}
-	// Sort names for consistency
-	names := funk.Keys(tmplMap).([]string)
-	sort.Strings(names)
+// TemplateParseError is returned when a template given to be written isn't a
+// valid template
+type TemplateParseError struct {
+	Err error
+}
 
-	for _, name := range names {
-		tmpl := tmplMap[name]
-		if name == tmpl.Tree.ParseName {
-			continue
+func (e TemplateParseError) Error() string {
+	return e.Err.Error()
+}
+
+func readDefaultTemplates() (string, error) {
+	f, err := asset.Assets.Open("/templates/default.tmpl")
+	if err != nil {
+		return "", fmt.Errorf("error opening default templates: %v", err)
+	}
+	defer f.Close()
+	defaults, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", fmt.Errorf("error reading default templates: %v", err)
+	}
+	return string(defaults), nil
+}
+
+// completeTemplateData fills in the fields of data that alertmanager derives
+// from the alerts themselves, if they weren't given
+func completeTemplateData(data *amtemplate.Data) {
+	firing := false
+	for i := range data.Alerts {
+		amAlert := &data.Alerts[i]
+		if amAlert.Status == "" {
+			amAlert.Status = "firing"
+		}
+		if amAlert.Status == "firing" {
+			firing = true
+		}
+		if amAlert.Labels == nil {
+			amAlert.Labels = amtemplate.KV{}
+		}
+		if amAlert.Annotations == nil {
+			amAlert.Annotations = amtemplate.KV{}
+		}
+	}
+	if data.Status == "" {
+		data.Status = "resolved"
+		if firing {
+			data.Status = "firing"
+		}
+	}
+	if data.GroupLabels == nil {
+		data.GroupLabels = amtemplate.KV{}
+	}
+	if data.CommonLabels == nil {
+		data.CommonLabels = commonKV(data.Alerts, func(a amtemplate.Alert) amtemplate.KV { return a.Labels })
+	}
+	if data.CommonAnnotations == nil {
+		data.CommonAnnotations = commonKV(data.Alerts, func(a amtemplate.Alert) amtemplate.KV { return a.Annotations })
+	}
+}
+
+// commonKV returns the pairs that are shared by every alert
+func commonKV(alerts amtemplate.Alerts, getKV func(amtemplate.Alert) amtemplate.KV) amtemplate.KV {
+	common := amtemplate.KV{}
+	if len(alerts) == 0 {
+		return common
+	}
+	for k, v := range getKV(alerts[0]) {
+		common[k] = v
+	}
+	for _, amAlert := range alerts[1:] {
+		kv := getKV(amAlert)
+		for k, v := range common {
+			if kv[k] != v {
+				delete(common, k)
+			}
 		}
-		str.WriteString(defineTemplate(name, tmpl.Root.String()))
-		str.WriteRune('\n')
 	}
-	return str.String()
+	return common
+}
+
+func addFilePostfix(filename string) string {
+	return filename + TemplateFilePostfix
 }
 
-func defineTemplate(tmplName, tmplText string) string {
-	return fmt.Sprintf(`{{ define "%s" }}%s{{ end }}`, tmplName, tmplText)
+func writeTemplateText(tmpl *template.Template) string {
+	return tmpl.Root.String()
 }
 
 func getTemplatesByName(tmpl *template.Template) map[string]*template.Template {
 	field := reflect.ValueOf(tmpl).Elem().FieldByName("tmpl")
 	return reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem().Interface().(map[string]*template.Template)
 }
+
+// BulkTemplateResults holds the outcome of each template in a bulk update,
+// keyed by template name. Errors are kept as strings so they are included
+// when the results are encoded as JSON.
+type BulkTemplateResults struct {
+	Errors   map[string]string
+	Statuses map[string]string
+}
+
+// NewBulkTemplateResults returns empty results ready to be filled in
+func NewBulkTemplateResults() BulkTemplateResults {
+	return BulkTemplateResults{
+		Errors:   make(map[string]string),
+		Statuses: make(map[string]string),
+	}
+}
@@ -8,12 +8,20 @@
 package client
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/facebookincubator/prometheus-configmanager/fsclient"
 	"github.com/facebookincubator/prometheus-configmanager/fsclient/mocks"
 	"github.com/facebookincubator/prometheus-configmanager/prometheus/alert"
+	amtemplate "github.com/prometheus/alertmanager/template"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -34,6 +42,33 @@ func TestTemplateClient_CreateTemplateFile(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestTemplateClient_CreateTemplateFileWithTemplates(t *testing.T) {
+	client, fsClient, out := newInMemoryTmplClient("")
+
+	err := client.CreateTemplateFileWithTemplates("test", map[string]string{
+		"b.text": "b body",
+		"a.text": "a body",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `{{ define "a.text" }}a body{{ end }}
+{{ define "b.text" }}b body{{ end }}
+`, string(*out))
+	fsClient.AssertNumberOfCalls(t, "WriteFile", 1)
+
+	tmpls, err := client.GetTemplates("test")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"a.text": "a body", "b.text": "b body"}, tmpls)
+
+	// Nothing is written if any template is invalid
+	err = client.CreateTemplateFileWithTemplates("other", map[string]string{
+		"a.text":   "a body",
+		"bad.text": "{{ if }}",
+	})
+	assert.IsType(t, TemplateParseError{}, err)
+	assert.Contains(t, err.Error(), "error parsing template bad.text")
+	fsClient.AssertNumberOfCalls(t, "WriteFile", 1)
+}
+
 func TestTemplateClient_EditTemplateFile(t *testing.T) {
 	client, _, out := newTestTmplClient()
 
@@ -60,6 +95,33 @@ func TestTemplateClient_GetTemplates(t *testing.T) {
 	assert.NotNil(t, tmpls["slack.myorg2.text"])
 }
 
+func TestTemplateClient_GetAllTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fileLocks, _ := alert.NewFileLocker(alert.NewDirectoryClient(dir))
+	client := NewTemplateClient(fsclient.NewFSClient(dir), fileLocks)
+	assert.NoError(t, client.CreateTemplateFile("slack", `{{ define "slack.text" }}slack body{{ end }}`))
+	assert.NoError(t, client.CreateTemplateFile("email", `{{ define "email.subject" }}subject{{ end }}
+{{ define "email.body" }}body{{ end }}`))
+	// Tenants' files and anything that isn't a template file are left out
+	assert.NoError(t, client.ForTenant("tenantA").CreateTemplateFile("slack", `{{ define "tenant.text" }}tenant body{{ end }}`))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0660))
+
+	tmpls, err := client.GetAllTemplates()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]map[string]string{
+		"slack": {"slack.text": "slack body"},
+		"email": {"email.subject": "subject", "email.body": "body"},
+	}, tmpls)
+
+	// A file that can't be parsed fails the whole listing
+	assert.NoError(t, client.EditTemplateFile("email", `{{ define "email.subject" }}`))
+	_, err = client.GetAllTemplates()
+	assert.Error(t, err)
+}
+
 func TestTemplateClient_GetTemplate(t *testing.T) {
 	client, _, _ := newTestTmplClient()
 
@@ -70,7 +132,8 @@ func TestTemplateClient_GetTemplate(t *testing.T) {
 	assert.Equal(t, expectedText, text)
 
 	_, err = client.GetTemplate("test", "noTemplate")
-	assert.EqualError(t, err, "template noTemplate not found")
+	assert.EqualError(t, err, "template noTemplate: template does not exist")
+	assert.True(t, errors.Is(err, ErrTemplateNotFound))
 }
 
 func TestTemplateClient_AddTemplate(t *testing.T) {
@@ -91,12 +154,81 @@ func TestTemplateClient_EditTemplate(t *testing.T) {
 	err := client.EditTemplate("test", "slack.myorg.text", "new text")
 
 	expectedText := `{{ define "slack.myorg.text" }}new text{{ end }}
-{{ define "slack.myorg2.text" }}https://external.myorg.net/wiki/alerts/{{.GroupLabels.app}}/{{.GroupLabels.alertname}}{{ end }}
-`
+{{ define "slack.myorg2.text" }}https://external.myorg.net/wiki/alerts/{{.GroupLabels.app}}/{{.GroupLabels.alertname}}{{ end }}`
 	assert.NoError(t, err)
 	assert.Equal(t, expectedText, string(*out))
 }
 
+func TestTemplateClient_PreservesFileContent(t *testing.T) {
+	const fileText = `{{/* Templates owned by the infra team */}}
+{{ define "b.text" }}{{ if .Alerts }}b body{{ end }}{{ end }}
+
+Raw text between definitions
+{{ define "a.text" }}a body{{ end }}
+`
+	client, _, out := newTestTmplClientWithFile(fileText)
+
+	// Editing a template leaves comments, ordering, and raw text in place
+	err := client.EditTemplate("test", "b.text", "new b body")
+	assert.NoError(t, err)
+	assert.Equal(t, `{{/* Templates owned by the infra team */}}
+{{ define "b.text" }}new b body{{ end }}
+
+Raw text between definitions
+{{ define "a.text" }}a body{{ end }}
+`, string(*out))
+
+	// Deleting a template only removes its definition
+	err = client.DeleteTemplate("test", "b.text")
+	assert.NoError(t, err)
+	assert.Equal(t, `{{/* Templates owned by the infra team */}}
+
+Raw text between definitions
+{{ define "a.text" }}a body{{ end }}
+`, string(*out))
+
+	// Adding a template appends it to the end of the file
+	err = client.AddTemplate("test", "c.text", "c body")
+	assert.NoError(t, err)
+	assert.Equal(t, fileText+`{{ define "c.text" }}c body{{ end }}
+`, string(*out))
+}
+
+func TestTemplateClient_RejectsBodyThatBreaksFile(t *testing.T) {
+	const fileText = `{{ define "a.text" }}a body{{ end }}
+`
+	client, _, out := newTestTmplClientWithFile(fileText)
+
+	// A nested define parses on its own but not inside another definition
+	err := client.EditTemplate("test", "a.text", `{{ define "other" }}z{{ end }}`)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "error parsing template file")
+	assert.Nil(t, *out)
+
+	err = client.AddTemplate("test", "b.text", `{{ define "other" }}z{{ end }}`)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "error parsing template file")
+	assert.Nil(t, *out)
+}
+
+func TestTemplateClient_BlockTemplates(t *testing.T) {
+	const fileText = `{{ block "greeting" . }}hello{{ end }}
+{{ define "a.text" }}a body{{ end }}
+`
+	client, _, out := newTestTmplClientWithFile(fileText)
+
+	err := client.EditTemplate("test", "greeting", "goodbye")
+	assert.NoError(t, err)
+	assert.Equal(t, `{{ block "greeting" . }}goodbye{{ end }}
+{{ define "a.text" }}a body{{ end }}
+`, string(*out))
+
+	err = client.DeleteTemplate("test", "greeting")
+	assert.NoError(t, err)
+	assert.Equal(t, `{{ define "a.text" }}a body{{ end }}
+`, string(*out))
+}
+
 func TestTemplateClient_DeleteTemplate(t *testing.T) {
 	client, _, out := newTestTmplClient()
 
@@ -110,12 +242,224 @@ func TestTemplateClient_DeleteTemplate(t *testing.T) {
 	assert.Equal(t, expectedText, strings.TrimSpace(string(*out)))
 
 	err = client.DeleteTemplate("test", "notATemplate")
-	assert.EqualError(t, err, "template notATemplate does not exist")
+	assert.EqualError(t, err, "template notATemplate: template does not exist")
+	assert.True(t, errors.Is(err, ErrTemplateNotFound))
+}
+
+func TestTemplateClient_PreservesTrimMarkers(t *testing.T) {
+	const fileText = `{{- define "trimmed.text" -}}
+  {{ .CommonLabels.alertname }}
+{{- end }}
+{{ define "plain.text" }}plain body{{ end }}
+`
+	client, _, out := newInMemoryTmplClient(fileText)
+
+	// Editing an unrelated template keeps the trim markers of the others
+	err := client.EditTemplate("test", "plain.text", "new plain body")
+	assert.NoError(t, err)
+	assert.Equal(t, `{{- define "trimmed.text" -}}
+  {{ .CommonLabels.alertname }}
+{{- end }}
+{{ define "plain.text" }}new plain body{{ end }}
+`, string(*out))
+
+	// Editing the trimmed template itself keeps its own delimiters
+	err = client.EditTemplate("test", "trimmed.text", "\n  {{ .CommonLabels.severity }}\n")
+	assert.NoError(t, err)
+	assert.Equal(t, `{{- define "trimmed.text" -}}
+  {{ .CommonLabels.severity }}
+{{- end }}
+{{ define "plain.text" }}new plain body{{ end }}
+`, string(*out))
+
+	// Reading back gives the edited body without the delimiters
+	tmplText, err := client.GetTemplate("test", "trimmed.text")
+	assert.NoError(t, err)
+	assert.Equal(t, "{{.CommonLabels.severity}}", tmplText)
+}
+
+func TestTemplateClient_BulkUpdateTemplates(t *testing.T) {
+	const fileText = `{{ define "a.text" }}a body{{ end }}
+{{ define "b.text" }}b body{{ end }}
+`
+	client, _, out := newInMemoryTmplClient(fileText)
+
+	results, err := client.BulkUpdateTemplates("test", map[string]string{
+		"b.text":   "new b body",
+		"c.text":   "c body",
+		"bad.text": "{{ if }}",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"b.text": "updated", "c.text": "created"}, results.Statuses)
+	assert.Len(t, results.Errors, 1)
+	assert.Contains(t, results.Errors["bad.text"], "error parsing template")
+
+	// Valid templates are written even though one failed
+	assert.Equal(t, `{{ define "a.text" }}a body{{ end }}
+{{ define "b.text" }}new b body{{ end }}
+{{ define "c.text" }}c body{{ end }}
+`, string(*out))
+
+	tmpls, err := client.GetTemplates("test")
+	assert.NoError(t, err)
+	assert.Equal(t, "new b body", tmpls["b.text"])
+	assert.Equal(t, "c body", tmpls["c.text"])
+	assert.NotContains(t, tmpls, "bad.text")
+
+	// Nothing is written when every template fails
+	results, err = client.BulkUpdateTemplates("test", map[string]string{"bad.text": "{{ end }}"})
+	assert.NoError(t, err)
+	assert.Empty(t, results.Statuses)
+	assert.Len(t, results.Errors, 1)
+	assert.Contains(t, string(*out), "new b body")
+}
+
+func TestTemplateClient_FileMode(t *testing.T) {
+	fsClient := &mocks.FSClient{}
+	fsClient.On("ReadFile", mock.Anything).Return([]byte(`{{ define "a.text" }}a body{{ end }}`), nil)
+	fsClient.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	fsClient.On("Root").Return("testdata/")
+	fileLocks, _ := alert.NewFileLocker(alert.NewDirectoryClient("."))
+
+	client := NewTemplateClient(fsClient, fileLocks)
+	assert.NoError(t, client.CreateTemplateFile("test", "text"))
+	fsClient.AssertCalled(t, "WriteFile", "test.tmpl", mock.Anything, DefaultTemplateFileMode)
+
+	fsClient.Calls = nil
+	client = NewTemplateClient(fsClient, fileLocks, WithTemplateFileMode(0640))
+	assert.NoError(t, client.CreateTemplateFile("test", "text"))
+	assert.NoError(t, client.EditTemplateFile("test", "text"))
+	assert.NoError(t, client.AddTemplate("test", "b.text", "b body"))
+	fsClient.AssertNumberOfCalls(t, "WriteFile", 3)
+	for _, call := range fsClient.Calls {
+		if call.Method == "WriteFile" {
+			assert.Equal(t, os.FileMode(0640), call.Arguments.Get(2))
+		}
+	}
+}
+
+func TestTemplateClient_RenderTemplate(t *testing.T) {
+	const fileText = `{{ define "alerts.text" }}{{ .Status }}: {{ .CommonLabels.severity }}
+{{ range .Alerts }}{{ .Labels.alertname }} is {{ .Status }}{{ if .Annotations.summary }} ({{ .Annotations.summary }}){{ end }}
+{{ end }}{{ end }}
+{{ define "title.text" }}{{ template "__subject" . }}{{ end }}
+{{ define "broken.text" }}{{ .Alerts.NoSuchMethod }}{{ end }}`
+	client, _, _ := newInMemoryTmplClient(fileText)
+
+	data := &amtemplate.Data{
+		Alerts: amtemplate.Alerts{
+			{Labels: amtemplate.KV{"alertname": "HighCPU", "severity": "major"}, Annotations: amtemplate.KV{"summary": "CPU over 90%"}},
+			{Labels: amtemplate.KV{"alertname": "DiskFull", "severity": "major"}, Status: "resolved"},
+		},
+		GroupLabels: amtemplate.KV{"alertname": "HighCPU"},
+	}
+	out, err := client.RenderTemplate("test", "alerts.text", data)
+	assert.NoError(t, err)
+	assert.Equal(t, `firing: major
+HighCPU is firing (CPU over 90%)
+DiskFull is resolved
+`, out)
+
+	// alertmanager's default templates can be used
+	out, err = client.RenderTemplate("test", "title.text", data)
+	assert.NoError(t, err)
+	assert.Equal(t, "[FIRING:1] HighCPU ", out)
+
+	_, err = client.RenderTemplate("test", "broken.text", data)
+	assert.IsType(t, TemplateRenderError{}, err)
+	assert.Contains(t, err.Error(), "error executing template")
+
+	_, err = client.RenderTemplate("test", "missing.text", data)
+	assert.EqualError(t, err, "template missing.text not found")
+}
+
+func TestTemplateClient_ForTenant(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fileLocks, _ := alert.NewFileLocker(alert.NewDirectoryClient("."))
+	client := NewTemplateClient(fsclient.NewFSClient(dir), fileLocks)
+	clientA := client.ForTenant("tenantA")
+	clientB := client.ForTenant("tenantB")
+	assert.Equal(t, dir+"/tenantA/", clientA.Root())
+
+	assert.NoError(t, clientA.CreateTemplateFile("slack", "tenantA text"))
+	fileText, err := ioutil.ReadFile(dir + "/tenantA/slack.tmpl")
+	assert.NoError(t, err)
+	assert.Equal(t, "tenantA text", string(fileText))
+
+	// Other tenants and the shared directory don't see the file
+	_, err = clientB.GetTemplateFile("slack")
+	assert.Error(t, err)
+	_, err = client.GetTemplateFile("slack")
+	assert.Error(t, err)
+
+	assert.NoError(t, clientB.CreateTemplateFile("slack", "tenantB text"))
+	text, err := clientA.GetTemplateFile("slack")
+	assert.NoError(t, err)
+	assert.Equal(t, "tenantA text", text)
+
+	assert.NoError(t, clientB.DeleteTemplateFile("slack"))
+	_, err = clientA.GetTemplateFile("slack")
+	assert.NoError(t, err)
+}
+
+func TestTemplateClient_ConcurrentFileEdits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fileLocks, _ := alert.NewFileLocker(alert.NewDirectoryClient(dir))
+	client := NewTemplateClient(fsclient.NewFSClient(dir), fileLocks)
+	assert.NoError(t, client.CreateTemplateFile("slack", ""))
+
+	const baseFile = `{{ define "base" }}base{{ end }}`
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			errs <- client.AddTemplate("slack", fmt.Sprintf("tmpl%d", i), "text")
+		}(i)
+		go func() {
+			defer wg.Done()
+			errs <- client.EditTemplateFile("slack", baseFile)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	// Every edit saw and left a whole file
+	tmpls, err := client.GetTemplates("slack")
+	assert.NoError(t, err)
+	assert.Contains(t, tmpls, "base")
+
+	// Anything else locking the file by its on-disk path blocks the template
+	// client
+	fileLocks.Lock(filepath.Join(dir, "slack.tmpl"))
+	done := make(chan error)
+	go func() { done <- client.EditTemplateFile("slack", baseFile) }()
+	select {
+	case <-done:
+		t.Fatal("template file edited while locked")
+	case <-time.After(50 * time.Millisecond):
+	}
+	fileLocks.Unlock(filepath.Join(dir, "slack.tmpl"))
+	assert.NoError(t, <-done)
 }
 
 func newTestTmplClient() (TemplateClient, *mocks.FSClient, *[]byte) {
+	fileText, _ := readTestFileString()
+	return newTestTmplClientWithFile(fileText)
+}
+
+func newTestTmplClientWithFile(fileText string) (TemplateClient, *mocks.FSClient, *[]byte) {
 	fsClient := &mocks.FSClient{}
-	fsClient.On("ReadFile", mock.Anything).Return(readTestFile())
+	fsClient.On("ReadFile", mock.Anything).Return([]byte(fileText), nil)
 
 	var outputFile []byte
 	fsClient.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).
@@ -128,13 +472,25 @@ func newTestTmplClient() (TemplateClient, *mocks.FSClient, *[]byte) {
 	return NewTemplateClient(fsClient, fileLocks), fsClient, &outputFile
 }
 
-const copyrightHeaderLength = 200
+// newInMemoryTmplClient returns a template client whose file reads return
+// whatever was last written, starting from fileText
+func newInMemoryTmplClient(fileText string) (TemplateClient, *mocks.FSClient, *[]byte) {
+	fsClient := &mocks.FSClient{}
+	outputFile := []byte(fileText)
+	fsClient.On("ReadFile", mock.Anything).Return(func(string) []byte {
+		return outputFile
+	}, nil)
+	fsClient.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil).
+		Run(func(args mock.Arguments) { outputFile = args[1].([]byte) })
 
-func readTestFile() ([]byte, error) {
-	text, err := ioutil.ReadFile("testdata/test.tmpl")
-	return text[copyrightHeaderLength:], err
+	fsClient.On("Root").Return("testdata/")
+	fileLocks, _ := alert.NewFileLocker(alert.NewDirectoryClient("."))
+	return NewTemplateClient(fsClient, fileLocks), fsClient, &outputFile
 }
 
+const copyrightHeaderLength = 200
+
 func readTestFileString() (string, error) {
 	file, err := ioutil.ReadFile("testdata/test.tmpl")
 	return string(file[copyrightHeaderLength:]), err
@@ -0,0 +1,207 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tmplDefinition holds the location of a `{{ define }}` or `{{ block }}`
+// within the text of a template file
+type tmplDefinition struct {
+	name string
+	// start and end of the whole block, including the define and end actions
+	start, end int
+	// start and end of the template body between the define and end actions
+	bodyStart, bodyEnd int
+}
+
+// findTmplDefinitions scans template file text and returns the location of
+// each define and block action, so that individual templates can be modified
+// without rewriting the rest of the file.
+func findTmplDefinitions(text string) ([]tmplDefinition, error) {
+	var (
+		definitions []tmplDefinition
+		// open blocks; nil entries are non-define blocks such as if/range
+		stack []*tmplDefinition
+	)
+	pos := 0
+	for {
+		idx := strings.Index(text[pos:], "{{")
+		if idx < 0 {
+			break
+		}
+		actionStart := pos + idx
+		actionEnd, err := findActionEnd(text, actionStart)
+		if err != nil {
+			return nil, err
+		}
+		pos = actionEnd
+
+		keyword, args := splitAction(text[actionStart+2 : actionEnd-2])
+		switch keyword {
+		case "define", "block":
+			name, err := unquoteTmplName(args)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, &tmplDefinition{
+				name:      name,
+				start:     actionStart,
+				bodyStart: actionEnd,
+			})
+		case "if", "range", "with":
+			stack = append(stack, nil)
+		case "end":
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("unexpected {{end}} at position %d", actionStart)
+			}
+			def := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if def != nil {
+				def.bodyEnd = actionStart
+				def.end = actionEnd
+				definitions = append(definitions, *def)
+			}
+		}
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("unclosed action in template file")
+	}
+	return definitions, nil
+}
+
+// findActionEnd returns the index just past the closing delimiter of the
+// action starting at actionStart, skipping over comments and quoted strings.
+func findActionEnd(text string, actionStart int) (int, error) {
+	i := actionStart + 2
+	if strings.HasPrefix(text[i:], "- ") {
+		i += 2
+	}
+	if strings.HasPrefix(text[i:], "/*") {
+		commentEnd := strings.Index(text[i:], "*/")
+		if commentEnd < 0 {
+			return 0, fmt.Errorf("unclosed comment at position %d", actionStart)
+		}
+		i += commentEnd + 2
+	}
+	for i < len(text) {
+		switch text[i] {
+		case '"', '\'':
+			quote := text[i]
+			i++
+			for i < len(text) && text[i] != quote {
+				if text[i] == '\\' {
+					i++
+				}
+				i++
+			}
+		case '`':
+			rawEnd := strings.IndexByte(text[i+1:], '`')
+			if rawEnd < 0 {
+				return 0, fmt.Errorf("unterminated raw string at position %d", i)
+			}
+			i += rawEnd + 1
+		case '}':
+			if strings.HasPrefix(text[i:], "}}") {
+				return i + 2, nil
+			}
+		}
+		i++
+	}
+	return 0, fmt.Errorf("unclosed action at position %d", actionStart)
+}
+
+// splitAction returns the leading keyword of an action and the rest of its
+// contents, with trim markers removed
+func splitAction(action string) (string, string) {
+	action = strings.TrimPrefix(action, "-")
+	action = strings.TrimSuffix(action, "-")
+	action = strings.TrimSpace(action)
+	fields := strings.SplitN(action, " ", 2)
+	if len(fields) == 1 {
+		return fields[0], ""
+	}
+	return fields[0], strings.TrimSpace(fields[1])
+}
+
+// unquoteTmplName returns the template name at the start of the arguments
+// of a define or block action. Block actions also carry a pipeline after it.
+func unquoteTmplName(args string) (string, error) {
+	nameEnd := len(args)
+	if len(args) > 0 {
+		quote := args[0]
+		for i := 1; i < len(args); i++ {
+			if args[i] == '\\' && quote != '`' {
+				i++
+				continue
+			}
+			if args[i] == quote {
+				nameEnd = i + 1
+				break
+			}
+		}
+	}
+	name, err := strconv.Unquote(args[:nameEnd])
+	if err != nil {
+		return "", fmt.Errorf("invalid template name %s: %v", args, err)
+	}
+	return name, nil
+}
+
+func getTmplDefinition(text, tmplName string) (tmplDefinition, error) {
+	definitions, err := findTmplDefinitions(text)
+	if err != nil {
+		return tmplDefinition{}, err
+	}
+	for _, def := range definitions {
+		if def.name == tmplName {
+			return def, nil
+		}
+	}
+	return tmplDefinition{}, fmt.Errorf("template %s: %w", tmplName, ErrTemplateNotFound)
+}
+
+// appendTmplDefinition returns text with a new define block added at the end
+func appendTmplDefinition(text, tmplName, tmplText string) string {
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return text + defineTemplate(tmplName, tmplText) + "\n"
+}
+
+// replaceTmplDefinition returns text with the body of the named define block
+// replaced, leaving everything else in the file untouched. The define and end
+// actions are kept as written so any trim markers on them are preserved.
+func replaceTmplDefinition(text, tmplName, tmplText string) (string, error) {
+	def, err := getTmplDefinition(text, tmplName)
+	if err != nil {
+		return "", err
+	}
+	return text[:def.bodyStart] + tmplText + text[def.bodyEnd:], nil
+}
+
+// removeTmplDefinition returns text with the named define block removed,
+// along with the newline following it
+func removeTmplDefinition(text, tmplName string) (string, error) {
+	def, err := getTmplDefinition(text, tmplName)
+	if err != nil {
+		return "", err
+	}
+	end := def.end
+	if strings.HasPrefix(text[end:], "\n") {
+		end++
+	}
+	return text[:def.start] + text[end:], nil
+}
+
+func defineTemplate(tmplName, tmplText string) string {
+	return fmt.Sprintf(`{{ define "%s" }}%s{{ end }}`, tmplName, tmplText)
+}
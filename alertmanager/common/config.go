@@ -51,3 +51,46 @@ type TLSConfig struct {
 	// Disable target certificate validation.
 	InsecureSkipVerify bool `yaml:"insecure_skip_verify" json:"insecure_skip_verify,omitempty"`
 }
+
+// SecretPlaceholder replaces the value of secret fields when secrets are
+// scrubbed from configs that are read back
+const SecretPlaceholder = "<secret>"
+
+// ScrubSecret replaces a non-empty secret with SecretPlaceholder
+func ScrubSecret(secret *string) {
+	if *secret != "" {
+		*secret = SecretPlaceholder
+	}
+}
+
+// RestoreSecret sets secret back to its stored value if it was left as
+// SecretPlaceholder, or if it was omitted and restoreOmitted is set
+func RestoreSecret(secret *string, stored string, restoreOmitted bool) {
+	if *secret == SecretPlaceholder || (*secret == "" && restoreOmitted) {
+		*secret = stored
+	}
+}
+
+// ScrubSecrets replaces the bearer token and basic auth password with
+// SecretPlaceholder
+func (h *HTTPConfig) ScrubSecrets() {
+	if h == nil {
+		return
+	}
+	ScrubSecret(&h.BearerToken)
+	if h.BasicAuth != nil {
+		ScrubSecret(&h.BasicAuth.Password)
+	}
+}
+
+// RestoreSecrets sets the secrets of h back to their values in stored, see
+// RestoreSecret
+func (h *HTTPConfig) RestoreSecrets(stored *HTTPConfig, restoreOmitted bool) {
+	if h == nil || stored == nil {
+		return
+	}
+	RestoreSecret(&h.BearerToken, stored.BearerToken, restoreOmitted)
+	if h.BasicAuth != nil && stored.BasicAuth != nil {
+		RestoreSecret(&h.BasicAuth.Password, stored.BasicAuth.Password, restoreOmitted)
+	}
+}
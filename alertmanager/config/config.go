@@ -33,6 +33,13 @@ type Config struct {
 	Templates    []string                `yaml:"templates" json:"templates"`
 }
 
+// TenantDefaults holds the receivers and routing tree that new tenants are
+// provisioned with. Names are unsecured and are prefixed on provisioning.
+type TenantDefaults struct {
+	Receivers []*Receiver `yaml:"receivers,omitempty" json:"receivers,omitempty"`
+	Route     *Route      `yaml:"route,omitempty" json:"route,omitempty"`
+}
+
 // GetReceiver returns the receiver config with the given name
 func (c *Config) GetReceiver(name string) *Receiver {
 	for _, rec := range c.Receivers {
@@ -52,11 +59,18 @@ func (c *Config) GetRouteIdx(name string) int {
 	return -1
 }
 
-func (c *Config) InitializeNetworkBaseRoute(route *Route, matcherLabel, tenantID string) error {
+// InitializeNetworkBaseRoute adds route as the tenant's base route, whose
+// receiver notifies no one. If fallbackReceiver is set, the tenant's alerts
+// that none of the route's children match are sent to it instead, through a
+// catch-all last child route.
+func (c *Config) InitializeNetworkBaseRoute(route *Route, matcherLabel, tenantID, fallbackReceiver string) error {
 	baseRouteName := MakeBaseRouteName(tenantID)
 	if c.GetReceiver(baseRouteName) != nil {
 		return fmt.Errorf("Base route for tenant %s already exists", tenantID)
 	}
+	if fallbackReceiver != "" && c.GetReceiver(fallbackReceiver) == nil {
+		return fmt.Errorf("fallback receiver %s does not exist", fallbackReceiver)
+	}
 
 	c.Receivers = append(c.Receivers, &Receiver{Name: baseRouteName})
 	route.Receiver = baseRouteName
@@ -64,6 +78,9 @@ func (c *Config) InitializeNetworkBaseRoute(route *Route, matcherLabel, tenantID
 	if matcherLabel != "" {
 		route.Match = map[string]string{matcherLabel: tenantID}
 	}
+	if fallbackReceiver != "" {
+		route.Routes = append(route.Routes, &Route{Receiver: fallbackReceiver})
+	}
 
 	c.Route.Routes = append(c.Route.Routes, route)
 
@@ -86,27 +103,59 @@ func (c *Config) Validate() error {
 }
 
 func (c *Config) SearchRoutesForReceiver(receiver string) bool {
-	if c.Route.Receiver == receiver {
-		return true
+	return len(c.FindRoutePathsForReceiver(receiver)) > 0
+}
+
+// FindRoutePathsForReceiver returns the path of every route in the routing
+// tree that sends to receiver, e.g. "route.routes[2].routes[0]"
+func (c *Config) FindRoutePathsForReceiver(receiver string) []string {
+	return findRoutePathsForReceiverImpl(receiver, c.Route, "route")
+}
+
+func findRoutePathsForReceiverImpl(receiver string, route *Route, path string) []string {
+	var paths []string
+	if route.Receiver == receiver {
+		paths = append(paths, path)
 	}
-	for _, route := range c.Route.Routes {
-		if searchRoutesForReceiverImpl(receiver, route) {
-			return true
+	for i, childRoute := range route.Routes {
+		childPath := fmt.Sprintf("%s.routes[%d]", path, i)
+		paths = append(paths, findRoutePathsForReceiverImpl(receiver, childRoute, childPath)...)
+	}
+	return paths
+}
+
+// CheckIntegrity returns a description of each problem in the config that
+// makes lookups by receiver name ambiguous or broken: receivers sharing a
+// name, and routes sending to a receiver that isn't defined
+func (c *Config) CheckIntegrity() []string {
+	problems := []string{}
+	counts := map[string]int{}
+	for _, rec := range c.Receivers {
+		counts[rec.Name]++
+		if counts[rec.Name] == 2 {
+			problems = append(problems, fmt.Sprintf("duplicate receiver name: %s", rec.Name))
 		}
 	}
-	return false
+	if c.Route != nil {
+		problems = append(problems, findUndefinedReceiversImpl(counts, c.Route, "route")...)
+	}
+	return problems
 }
 
-func searchRoutesForReceiverImpl(receiver string, route *Route) bool {
-	if route.Receiver == receiver {
-		return true
+func findUndefinedReceiversImpl(defined map[string]int, route *Route, path string) []string {
+	var problems []string
+	// Routes without a receiver inherit their parent's
+	if route.Receiver != "" && defined[route.Receiver] == 0 {
+		problems = append(problems, fmt.Sprintf("%s sends to undefined receiver: %s", path, route.Receiver))
 	}
-	for _, route := range route.Routes {
-		if searchRoutesForReceiverImpl(receiver, route) {
-			return true
+	for i, childRoute := range route.Routes {
+		if childRoute == nil {
+			continue
 		}
+		childPath := fmt.Sprintf("%s.routes[%d]", path, i)
+		problems = append(problems, findUndefinedReceiversImpl(defined, childRoute, childPath)...)
 	}
-	return false
+	return problems
 }
 
 func (c *Config) RemoveReceiverFromRoute(receiver string) {
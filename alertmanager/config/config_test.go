@@ -61,22 +61,58 @@ func TestConfig_SearchRoutesForReceiver(t *testing.T) {
 	assert.False(t, testConfig.SearchRoutesForReceiver("foo"))
 }
 
+func TestConfig_FindRoutePathsForReceiver(t *testing.T) {
+	assert.Equal(t, []string{"route"}, testConfig.FindRoutePathsForReceiver("base"))
+	assert.Equal(t, []string{"route.routes[0]", "route.routes[2].routes[0]"}, testConfig.FindRoutePathsForReceiver("testReceiver"))
+	assert.Equal(t, []string{"route.routes[2].routes[1]"}, testConfig.FindRoutePathsForReceiver("testReceiverChild1"))
+	assert.Empty(t, testConfig.FindRoutePathsForReceiver("foo"))
+}
+
+func TestConfig_CheckIntegrity(t *testing.T) {
+	assert.Empty(t, testConfig.CheckIntegrity())
+
+	copy := deepCopy(testConfig)
+	copy.Receivers = append(copy.Receivers, &Receiver{Name: "testReceiver2"}, &Receiver{Name: "testReceiver2"})
+	copy.Route.Routes[2].Routes = append(copy.Route.Routes[2].Routes, &Route{Receiver: "missing"}, &Route{})
+	assert.Equal(t, []string{
+		"duplicate receiver name: testReceiver2",
+		"route.routes[2].routes[2] sends to undefined receiver: missing",
+	}, copy.CheckIntegrity())
+}
+
 func TestConfig_InitializeBaseRoute(t *testing.T) {
 	newRoute := &Route{
 		Receiver: "test",
 		Match:    map[string]string{"tenant": "test"},
 	}
 	copy := deepCopy(testConfig)
-	err := copy.InitializeNetworkBaseRoute(newRoute, "testMatcher", "tenant1")
+	err := copy.InitializeNetworkBaseRoute(newRoute, "testMatcher", "tenant1", "")
 	assert.True(t, copy.SearchRoutesForReceiver("tenant1_tenant_base_route"))
 	assert.Equal(t, copy.Route.Routes[3].Receiver, "tenant1_tenant_base_route")
 	assert.Equal(t, copy.Route.Routes[3].Match["testMatcher"], "tenant1")
 	assert.NoError(t, err)
 
-	err = copy.InitializeNetworkBaseRoute(newRoute, "testMatcher", "tenant1")
+	err = copy.InitializeNetworkBaseRoute(newRoute, "testMatcher", "tenant1", "")
 	assert.EqualError(t, err, "Base route for tenant tenant1 already exists")
 }
 
+func TestConfig_InitializeBaseRouteWithFallback(t *testing.T) {
+	copy := deepCopy(testConfig)
+	newRoute := &Route{Routes: []*Route{{Receiver: "testReceiver", Match: map[string]string{"severity": "critical"}}}}
+	err := copy.InitializeNetworkBaseRoute(newRoute, "testMatcher", "tenant1", "testReceiver")
+	assert.NoError(t, err)
+
+	// The fallback catches whatever the tenant's own routes don't
+	baseRoute := copy.Route.Routes[copy.GetRouteIdx("tenant1_tenant_base_route")]
+	assert.Len(t, baseRoute.Routes, 2)
+	assert.Equal(t, &Route{Receiver: "testReceiver"}, baseRoute.Routes[1])
+	assert.Equal(t, []string{"testReceiver"}, baseRoute.Receivers(map[string]string{"testMatcher": "tenant1"}))
+
+	copy = deepCopy(testConfig)
+	err = copy.InitializeNetworkBaseRoute(&Route{}, "testMatcher", "tenant1", "missing")
+	assert.EqualError(t, err, "fallback receiver missing does not exist")
+}
+
 func deepCopy(conf Config) (new Config) {
 	b, _ := json.Marshal(conf)
 	err := json.Unmarshal(b, &new)
@@ -85,3 +121,27 @@ func deepCopy(conf Config) (new Config) {
 	}
 	return new
 }
+
+func TestRoute_Receivers(t *testing.T) {
+	route := Route{}
+	err := json.Unmarshal([]byte(`{
+		"receiver": "base",
+		"routes": [
+			{"receiver": "pager", "match": {"severity": "critical"}, "continue": true},
+			{"match_re": {"severity": "crit.*|major"}, "routes": [
+				{"receiver": "db_team", "match": {"team": "db"}}
+			]},
+			{"receiver": "slack", "match": {"team": "db"}}
+		]
+	}`), &route)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"pager", "db_team"}, route.Receivers(map[string]string{"severity": "critical", "team": "db"}))
+	// A matching route without a receiver inherits its parent's
+	assert.Equal(t, []string{"pager", "base"}, route.Receivers(map[string]string{"severity": "critical"}))
+	assert.Equal(t, []string{"db_team"}, route.Receivers(map[string]string{"severity": "major", "team": "db"}))
+	assert.Equal(t, []string{"slack"}, route.Receivers(map[string]string{"severity": "minor", "team": "db"}))
+	assert.Equal(t, []string{"base"}, route.Receivers(map[string]string{"severity": "minor"}))
+	// match_re is anchored
+	assert.Equal(t, []string{"base"}, route.Receivers(map[string]string{"severity": "notmajor"}))
+}
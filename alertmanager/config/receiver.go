@@ -8,6 +8,7 @@
 package config
 
 import (
+	"encoding/json"
 	"strings"
 
 	"github.com/facebookincubator/prometheus-configmanager/alertmanager/common"
@@ -65,7 +66,7 @@ func UnsecureReceiverName(name, tenantID string) string {
 // is marshaled as is instead of being obscured which is how alertmanager handles
 // secrets
 type SlackConfig struct {
-	config.NotifierConfig `yaml:",inline" json:"notifier_config,inline"`
+	config.NotifierConfig `yaml:",inline" json:",inline"`
 	HTTPConfig            *common.HTTPConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
 
 	APIURL      string                `yaml:"api_url" json:"api_url"`
@@ -94,7 +95,7 @@ type SlackConfig struct {
 // alertmanager handles secrets. Otherwise the secrets would be obscured on write
 // to the yml file, making it unusable.
 type EmailConfig struct {
-	config.NotifierConfig `yaml:",inline" json:"notifier_config,inline"`
+	config.NotifierConfig `yaml:",inline" json:",inline"`
 
 	To           string            `yaml:"to,omitempty" json:"to,omitempty"`
 	From         string            `yaml:"from,omitempty" json:"from,omitempty"`
@@ -115,7 +116,7 @@ type EmailConfig struct {
 // alertmanager handles secrets. Otherwise the secrets would be obscured on
 // write to the yml file, making it unusable.
 type PagerDutyConfig struct {
-	config.NotifierConfig `yaml:",inline" json:"notifier_config,inline"`
+	config.NotifierConfig `yaml:",inline" json:",inline"`
 	HTTPConfig            *common.HTTPConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
 
 	RoutingKey  string                   `yaml:"routing_key,omitempty" json:"routing_key,omitempty"`
@@ -135,7 +136,7 @@ type PagerDutyConfig struct {
 // alertmanager handles secrets. Otherwise the secrets would be obscured on
 // write to the yml file, making it unusable.
 type PushoverConfig struct {
-	config.NotifierConfig `yaml:",inline" json:"notifier_config,inline"`
+	config.NotifierConfig `yaml:",inline" json:",inline"`
 	HTTPConfig            *common.HTTPConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
 
 	UserKey  string         `yaml:"user_key" json:"user_key"`
@@ -149,7 +150,7 @@ type PushoverConfig struct {
 }
 
 type PushoverJSONWrapper struct {
-	config.NotifierConfig `yaml:",inline" json:"notifier_config,inline"`
+	config.NotifierConfig `yaml:",inline" json:",inline"`
 	HTTPConfig            *common.HTTPConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
 
 	UserKey  string `yaml:"user_key" json:"user_key"`
@@ -205,16 +206,108 @@ func (r *ReceiverJSONWrapper) ToReceiverFmt() (Receiver, error) {
 	return receiver, nil
 }
 
+// ToJSONWrapper converts the receiver to its JSON compatible form, the reverse
+// of ReceiverJSONWrapper.ToReceiverFmt
+func (r *Receiver) ToJSONWrapper() ReceiverJSONWrapper {
+	wrapper := ReceiverJSONWrapper{
+		Name:             r.Name,
+		SlackConfigs:     r.SlackConfigs,
+		WebhookConfigs:   r.WebhookConfigs,
+		EmailConfigs:     r.EmailConfigs,
+		PagerDutyConfigs: r.PagerDutyConfigs,
+	}
+
+	for _, p := range r.PushoverConfigs {
+		pushoverConf := PushoverJSONWrapper{
+			NotifierConfig: p.NotifierConfig,
+			HTTPConfig:     p.HTTPConfig,
+			UserKey:        p.UserKey,
+			Token:          p.Token,
+			Title:          p.Title,
+			Message:        p.Message,
+			URL:            p.URL,
+			Priority:       p.Priority,
+		}
+		if p.Retry != 0 {
+			pushoverConf.Retry = p.Retry.String()
+		}
+		if p.Expire != 0 {
+			pushoverConf.Expire = p.Expire.String()
+		}
+		wrapper.PushoverConfigs = append(wrapper.PushoverConfigs, &pushoverConf)
+	}
+
+	return wrapper
+}
+
+// legacyReceiverJSON holds the notifier configs of a receiver in the JSON
+// format used before send_resolved was moved to the top level of each
+// notifier config
+type legacyReceiverJSON struct {
+	SlackConfigs     []legacyNotifierJSON `json:"slack_configs"`
+	WebhookConfigs   []legacyNotifierJSON `json:"webhook_configs"`
+	EmailConfigs     []legacyNotifierJSON `json:"email_configs"`
+	PagerDutyConfigs []legacyNotifierJSON `json:"pagerduty_configs"`
+	PushoverConfigs  []legacyNotifierJSON `json:"pushover_configs"`
+}
+
+type legacyNotifierJSON struct {
+	NotifierConfig *config.NotifierConfig `json:"notifier_config"`
+}
+
+// ApplyLegacyNotifierConfigs sets the NotifierConfig of each notifier that is
+// given nested under notifier_config in body, so that receivers posted in the
+// older JSON format keep their send_resolved setting
+func (r *Receiver) ApplyLegacyNotifierConfigs(body []byte) error {
+	legacy := legacyReceiverJSON{}
+	err := json.Unmarshal(body, &legacy)
+	if err != nil {
+		return err
+	}
+	for i, l := range legacy.SlackConfigs {
+		if l.NotifierConfig != nil && i < len(r.SlackConfigs) {
+			r.SlackConfigs[i].NotifierConfig = *l.NotifierConfig
+		}
+	}
+	for i, l := range legacy.WebhookConfigs {
+		if l.NotifierConfig != nil && i < len(r.WebhookConfigs) {
+			r.WebhookConfigs[i].NotifierConfig = *l.NotifierConfig
+		}
+	}
+	for i, l := range legacy.EmailConfigs {
+		if l.NotifierConfig != nil && i < len(r.EmailConfigs) {
+			r.EmailConfigs[i].NotifierConfig = *l.NotifierConfig
+		}
+	}
+	for i, l := range legacy.PagerDutyConfigs {
+		if l.NotifierConfig != nil && i < len(r.PagerDutyConfigs) {
+			r.PagerDutyConfigs[i].NotifierConfig = *l.NotifierConfig
+		}
+	}
+	for i, l := range legacy.PushoverConfigs {
+		if l.NotifierConfig != nil && i < len(r.PushoverConfigs) {
+			r.PushoverConfigs[i].NotifierConfig = *l.NotifierConfig
+		}
+	}
+	return nil
+}
+
 // WebhookConfig is a copy of prometheus/alertmanager/config.WebhookConfig with
 // alertmanager-configurer's custom HTTPConfig
 type WebhookConfig struct {
-	config.NotifierConfig `yaml:",inline" json:"notifier_config,inline"`
+	config.NotifierConfig `yaml:",inline" json:",inline"`
 
 	HTTPConfig *common.HTTPConfig `yaml:"http_config,omitempty" json:"http_config,omitempty"`
 
 	URL *config.URL `yaml:"url" json:"url"`
 }
 
+// ReceiverTenantPrefix returns the prefix of receiver names belonging to
+// tenantID. An empty tenantID is used in single-tenant mode, where receiver
+// names aren't prefixed, so Secure and Unsecure leave names unchanged.
 func ReceiverTenantPrefix(tenantID string) string {
+	if tenantID == "" {
+		return ""
+	}
 	return strings.Replace(tenantID, "_", "", -1) + "_"
 }
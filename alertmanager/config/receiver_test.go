@@ -8,13 +8,16 @@
 package config_test
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/facebookincubator/prometheus-configmanager/alertmanager/config"
 	tc "github.com/facebookincubator/prometheus-configmanager/alertmanager/testcommon"
 
 	amconfig "github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/yaml.v2"
 )
@@ -179,6 +182,55 @@ func TestReceiver_Unsecure(t *testing.T) {
 	assert.Equal(t, "receiverName", rec.Name)
 }
 
+func TestReceiver_SecureSingleTenant(t *testing.T) {
+	rec := config.Receiver{Name: "receiverName"}
+	rec.Secure("")
+	assert.Equal(t, "receiverName", rec.Name)
+
+	rec.Unsecure("")
+	assert.Equal(t, "receiverName", rec.Name)
+}
+
+func TestReceiver_JSONWrapperSendResolved(t *testing.T) {
+	sendResolved := amconfig.NotifierConfig{VSendResolved: true}
+	rec := config.Receiver{
+		Name:             "receiver",
+		SlackConfigs:     []*config.SlackConfig{{NotifierConfig: sendResolved, APIURL: "http://slack.com/1"}},
+		WebhookConfigs:   []*config.WebhookConfig{{NotifierConfig: sendResolved}},
+		EmailConfigs:     []*config.EmailConfig{{NotifierConfig: sendResolved, To: "test@mail.com"}},
+		PagerDutyConfigs: []*config.PagerDutyConfig{{NotifierConfig: sendResolved, RoutingKey: "key"}},
+		PushoverConfigs:  []*config.PushoverConfig{{NotifierConfig: sendResolved, UserKey: "user", Token: "token", Retry: model.Duration(time.Minute)}},
+	}
+
+	// send_resolved is at the top level of each notifier, as in alertmanager.yml
+	body, err := json.Marshal(rec.ToJSONWrapper())
+	assert.NoError(t, err)
+	assert.Equal(t, 5, strings.Count(string(body), `"send_resolved":true`))
+	assert.Contains(t, string(body), `"retry":"1m"`)
+
+	wrapper := config.ReceiverJSONWrapper{}
+	assert.NoError(t, json.Unmarshal(body, &wrapper))
+	roundTrip, err := wrapper.ToReceiverFmt()
+	assert.NoError(t, err)
+	assert.Equal(t, rec, roundTrip)
+}
+
+func TestReceiver_ApplyLegacyNotifierConfigs(t *testing.T) {
+	body := []byte(`{
+		"name": "receiver",
+		"webhook_configs": [{"url": "http://test.com"}, {"notifier_config": {"send_resolved": true}, "url": "http://test.com"}],
+		"slack_configs": [{"notifier_config": {"send_resolved": true}, "api_url": "http://slack.com/1"}]
+	}`)
+	rec := config.Receiver{}
+	assert.NoError(t, json.Unmarshal(body, &rec))
+	assert.False(t, rec.SlackConfigs[0].VSendResolved)
+
+	assert.NoError(t, rec.ApplyLegacyNotifierConfigs(body))
+	assert.False(t, rec.WebhookConfigs[0].VSendResolved)
+	assert.True(t, rec.WebhookConfigs[1].VSendResolved)
+	assert.True(t, rec.SlackConfigs[0].VSendResolved)
+}
+
 func TestMarshalYamlEmailConfig(t *testing.T) {
 	valTrue := true
 	emailConf := config.EmailConfig{
@@ -8,6 +8,8 @@
 package config
 
 import (
+	"fmt"
+
 	"github.com/prometheus/alertmanager/config"
 	"github.com/prometheus/common/model"
 )
@@ -29,4 +31,93 @@ type Route struct {
 	GroupWait      string `yaml:"group_wait,omitempty" json:"group_wait,omitempty"`
 	GroupInterval  string `yaml:"group_interval,omitempty" json:"group_interval,omitempty"`
 	RepeatInterval string `yaml:"repeat_interval,omitempty" json:"repeat_interval,omitempty"`
+
+	// Names of time intervals during which the route is muted or active
+	MuteTimeIntervals   []string `yaml:"mute_time_intervals,omitempty" json:"mute_time_intervals,omitempty"`
+	ActiveTimeIntervals []string `yaml:"active_time_intervals,omitempty" json:"active_time_intervals,omitempty"`
+}
+
+// RouteTimings are the grouping and notification intervals of a route
+type RouteTimings struct {
+	GroupWait      string
+	GroupInterval  string
+	RepeatInterval string
+}
+
+// ApplyDefaultTimings sets each of the route's timing fields that is unset
+// to the corresponding default
+func (r *Route) ApplyDefaultTimings(defaults RouteTimings) {
+	if r.GroupWait == "" {
+		r.GroupWait = defaults.GroupWait
+	}
+	if r.GroupInterval == "" {
+		r.GroupInterval = defaults.GroupInterval
+	}
+	if r.RepeatInterval == "" {
+		r.RepeatInterval = defaults.RepeatInterval
+	}
+}
+
+// RoutesWithoutGroupBy returns the path of each route in the tree rooted at
+// r, which is found at path, that neither sets group_by nor inherits it.
+// inherited reports whether a route above r sets group_by.
+func (r *Route) RoutesWithoutGroupBy(path string, inherited bool) []string {
+	inherited = inherited || len(r.GroupByStr) > 0
+	var paths []string
+	if !inherited {
+		paths = append(paths, path)
+	}
+	for i, child := range r.Routes {
+		if child == nil {
+			continue
+		}
+		paths = append(paths, child.RoutesWithoutGroupBy(fmt.Sprintf("%s.routes[%d]", path, i), inherited)...)
+	}
+	return paths
+}
+
+// Matches reports whether an alert with the given labels satisfies every
+// match and match_re matcher of the route. Child routes aren't considered.
+func (r *Route) Matches(labels map[string]string) bool {
+	for name, value := range r.Match {
+		if labels[name] != value {
+			return false
+		}
+	}
+	for name, re := range r.MatchRE {
+		if re.Regexp == nil || !re.MatchString(labels[name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Receivers returns the receivers an alert with the given labels would be
+// sent to if r were the root of the routing tree. As in alertmanager, the
+// first matching child route takes the alert unless it has continue set, a
+// route without a receiver uses its parent's, and an alert that matches no
+// child stays with the route itself.
+func (r *Route) Receivers(labels map[string]string) []string {
+	return r.receivers(labels, "")
+}
+
+func (r *Route) receivers(labels map[string]string, parentReceiver string) []string {
+	receiver := r.Receiver
+	if receiver == "" {
+		receiver = parentReceiver
+	}
+	var receivers []string
+	for _, child := range r.Routes {
+		if !child.Matches(labels) {
+			continue
+		}
+		receivers = append(receivers, child.receivers(labels, receiver)...)
+		if !child.Continue {
+			break
+		}
+	}
+	if len(receivers) == 0 {
+		return []string{receiver}
+	}
+	return receivers
 }
@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package config
+
+import (
+	"github.com/facebookincubator/prometheus-configmanager/alertmanager/common"
+)
+
+// ScrubSecrets replaces the secret fields of each of the receiver's notifier
+// configs with common.SecretPlaceholder
+func (r *Receiver) ScrubSecrets() {
+	for _, s := range r.SlackConfigs {
+		common.ScrubSecret(&s.APIURL)
+		s.HTTPConfig.ScrubSecrets()
+	}
+	for _, w := range r.WebhookConfigs {
+		w.HTTPConfig.ScrubSecrets()
+	}
+	for _, e := range r.EmailConfigs {
+		common.ScrubSecret(&e.AuthPassword)
+		common.ScrubSecret(&e.AuthSecret)
+	}
+	for _, p := range r.PagerDutyConfigs {
+		common.ScrubSecret(&p.RoutingKey)
+		common.ScrubSecret(&p.ServiceKey)
+		p.HTTPConfig.ScrubSecrets()
+	}
+	for _, p := range r.PushoverConfigs {
+		common.ScrubSecret(&p.UserKey)
+		common.ScrubSecret(&p.Token)
+		p.HTTPConfig.ScrubSecrets()
+	}
+}
+
+// RestoreSecrets sets the secret fields of the receiver that were left as
+// common.SecretPlaceholder, or omitted if restoreOmitted is set, back to
+// their values in stored. Notifier configs are matched to the stored ones of
+// the same type by position.
+func (r *Receiver) RestoreSecrets(stored *Receiver, restoreOmitted bool) {
+	for i, s := range r.SlackConfigs {
+		if i < len(stored.SlackConfigs) {
+			common.RestoreSecret(&s.APIURL, stored.SlackConfigs[i].APIURL, restoreOmitted)
+			s.HTTPConfig.RestoreSecrets(stored.SlackConfigs[i].HTTPConfig, restoreOmitted)
+		}
+	}
+	for i, w := range r.WebhookConfigs {
+		if i < len(stored.WebhookConfigs) {
+			w.HTTPConfig.RestoreSecrets(stored.WebhookConfigs[i].HTTPConfig, restoreOmitted)
+		}
+	}
+	for i, e := range r.EmailConfigs {
+		if i < len(stored.EmailConfigs) {
+			common.RestoreSecret(&e.AuthPassword, stored.EmailConfigs[i].AuthPassword, restoreOmitted)
+			common.RestoreSecret(&e.AuthSecret, stored.EmailConfigs[i].AuthSecret, restoreOmitted)
+		}
+	}
+	for i, p := range r.PagerDutyConfigs {
+		if i < len(stored.PagerDutyConfigs) {
+			common.RestoreSecret(&p.RoutingKey, stored.PagerDutyConfigs[i].RoutingKey, restoreOmitted)
+			common.RestoreSecret(&p.ServiceKey, stored.PagerDutyConfigs[i].ServiceKey, restoreOmitted)
+			p.HTTPConfig.RestoreSecrets(stored.PagerDutyConfigs[i].HTTPConfig, restoreOmitted)
+		}
+	}
+	for i, p := range r.PushoverConfigs {
+		if i < len(stored.PushoverConfigs) {
+			common.RestoreSecret(&p.UserKey, stored.PushoverConfigs[i].UserKey, restoreOmitted)
+			common.RestoreSecret(&p.Token, stored.PushoverConfigs[i].Token, restoreOmitted)
+			p.HTTPConfig.RestoreSecrets(stored.PushoverConfigs[i].HTTPConfig, restoreOmitted)
+		}
+	}
+}
+
+// ScrubSecrets replaces the secret fields of the global config with
+// common.SecretPlaceholder
+func (g *GlobalConfig) ScrubSecrets() {
+	common.ScrubSecret(&g.SMTPAuthPassword)
+	common.ScrubSecret(&g.SMTPAuthSecret)
+	common.ScrubSecret(&g.HipchatAuthToken)
+	common.ScrubSecret(&g.OpsGenieAPIKey)
+	common.ScrubSecret(&g.WeChatAPISecret)
+	common.ScrubSecret(&g.VictorOpsAPIKey)
+	g.HTTPConfig.ScrubSecrets()
+}
+
+// RestoreSecrets sets the secret fields of the global config back to their
+// values in stored, like Receiver.RestoreSecrets
+func (g *GlobalConfig) RestoreSecrets(stored *GlobalConfig, restoreOmitted bool) {
+	common.RestoreSecret(&g.SMTPAuthPassword, stored.SMTPAuthPassword, restoreOmitted)
+	common.RestoreSecret(&g.SMTPAuthSecret, stored.SMTPAuthSecret, restoreOmitted)
+	common.RestoreSecret(&g.HipchatAuthToken, stored.HipchatAuthToken, restoreOmitted)
+	common.RestoreSecret(&g.OpsGenieAPIKey, stored.OpsGenieAPIKey, restoreOmitted)
+	common.RestoreSecret(&g.WeChatAPISecret, stored.WeChatAPISecret, restoreOmitted)
+	common.RestoreSecret(&g.VictorOpsAPIKey, stored.VictorOpsAPIKey, restoreOmitted)
+	g.HTTPConfig.RestoreSecrets(stored.HTTPConfig, restoreOmitted)
+}
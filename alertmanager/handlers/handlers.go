@@ -9,18 +9,29 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/facebookincubator/prometheus-configmanager/alertmanager/client"
 	"github.com/facebookincubator/prometheus-configmanager/alertmanager/config"
+	"github.com/facebookincubator/prometheus-configmanager/prometheus/alert"
+	"github.com/facebookincubator/prometheus-configmanager/version"
 	"github.com/golang/glog"
 
 	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const (
+	routesInfoPath = "/v1/routes-info"
+	versionPath    = "/version"
+	metricsPath    = "/metrics"
+
 	v0rootPath               = "/:tenant_id"
 	v0receiverPath           = "/receiver"
 	v0RoutePath              = "/receiver/route"
@@ -30,21 +41,40 @@ const (
 	tenantIDPart     = "/:tenant_id"
 	v1TenantRootPath = v1rootPath + tenantIDPart
 
-	v1receiverPath     = "/receiver"
-	v1receiverNamePath = v1receiverPath + "/:" + receiverNameParam
-	v1routePath        = "/route"
-	v1GlobalPath       = "/global"
-	v1TenantPath       = "/tenants"
-	v1TenancyPath      = "/tenancy"
+	v1receiverPath      = "/receiver"
+	v1receiverNamePath  = v1receiverPath + "/:" + receiverNameParam
+	v1routePath         = "/route"
+	v1RouteValidatePath = v1routePath + "/validate"
+	v1RouteSimulatePath = v1routePath + "/simulate"
+	v1GlobalPath        = "/global"
+	v1TenantPath        = "/tenants"
+	v1TenancyPath       = "/tenancy"
+	v1ProvisionPath     = "/provision"
+	v1ConfigPath        = "/config"
+	v1IntegrityPath     = v1ConfigPath + "/integrity"
 
 	receiverNameParam = "receiver_name"
 	tenantIDParam     = "tenant_id"
 
+	prefixQueryParam = "prefix"
+	limitQueryParam  = "limit"
+	offsetQueryParam = "offset"
+
+	headerIfMatch = "If-Match"
+	headerETag    = "ETag"
+	// set by ifMatchMiddlewareProvider to the config hash a modification expects
+	configHashParam = "config_hash"
+
 	// Templates
-	v1TemplateRoot     = v1rootPath + "/:tmpl_file_name"
-	v1TemplatePath     = "/template"
-	v1TemplatesPath    = "/templates"
-	v1TemplateSpecPath = v1TemplatePath + "/:tmpl_name"
+	v1TemplateRoot        = v1rootPath + "/:tmpl_file_name"
+	v1TenantTemplateRoot  = v1TenantRootPath + "/template_files/:tmpl_file_name"
+	v1TemplatePath        = "/template"
+	v1TemplateWithContent = "/template-with-content"
+	v1TemplatesPath       = "/templates"
+	v1TemplatesBulk       = v1TemplatesPath + "/bulk"
+	v1TemplateSpecPath    = v1TemplatePath + "/:tmpl_name"
+	v1TemplateRender      = v1TemplateSpecPath + "/render"
+	v1AllTemplatesPath    = v1rootPath + v1TemplatesPath + "/all"
 
 	templateFilenameParam = "tmpl_file_name"
 	templateNameParam     = "tmpl_name"
@@ -52,11 +82,35 @@ const (
 
 func RegisterBaseHandlers(e *echo.Echo) {
 	e.GET("/", statusHandler)
+	e.GET(routesInfoPath, GetRoutesInfoHandler(e))
+	e.GET(versionPath, versionHandler)
+	e.GET(metricsPath, echo.WrapHandler(promhttp.Handler()))
 }
 
-func RegisterV0Handlers(e *echo.Echo, client client.AlertmanagerClient) {
+func versionHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, version.Get())
+}
+
+// GetRoutesInfoHandler returns a handler that lists the method, path, and
+// handler name of every route registered on e
+func GetRoutesInfoHandler(e *echo.Echo) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		routes := e.Routes()
+		sort.Slice(routes, func(i, j int) bool {
+			if routes[i].Path != routes[j].Path {
+				return routes[i].Path < routes[j].Path
+			}
+			return routes[i].Method < routes[j].Method
+		})
+		return c.JSON(http.StatusOK, routes)
+	}
+}
+
+func RegisterV0Handlers(e *echo.Echo, client client.AlertmanagerClient, readOnly bool) {
 	v0 := e.Group(v0rootPath)
+	v0.Use(readOnlyMiddlewareProvider(readOnly))
 	v0.Use(tenancyMiddlewareProvider(client, pathTenantProvider))
+	v0.Use(ifMatchMiddlewareProvider(client))
 
 	v0.POST(v0receiverPath, GetReceiverPostHandler(client))
 	v0.GET(v0receiverPath, GetGetReceiversHandler(client))
@@ -67,49 +121,124 @@ func RegisterV0Handlers(e *echo.Echo, client client.AlertmanagerClient) {
 	v0.GET(v0RoutePath, GetGetRouteHandler(client))
 }
 
-func RegisterV1Handlers(e *echo.Echo, client client.AlertmanagerClient, tmplClient client.TemplateClient) {
+func RegisterV1Handlers(e *echo.Echo, client client.AlertmanagerClient, tmplClient client.TemplateClient, readOnly bool) {
 	v1 := e.Group(v1rootPath)
+	v1.Use(readOnlyMiddlewareProvider(readOnly))
 	v1Template := e.Group(v1TemplateRoot)
 
 	// these don't require tenancy so register before middleware
 	v1.GET(v1TenantPath, GetGetTenantsHandler(client))
 	v1.GET(v1TenancyPath, GetGetTenancyHandler(client))
-
-	v1.POST(v1GlobalPath, GetUpdateGlobalConfigHandler(client))
-	v1.GET(v1GlobalPath, GetGetGlobalConfigHandler(client))
+	v1.GET(v1IntegrityPath, GetConfigIntegrityHandler(client))
+
+	v1.POST(v1GlobalPath, GetUpdateGlobalConfigHandler(client), ifMatchMiddlewareProvider(client))
+	v1.GET(v1GlobalPath, GetGetGlobalConfigHandler(client), ifMatchMiddlewareProvider(client))
+
+	// Without tenancy, receivers and the routing tree are also available
+	// without a tenant path and are used as they are in the config
+	if client.Tenancy() == nil {
+		v1Default := e.Group(v1rootPath)
+		v1Default.Use(readOnlyMiddlewareProvider(readOnly))
+		v1Default.Use(tenancyMiddlewareProvider(client, pathTenantProvider))
+		v1Default.Use(ifMatchMiddlewareProvider(client))
+		registerReceiverRouteHandlers(v1Default, client)
+	} else {
+		// With tenancy, the top-level route is the parent of every tenant's
+		// base route. Without it, the routing tree above is used instead.
+		v1.PUT(v1routePath, GetUpdateGlobalRouteHandler(client), ifMatchMiddlewareProvider(client))
+		v1.GET(v1routePath, GetGetGlobalRouteHandler(client), ifMatchMiddlewareProvider(client))
+	}
 
 	v1Tenant := e.Group(v1TenantRootPath)
+	v1Tenant.Use(readOnlyMiddlewareProvider(readOnly))
 	v1Tenant.Use(tenancyMiddlewareProvider(client, pathTenantProvider))
+	v1Tenant.Use(ifMatchMiddlewareProvider(client))
 
-	v1Tenant.POST(v1receiverPath, GetReceiverPostHandler(client))
-	v1Tenant.GET(v1receiverPath, GetGetReceiversHandler(client))
+	registerReceiverRouteHandlers(v1Tenant, client)
 
-	v1Tenant.DELETE(v1receiverNamePath, GetDeleteReceiverHandler(client, receiverNamePathProvider))
-	v1Tenant.PUT(v1receiverNamePath, GetUpdateReceiverHandler(client, receiverNamePathProvider))
-	v1Tenant.GET(v1receiverNamePath, GetGetReceiversHandler(client))
+	v1Tenant.POST(v1ProvisionPath, GetProvisionTenantHandler(client))
 
-	v1Tenant.POST(v1routePath, GetUpdateRouteHandler(client))
-	v1Tenant.GET(v1routePath, GetGetRouteHandler(client))
+	v1Tenant.GET(v1ConfigPath, GetGetTenantConfigHandler(client))
 
+	v1Template.Use(readOnlyMiddlewareProvider(readOnly))
 	v1Template.Use(stringParamProvider(templateFilenameParam))
+	v1Template.Use(ifMatchMiddlewareProvider(client))
+	registerTemplateHandlers(v1Template, client, tmplClient)
+
+	// Tenant-scoped templates are kept apart from the shared ones above
+	v1TenantTemplate := e.Group(v1TenantTemplateRoot)
+	v1TenantTemplate.Use(readOnlyMiddlewareProvider(readOnly))
+	v1TenantTemplate.Use(tenancyMiddlewareProvider(client, pathTenantProvider))
+	v1TenantTemplate.Use(templateTenantMiddleware)
+	v1TenantTemplate.Use(stringParamProvider(templateFilenameParam))
+	v1TenantTemplate.Use(ifMatchMiddlewareProvider(client))
+	registerTemplateHandlers(v1TenantTemplate, client, tmplClient)
+
+	// rendering doesn't modify anything, so it's registered outside of the
+	// template group to be available in read-only mode
+	e.POST(v1TemplateRoot+v1TemplateRender, GetRenderTemplateHandler(client, tmplClient),
+		stringParamProvider(templateFilenameParam), stringParamProvider(templateNameParam))
+	e.POST(v1TenantTemplateRoot+v1TemplateRender, GetRenderTemplateHandler(client, tmplClient),
+		tenancyMiddlewareProvider(client, pathTenantProvider), templateTenantMiddleware,
+		stringParamProvider(templateFilenameParam), stringParamProvider(templateNameParam))
+	// as is validating a route without applying it
+	e.POST(v1TenantRootPath+v1RouteValidatePath, GetValidateRouteHandler(client),
+		tenancyMiddlewareProvider(client, pathTenantProvider))
+	// or simulating how an alert is routed
+	e.POST(v1TenantRootPath+v1RouteSimulatePath, GetSimulateRouteHandler(client),
+		tenancyMiddlewareProvider(client, pathTenantProvider))
+	// and listing the templates of every shared template file
+	e.GET(v1AllTemplatesPath, GetGetAllTemplatesHandler(tmplClient))
+}
+
+// registerReceiverRouteHandlers adds the receiver and route routes to a group
+// that provides the tenant ID
+func registerReceiverRouteHandlers(g *echo.Group, client client.AlertmanagerClient) {
+	g.POST(v1receiverPath, GetReceiverPostHandler(client))
+	g.GET(v1receiverPath, GetGetReceiversHandler(client))
+
+	g.DELETE(v1receiverNamePath, GetDeleteReceiverHandler(client, receiverNamePathProvider))
+	g.PUT(v1receiverNamePath, GetUpdateReceiverHandler(client, receiverNamePathProvider))
+	g.GET(v1receiverNamePath, GetGetReceiversHandler(client))
+
+	g.POST(v1routePath, GetUpdateRouteHandler(client))
+	g.GET(v1routePath, GetGetRouteHandler(client))
+}
+
+// registerTemplateHandlers adds the template file and template routes to a
+// group that provides the template file name
+func registerTemplateHandlers(g *echo.Group, client client.AlertmanagerClient, tmplClient client.TemplateClient) {
+	g.GET(v1TemplatePath, GetGetTemplateFileHandler(client, tmplClient))
+	g.POST(v1TemplatePath, GetPostTemplateFileHandler(client, tmplClient))
+	g.PUT(v1TemplatePath, GetPutTemplateFileHandler(client, tmplClient))
+	g.DELETE(v1TemplatePath, GetDeleteTemplateFileHandler(client, tmplClient))
+	g.POST(v1TemplateWithContent, GetPostTemplateFileWithTemplatesHandler(client, tmplClient))
 
-	v1Template.GET(v1TemplatePath, GetGetTemplateFileHandler(client, tmplClient))
-	v1Template.POST(v1TemplatePath, GetPostTemplateFileHandler(client, tmplClient))
-	v1Template.PUT(v1TemplatePath, GetPutTemplateFileHandler(client, tmplClient))
-	v1Template.DELETE(v1TemplatePath, GetDeleteTemplateFileHandler(client, tmplClient))
+	g.POST(v1TemplatesBulk, GetBulkTemplatesHandler(client, tmplClient))
 
-	v1Template.Use(stringParamProvider(templateNameParam))
+	g.Use(stringParamProvider(templateNameParam))
 
-	v1Template.GET(v1TemplatesPath, GetGetTemplatesHandler(client, tmplClient))
-	v1Template.GET(v1TemplateSpecPath, GetGetTemplateHandler(client, tmplClient))
-	v1Template.POST(v1TemplateSpecPath, GetPostTemplateHandler(client, tmplClient))
-	v1Template.PUT(v1TemplateSpecPath, GetPutTemplateHandler(client, tmplClient))
-	v1Template.DELETE(v1TemplateSpecPath, GetDeleteTemplateHandler(client, tmplClient))
+	g.GET(v1TemplatesPath, GetGetTemplatesHandler(client, tmplClient))
+	g.GET(v1TemplateSpecPath, GetGetTemplateHandler(client, tmplClient))
+	g.POST(v1TemplateSpecPath, GetPostTemplateHandler(client, tmplClient))
+	g.PUT(v1TemplateSpecPath, GetPutTemplateHandler(client, tmplClient))
+	g.DELETE(v1TemplateSpecPath, GetDeleteTemplateHandler(client, tmplClient))
+}
 
+// serviceStatus is the JSON body of the status handler
+type serviceStatus struct {
+	Service string `json:"service"`
+	Status  string `json:"status"`
 }
 
+// statusHandler responds with plain text to browsers and with JSON to
+// anything else, such as programmatic health checks
 func statusHandler(c echo.Context) error {
-	return c.String(http.StatusOK, "Alertmanager Config server")
+	accept := c.Request().Header.Get(echo.HeaderAccept)
+	if strings.Contains(accept, echo.MIMETextPlain) || strings.Contains(accept, echo.MIMETextHTML) {
+		return c.String(http.StatusOK, "Alertmanager Config server")
+	}
+	return c.JSON(http.StatusOK, serviceStatus{Service: "alertmanager-config-manager", Status: "ok"})
 }
 
 type paramProvider func(c echo.Context) string
@@ -141,6 +270,75 @@ func tenancyMiddlewareProvider(client client.AlertmanagerClient, getTenantID par
 	}
 }
 
+// Returns middleware func that rejects any request that would modify the
+// config with a 403 when the server is read-only
+func readOnlyMiddlewareProvider(readOnly bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !readOnly {
+				return next(c)
+			}
+			switch c.Request().Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+				return echo.NewHTTPError(http.StatusForbidden, "server is in read-only mode")
+			}
+			return next(c)
+		}
+	}
+}
+
+// Returns middleware func that rejects modifications with a 409 if the
+// request's If-Match header doesn't match the hash of the current config.
+// Responses to reads carry the current hash in the ETag header. Since the
+// config can still change before the handler writes it, the hash is also
+// passed on for handlers to check under the client's lock with requestClient.
+func ifMatchMiddlewareProvider(amClient client.AlertmanagerClient) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			method := c.Request().Method
+			if method == http.MethodGet || method == http.MethodHead {
+				if hash, err := amClient.GetConfigHash(); err == nil {
+					c.Response().Header().Set(headerETag, fmt.Sprintf("%q", hash))
+				}
+				return next(c)
+			}
+
+			ifMatch := c.Request().Header.Get(headerIfMatch)
+			if ifMatch == "" || ifMatch == "*" {
+				return next(c)
+			}
+			hash, err := amClient.GetConfigHash()
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			}
+			if strings.Trim(ifMatch, `"`) != hash {
+				return echo.NewHTTPError(http.StatusConflict, client.ErrConfigModified.Error())
+			}
+			c.Set(configHashParam, hash)
+			return next(c)
+		}
+	}
+}
+
+// requestClient returns the client to make a request's modifications with,
+// which enforces the request's If-Match config hash if it has one
+func requestClient(c echo.Context, amClient client.AlertmanagerClient) client.AlertmanagerClient {
+	if hash, ok := c.Get(configHashParam).(string); ok {
+		return amClient.IfMatch(hash)
+	}
+	return amClient
+}
+
+// modifyErrorStatus returns 409 Conflict if a modification failed because the
+// config changed after the request's If-Match hash was read, or status if it
+// failed for any other reason
+func modifyErrorStatus(err error, status int) int {
+	if err == client.ErrConfigModified {
+		return http.StatusConflict
+	}
+	return status
+}
+
 // GetReceiverPostHandler returns a handler function that creates a new
 // receiver and then reloads alertmanager
 func GetReceiverPostHandler(client client.AlertmanagerClient) func(c echo.Context) error {
@@ -148,14 +346,14 @@ func GetReceiverPostHandler(client client.AlertmanagerClient) func(c echo.Contex
 		defer glog.Flush()
 		receiver, err := decodeReceiverPostRequest(c)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			return decodeError(err, http.StatusInternalServerError)
 		}
 		tenantID := c.Get(tenantIDParam).(string)
 		glog.Infof("Configure Receiver: Tenant: %s, receiver: %+v", tenantID, receiver)
 
-		err = client.CreateReceiver(tenantID, receiver)
+		err = requestClient(c, client).CreateReceiver(tenantID, receiver)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			return echo.NewHTTPError(modifyErrorStatus(err, http.StatusBadRequest), err.Error())
 		}
 
 		err = client.ReloadAlertmanager()
@@ -192,9 +390,15 @@ func GetGetReceiversHandler(client client.AlertmanagerClient) func(c echo.Contex
 	}
 }
 
+// GetGetTenantsHandler returns a handler that lists tenants, optionally
+// filtered by the prefix query parameter and paged by limit and offset
 func GetGetTenantsHandler(client client.AlertmanagerClient) func(c echo.Context) error {
 	return func(c echo.Context) error {
-		tenants, err := client.GetTenants()
+		opts, err := tenantListOptions(c)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		tenants, err := client.GetTenants(opts)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 		}
@@ -202,12 +406,47 @@ func GetGetTenantsHandler(client client.AlertmanagerClient) func(c echo.Context)
 	}
 }
 
+// tenantListOptions reads the optional prefix, limit and offset query
+// parameters of a request to list tenants
+func tenantListOptions(c echo.Context) (alert.TenantListOptions, error) {
+	opts := alert.TenantListOptions{Prefix: c.QueryParam(prefixQueryParam)}
+	params := []struct {
+		name  string
+		value *int
+	}{{limitQueryParam, &opts.Limit}, {offsetQueryParam, &opts.Offset}}
+	for _, p := range params {
+		param := c.QueryParam(p.name)
+		if param == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed < 0 {
+			return opts, fmt.Errorf("invalid %s parameter: %s", p.name, param)
+		}
+		*p.value = parsed
+	}
+	return opts, nil
+}
+
 func GetGetTenancyHandler(client client.AlertmanagerClient) func(c echo.Context) error {
 	return func(c echo.Context) error {
 		return c.JSON(http.StatusOK, client.Tenancy())
 	}
 }
 
+// GetConfigIntegrityHandler returns a handler function that reports problems
+// in the config file, such as duplicate receiver names, that can be left by
+// editing it by hand
+func GetConfigIntegrityHandler(client client.AlertmanagerClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		problems, err := client.CheckConfigIntegrity()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(http.StatusOK, problems)
+	}
+}
+
 // GetUpdateReceiverHandler returns a handler function to update a receivers
 func GetUpdateReceiverHandler(client client.AlertmanagerClient, getReceiverName paramProvider) func(c echo.Context) error {
 	return func(c echo.Context) error {
@@ -218,12 +457,12 @@ func GetUpdateReceiverHandler(client client.AlertmanagerClient, getReceiverName
 
 		newReceiver, err := decodeReceiverPostRequest(c)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			return decodeError(err, http.StatusBadRequest)
 		}
 
-		err = client.UpdateReceiver(tenantID, receiverName, &newReceiver)
+		err = requestClient(c, client).UpdateReceiver(tenantID, receiverName, &newReceiver)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			return echo.NewHTTPError(modifyErrorStatus(err, http.StatusBadRequest), err.Error())
 		}
 
 		err = client.ReloadAlertmanager()
@@ -240,9 +479,9 @@ func GetDeleteReceiverHandler(client client.AlertmanagerClient, getReceiverName
 		tenantID := c.Get(tenantIDParam).(string)
 		glog.Infof("Delete Receiver: Tenant: %s, receiver: %s", tenantID, getReceiverName(c))
 
-		err := client.DeleteReceiver(tenantID, getReceiverName(c))
+		err := requestClient(c, client).DeleteReceiver(tenantID, getReceiverName(c))
 		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			return deleteReceiverError(err)
 		}
 
 		err = client.ReloadAlertmanager()
@@ -253,6 +492,26 @@ func GetDeleteReceiverHandler(client client.AlertmanagerClient, getReceiverName
 	}
 }
 
+// receiverReferencedResponse is the body of the 409 returned when deleting a
+// receiver that routes still reference
+type receiverReferencedResponse struct {
+	Message string   `json:"message"`
+	Paths   []string `json:"paths"`
+}
+
+// deleteReceiverError returns a 409 listing the referencing route paths if
+// the receiver is still in use, otherwise the usual error status
+func deleteReceiverError(err error) error {
+	var referencedErr client.ReceiverReferencedError
+	if errors.As(err, &referencedErr) {
+		return echo.NewHTTPError(http.StatusConflict, receiverReferencedResponse{
+			Message: err.Error(),
+			Paths:   referencedErr.Paths,
+		})
+	}
+	return echo.NewHTTPError(modifyErrorStatus(err, http.StatusBadRequest), err.Error())
+}
+
 func GetGetRouteHandler(client client.AlertmanagerClient) func(c echo.Context) error {
 	return func(c echo.Context) error {
 		defer glog.Flush()
@@ -261,12 +520,37 @@ func GetGetRouteHandler(client client.AlertmanagerClient) func(c echo.Context) e
 
 		route, err := client.GetRoute(tenantID)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			return echo.NewHTTPError(getRouteErrorStatus(err), err.Error())
 		}
 		return c.JSON(http.StatusOK, *route)
 	}
 }
 
+// getRouteErrorStatus returns 404 if the tenant has no route, and 500 for
+// failures reading the config
+func getRouteErrorStatus(err error) int {
+	if errors.Is(err, client.ErrRouteNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// GetGetTenantConfigHandler returns a handler that previews the tenant's
+// routing tree and receivers as a standalone alertmanager config
+func GetGetTenantConfigHandler(client client.AlertmanagerClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		defer glog.Flush()
+		tenantID := c.Get(tenantIDParam).(string)
+		glog.Infof("Get Config Preview: Tenant: %s", tenantID)
+
+		conf, err := client.GetTenantConfigPreview(tenantID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(http.StatusOK, *conf)
+	}
+}
+
 func GetUpdateRouteHandler(client client.AlertmanagerClient) func(c echo.Context) error {
 	return func(c echo.Context) error {
 		defer glog.Flush()
@@ -275,12 +559,84 @@ func GetUpdateRouteHandler(client client.AlertmanagerClient) func(c echo.Context
 
 		newRoute, err := decodeRoutePostRequest(c)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			return decodeError(err, http.StatusBadRequest)
+		}
+		err = requestClient(c, client).ModifyTenantRoute(tenantID, &newRoute)
+		if err != nil {
+			return echo.NewHTTPError(modifyErrorStatus(err, http.StatusBadRequest), err.Error())
+		}
+
+		err = client.ReloadAlertmanager()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.NoContent(http.StatusOK)
+	}
+}
+
+// GetValidateRouteHandler returns a handler function that checks a route the
+// way GetUpdateRouteHandler would apply it, without modifying the config
+func GetValidateRouteHandler(client client.AlertmanagerClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		defer glog.Flush()
+		tenantID := c.Get(tenantIDParam).(string)
+		glog.Infof("Validate Route: Tenant: %s", tenantID)
+
+		newRoute, err := decodeRoutePostRequest(c)
+		if err != nil {
+			return decodeError(err, http.StatusBadRequest)
 		}
-		err = client.ModifyTenantRoute(tenantID, &newRoute)
+		err = client.ValidateTenantRoute(tenantID, &newRoute)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 		}
+		return c.NoContent(http.StatusOK)
+	}
+}
+
+// routeSimulation is the JSON body of a request simulating the routing of an
+// alert, and of its response
+type routeSimulation struct {
+	Labels    map[string]string `json:"labels,omitempty"`
+	Receivers []string          `json:"receivers,omitempty"`
+}
+
+// GetSimulateRouteHandler returns a handler function that responds with the
+// receivers an alert with the labels in the request would be sent to by the
+// tenant's routing tree
+func GetSimulateRouteHandler(client client.AlertmanagerClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		defer glog.Flush()
+		tenantID := c.Get(tenantIDParam).(string)
+
+		simulation := routeSimulation{}
+		err := json.NewDecoder(c.Request().Body).Decode(&simulation)
+		if err != nil {
+			return decodeError(fmt.Errorf("error unmarshalling payload: %w", err), http.StatusBadRequest)
+		}
+		glog.Infof("Simulate Route: Tenant: %s, labels: %v", tenantID, simulation.Labels)
+
+		receivers, err := client.SimulateRoute(tenantID, simulation.Labels)
+		if err != nil {
+			return echo.NewHTTPError(getRouteErrorStatus(err), err.Error())
+		}
+		return c.JSON(http.StatusOK, routeSimulation{Receivers: receivers})
+	}
+}
+
+// GetProvisionTenantHandler returns a handler function that provisions a new
+// tenant with the default receivers and routing tree and then reloads
+// alertmanager
+func GetProvisionTenantHandler(client client.AlertmanagerClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		defer glog.Flush()
+		tenantID := c.Get(tenantIDParam).(string)
+		glog.Infof("Provision Tenant: Tenant: %s", tenantID)
+
+		err := requestClient(c, client).ProvisionTenantDefaults(tenantID)
+		if err != nil {
+			return echo.NewHTTPError(modifyErrorStatus(err, http.StatusBadRequest), err.Error())
+		}
 
 		err = client.ReloadAlertmanager()
 		if err != nil {
@@ -296,11 +652,11 @@ func GetUpdateGlobalConfigHandler(client client.AlertmanagerClient) func(c echo.
 		glog.Infof("Update Global Config")
 		newGlobalConfig, err := decodeGlobalConfigPostRequest(c)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			return decodeError(err, http.StatusBadRequest)
 		}
-		err = client.SetGlobalConfig(newGlobalConfig)
+		err = requestClient(c, client).SetGlobalConfig(newGlobalConfig)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			return echo.NewHTTPError(modifyErrorStatus(err, http.StatusBadRequest), err.Error())
 		}
 
 		err = client.ReloadAlertmanager()
@@ -323,11 +679,58 @@ func GetGetGlobalConfigHandler(client client.AlertmanagerClient) func(c echo.Con
 	}
 }
 
+// GetUpdateGlobalRouteHandler returns a handler function that replaces the
+// top-level route, leaving the tenant routes below it untouched
+func GetUpdateGlobalRouteHandler(client client.AlertmanagerClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		defer glog.Flush()
+		glog.Infof("Update Global Route")
+		newRoute, err := decodeRoutePostRequest(c)
+		if err != nil {
+			return decodeError(err, http.StatusBadRequest)
+		}
+		err = requestClient(c, client).SetGlobalRoute(newRoute)
+		if err != nil {
+			return echo.NewHTTPError(modifyErrorStatus(err, http.StatusBadRequest), err.Error())
+		}
+
+		err = client.ReloadAlertmanager()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.NoContent(http.StatusOK)
+	}
+}
+
+// GetGetGlobalRouteHandler returns a handler function that responds with the
+// top-level route, without the tenant routes below it
+func GetGetGlobalRouteHandler(client client.AlertmanagerClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		defer glog.Flush()
+		glog.Infof("Get Global Route")
+		route, err := client.GetGlobalRoute()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(http.StatusOK, route)
+	}
+}
+
+// decodeError returns the HTTP error for a request body that couldn't be
+// decoded. Bodies over the server's size limit are rejected with 413 instead
+// of the given status.
+func decodeError(err error, status int) *echo.HTTPError {
+	if errors.Is(err, echo.ErrStatusRequestEntityTooLarge) {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+	}
+	return echo.NewHTTPError(status, err.Error())
+}
+
 func decodeGlobalConfigPostRequest(c echo.Context) (config.GlobalConfig, error) {
 	body, err := ioutil.ReadAll(c.Request().Body)
 	if err != nil {
 		glog.Errorf("error decoding global config: %v", err)
-		return config.GlobalConfig{}, fmt.Errorf("error reading request body: %v", err)
+		return config.GlobalConfig{}, fmt.Errorf("error reading request body: %w", err)
 	}
 	globalConfig := config.GlobalConfig{}
 	err = json.Unmarshal(body, &globalConfig)
@@ -342,30 +745,33 @@ func decodeReceiverPostRequest(c echo.Context) (config.Receiver, error) {
 	body, err := ioutil.ReadAll(c.Request().Body)
 	if err != nil {
 		glog.Errorf("error decoding receiver config: %v", err)
-		return config.Receiver{}, fmt.Errorf("error reading request body: %v", err)
+		return config.Receiver{}, fmt.Errorf("error reading request body: %w", err)
 	}
 	receiver := config.Receiver{}
 	err = json.Unmarshal(body, &receiver)
-	if err == nil {
-		return receiver, nil
-	}
-
-	// Try to unmarshal into the ReceiverJSONWrapper struct if prometheus struct doesn't work
-	jsonPayload := config.ReceiverJSONWrapper{}
-	err = json.Unmarshal(body, &jsonPayload)
 	if err != nil {
-		glog.Errorf("error decoding receiver config: %v", err)
-		return receiver, fmt.Errorf("error unmarshalling payload: %v", err)
+		// Try to unmarshal into the ReceiverJSONWrapper struct if prometheus struct doesn't work
+		jsonPayload := config.ReceiverJSONWrapper{}
+		err = json.Unmarshal(body, &jsonPayload)
+		if err != nil {
+			glog.Errorf("error decoding receiver config: %v", err)
+			return receiver, fmt.Errorf("error unmarshalling payload: %v", err)
+		}
+		receiver, err = jsonPayload.ToReceiverFmt()
+		if err != nil {
+			return receiver, err
+		}
 	}
 
-	return jsonPayload.ToReceiverFmt()
+	err = receiver.ApplyLegacyNotifierConfigs(body)
+	return receiver, err
 }
 
 func decodeRoutePostRequest(c echo.Context) (config.Route, error) {
 	body, err := ioutil.ReadAll(c.Request().Body)
 	if err != nil {
 		glog.Errorf("error decoding route config: %v", err)
-		return config.Route{}, fmt.Errorf("error reading request body: %v", err)
+		return config.Route{}, fmt.Errorf("error reading request body: %w", err)
 	}
 	route := config.Route{}
 	err = json.Unmarshal(body, &route)
@@ -10,6 +10,7 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -17,13 +18,17 @@ import (
 	"strings"
 	"testing"
 
+	amclient "github.com/facebookincubator/prometheus-configmanager/alertmanager/client"
 	"github.com/facebookincubator/prometheus-configmanager/alertmanager/client/mocks"
 	"github.com/facebookincubator/prometheus-configmanager/alertmanager/config"
 	"github.com/facebookincubator/prometheus-configmanager/prometheus/alert"
+	"github.com/facebookincubator/prometheus-configmanager/version"
 
 	"github.com/labstack/echo"
+	"github.com/labstack/echo/middleware"
 	amconfig "github.com/prometheus/alertmanager/config"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 const (
@@ -217,6 +222,22 @@ func TestGetDeleteReceiverHandler(t *testing.T) {
 	assert.EqualError(t, err, `code=400, message=error`)
 	client.AssertExpectations(t)
 
+	// Receiver still referenced by routes
+	client = &mocks.AlertmanagerClient{}
+	referencedErr := amclient.ReceiverReferencedError{Receiver: sampleReceiver.Name, Paths: []string{"route.routes[0].routes[1]"}}
+	client.On("DeleteReceiver", testNID, sampleReceiver.Name).Return(referencedErr)
+	c, _ = buildContext(nil, http.MethodGet, "/", v1receiverPath, testNID)
+	c.SetParamNames(receiverNameParam)
+	c.SetParamValues(sampleReceiver.Name)
+
+	err = GetDeleteReceiverHandler(client, receiverNamePathProvider)(c)
+	assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+	assert.Equal(t, receiverReferencedResponse{
+		Message: referencedErr.Error(),
+		Paths:   []string{"route.routes[0].routes[1]"},
+	}, err.(*echo.HTTPError).Message)
+	client.AssertExpectations(t)
+
 	// Alertmanager Error
 	client = &mocks.AlertmanagerClient{}
 	client.On("DeleteReceiver", testNID, sampleReceiver.Name).Return(nil)
@@ -247,14 +268,64 @@ func TestGetGetRouteHandler(t *testing.T) {
 	assert.Equal(t, sampleRoute, retrievedRoute)
 	client.AssertExpectations(t)
 
-	// Client Error
+	// Route not found
+	client = &mocks.AlertmanagerClient{}
+	client.On("GetRoute", testNID).Return(nil, fmt.Errorf("tenant test: %w", amclient.ErrRouteNotFound))
+	c, _ = buildContext(nil, http.MethodGet, "/", v1routePath, testNID)
+
+	err = GetGetRouteHandler(client)(c)
+	assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+	assert.EqualError(t, err, `code=404, message=tenant test: route does not exist`)
+	client.AssertExpectations(t)
+
+	// Read Error
 	client = &mocks.AlertmanagerClient{}
 	client.On("GetRoute", testNID).Return(nil, errors.New("error"))
 	c, _ = buildContext(nil, http.MethodGet, "/", v1routePath, testNID)
 
 	err = GetGetRouteHandler(client)(c)
+	assert.Equal(t, http.StatusInternalServerError, err.(*echo.HTTPError).Code)
+	assert.EqualError(t, err, `code=500, message=error`)
+	client.AssertExpectations(t)
+
+	// Missing tenant
+	client = &mocks.AlertmanagerClient{}
+	client.On("Tenancy").Return(&alert.TenancyConfig{RestrictorLabel: "tenantID"})
+	c, _ = buildContext(nil, http.MethodGet, "/", v1routePath, "")
+
+	err = tenancyMiddlewareProvider(client, pathTenantProvider)(GetGetRouteHandler(client))(c)
 	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
-	assert.EqualError(t, err, `code=400, message=error`)
+	client.AssertNotCalled(t, "GetRoute", mock.Anything)
+}
+
+func TestGetGetTenantConfigHandler(t *testing.T) {
+	// Successful Get
+	sampleConfig := config.Config{
+		Route:     &sampleRoute,
+		Receivers: []*config.Receiver{&sampleReceiver},
+	}
+	client := &mocks.AlertmanagerClient{}
+	client.On("GetTenantConfigPreview", testNID).Return(&sampleConfig, nil)
+	c, rec := buildContext(nil, http.MethodGet, "/", v1ConfigPath, testNID)
+
+	err := GetGetTenantConfigHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var retrievedConfig config.Config
+	body, _ := ioutil.ReadAll(rec.Body)
+	err = json.Unmarshal(body, &retrievedConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, sampleRoute, *retrievedConfig.Route)
+	assert.Equal(t, sampleReceiver.Name, retrievedConfig.Receivers[0].Name)
+	client.AssertExpectations(t)
+
+	// Client Error
+	client = &mocks.AlertmanagerClient{}
+	client.On("GetTenantConfigPreview", testNID).Return(nil, errors.New("error"))
+	c, _ = buildContext(nil, http.MethodGet, "/", v1ConfigPath, testNID)
+
+	err = GetGetTenantConfigHandler(client)(c)
+	assert.EqualError(t, err, `code=500, message=error`)
 	client.AssertExpectations(t)
 }
 
@@ -292,6 +363,81 @@ func TestGetUpdateRouteHandler(t *testing.T) {
 	client.AssertExpectations(t)
 }
 
+func TestGetValidateRouteHandler(t *testing.T) {
+	client := &mocks.AlertmanagerClient{}
+	client.On("ValidateTenantRoute", testNID, &sampleRoute).Return(nil)
+	c, rec := buildContext(sampleRoute, http.MethodPost, "/", v1RouteValidatePath, testNID)
+
+	err := GetValidateRouteHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	client.AssertExpectations(t)
+	client.AssertNotCalled(t, "ReloadAlertmanager")
+
+	client = &mocks.AlertmanagerClient{}
+	client.On("ValidateTenantRoute", testNID, &sampleRoute).Return(errors.New("route base receiver is incorrect"))
+	c, _ = buildContext(sampleRoute, http.MethodPost, "/", v1RouteValidatePath, testNID)
+
+	err = GetValidateRouteHandler(client)(c)
+	assert.EqualError(t, err, `code=400, message=route base receiver is incorrect`)
+	client.AssertExpectations(t)
+}
+
+func TestGetSimulateRouteHandler(t *testing.T) {
+	labels := map[string]string{"severity": "critical"}
+	client := &mocks.AlertmanagerClient{}
+	client.On("SimulateRoute", testNID, labels).Return([]string{"pager", "slack"}, nil)
+	c, rec := buildContext(routeSimulation{Labels: labels}, http.MethodPost, "/", v1RouteSimulatePath, testNID)
+
+	err := GetSimulateRouteHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"receivers": ["pager", "slack"]}`, rec.Body.String())
+	client.AssertExpectations(t)
+
+	client = &mocks.AlertmanagerClient{}
+	client.On("SimulateRoute", testNID, labels).Return(nil, fmt.Errorf("tenant %s: %w", testNID, amclient.ErrRouteNotFound))
+	c, _ = buildContext(routeSimulation{Labels: labels}, http.MethodPost, "/", v1RouteSimulatePath, testNID)
+
+	err = GetSimulateRouteHandler(client)(c)
+	assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+	client.AssertExpectations(t)
+}
+
+func TestGetProvisionTenantHandler(t *testing.T) {
+	// Successful Provision
+	client := &mocks.AlertmanagerClient{}
+	client.On("ProvisionTenantDefaults", testNID).Return(nil)
+	client.On("ReloadAlertmanager").Return(nil)
+	c, rec := buildContext(nil, http.MethodPost, "/", v1ProvisionPath, testNID)
+
+	err := GetProvisionTenantHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	client.AssertExpectations(t)
+
+	// Client Error
+	client = &mocks.AlertmanagerClient{}
+	client.On("ProvisionTenantDefaults", testNID).Return(errors.New("error"))
+	c, _ = buildContext(nil, http.MethodPost, "/", v1ProvisionPath, testNID)
+
+	err = GetProvisionTenantHandler(client)(c)
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	assert.EqualError(t, err, `code=400, message=error`)
+	client.AssertExpectations(t)
+
+	// Alertmanager Error
+	client = &mocks.AlertmanagerClient{}
+	client.On("ProvisionTenantDefaults", testNID).Return(nil)
+	client.On("ReloadAlertmanager").Return(errors.New("error"))
+	c, _ = buildContext(nil, http.MethodPost, "/", v1ProvisionPath, testNID)
+
+	err = GetProvisionTenantHandler(client)(c)
+	assert.Equal(t, http.StatusInternalServerError, err.(*echo.HTTPError).Code)
+	assert.EqualError(t, err, `code=500, message=error`)
+	client.AssertExpectations(t)
+}
+
 func TestGetGetGlobalConfigHandler(t *testing.T) {
 	defaultConfig := config.DefaultGlobalConfig()
 	// Successful Get
@@ -354,6 +500,91 @@ func TestGetUpdateGlobalConfigHandler(t *testing.T) {
 	client.AssertExpectations(t)
 }
 
+func TestGetGetGlobalRouteHandler(t *testing.T) {
+	globalRoute := config.Route{Receiver: "null_receiver", GroupByStr: []string{"alertname"}, GroupWait: "10s"}
+	// Successful Get
+	client := &mocks.AlertmanagerClient{}
+	client.On("GetGlobalRoute").Return(&globalRoute, nil)
+	c, rec := buildContext(nil, http.MethodGet, "/", v1routePath, "")
+
+	err := GetGetGlobalRouteHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var retrievedRoute config.Route
+	body, _ := ioutil.ReadAll(rec.Body)
+	err = json.Unmarshal(body, &retrievedRoute)
+	assert.NoError(t, err)
+	assert.Equal(t, globalRoute, retrievedRoute)
+	client.AssertExpectations(t)
+
+	// Client Error
+	client = &mocks.AlertmanagerClient{}
+	client.On("GetGlobalRoute").Return(nil, errors.New("error"))
+	c, _ = buildContext(nil, http.MethodGet, "/", v1routePath, "")
+
+	err = GetGetGlobalRouteHandler(client)(c)
+	assert.Equal(t, http.StatusInternalServerError, err.(*echo.HTTPError).Code)
+	assert.EqualError(t, err, `code=500, message=error`)
+	client.AssertExpectations(t)
+}
+
+func TestGetUpdateGlobalRouteHandler(t *testing.T) {
+	globalRoute := config.Route{Receiver: "null_receiver", GroupByStr: []string{"alertname"}, GroupWait: "30s"}
+	// Successful Update
+	client := &mocks.AlertmanagerClient{}
+	client.On("SetGlobalRoute", globalRoute).Return(nil)
+	client.On("ReloadAlertmanager").Return(nil)
+	c, rec := buildContext(globalRoute, http.MethodPut, "/", v1routePath, "")
+
+	err := GetUpdateGlobalRouteHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	client.AssertExpectations(t)
+
+	// Client Error
+	client = &mocks.AlertmanagerClient{}
+	client.On("SetGlobalRoute", globalRoute).Return(errors.New("error"))
+	c, _ = buildContext(globalRoute, http.MethodPut, "/", v1routePath, "")
+
+	err = GetUpdateGlobalRouteHandler(client)(c)
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	assert.EqualError(t, err, `code=400, message=error`)
+	client.AssertExpectations(t)
+
+	// Alertmanager Error
+	client = &mocks.AlertmanagerClient{}
+	client.On("SetGlobalRoute", globalRoute).Return(nil)
+	client.On("ReloadAlertmanager").Return(errors.New("error"))
+	c, _ = buildContext(globalRoute, http.MethodPut, "/", v1routePath, "")
+
+	err = GetUpdateGlobalRouteHandler(client)(c)
+	assert.Equal(t, http.StatusInternalServerError, err.(*echo.HTTPError).Code)
+	assert.EqualError(t, err, `code=500, message=error`)
+	client.AssertExpectations(t)
+}
+
+func TestGetGetTenantsHandler(t *testing.T) {
+	client := &mocks.AlertmanagerClient{}
+	client.On("GetTenants", alert.TenantListOptions{}).Return([]string{"other", "test"}, nil)
+	client.On("GetTenants", alert.TenantListOptions{Prefix: "te", Limit: 1, Offset: 2}).Return([]string{"test3"}, nil)
+
+	c, rec := buildContext(nil, http.MethodGet, "/", v1TenantPath, "")
+	err := GetGetTenantsHandler(client)(c)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `["other", "test"]`, rec.Body.String())
+
+	c, rec = buildContext(nil, http.MethodGet, "/?prefix=te&limit=1&offset=2", v1TenantPath, "")
+	err = GetGetTenantsHandler(client)(c)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `["test3"]`, rec.Body.String())
+	client.AssertExpectations(t)
+
+	// Invalid paging parameters
+	c, _ = buildContext(nil, http.MethodGet, "/?limit=many", v1TenantPath, "")
+	err = GetGetTenantsHandler(client)(c)
+	assert.EqualError(t, err, `code=400, message=invalid limit parameter: many`)
+}
+
 func TestGetGetTenancyHandler(t *testing.T) {
 	client := &mocks.AlertmanagerClient{}
 	client.On("Tenancy").Return(&alert.TenancyConfig{RestrictorLabel: "", RestrictQueries: false})
@@ -365,6 +596,24 @@ func TestGetGetTenancyHandler(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestGetConfigIntegrityHandler(t *testing.T) {
+	client := &mocks.AlertmanagerClient{}
+	client.On("CheckConfigIntegrity").Return([]string{"duplicate receiver name: slack"}, nil)
+	c, rec := buildContext(nil, http.MethodGet, "/", v1IntegrityPath, "")
+
+	err := GetConfigIntegrityHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `["duplicate receiver name: slack"]`, rec.Body.String())
+
+	client = &mocks.AlertmanagerClient{}
+	client.On("CheckConfigIntegrity").Return(nil, errors.New("error"))
+	c, _ = buildContext(nil, http.MethodGet, "/", v1IntegrityPath, "")
+
+	err = GetConfigIntegrityHandler(client)(c)
+	assert.EqualError(t, err, `code=500, message=error`)
+}
+
 func TestDecodeReceiverPostRequest(t *testing.T) {
 	// Successful Decode
 	c, _ := buildContext(sampleReceiver, http.MethodPost, "/", v1receiverPath, testNID)
@@ -380,6 +629,30 @@ func TestDecodeReceiverPostRequest(t *testing.T) {
 	assert.EqualError(t, err, `error unmarshalling payload: json: cannot unmarshal bool into Go struct field ReceiverJSONWrapper.name of type string`)
 }
 
+func TestWebhookSendResolved(t *testing.T) {
+	var created config.Receiver
+	client := &mocks.AlertmanagerClient{}
+	client.On("CreateReceiver", testNID, mock.Anything).Return(nil).
+		Run(func(args mock.Arguments) { created = args[1].(config.Receiver) })
+	client.On("ReloadAlertmanager").Return(nil)
+	client.On("GetReceivers", testNID).Return(func(string) []config.Receiver {
+		return []config.Receiver{created}
+	}, nil)
+
+	body := `{"name": "webhook", "webhook_configs": [{"send_resolved": true, "url": "http://test.com"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	c.Set(tenantIDParam, testNID)
+	assert.NoError(t, GetReceiverPostHandler(client)(c))
+	assert.True(t, created.WebhookConfigs[0].VSendResolved)
+
+	c, rec := buildContext(nil, http.MethodGet, "/", v1receiverNamePath, testNID)
+	c.SetParamNames(tenantIDParam, receiverNameParam)
+	c.SetParamValues(testNID, "webhook")
+	assert.NoError(t, GetGetReceiversHandler(client)(c))
+	assert.JSONEq(t, body, rec.Body.String())
+}
+
 func TestDecodeRoutePostRequest(t *testing.T) {
 	// Successful Decode
 	c, _ := buildContext(sampleRoute, http.MethodPost, "/", v1receiverPath, testNID)
@@ -449,6 +722,258 @@ func (tc *tenancyTestCase) runTest(t *testing.T) {
 	}
 }
 
+func TestIfMatchMiddleware(t *testing.T) {
+	const hash = "abc123"
+	handler := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+
+	// Matching hash
+	client := &mocks.AlertmanagerClient{}
+	client.On("GetConfigHash").Return(hash, nil)
+	c, rec := buildContext(nil, http.MethodPost, "/", v1routePath, testNID)
+	c.Request().Header.Set(headerIfMatch, `"abc123"`)
+	err := ifMatchMiddlewareProvider(client)(handler)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, hash, c.Get(configHashParam))
+	client.AssertExpectations(t)
+
+	// Mismatched hash
+	c, _ = buildContext(nil, http.MethodPost, "/", v1routePath, testNID)
+	c.Request().Header.Set(headerIfMatch, `"stale"`)
+	err = ifMatchMiddlewareProvider(client)(handler)(c)
+	assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+
+	// No If-Match header doesn't check hash
+	client = &mocks.AlertmanagerClient{}
+	c, rec = buildContext(nil, http.MethodDelete, "/", v1routePath, testNID)
+	err = ifMatchMiddlewareProvider(client)(handler)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	client.AssertNotCalled(t, "GetConfigHash")
+
+	// Error getting hash
+	client = &mocks.AlertmanagerClient{}
+	client.On("GetConfigHash").Return("", errors.New("error"))
+	c, _ = buildContext(nil, http.MethodPut, "/", v1routePath, testNID)
+	c.Request().Header.Set(headerIfMatch, hash)
+	err = ifMatchMiddlewareProvider(client)(handler)(c)
+	assert.Equal(t, http.StatusInternalServerError, err.(*echo.HTTPError).Code)
+
+	// Reads get the hash as ETag
+	client = &mocks.AlertmanagerClient{}
+	client.On("GetConfigHash").Return(hash, nil)
+	c, rec = buildContext(nil, http.MethodGet, "/", v1routePath, testNID)
+	err = ifMatchMiddlewareProvider(client)(handler)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, `"abc123"`, rec.Header().Get(headerETag))
+}
+
+func TestIfMatchCheckedByClient(t *testing.T) {
+	const hash = "abc123"
+
+	// Modification goes through a client that checks the hash under its lock
+	ifMatchClient := &mocks.AlertmanagerClient{}
+	ifMatchClient.On("CreateReceiver", testNID, sampleReceiver).Return(nil)
+	client := &mocks.AlertmanagerClient{}
+	client.On("IfMatch", hash).Return(ifMatchClient)
+	client.On("ReloadAlertmanager").Return(nil)
+	c, rec := buildContext(sampleReceiver, http.MethodPost, "/", v1receiverPath, testNID)
+	c.Set(configHashParam, hash)
+
+	err := GetReceiverPostHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	client.AssertExpectations(t)
+	ifMatchClient.AssertExpectations(t)
+
+	// Config modified between the middleware check and the write
+	ifMatchClient = &mocks.AlertmanagerClient{}
+	ifMatchClient.On("ModifyTenantRoute", testNID, mock.Anything).Return(amclient.ErrConfigModified)
+	client = &mocks.AlertmanagerClient{}
+	client.On("IfMatch", hash).Return(ifMatchClient)
+	c, _ = buildContext(config.Route{Receiver: "receiver"}, http.MethodPost, "/", v1routePath, testNID)
+	c.Set(configHashParam, hash)
+
+	err = GetUpdateRouteHandler(client)(c)
+	assert.Equal(t, http.StatusConflict, err.(*echo.HTTPError).Code)
+	assert.EqualError(t, err, `code=409, message=Config has been modified since it was last read`)
+	client.AssertExpectations(t)
+	client.AssertNotCalled(t, "ReloadAlertmanager")
+}
+
+func TestStatusHandler(t *testing.T) {
+	e := echo.New()
+	RegisterBaseHandlers(e)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"service": "alertmanager-config-manager", "status": "ok"}`, rec.Body.String())
+
+	// Browsers get plain text
+	for _, accept := range []string{"text/plain", "text/html,application/xhtml+xml,*/*;q=0.8"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderAccept, accept)
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "Alertmanager Config server", rec.Body.String())
+	}
+}
+
+func TestVersionHandler(t *testing.T) {
+	defer func(v, commit, date string) {
+		version.Version, version.Commit, version.BuildDate = v, commit, date
+	}(version.Version, version.Commit, version.BuildDate)
+	version.Version, version.Commit, version.BuildDate = "1.2.3", "abc123", "2020-09-01"
+
+	e := echo.New()
+	RegisterBaseHandlers(e)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, versionPath, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var info version.Info
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &info))
+	assert.Equal(t, version.Info{Version: "1.2.3", Commit: "abc123", BuildDate: "2020-09-01"}, info)
+}
+
+func TestGetRoutesInfoHandler(t *testing.T) {
+	e := echo.New()
+	RegisterBaseHandlers(e)
+	client := &mocks.AlertmanagerClient{}
+	client.On("Tenancy").Return(nil)
+	RegisterV0Handlers(e, client, false)
+	RegisterV1Handlers(e, client, &mocks.TemplateClient{}, false)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, routesInfoPath, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var routes []echo.Route
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &routes))
+	registered := map[string]bool{}
+	for _, route := range routes {
+		registered[route.Method+" "+route.Path] = true
+	}
+	for _, expected := range []string{
+		"POST /:tenant_id/receiver",
+		"POST /v1/:tenant_id/receiver",
+		"GET /v1/:tenant_id/route",
+		"POST /v1/receiver",
+		"GET /v1/route",
+		"GET /v1/tenancy",
+		"GET /v1/routes-info",
+	} {
+		assert.True(t, registered[expected], "missing route %s", expected)
+	}
+}
+
+func TestSingleTenantMode(t *testing.T) {
+	client := &mocks.AlertmanagerClient{}
+	client.On("Tenancy").Return(nil)
+	client.On("GetConfigHash").Return("abc123", nil)
+	client.On("CreateReceiver", "", sampleReceiver).Return(nil)
+	client.On("GetReceivers", "").Return([]config.Receiver{sampleReceiver}, nil)
+	client.On("ReloadAlertmanager").Return(nil)
+
+	e := echo.New()
+	RegisterV1Handlers(e, client, &mocks.TemplateClient{}, false)
+
+	// Receivers are reachable without a tenant path
+	body, _ := json.Marshal(sampleReceiver)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/receiver", strings.NewReader(string(body))))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	client.AssertCalled(t, "CreateReceiver", "", sampleReceiver)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/receiver", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var recs []config.Receiver
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &recs))
+	assert.Equal(t, 1, len(recs))
+	assert.Equal(t, sampleReceiver.Name, recs[0].Name)
+
+	// The routes aren't registered when tenancy is configured
+	client = &mocks.AlertmanagerClient{}
+	client.On("Tenancy").Return(&alert.TenancyConfig{RestrictorLabel: "tenantID"})
+	e = echo.New()
+	RegisterV1Handlers(e, client, &mocks.TemplateClient{}, false)
+	for _, route := range e.Routes() {
+		assert.NotEqual(t, "/v1/receiver", route.Path)
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	client := &mocks.AlertmanagerClient{}
+	client.On("Tenancy").Return(&alert.TenancyConfig{RestrictorLabel: "tenantID"})
+	tmplClient := &mocks.TemplateClient{}
+	e := echo.New()
+	e.Use(middleware.BodyLimit("1K"))
+	RegisterV1Handlers(e, client, tmplClient, false)
+	oversized := fmt.Sprintf(`{"name": "%s"}`, strings.Repeat("a", 2048))
+
+	// Bodies with a known length are rejected before reaching the handler
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/test/receiver", strings.NewReader(oversized)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	// Bodies of unknown length are rejected while they're decoded
+	for _, path := range []string{"/v1/test/receiver", "/v1/test/route", "/v1/global"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(oversized))
+		req.ContentLength = -1
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code, path)
+	}
+	client.AssertNotCalled(t, "CreateReceiver", mock.Anything, mock.Anything)
+	client.AssertNotCalled(t, "SetGlobalConfig", mock.Anything)
+}
+
+func TestReadOnlyMode(t *testing.T) {
+	client := &mocks.AlertmanagerClient{}
+	client.On("Tenancy").Return(&alert.TenancyConfig{RestrictorLabel: "tenantID"})
+	client.On("GetConfigHash").Return("abc123", nil)
+	client.On("GetReceivers", testNID).Return([]config.Receiver{sampleReceiver}, nil)
+	tmplClient := &mocks.TemplateClient{}
+
+	e := echo.New()
+	RegisterV0Handlers(e, client, true)
+	RegisterV1Handlers(e, client, tmplClient, true)
+
+	// Modifications are rejected before reaching the clients
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(method, "/v1/test/receiver/testSlackReceiver", strings.NewReader("{}")))
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/test/receiver", strings.NewReader("{}")))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/global", strings.NewReader("{}")))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/test/receiver", strings.NewReader("{}")))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	client.AssertNotCalled(t, "CreateReceiver", mock.Anything, mock.Anything)
+	client.AssertNotCalled(t, "SetGlobalConfig", mock.Anything)
+
+	// Reads are still served
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/test/receiver", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/tenancy", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Nothing is rejected when not read-only
+	handler := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	c, _ := buildContext(nil, http.MethodPost, "/", v1receiverPath, testNID)
+	assert.NoError(t, readOnlyMiddlewareProvider(false)(handler)(c))
+}
+
 func buildContext(body interface{}, method, target, path, tenantID string) (echo.Context, *httptest.ResponseRecorder) {
 	bytes, _ := json.Marshal(body)
 	req := httptest.NewRequest(method, target, strings.NewReader(string(bytes)))
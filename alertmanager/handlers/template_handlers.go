@@ -8,17 +8,22 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 
 	"github.com/facebookincubator/prometheus-configmanager/alertmanager/client"
 	"github.com/labstack/echo"
+	amtemplate "github.com/prometheus/alertmanager/template"
 )
 
 func GetGetTemplateFileHandler(amClient client.AlertmanagerClient, tmplClient client.TemplateClient) func(c echo.Context) error {
 	return func(c echo.Context) error {
 		filename := c.Get(templateFilenameParam).(string)
+		tmplClient := requestTemplateClient(c, tmplClient)
 		exists, err := fileExists(amClient, tmplClient, filename)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
@@ -38,6 +43,7 @@ func GetGetTemplateFileHandler(amClient client.AlertmanagerClient, tmplClient cl
 func GetPostTemplateFileHandler(amClient client.AlertmanagerClient, tmplClient client.TemplateClient) func(c echo.Context) error {
 	return func(c echo.Context) error {
 		filename := c.Get(templateFilenameParam).(string)
+		tmplClient := requestTemplateClient(c, tmplClient)
 
 		exists, err := fileExists(amClient, tmplClient, filename)
 		if err != nil {
@@ -49,7 +55,7 @@ func GetPostTemplateFileHandler(amClient client.AlertmanagerClient, tmplClient c
 
 		body, err := readStringBody(c)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			return decodeError(err, http.StatusInternalServerError)
 		}
 
 		err = tmplClient.CreateTemplateFile(filename, body)
@@ -57,9 +63,62 @@ func GetPostTemplateFileHandler(amClient client.AlertmanagerClient, tmplClient c
 			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("error creating template file: %v", err))
 		}
 
-		err = amClient.AddTemplateFile(getFullFilePath(filename, tmplClient))
+		err = requestClient(c, amClient).AddTemplateFile(getFullFilePath(filename, tmplClient))
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("error creating template file: %v", err))
+			if err == client.ErrConfigModified {
+				// the file isn't referenced by the config, so don't leave it behind
+				_ = tmplClient.DeleteTemplateFile(filename)
+			}
+			return echo.NewHTTPError(modifyErrorStatus(err, http.StatusInternalServerError), fmt.Sprintf("error creating template file: %v", err))
+		}
+
+		return c.String(http.StatusOK, "Created")
+	}
+}
+
+// GetPostTemplateFileWithTemplatesHandler returns a handler that creates a
+// template file holding the templates in the request's JSON map of template
+// names to bodies, and adds it to the alertmanager config, with one write of
+// each
+func GetPostTemplateFileWithTemplatesHandler(amClient client.AlertmanagerClient, tmplClient client.TemplateClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		filename := c.Get(templateFilenameParam).(string)
+		tmplClient := requestTemplateClient(c, tmplClient)
+
+		var tmpls map[string]string
+		err := json.NewDecoder(c.Request().Body).Decode(&tmpls)
+		if err != nil {
+			return decodeError(fmt.Errorf("error decoding templates: %w", err), http.StatusBadRequest)
+		}
+		if len(tmpls) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "no templates given")
+		}
+
+		exists, err := fileExists(amClient, tmplClient, filename)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if exists {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("file %s already exists", filename))
+		}
+
+		err = tmplClient.CreateTemplateFileWithTemplates(filename, tmpls)
+		if err != nil {
+			status := http.StatusInternalServerError
+			var parseErr client.TemplateParseError
+			if errors.As(err, &parseErr) {
+				status = http.StatusBadRequest
+			}
+			return echo.NewHTTPError(status, fmt.Sprintf("error creating template file: %v", err))
+		}
+
+		err = requestClient(c, amClient).AddTemplateFile(getFullFilePath(filename, tmplClient))
+		if err != nil {
+			if err == client.ErrConfigModified {
+				// the file isn't referenced by the config, so don't leave it behind
+				_ = tmplClient.DeleteTemplateFile(filename)
+			}
+			return echo.NewHTTPError(modifyErrorStatus(err, http.StatusInternalServerError), fmt.Sprintf("error creating template file: %v", err))
 		}
 
 		return c.String(http.StatusOK, "Created")
@@ -69,6 +128,7 @@ func GetPostTemplateFileHandler(amClient client.AlertmanagerClient, tmplClient c
 func GetPutTemplateFileHandler(amClient client.AlertmanagerClient, tmplClient client.TemplateClient) func(c echo.Context) error {
 	return func(c echo.Context) error {
 		filename := c.Get(templateFilenameParam).(string)
+		tmplClient := requestTemplateClient(c, tmplClient)
 
 		exists, err := fileExists(amClient, tmplClient, filename)
 		if err != nil {
@@ -80,7 +140,7 @@ func GetPutTemplateFileHandler(amClient client.AlertmanagerClient, tmplClient cl
 
 		body, err := readStringBody(c)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, err)
+			return decodeError(err, http.StatusInternalServerError)
 		}
 
 		err = tmplClient.EditTemplateFile(filename, body)
@@ -94,6 +154,7 @@ func GetPutTemplateFileHandler(amClient client.AlertmanagerClient, tmplClient cl
 func GetDeleteTemplateFileHandler(amClient client.AlertmanagerClient, tmplClient client.TemplateClient) func(c echo.Context) error {
 	return func(c echo.Context) error {
 		filename := c.Get(templateFilenameParam).(string)
+		tmplClient := requestTemplateClient(c, tmplClient)
 
 		exists, err := fileExists(amClient, tmplClient, filename)
 		if err != nil {
@@ -103,12 +164,14 @@ func GetDeleteTemplateFileHandler(amClient client.AlertmanagerClient, tmplClient
 			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("error deleting file: file %s does not exist", filename))
 		}
 
-		err = tmplClient.DeleteTemplateFile(filename)
+		// Remove the file from the config first so it's left untouched if the
+		// config has been modified since the request's If-Match hash
+		err = requestClient(c, amClient).RemoveTemplateFile(getFullFilePath(filename, tmplClient))
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("error deleting template file: %v", err))
+			return echo.NewHTTPError(modifyErrorStatus(err, http.StatusInternalServerError), fmt.Sprintf("error deleting template file: %v", err))
 		}
 
-		err = amClient.RemoveTemplateFile(getFullFilePath(filename, tmplClient))
+		err = tmplClient.DeleteTemplateFile(filename)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("error deleting template file: %v", err))
 		}
@@ -120,6 +183,7 @@ func GetDeleteTemplateFileHandler(amClient client.AlertmanagerClient, tmplClient
 func GetGetTemplatesHandler(amClient client.AlertmanagerClient, tmplClient client.TemplateClient) func(c echo.Context) error {
 	return func(c echo.Context) error {
 		filename := c.Get(templateFilenameParam).(string)
+		tmplClient := requestTemplateClient(c, tmplClient)
 
 		exists, err := fileExists(amClient, tmplClient, filename)
 		if err != nil {
@@ -137,9 +201,22 @@ func GetGetTemplatesHandler(amClient client.AlertmanagerClient, tmplClient clien
 	}
 }
 
+// GetGetAllTemplatesHandler returns a handler that responds with the templates
+// of every shared template file, keyed by file name and then template name
+func GetGetAllTemplatesHandler(tmplClient client.TemplateClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		tmpls, err := tmplClient.GetAllTemplates()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("error getting templates: %v", err))
+		}
+		return c.JSON(http.StatusOK, tmpls)
+	}
+}
+
 func GetGetTemplateHandler(amClient client.AlertmanagerClient, tmplClient client.TemplateClient) func(c echo.Context) error {
 	return func(c echo.Context) error {
 		filename := c.Get(templateFilenameParam).(string)
+		tmplClient := requestTemplateClient(c, tmplClient)
 		tmplName := c.Get(templateNameParam).(string)
 
 		exists, err := fileExists(amClient, tmplClient, filename)
@@ -152,7 +229,7 @@ func GetGetTemplateHandler(amClient client.AlertmanagerClient, tmplClient client
 
 		tmpl, err := tmplClient.GetTemplate(filename, tmplName)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("error getting template: %s", err.Error()))
+			return echo.NewHTTPError(templateErrorStatus(err), fmt.Sprintf("error getting template: %s", err.Error()))
 		}
 		return c.JSON(http.StatusOK, tmpl)
 	}
@@ -161,11 +238,12 @@ func GetGetTemplateHandler(amClient client.AlertmanagerClient, tmplClient client
 func GetPostTemplateHandler(amClient client.AlertmanagerClient, tmplClient client.TemplateClient) func(c echo.Context) error {
 	return func(c echo.Context) error {
 		filename := c.Get(templateFilenameParam).(string)
+		tmplClient := requestTemplateClient(c, tmplClient)
 		tmplName := c.Get(templateNameParam).(string)
 
 		tmplText, err := readStringBody(c)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			return decodeError(err, http.StatusBadRequest)
 		}
 
 		exists, err := fileExists(amClient, tmplClient, filename)
@@ -187,11 +265,12 @@ func GetPostTemplateHandler(amClient client.AlertmanagerClient, tmplClient clien
 func GetPutTemplateHandler(amClient client.AlertmanagerClient, tmplClient client.TemplateClient) func(c echo.Context) error {
 	return func(c echo.Context) error {
 		filename := c.Get(templateFilenameParam).(string)
+		tmplClient := requestTemplateClient(c, tmplClient)
 		tmplName := c.Get(templateNameParam).(string)
 
 		tmplText, err := readStringBody(c)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			return decodeError(err, http.StatusBadRequest)
 		}
 
 		exists, err := fileExists(amClient, tmplClient, filename)
@@ -204,7 +283,7 @@ func GetPutTemplateHandler(amClient client.AlertmanagerClient, tmplClient client
 
 		err = tmplClient.EditTemplate(filename, tmplName, tmplText)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("error editing template: %s", err.Error()))
+			return echo.NewHTTPError(templateErrorStatus(err), fmt.Sprintf("error editing template: %s", err.Error()))
 		}
 		return c.NoContent(http.StatusOK)
 	}
@@ -213,6 +292,7 @@ func GetPutTemplateHandler(amClient client.AlertmanagerClient, tmplClient client
 func GetDeleteTemplateHandler(amClient client.AlertmanagerClient, tmplClient client.TemplateClient) func(c echo.Context) error {
 	return func(c echo.Context) error {
 		filename := c.Get(templateFilenameParam).(string)
+		tmplClient := requestTemplateClient(c, tmplClient)
 		tmplName := c.Get(templateNameParam).(string)
 
 		exists, err := fileExists(amClient, tmplClient, filename)
@@ -225,12 +305,86 @@ func GetDeleteTemplateHandler(amClient client.AlertmanagerClient, tmplClient cli
 
 		err = tmplClient.DeleteTemplate(filename, tmplName)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("error deleting template: %s", err.Error()))
+			return echo.NewHTTPError(templateErrorStatus(err), fmt.Sprintf("error deleting template: %s", err.Error()))
 		}
 		return c.NoContent(http.StatusOK)
 	}
 }
 
+// GetBulkTemplatesHandler returns a handler that adds or edits every template
+// in the request's JSON map of template names to bodies in a single write of
+// the template file, responding with the outcome for each template
+func GetBulkTemplatesHandler(amClient client.AlertmanagerClient, tmplClient client.TemplateClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		filename := c.Get(templateFilenameParam).(string)
+		tmplClient := requestTemplateClient(c, tmplClient)
+
+		var tmpls map[string]string
+		err := json.NewDecoder(c.Request().Body).Decode(&tmpls)
+		if err != nil {
+			return decodeError(fmt.Errorf("error decoding templates: %w", err), http.StatusBadRequest)
+		}
+
+		exists, err := fileExists(amClient, tmplClient, filename)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if !exists {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("error getting file: file %s does not exist", filename))
+		}
+
+		results, err := tmplClient.BulkUpdateTemplates(filename, tmpls)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("error updating templates: %s", err.Error()))
+		}
+		return c.JSON(http.StatusOK, results)
+	}
+}
+
+// GetRenderTemplateHandler returns a handler that renders a template against
+// the alertmanager notification data in the request body. Fields derived from
+// the alerts, like the common labels, are filled in if not given.
+func GetRenderTemplateHandler(amClient client.AlertmanagerClient, tmplClient client.TemplateClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		filename := c.Get(templateFilenameParam).(string)
+		tmplClient := requestTemplateClient(c, tmplClient)
+		tmplName := c.Get(templateNameParam).(string)
+
+		data := amtemplate.Data{}
+		err := json.NewDecoder(c.Request().Body).Decode(&data)
+		if err != nil {
+			return decodeError(fmt.Errorf("error decoding alert data: %w", err), http.StatusBadRequest)
+		}
+
+		exists, err := fileExists(amClient, tmplClient, filename)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if !exists {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("error rendering template: file %s does not exist", filename))
+		}
+
+		out, err := tmplClient.RenderTemplate(filename, tmplName, &data)
+		if err != nil {
+			var renderErr client.TemplateRenderError
+			if errors.As(err, &renderErr) {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("error rendering template: %v", err))
+		}
+		return c.JSON(http.StatusOK, out)
+	}
+}
+
+// templateErrorStatus returns the status of the response to a template client
+// error: 404 if the template doesn't exist, and 500 otherwise
+func templateErrorStatus(err error) int {
+	if errors.Is(err, client.ErrTemplateNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
 func stringParamProvider(paramName string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -244,13 +398,34 @@ func stringParamProvider(paramName string) echo.MiddlewareFunc {
 	}
 }
 
+// requestTemplateClient returns the client for the request's tenant if the
+// route is tenant-scoped, otherwise the shared template client
+func requestTemplateClient(c echo.Context, tmplClient client.TemplateClient) client.TemplateClient {
+	if tenantID, ok := c.Get(tenantIDParam).(string); ok && tenantID != "" {
+		return tmplClient.ForTenant(tenantID)
+	}
+	return tmplClient
+}
+
+// templateTenantMiddleware rejects tenant IDs that can't be used as the name
+// of the tenant's template directory
+func templateTenantMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		tenantID := c.Param(tenantIDParam)
+		if tenantID == "." || tenantID == ".." || strings.ContainsAny(tenantID, `/\`) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid %s for templates: %s", tenantIDParam, tenantID))
+		}
+		return next(c)
+	}
+}
+
 func fileExists(amClient client.AlertmanagerClient, tmplClient client.TemplateClient, filename string) (bool, error) {
 	files, err := amClient.GetTemplateFileList()
 	if err != nil {
 		return false, err
 	}
 	for _, file := range files {
-		if file == getFullFilePath(filename, tmplClient) {
+		if client.SameTemplatePath(file, getFullFilePath(filename, tmplClient)) {
 			return true, nil
 		}
 	}
@@ -258,13 +433,13 @@ func fileExists(amClient client.AlertmanagerClient, tmplClient client.TemplateCl
 }
 
 func getFullFilePath(filename string, tmplClient client.TemplateClient) string {
-	return tmplClient.Root() + filename + client.TemplateFilePostfix
+	return client.TemplateFilePath(tmplClient.Root(), filename)
 }
 
 func readStringBody(c echo.Context) (string, error) {
 	body, err := ioutil.ReadAll(c.Request().Body)
 	if err != nil {
-		return string(body), fmt.Errorf("error reading request body: %v", err)
+		return string(body), fmt.Errorf("error reading request body: %w", err)
 	}
 	return string(body), nil
 }
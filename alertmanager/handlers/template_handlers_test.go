@@ -10,6 +10,7 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -17,8 +18,10 @@ import (
 
 	"github.com/facebookincubator/prometheus-configmanager/alertmanager/client"
 	"github.com/facebookincubator/prometheus-configmanager/alertmanager/client/mocks"
+	"github.com/facebookincubator/prometheus-configmanager/prometheus/alert"
 	"github.com/imdario/mergo"
 	"github.com/labstack/echo"
+	amtemplate "github.com/prometheus/alertmanager/template"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -69,6 +72,25 @@ func (tc *templateTestCase) RunTest(t *testing.T) {
 	assert.EqualError(t, err, tc.ExpectedError)
 }
 
+func TestFileExists(t *testing.T) {
+	amClient := &mocks.AlertmanagerClient{}
+	amClient.On("GetTemplateFileList").Return([]string{"/template/dir/file1.tmpl", "/template/dir//file2.tmpl"}, nil)
+
+	for _, root := range []string{"/template/dir", "/template/dir/"} {
+		tmplClient := &mocks.TemplateClient{}
+		tmplClient.On("Root").Return(root)
+
+		assert.Equal(t, "/template/dir/file1.tmpl", getFullFilePath("file1", tmplClient))
+		assert.Equal(t, "/template/dir/file1.tmpl", getFullFilePath("/file1", tmplClient))
+
+		for filename, expected := range map[string]bool{"file1": true, "/file1": true, "file2": true, "file3": false} {
+			exists, err := fileExists(amClient, tmplClient, filename)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, exists, "root %s, file %s", root, filename)
+		}
+	}
+}
+
 func TestGetGetTemplateFileHandler(t *testing.T) {
 	baseTest := templateTestCase{
 		Name:                     "successful get",
@@ -128,6 +150,71 @@ func TestGetPostTemplateFileHandler(t *testing.T) {
 	runAllTests(t, tests, baseTest)
 }
 
+func TestGetPostTemplateFileWithTemplatesHandler(t *testing.T) {
+	tmpls := map[string]string{"a.text": "a body", "b.text": "b body"}
+
+	// The file is created with both templates and added to the config once
+	tmplClient := getTestTmplClient()
+	tmplClient.On("CreateTemplateFileWithTemplates", "file4", tmpls).Return(nil)
+	amClient := getTestAMClient()
+	amClient.On("AddTemplateFile", "/template/dir/file4.tmpl").Return(nil)
+	body, _ := json.Marshal(tmpls)
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(body)))
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.Set(templateFilenameParam, "file4")
+
+	err := GetPostTemplateFileWithTemplatesHandler(amClient, tmplClient)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	tmplClient.AssertExpectations(t)
+	amClient.AssertExpectations(t)
+	amClient.AssertNumberOfCalls(t, "AddTemplateFile", 1)
+
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}"))
+	c = echo.New().NewContext(req, httptest.NewRecorder())
+	c.Set(templateFilenameParam, "file4")
+	err = GetPostTemplateFileWithTemplatesHandler(getTestAMClient(), getTestTmplClient())(c)
+	assert.EqualError(t, err, "code=400, message=no templates given")
+
+	baseTest := templateTestCase{
+		Name:                     "successful post",
+		Filename:                 "file4",
+		Payload:                  tmpls,
+		TmplClientFunc:           "CreateTemplateFileWithTemplates",
+		TmplClientExpectedParams: []interface{}{mock.Anything, mock.Anything},
+		TmplClientExpectedReturn: []interface{}{nil},
+		AmClientFunc:             "AddTemplateFile",
+		AmClientExpectedParams:   []interface{}{mock.Anything},
+		AmClientExpectedReturn:   []interface{}{nil},
+		HandlerFunc:              GetPostTemplateFileWithTemplatesHandler,
+	}
+	tests := []templateTestCase{
+		baseTest,
+		{
+			Name:          "file already exists",
+			Filename:      "file1",
+			ExpectedError: "code=400, message=file file1 already exists",
+		},
+		{
+			Name:                     "invalid template",
+			TmplClientExpectedReturn: []interface{}{client.TemplateParseError{Err: errors.New("error parsing template a.text")}},
+			ExpectedError:            "code=400, message=error creating template file: error parsing template a.text",
+		},
+		{
+			Name:                     "template client error",
+			TmplClientExpectedReturn: []interface{}{errors.New("template error")},
+			ExpectedError:            "code=500, message=error creating template file: template error",
+		},
+		{
+			Name:                   "alertmanager client error",
+			AmClientExpectedReturn: []interface{}{errors.New("alertmanager error")},
+			ExpectedError:          "code=500, message=error creating template file: alertmanager error",
+		},
+	}
+	runAllTests(t, tests, baseTest)
+}
+
 func TestGetPutTemplateFileHandler(t *testing.T) {
 	baseTest := templateTestCase{
 		Name:                     "successful post",
@@ -208,6 +295,11 @@ func TestGetGetTemplateHandler(t *testing.T) {
 			TmplClientExpectedReturn: []interface{}{"", errors.New("template error")},
 			ExpectedError:            "code=500, message=error getting template: template error",
 		},
+		{
+			Name:                     "template doesn't exist",
+			TmplClientExpectedReturn: []interface{}{"", fmt.Errorf("template test: %w", client.ErrTemplateNotFound)},
+			ExpectedError:            "code=404, message=error getting template: template test: template does not exist",
+		},
 	}
 	runAllTests(t, tests, baseTest)
 }
@@ -237,6 +329,33 @@ func TestGetGetTemplatesHandler(t *testing.T) {
 	runAllTests(t, tests, baseTest)
 }
 
+func TestGetGetAllTemplatesHandler(t *testing.T) {
+	allTmpls := map[string]map[string]string{
+		"file1": {"a": "sample template"},
+		"file2": {"b": "other template", "c": "third template"},
+	}
+	tmplClient := getTestTmplClient()
+	tmplClient.On("GetAllTemplates").Return(allTmpls, nil)
+	amClient := getTestAMClient()
+	amClient.On("Tenancy").Return(&alert.TenancyConfig{RestrictorLabel: "tenantID"})
+	e := echo.New()
+	RegisterV1Handlers(e, amClient, tmplClient, true)
+
+	// Listing is available in read-only mode
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, v1AllTemplatesPath, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var body map[string]map[string]string
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, allTmpls, body)
+
+	tmplClient = getTestTmplClient()
+	tmplClient.On("GetAllTemplates").Return(nil, errors.New("template error"))
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, v1AllTemplatesPath, nil), httptest.NewRecorder())
+	err := GetGetAllTemplatesHandler(tmplClient)(c)
+	assert.EqualError(t, err, "code=500, message=error getting templates: template error")
+}
+
 func TestGetPostTemplateHandler(t *testing.T) {
 	baseTest := templateTestCase{
 		Name:                     "successful post",
@@ -283,6 +402,11 @@ func TestGetPutTemplateHandler(t *testing.T) {
 			TmplClientExpectedReturn: []interface{}{errors.New("template error")},
 			ExpectedError:            "code=500, message=error editing template: template error",
 		},
+		{
+			Name:                     "template doesn't exist",
+			TmplClientExpectedReturn: []interface{}{fmt.Errorf("template test: %w", client.ErrTemplateNotFound)},
+			ExpectedError:            "code=404, message=error editing template: template test: template does not exist",
+		},
 	}
 	runAllTests(t, tests, baseTest)
 }
@@ -308,10 +432,130 @@ func TestGetDeleteTemplateHandler(t *testing.T) {
 			TmplClientExpectedReturn: []interface{}{errors.New("template error")},
 			ExpectedError:            "code=500, message=error deleting template: template error",
 		},
+		{
+			Name:                     "template doesn't exist",
+			TmplClientExpectedReturn: []interface{}{fmt.Errorf("template test: %w", client.ErrTemplateNotFound)},
+			ExpectedError:            "code=404, message=error deleting template: template test: template does not exist",
+		},
+	}
+	runAllTests(t, tests, baseTest)
+}
+
+func TestGetBulkTemplatesHandler(t *testing.T) {
+	results := client.NewBulkTemplateResults()
+	results.Statuses["test"] = "created"
+	baseTest := templateTestCase{
+		Name:                     "successful bulk update",
+		Filename:                 "file1",
+		Payload:                  map[string]string{"test": "test text"},
+		TmplClientFunc:           "BulkUpdateTemplates",
+		TmplClientExpectedParams: []interface{}{"file1", map[string]string{"test": "test text"}},
+		TmplClientExpectedReturn: []interface{}{results, nil},
+		HandlerFunc:              GetBulkTemplatesHandler,
+	}
+	tests := []templateTestCase{
+		baseTest,
+		{
+			Name:          "file doesn't exist",
+			Filename:      "not_a_file",
+			ExpectedError: "code=400, message=error getting file: file not_a_file does not exist",
+		},
+		{
+			Name:          "invalid payload",
+			Payload:       "test text",
+			ExpectedError: "code=400, message=error decoding templates: json: cannot unmarshal string into Go value of type map[string]string",
+		},
+		{
+			Name:                     "template client error",
+			TmplClientExpectedReturn: []interface{}{client.BulkTemplateResults{}, errors.New("template error")},
+			ExpectedError:            "code=500, message=error updating templates: template error",
+		},
 	}
 	runAllTests(t, tests, baseTest)
 }
 
+func TestGetRenderTemplateHandler(t *testing.T) {
+	data := amtemplate.Data{
+		Alerts: amtemplate.Alerts{{Labels: amtemplate.KV{"alertname": "HighCPU"}}},
+	}
+	baseTest := templateTestCase{
+		Name:                     "successful render",
+		Filename:                 "file1",
+		Payload:                  data,
+		TmplClientFunc:           "RenderTemplate",
+		TmplClientExpectedParams: []interface{}{"file1", "test", mock.AnythingOfType("*template.Data")},
+		TmplClientExpectedReturn: []interface{}{"HighCPU is firing", nil},
+		HandlerFunc:              GetRenderTemplateHandler,
+	}
+	tests := []templateTestCase{
+		baseTest,
+		{
+			Name:          "file doesn't exist",
+			Filename:      "not_a_file",
+			ExpectedError: "code=400, message=error rendering template: file not_a_file does not exist",
+		},
+		{
+			Name:          "invalid payload",
+			Payload:       "test text",
+			ExpectedError: "code=400, message=error decoding alert data: json: cannot unmarshal string into Go value of type template.Data",
+		},
+		{
+			Name:                     "execution error",
+			TmplClientExpectedReturn: []interface{}{"", client.TemplateRenderError{Err: errors.New("error executing template: bad field")}},
+			ExpectedError:            "code=400, message=error executing template: bad field",
+		},
+		{
+			Name:                     "template client error",
+			TmplClientExpectedReturn: []interface{}{"", errors.New("template error")},
+			ExpectedError:            "code=500, message=error rendering template: template error",
+		},
+	}
+	runAllTests(t, tests, baseTest)
+}
+
+func TestTenantTemplateRoutes(t *testing.T) {
+	amClient := &mocks.AlertmanagerClient{}
+	amClient.On("Tenancy").Return(&alert.TenancyConfig{RestrictorLabel: "tenantID"})
+	amClient.On("GetTemplateFileList").Return([]string{"/template/dir/tenantA/file1.tmpl"}, nil)
+	amClient.On("GetConfigHash").Return("abc123", nil)
+
+	tenantAClient := &mocks.TemplateClient{}
+	tenantAClient.On("Root").Return("/template/dir/tenantA/")
+	tenantAClient.On("GetTemplateFile", "file1").Return("tenantA text", nil)
+	tenantBClient := &mocks.TemplateClient{}
+	tenantBClient.On("Root").Return("/template/dir/tenantB/")
+	tmplClient := getTestTmplClient()
+	tmplClient.On("ForTenant", "tenantA").Return(tenantAClient)
+	tmplClient.On("ForTenant", "tenantB").Return(tenantBClient)
+
+	e := echo.New()
+	RegisterV1Handlers(e, amClient, tmplClient, false)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/tenantA/template_files/file1/template", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "tenantA text")
+
+	// Another tenant can't see the file
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/tenantB/template_files/file1/template", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "file does not exist")
+	tenantBClient.AssertNotCalled(t, "GetTemplateFile", mock.Anything)
+
+	// Neither can the shared template routes
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/file1/template", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	tmplClient.AssertNotCalled(t, "GetTemplateFile", mock.Anything)
+
+	// Tenant IDs that would escape the tenant's directory are rejected
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/../template_files/file1/template", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid tenant_id for templates: ..")
+}
+
 func getTestAMClient() *mocks.AlertmanagerClient {
 	client := mocks.AlertmanagerClient{}
 	client.On("GetTemplateFileList").Return(sampleFileList, nil)
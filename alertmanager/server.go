@@ -8,13 +8,24 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/facebookincubator/prometheus-configmanager/alertmanager/client"
+	amconfig "github.com/facebookincubator/prometheus-configmanager/alertmanager/config"
 	"github.com/facebookincubator/prometheus-configmanager/alertmanager/handlers"
+	"github.com/facebookincubator/prometheus-configmanager/envflag"
 	"github.com/facebookincubator/prometheus-configmanager/fsclient"
+	"github.com/facebookincubator/prometheus-configmanager/idempotency"
 	"github.com/facebookincubator/prometheus-configmanager/prometheus/alert"
 
 	"github.com/golang/glog"
@@ -27,28 +38,64 @@ const (
 	defaultAlertmanagerURL        = "alertmanager:9093"
 	defaultAlertmanagerConfigPath = "./alertmanager.yml"
 	defaultTemplateDir            = "./templates/"
+	defaultBodyLimit              = "10M"
+
+	// shutdownTimeout is how long in-flight requests have to finish on
+	// shutdown
+	shutdownTimeout = 30 * time.Second
 )
 
 func main() {
+	// Only the server's own flags are read from the environment, not those
+	// registered by imported packages, e.g. glog's
+	libraryFlags := envflag.Names(flag.CommandLine)
 	port := flag.String("port", defaultPort, fmt.Sprintf("Port to listen for requests. Default is %s", defaultPort))
 	alertmanagerConfPath := flag.String("alertmanager-conf", defaultAlertmanagerConfigPath, fmt.Sprintf("Path to alertmanager configuration file. Default is %s", defaultAlertmanagerConfigPath))
 	alertmanagerURL := flag.String("alertmanagerURL", defaultAlertmanagerURL, fmt.Sprintf("URL of the alertmanager instance that is being used. Default is %s", defaultAlertmanagerURL))
+	alertmanagerURLs := flag.String("alertmanagerURLs", "", "Comma-separated list of URLs of alertmanager cluster peers, all of which are reloaded after a change. Overrides alertmanagerURL")
+	reloadPath := flag.String("reload-path", client.DefaultReloadPath, fmt.Sprintf("Path of the reload endpoint of the alertmanager instances, e.g. when behind a path-rewriting proxy. Default is %s", client.DefaultReloadPath))
 	matcherLabel := flag.String("multitenant-label", "", "LabelName to use for enabling multitenancy through route matching. Leave empty for single tenant use cases.")
 	templateDirPath := flag.String("template-directory", defaultTemplateDir, fmt.Sprintf("Directory where template files are stored. Default is %s", defaultTemplateDir))
 	deleteRoutesByDefault := flag.Bool("delete-route-with-receiver", false, fmt.Sprintf("When a receiver is deleted, also delete all references in the route tree. Otherwise deleting before modifying tree will throw error."))
+	deniedGroupByLabels := flag.String("denied-group-by-labels", "", "Comma-separated list of high-cardinality labels that tenant routes may not group alerts by")
+	baseRouteGroupWait := flag.String("base-route-group-wait", "", "group_wait that tenant base routes are created with. Leave empty to use the alertmanager default.")
+	baseRouteGroupInterval := flag.String("base-route-group-interval", "", "group_interval that tenant base routes are created with. Leave empty to use the alertmanager default.")
+	baseRouteRepeatInterval := flag.String("base-route-repeat-interval", "", "repeat_interval that tenant base routes are created with. Leave empty to use the alertmanager default.")
+	baseRouteGroupBy := flag.String("base-route-group-by", "", "Comma-separated list of labels that tenant base routes group alerts by when modified without a group_by. Leave empty to require routes to set group_by themselves.")
+	baseRouteFallbackReceiver := flag.String("base-route-fallback-receiver", "", "Receiver that new tenant base routes send alerts matching none of the tenant's routes to, instead of dropping them. It must already exist in the alertmanager configuration. Leave empty to drop them.")
+	tenantDefaultsPath := flag.String("tenant-defaults", "", "Path to a file containing the receivers and route that new tenants are provisioned with. Leave empty to disable provisioning.")
+	fileMode := flag.String("file-mode", "0660", "Permission bits, in octal, that the config and template files are written with. Default is 0660")
+	readOnly := flag.Bool("read-only", false, "If this flag is set all requests that modify the configuration are rejected")
+	scrubSecrets := flag.Bool("scrub-secrets", false, "If this flag is set secrets are hidden from receivers and the global config that are read back, and updates that omit a secret keep the stored value")
+	idempotencyTTL := flag.Duration("idempotency-ttl", 24*time.Hour, "How long responses to requests with an Idempotency-Key header are kept for replay. Zero disables idempotency keys")
+	tempFileMaxAge := flag.Duration("temp-file-max-age", 0, "Temp files left in template-directory by interrupted writes are removed at startup once they are older than this. Zero keeps them. Default is 0")
+	bodyLimit := flag.String("body-limit", defaultBodyLimit, fmt.Sprintf("Largest request body accepted, e.g. 512K or 10M. Larger requests are rejected with 413. Default is %s", defaultBodyLimit))
 	flag.Parse()
+	if err := envflag.SetFromEnv(flag.CommandLine, libraryFlags); err != nil {
+		glog.Fatalf("Invalid configuration: %v", err)
+	}
 
-	if !strings.HasSuffix(*templateDirPath, "/") {
-		*templateDirPath += "/"
+	configFileMode, err := strconv.ParseUint(*fileMode, 8, 32)
+	if err != nil {
+		glog.Fatalf("Invalid file-mode: %v", err)
 	}
 
-	tenancy := &alert.TenancyConfig{
-		RestrictorLabel: *matcherLabel,
+	// Without a label the configurer is single-tenant, and receivers and
+	// routes are used without a tenant
+	var tenancy *alert.TenancyConfig
+	if *matcherLabel != "" {
+		tenancy = &alert.TenancyConfig{
+			RestrictorLabel: *matcherLabel,
+		}
 	}
 
 	e := echo.New()
 	e.Use(middleware.CORS())
 	e.Use(middleware.Logger())
+	e.Use(middleware.BodyLimit(*bodyLimit))
+	if *idempotencyTTL > 0 {
+		e.Use(idempotency.NewCache(*idempotencyTTL).Middleware())
+	}
 
 	fileLocks, err := alert.NewFileLocker(alert.NewDirectoryClient(*templateDirPath))
 	if err != nil {
@@ -56,19 +103,75 @@ func main() {
 	}
 
 	config := client.ClientConfig{
-		ConfigPath:      *alertmanagerConfPath,
-		AlertmanagerURL: *alertmanagerURL,
-		FsClient:        fsclient.NewFSClient("/"),
-		Tenancy:         tenancy,
-		DeleteRoutes:    *deleteRoutesByDefault,
+		ConfigPath:          *alertmanagerConfPath,
+		AlertmanagerURL:     *alertmanagerURL,
+		AlertmanagerURLs:    splitList(*alertmanagerURLs),
+		ReloadPath:          *reloadPath,
+		FsClient:            fsclient.NewFSClient("/"),
+		Tenancy:             tenancy,
+		DeleteRoutes:        *deleteRoutesByDefault,
+		DefaultsPath:        *tenantDefaultsPath,
+		FileMode:            os.FileMode(configFileMode),
+		DeniedGroupByLabels: splitList(*deniedGroupByLabels),
+		BaseRouteTimings: amconfig.RouteTimings{
+			GroupWait:      *baseRouteGroupWait,
+			GroupInterval:  *baseRouteGroupInterval,
+			RepeatInterval: *baseRouteRepeatInterval,
+		},
+		BaseRouteGroupBy:          splitList(*baseRouteGroupBy),
+		BaseRouteFallbackReceiver: *baseRouteFallbackReceiver,
+		ScrubSecrets:              *scrubSecrets,
+		FileLocks:                 fileLocks,
 	}
 	receiverClient := client.NewClient(config)
-	templateClient := client.NewTemplateClient(fsclient.NewFSClient(*templateDirPath), fileLocks)
+	templateFS := fsclient.NewFSClient(*templateDirPath)
+	if *tempFileMaxAge > 0 {
+		if _, err := fsclient.RemoveStaleTempFiles(templateFS, "", *tempFileMaxAge); err != nil {
+			glog.Errorf("Could not remove stale temp files: %v", err)
+		}
+	}
+	templateClient := client.NewTemplateClient(templateFS, fileLocks, client.WithTemplateFileMode(os.FileMode(configFileMode)))
 
 	handlers.RegisterBaseHandlers(e)
-	handlers.RegisterV0Handlers(e, receiverClient)
-	handlers.RegisterV1Handlers(e, receiverClient, templateClient)
+	handlers.RegisterV0Handlers(e, receiverClient, *readOnly)
+	handlers.RegisterV1Handlers(e, receiverClient, templateClient, *readOnly)
 
 	glog.Infof("Alertmanager Config server listening on port: %s\n", *port)
-	e.Logger.Fatal(e.Start(fmt.Sprintf(":%s", *port)))
+	go func() {
+		err := e.Start(fmt.Sprintf(":%s", *port))
+		if err != nil && err != http.ErrServerClosed {
+			e.Logger.Fatal(err)
+		}
+	}()
+	waitForShutdown(e, receiverClient)
+}
+
+// waitForShutdown blocks until the server is interrupted or terminated, then
+// stops accepting requests and closes the client so no pending work is lost
+func waitForShutdown(e *echo.Echo, client io.Closer) {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+
+	glog.Info("Shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		glog.Errorf("error shutting down server: %v", err)
+	}
+	if err := client.Close(); err != nil {
+		glog.Errorf("error closing client: %v", err)
+	}
+	glog.Flush()
+}
+
+// splitList splits a comma-separated flag value, ignoring empty entries
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
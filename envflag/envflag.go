@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package envflag
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Names returns the names of the flags defined in fs
+func Names(fs *flag.FlagSet) []string {
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) {
+		names = append(names, f.Name)
+	})
+	return names
+}
+
+// SetFromEnv sets every flag of fs that wasn't given on the command line from
+// its environment variable, if that is set. Flags given on the command line
+// override the environment, which overrides the flag's default. Flags named in
+// except are never read from the environment, e.g. the flags that imported
+// packages such as glog register, whose generic names like V and LOG_DIR are
+// likely to be set for other reasons. fs must already be parsed.
+func SetFromEnv(fs *flag.FlagSet, except []string) error {
+	skip := make(map[string]bool)
+	for _, name := range except {
+		skip[name] = true
+	}
+	fs.Visit(func(f *flag.Flag) {
+		skip[f.Name] = true
+	})
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || skip[f.Name] {
+			return
+		}
+		name := EnvName(f.Name)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid value %q for environment variable %s: %v", value, name, setErr)
+		}
+	})
+	return err
+}
+
+// EnvName returns the environment variable a flag is read from, which is the
+// flag name in upper snake case, e.g. RULES_DIR for rules-dir and
+// PROMETHEUS_URL for prometheusURL
+func EnvName(flagName string) string {
+	var name strings.Builder
+	var prev rune
+	for _, r := range flagName {
+		switch {
+		case r == '-' || r == '.':
+			r = '_'
+		case unicode.IsUpper(r) && (unicode.IsLower(prev) || unicode.IsDigit(prev)):
+			name.WriteRune('_')
+		}
+		name.WriteRune(unicode.ToUpper(r))
+		prev = r
+	}
+	return name.String()
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package envflag
+
+import (
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetFromEnv(t *testing.T) {
+	defer os.Unsetenv("RULES_DIR")
+	defer os.Unsetenv("PROMETHEUS_URL")
+	defer os.Unsetenv("RESTRICT_QUERIES")
+
+	newFlagSet := func() (*flag.FlagSet, *string, *string, *bool) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		rulesDir := fs.String("rules-dir", ".", "")
+		prometheusURL := fs.String("prometheusURL", "prometheus:9090", "")
+		restrictQueries := fs.Bool("restrict-queries", false, "")
+		return fs, rulesDir, prometheusURL, restrictQueries
+	}
+
+	// Defaults are kept without flags or environment variables
+	fs, rulesDir, prometheusURL, restrictQueries := newFlagSet()
+	assert.NoError(t, fs.Parse(nil))
+	assert.NoError(t, SetFromEnv(fs, nil))
+	assert.Equal(t, ".", *rulesDir)
+	assert.Equal(t, "prometheus:9090", *prometheusURL)
+	assert.False(t, *restrictQueries)
+
+	// Environment variables override defaults
+	os.Setenv("RULES_DIR", "/etc/rules")
+	os.Setenv("PROMETHEUS_URL", "prometheus:9091")
+	os.Setenv("RESTRICT_QUERIES", "true")
+	fs, rulesDir, prometheusURL, restrictQueries = newFlagSet()
+	assert.NoError(t, fs.Parse(nil))
+	assert.NoError(t, SetFromEnv(fs, nil))
+	assert.Equal(t, "/etc/rules", *rulesDir)
+	assert.Equal(t, "prometheus:9091", *prometheusURL)
+	assert.True(t, *restrictQueries)
+
+	// Flags override environment variables, even when given their default
+	fs, rulesDir, prometheusURL, restrictQueries = newFlagSet()
+	assert.NoError(t, fs.Parse([]string{"-rules-dir", ".", "-restrict-queries=false"}))
+	assert.NoError(t, SetFromEnv(fs, nil))
+	assert.Equal(t, ".", *rulesDir)
+	assert.Equal(t, "prometheus:9091", *prometheusURL)
+	assert.False(t, *restrictQueries)
+
+	// Invalid values are reported by variable name
+	os.Setenv("RESTRICT_QUERIES", "maybe")
+	fs, _, _, _ = newFlagSet()
+	assert.NoError(t, fs.Parse(nil))
+	assert.EqualError(t, SetFromEnv(fs, nil), `invalid value "maybe" for environment variable RESTRICT_QUERIES: parse error`)
+}
+
+func TestSetFromEnv_Except(t *testing.T) {
+	defer os.Unsetenv("V")
+	defer os.Unsetenv("RULES_DIR")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	verbosity := fs.Int("v", 0, "")
+	libraryFlags := Names(fs)
+	rulesDir := fs.String("rules-dir", ".", "")
+	assert.Equal(t, []string{"v"}, libraryFlags)
+
+	// Flags registered before the server's own aren't read from the
+	// environment
+	os.Setenv("V", "3")
+	os.Setenv("RULES_DIR", "/etc/rules")
+	assert.NoError(t, fs.Parse(nil))
+	assert.NoError(t, SetFromEnv(fs, libraryFlags))
+	assert.Equal(t, 0, *verbosity)
+	assert.Equal(t, "/etc/rules", *rulesDir)
+}
+
+func TestEnvName(t *testing.T) {
+	for flagName, envName := range map[string]string{
+		"rules-dir":          "RULES_DIR",
+		"multitenant-label":  "MULTITENANT_LABEL",
+		"prometheusURL":      "PROMETHEUS_URL",
+		"prometheusURLs":     "PROMETHEUS_URLS",
+		"alertmanager-conf":  "ALERTMANAGER_CONF",
+		"log_dir":            "LOG_DIR",
+		"reload-max-delay":   "RELOAD_MAX_DELAY",
+		"template-directory": "TEMPLATE_DIRECTORY",
+	} {
+		assert.Equal(t, envName, EnvName(flagName), flagName)
+	}
+}
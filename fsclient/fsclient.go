@@ -10,6 +10,8 @@ package fsclient
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 type FSClient interface {
@@ -17,6 +19,8 @@ type FSClient interface {
 	ReadFile(filename string) ([]byte, error)
 	DeleteFile(filename string) error
 	Stat(filename string) (os.FileInfo, error)
+	ReadDir(dir string) ([]os.FileInfo, error)
+	MkdirAll(dir string, perm os.FileMode) error
 
 	Root() string
 }
@@ -25,28 +29,89 @@ type fsclient struct {
 	root string
 }
 
+// NewFSClient returns an FSClient that resolves filenames relative to root.
+// A non-empty root is normalized to end in exactly one '/', so that it can
+// be given with or without a trailing slash.
 func NewFSClient(root string) FSClient {
+	if root != "" {
+		root = strings.TrimRight(root, "/") + "/"
+	}
 	return &fsclient{
 		root: root,
 	}
 }
 
 func (f *fsclient) WriteFile(filename string, data []byte, perm os.FileMode) error {
-	return ioutil.WriteFile(f.root+filename, data, perm)
+	return ioutil.WriteFile(filepath.Join(f.root, filename), data, perm)
 }
 
 func (f *fsclient) ReadFile(filename string) ([]byte, error) {
-	return ioutil.ReadFile(f.root + filename)
+	return ioutil.ReadFile(filepath.Join(f.root, filename))
 }
 
 func (f *fsclient) DeleteFile(filename string) error {
-	return os.Remove(f.root + filename)
+	return os.Remove(filepath.Join(f.root, filename))
 }
 
 func (f *fsclient) Stat(filename string) (os.FileInfo, error) {
-	return os.Stat(f.root + filename)
+	return os.Stat(filepath.Join(f.root, filename))
+}
+
+func (f *fsclient) ReadDir(dir string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(filepath.Join(f.root, dir))
+}
+
+func (f *fsclient) MkdirAll(dir string, perm os.FileMode) error {
+	return os.MkdirAll(filepath.Join(f.root, dir), perm)
 }
 
 func (f *fsclient) Root() string {
 	return f.root
 }
+
+// Sub returns an FSClient that resolves filenames relative to dir within
+// fs, creating dir when a file is first written to it
+func Sub(fs FSClient, dir string) FSClient {
+	return &subFSClient{
+		parent: fs,
+		dir:    dir,
+	}
+}
+
+type subFSClient struct {
+	parent FSClient
+	dir    string
+}
+
+func (f *subFSClient) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	// Directories need to be searchable by whoever can read the files in them
+	err := f.parent.MkdirAll(f.dir, perm|(perm&0444)>>2)
+	if err != nil {
+		return err
+	}
+	return f.parent.WriteFile(filepath.Join(f.dir, filename), data, perm)
+}
+
+func (f *subFSClient) ReadFile(filename string) ([]byte, error) {
+	return f.parent.ReadFile(filepath.Join(f.dir, filename))
+}
+
+func (f *subFSClient) DeleteFile(filename string) error {
+	return f.parent.DeleteFile(filepath.Join(f.dir, filename))
+}
+
+func (f *subFSClient) Stat(filename string) (os.FileInfo, error) {
+	return f.parent.Stat(filepath.Join(f.dir, filename))
+}
+
+func (f *subFSClient) ReadDir(dir string) ([]os.FileInfo, error) {
+	return f.parent.ReadDir(filepath.Join(f.dir, dir))
+}
+
+func (f *subFSClient) MkdirAll(dir string, perm os.FileMode) error {
+	return f.parent.MkdirAll(filepath.Join(f.dir, dir), perm)
+}
+
+func (f *subFSClient) Root() string {
+	return filepath.Join(f.parent.Root(), f.dir) + "/"
+}
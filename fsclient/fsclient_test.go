@@ -0,0 +1,183 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package fsclient
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFSClient_Root(t *testing.T) {
+	assert.Equal(t, "rules/", NewFSClient("rules").Root())
+	assert.Equal(t, "rules/", NewFSClient("rules/").Root())
+	assert.Equal(t, "rules/", NewFSClient("rules//").Root())
+	assert.Equal(t, "/", NewFSClient("/").Root())
+	assert.Equal(t, "", NewFSClient("").Root())
+}
+
+func TestFSClient_TrailingSlash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsclient")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	withoutSlash := NewFSClient(dir)
+	withSlash := NewFSClient(dir + "/")
+
+	err = withoutSlash.WriteFile("foo_rules.yml", []byte("groups: []"), 0660)
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "foo_rules.yml"))
+	assert.NoError(t, err)
+
+	data, err := withSlash.ReadFile("foo_rules.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, "groups: []", string(data))
+
+	files, err := withoutSlash.ReadDir("")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(files))
+	assert.Equal(t, "foo_rules.yml", files[0].Name())
+}
+
+func TestFSClient_ReadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsclient")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "tenant"), 0770))
+
+	client := NewFSClient(dir)
+	assert.NoError(t, client.WriteFile("foo_rules.yml", []byte("groups: []"), 0660))
+	assert.NoError(t, client.WriteFile("bar_rules.yml", []byte("groups: []"), 0660))
+
+	// Entries are sorted by name, and include directories
+	files, err := client.ReadDir("")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(files))
+	assert.Equal(t, "bar_rules.yml", files[0].Name())
+	assert.Equal(t, "foo_rules.yml", files[1].Name())
+	assert.Equal(t, "tenant", files[2].Name())
+	assert.True(t, files[2].IsDir())
+
+	_, err = client.ReadDir("missing")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFSClient_NestedFilenames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsclient")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "tenant", "templates"), 0770))
+
+	client := NewFSClient(dir)
+	err = client.WriteFile("tenant/templates/slack.tmpl", []byte("tmpl"), 0660)
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "tenant", "templates", "slack.tmpl"))
+	assert.NoError(t, err)
+
+	// Redundant separators resolve to the same file
+	data, err := client.ReadFile("/tenant//templates/slack.tmpl")
+	assert.NoError(t, err)
+	assert.Equal(t, "tmpl", string(data))
+
+	info, err := client.Stat("tenant/./templates/slack.tmpl")
+	assert.NoError(t, err)
+	assert.Equal(t, "slack.tmpl", info.Name())
+
+	files, err := client.ReadDir("tenant/templates/")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(files))
+
+	assert.NoError(t, client.DeleteFile("tenant/templates/slack.tmpl"))
+	_, err = client.Stat("tenant/templates/slack.tmpl")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSub(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsclient")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	client := NewFSClient(dir)
+	sub := Sub(client, "tenant")
+	assert.Equal(t, filepath.Join(dir, "tenant")+"/", sub.Root())
+
+	// Writing creates the directory
+	err = sub.WriteFile("slack.tmpl", []byte("tmpl"), 0660)
+	assert.NoError(t, err)
+	info, err := os.Stat(filepath.Join(dir, "tenant"))
+	assert.NoError(t, err)
+	assert.True(t, info.IsDir())
+
+	data, err := client.ReadFile("tenant/slack.tmpl")
+	assert.NoError(t, err)
+	assert.Equal(t, "tmpl", string(data))
+	data, err = sub.ReadFile("slack.tmpl")
+	assert.NoError(t, err)
+	assert.Equal(t, "tmpl", string(data))
+
+	// Files outside the directory aren't visible
+	assert.NoError(t, client.WriteFile("other.tmpl", []byte("other"), 0660))
+	_, err = sub.ReadFile("other.tmpl")
+	assert.True(t, os.IsNotExist(err))
+
+	files, err := sub.ReadDir("")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(files))
+
+	assert.NoError(t, sub.DeleteFile("slack.tmpl"))
+	_, err = client.Stat("tenant/slack.tmpl")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestTempFilename(t *testing.T) {
+	assert.Equal(t, ".foo_rules.yml.tmp", TempFilename("foo_rules.yml"))
+	assert.Equal(t, "tenant/.slack.tmpl.tmp", TempFilename("tenant/slack.tmpl"))
+}
+
+func TestRemoveStaleTempFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsclient")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	client := NewFSClient(dir)
+	stale := time.Now().Add(-2 * time.Hour)
+	filenames := []string{
+		TempFilename("foo_rules.yml"),
+		TempFilename("tenant/slack.tmpl"),
+		TempFilename("recent_rules.yml"),
+		"foo_rules.yml",
+		"notes.tmp",
+		".tmp",
+	}
+	for _, filename := range filenames {
+		assert.NoError(t, Sub(client, filepath.Dir(filename)).WriteFile(filepath.Base(filename), []byte("groups: []"), 0660))
+	}
+	for _, filename := range filenames {
+		if filename != TempFilename("recent_rules.yml") {
+			assert.NoError(t, os.Chtimes(filepath.Join(dir, filename), stale, stale))
+		}
+	}
+
+	removed, err := RemoveStaleTempFiles(client, "", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{".foo_rules.yml.tmp"}, removed)
+
+	_, err = client.Stat(".foo_rules.yml.tmp")
+	assert.True(t, os.IsNotExist(err))
+
+	// Rule files, files that aren't named like temp files, temp files below
+	// the directory and temp files of writes that may be in progress are kept
+	for _, filename := range filenames[1:] {
+		_, err = client.Stat(filename)
+		assert.NoError(t, err, filename)
+	}
+}
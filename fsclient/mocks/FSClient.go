@@ -34,6 +34,43 @@ func (_m *FSClient) DeleteFile(filename string) error {
 	return r0
 }
 
+// MkdirAll provides a mock function with given fields: dir, perm
+func (_m *FSClient) MkdirAll(dir string, perm os.FileMode) error {
+	ret := _m.Called(dir, perm)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, os.FileMode) error); ok {
+		r0 = rf(dir, perm)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ReadDir provides a mock function with given fields: dir
+func (_m *FSClient) ReadDir(dir string) ([]os.FileInfo, error) {
+	ret := _m.Called(dir)
+
+	var r0 []os.FileInfo
+	if rf, ok := ret.Get(0).(func(string) []os.FileInfo); ok {
+		r0 = rf(dir)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]os.FileInfo)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(dir)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // ReadFile provides a mock function with given fields: filename
 func (_m *FSClient) ReadFile(filename string) ([]byte, error) {
 	ret := _m.Called(filename)
@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package mocks
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (f testFileInfo) Name() string { return f.name }
+
+func TestFSClient_ReadDir(t *testing.T) {
+	fsClient := &FSClient{}
+	fsClient.On("ReadDir", "rules").Return([]os.FileInfo{testFileInfo{name: "test_rules.yml"}}, nil)
+	fsClient.On("ReadDir", "templates").Return(func(dir string) []os.FileInfo {
+		return []os.FileInfo{testFileInfo{name: dir + ".tmpl"}}
+	}, func(string) error {
+		return nil
+	})
+	fsClient.On("ReadDir", "missing").Return(nil, errors.New("readdir err"))
+
+	files, err := fsClient.ReadDir("rules")
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Equal(t, "test_rules.yml", files[0].Name())
+
+	// Return values can be computed from the directory
+	files, err = fsClient.ReadDir("templates")
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Equal(t, "templates.tmpl", files[0].Name())
+
+	files, err = fsClient.ReadDir("missing")
+	assert.EqualError(t, err, "readdir err")
+	assert.Nil(t, files)
+
+	fsClient.AssertNumberOfCalls(t, "ReadDir", 3)
+}
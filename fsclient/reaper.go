@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package fsclient
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// TempFileSuffix marks files that are written before being renamed over the
+// file they replace. A write that is interrupted leaves one behind.
+const TempFileSuffix = ".tmp"
+
+// TempFilename returns the name of the temp file written before being renamed
+// over filename. It's hidden and kept in the same directory, so the rename
+// doesn't cross filesystems.
+func TempFilename(filename string) string {
+	dir, base := filepath.Split(filename)
+	return filepath.Join(dir, "."+base+TempFileSuffix)
+}
+
+// isTempFilename reports whether name, without its directory, is named like
+// the files from TempFilename
+func isTempFilename(name string) bool {
+	return len(name) > len("."+TempFileSuffix) && strings.HasPrefix(name, ".") && strings.HasSuffix(name, TempFileSuffix)
+}
+
+// RemoveStaleTempFiles deletes the temp files directly in dir that were last
+// modified more than olderThan ago, and returns the names of the files it
+// removed. Only files named by TempFilename are removed, and directories below
+// dir aren't scanned. Newer temp files may belong to a write that is still in
+// progress, so they're left alone.
+func RemoveStaleTempFiles(fs FSClient, dir string, olderThan time.Duration) ([]string, error) {
+	files, err := fs.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading directory %s: %v", dir, err)
+	}
+	cutoff := time.Now().Add(-olderThan)
+	var removed []string
+	for _, file := range files {
+		if file.IsDir() || !isTempFilename(file.Name()) || !file.ModTime().Before(cutoff) {
+			continue
+		}
+		filename := filepath.Join(dir, file.Name())
+		err := fs.DeleteFile(filename)
+		if err != nil {
+			return removed, fmt.Errorf("error removing temp file %s: %v", filename, err)
+		}
+		glog.Infof("Removed stale temp file %s, last modified %s", filename, file.ModTime().Format(time.RFC3339))
+		removed = append(removed, filename)
+	}
+	return removed, nil
+}
@@ -9,6 +9,7 @@ require (
 	github.com/labstack/gommon v0.2.8 // indirect
 	github.com/pkg/errors v0.9.1
 	github.com/prometheus/alertmanager v0.21.0
+	github.com/prometheus/client_golang v1.7.1
 	github.com/prometheus/common v0.11.1
 	github.com/prometheus/prometheus v1.8.2-0.20200819132913-cb830b0a9c78
 	github.com/prometheus/tsdb v0.10.0 // indirect
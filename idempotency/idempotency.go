@@ -0,0 +1,182 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	// HeaderIdempotencyKey is the request header that identifies retries of
+	// the same mutation
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed is set on responses replayed from the cache
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+	tenantIDParam = "tenant_id"
+)
+
+// Cache records the responses to mutating requests carrying an
+// Idempotency-Key header, so that a retry with the same key is answered with
+// the original response instead of being executed again
+type Cache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	lock    sync.Mutex
+	entries map[cacheKey]*cachedResponse
+}
+
+// Keys are scoped to a tenant so that tenants can't see each others'
+// responses by reusing a key
+type cacheKey struct {
+	tenantID string
+	key      string
+}
+
+type cachedResponse struct {
+	expires  time.Time
+	inFlight bool
+	// A key is only replayed for the request it was first used with
+	method   string
+	path     string
+	bodyHash [sha256.Size]byte
+
+	status int
+	header http.Header
+	body   []byte
+}
+
+// NewCache returns a Cache that keeps responses for ttl
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[cacheKey]*cachedResponse{},
+	}
+}
+
+// Middleware returns an echo middleware that replays cached responses for
+// repeated Idempotency-Keys. Requests without the header and requests that
+// don't modify anything are passed through. A key reused with a different
+// method, path or body is rejected with 422.
+func (cache *Cache) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			idempotencyKey := c.Request().Header.Get(HeaderIdempotencyKey)
+			if idempotencyKey == "" || !isMutation(c.Request().Method) {
+				return next(c)
+			}
+			key := cacheKey{tenantID: c.Param(tenantIDParam), key: idempotencyKey}
+			method, path := c.Request().Method, c.Request().URL.Path
+			bodyHash, err := hashBody(c.Request())
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+
+			cache.lock.Lock()
+			cache.removeExpired()
+			if entry, ok := cache.entries[key]; ok {
+				cache.lock.Unlock()
+				if entry.method != method || entry.path != path || entry.bodyHash != bodyHash {
+					return echo.NewHTTPError(http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+				}
+				if entry.inFlight {
+					return echo.NewHTTPError(http.StatusConflict, "A request with this Idempotency-Key is still in progress")
+				}
+				return replay(c, entry)
+			}
+			cache.entries[key] = &cachedResponse{inFlight: true, expires: cache.now().Add(cache.ttl), method: method, path: path, bodyHash: bodyHash}
+			cache.lock.Unlock()
+
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+			err = next(c)
+
+			cache.lock.Lock()
+			defer cache.lock.Unlock()
+			// Only completed responses are replayed, anything else can be
+			// retried with the same key
+			if err != nil || !c.Response().Committed || c.Response().Status >= http.StatusInternalServerError {
+				delete(cache.entries, key)
+				return err
+			}
+			cache.entries[key] = &cachedResponse{
+				expires:  cache.now().Add(cache.ttl),
+				method:   method,
+				path:     path,
+				bodyHash: bodyHash,
+				status:   c.Response().Status,
+				header:   c.Response().Header().Clone(),
+				body:     recorder.body.Bytes(),
+			}
+			return nil
+		}
+	}
+}
+
+// removeExpired must be called with the lock held
+func (cache *Cache) removeExpired() {
+	now := cache.now()
+	for key, entry := range cache.entries {
+		if !entry.inFlight && now.After(entry.expires) {
+			delete(cache.entries, key)
+		}
+	}
+}
+
+// hashBody returns the hash of the request body, and leaves the body in place
+// to be read by the handler
+func hashBody(req *http.Request) ([sha256.Size]byte, error) {
+	if req.Body == nil {
+		return sha256.Sum256(nil), nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return sha256.Sum256(body), nil
+}
+
+// replay writes the cached response, with all of its original headers
+func replay(c echo.Context, entry *cachedResponse) error {
+	for name, values := range entry.header {
+		c.Response().Header()[name] = append([]string(nil), values...)
+	}
+	c.Response().Header().Set(HeaderIdempotentReplayed, "true")
+	c.Response().WriteHeader(entry.status)
+	_, err := c.Response().Write(entry.body)
+	return err
+}
+
+func isMutation(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// responseRecorder keeps a copy of the response body written through it
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
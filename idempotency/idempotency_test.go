@@ -0,0 +1,155 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package idempotency
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(cache *Cache, calls *int) *echo.Echo {
+	e := echo.New()
+	e.Use(cache.Middleware())
+	e.POST("/:tenant_id/receiver", func(c echo.Context) error {
+		*calls++
+		c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("/%s/receiver/%d", c.Param("tenant_id"), *calls))
+		c.Response().Header().Set("ETag", fmt.Sprintf(`"%d"`, *calls))
+		return c.String(http.StatusCreated, fmt.Sprintf("created %d", *calls))
+	})
+	e.PUT("/:tenant_id/receiver", func(c echo.Context) error {
+		*calls++
+		return echo.NewHTTPError(http.StatusInternalServerError, "error")
+	})
+	e.DELETE("/:tenant_id/receiver/:name", func(c echo.Context) error {
+		*calls++
+		return c.String(http.StatusOK, fmt.Sprintf("deleted %d", *calls))
+	})
+	e.GET("/:tenant_id/receiver", func(c echo.Context) error {
+		*calls++
+		return c.String(http.StatusOK, fmt.Sprintf("read %d", *calls))
+	})
+	return e
+}
+
+func doRequest(e *echo.Echo, method, target, key string) *httptest.ResponseRecorder {
+	return doRequestWithBody(e, method, target, key, "")
+}
+
+func doRequestWithBody(e *echo.Echo, method, target, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(HeaderIdempotencyKey, key)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCache_Middleware(t *testing.T) {
+	calls := 0
+	cache := NewCache(time.Hour)
+	e := newTestServer(cache, &calls)
+
+	rec := doRequest(e, http.MethodPost, "/test/receiver", "key1")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "created 1", rec.Body.String())
+
+	// Same key replays the original response, headers included
+	rec = doRequest(e, http.MethodPost, "/test/receiver", "key1")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "created 1", rec.Body.String())
+	assert.Equal(t, "/test/receiver/1", rec.Header().Get(echo.HeaderLocation))
+	assert.Equal(t, `"1"`, rec.Header().Get("ETag"))
+	assert.Equal(t, echo.MIMETextPlainCharsetUTF8, rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, "true", rec.Header().Get(HeaderIdempotentReplayed))
+	assert.Equal(t, 1, calls)
+
+	// Different key executes fresh
+	rec = doRequest(e, http.MethodPost, "/test/receiver", "key2")
+	assert.Equal(t, "created 2", rec.Body.String())
+	assert.Equal(t, "", rec.Header().Get(HeaderIdempotentReplayed))
+
+	// Same key for another tenant executes fresh
+	rec = doRequest(e, http.MethodPost, "/other/receiver", "key1")
+	assert.Equal(t, "created 3", rec.Body.String())
+
+	// Requests without a key are always executed
+	doRequest(e, http.MethodPost, "/test/receiver", "")
+	doRequest(e, http.MethodPost, "/test/receiver", "")
+	assert.Equal(t, 5, calls)
+
+	// Reads are not cached
+	doRequest(e, http.MethodGet, "/test/receiver", "key3")
+	rec = doRequest(e, http.MethodGet, "/test/receiver", "key3")
+	assert.Equal(t, "read 7", rec.Body.String())
+
+	// Failed requests can be retried with the same key
+	rec = doRequest(e, http.MethodPut, "/test/receiver", "key4")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	doRequest(e, http.MethodPut, "/test/receiver", "key4")
+	assert.Equal(t, 9, calls)
+}
+
+func TestCache_DifferentRequest(t *testing.T) {
+	calls := 0
+	cache := NewCache(time.Hour)
+	e := newTestServer(cache, &calls)
+
+	rec := doRequest(e, http.MethodPost, "/test/receiver", "key1")
+	assert.Equal(t, "created 1", rec.Body.String())
+
+	// Reusing the key for another method or path is rejected rather than
+	// answered with the cached response or executed
+	rec = doRequest(e, http.MethodDelete, "/test/receiver/slack", "key1")
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, "", rec.Header().Get(HeaderIdempotentReplayed))
+	rec = doRequest(e, http.MethodPut, "/test/receiver", "key1")
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, 1, calls)
+
+	// Same for the same method and path with another body
+	rec = doRequestWithBody(e, http.MethodPost, "/test/receiver", "key1", `{"name": "slack"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, 1, calls)
+
+	// The original request is still replayed
+	rec = doRequest(e, http.MethodPost, "/test/receiver", "key1")
+	assert.Equal(t, "created 1", rec.Body.String())
+	assert.Equal(t, "true", rec.Header().Get(HeaderIdempotentReplayed))
+
+	// A retry with the same body is replayed
+	doRequestWithBody(e, http.MethodPost, "/test/receiver", "key2", `{"name": "slack"}`)
+	rec = doRequestWithBody(e, http.MethodPost, "/test/receiver", "key2", `{"name": "slack"}`)
+	assert.Equal(t, "created 2", rec.Body.String())
+	assert.Equal(t, "true", rec.Header().Get(HeaderIdempotentReplayed))
+}
+
+func TestCache_Expiry(t *testing.T) {
+	calls := 0
+	now := time.Now()
+	cache := NewCache(time.Minute)
+	cache.now = func() time.Time { return now }
+	e := newTestServer(cache, &calls)
+
+	doRequest(e, http.MethodPost, "/test/receiver", "key1")
+	now = now.Add(30 * time.Second)
+	rec := doRequest(e, http.MethodPost, "/test/receiver", "key1")
+	assert.Equal(t, "created 1", rec.Body.String())
+
+	now = now.Add(time.Minute)
+	rec = doRequest(e, http.MethodPost, "/test/receiver", "key1")
+	assert.Equal(t, "created 2", rec.Body.String())
+	assert.Equal(t, 1, len(cache.entries))
+}
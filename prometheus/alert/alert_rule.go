@@ -8,12 +8,17 @@
 package alert
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/facebookincubator/prometheus-configmanager/restrictor"
 
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"github.com/prometheus/prometheus/promql/parser"
 )
 
 type File struct {
@@ -24,7 +29,16 @@ type File struct {
 type RuleGroup struct {
 	Name     string         `yaml:"name"`
 	Interval model.Duration `yaml:"interval,omitempty"`
-	Rules    []rulefmt.Rule `yaml:"rules"`
+	// Limit caps the number of alerts the group's rules may produce, or the
+	// number of series they may record. Zero means no limit.
+	Limit int            `yaml:"limit,omitempty"`
+	Rules []rulefmt.Rule `yaml:"rules"`
+}
+
+// GroupedRule is a rule along with the name of the rule group it belongs to
+type GroupedRule struct {
+	Group string
+	Rule  rulefmt.Rule
 }
 
 func NewFile(tenantID string) *File {
@@ -37,59 +51,231 @@ func NewFile(tenantID string) *File {
 
 // Rules returns the rule configs from this file
 func (f *File) Rules() []rulefmt.Rule {
-	return f.RuleGroups[0].Rules
+	var rules []rulefmt.Rule
+	for _, group := range f.RuleGroups {
+		rules = append(rules, group.Rules...)
+	}
+	return rules
+}
+
+// GroupedRules returns the rule configs from this file along with the names
+// of the groups they are in
+func (f *File) GroupedRules() []GroupedRule {
+	var rules []GroupedRule
+	for _, group := range f.RuleGroups {
+		for _, rule := range group.Rules {
+			rules = append(rules, GroupedRule{Group: group.Name, Rule: rule})
+		}
+	}
+	return rules
+}
+
+// GetGroupedRule returns the specific rule by name along with the name of its
+// group. Nil if it isn't found
+func (f *File) GetGroupedRule(rulename string) *GroupedRule {
+	for _, group := range f.RuleGroups {
+		for _, rule := range group.Rules {
+			if getRuleName(rule) == rulename {
+				return &GroupedRule{Group: group.Name, Rule: rule}
+			}
+		}
+	}
+	return nil
 }
 
 // GetRule returns the specific rule by name. Nil if it isn't found
 func (f *File) GetRule(rulename string) *rulefmt.Rule {
-	for _, rule := range f.RuleGroups[0].Rules {
-		if rule.Alert == rulename {
-			return &rule
+	for _, group := range f.RuleGroups {
+		for _, rule := range group.Rules {
+			if getRuleName(rule) == rulename {
+				return &rule
+			}
 		}
 	}
 	return nil
 }
 
-// AddRule appends a new rule to the list of rules in this file
+// GetRuleByIndex returns the rule at position idx of the named group,
+// wrapping ErrRuleNotFound if there is no such group or index
+func (f *File) GetRuleByIndex(groupName string, idx int) (*rulefmt.Rule, error) {
+	for _, group := range f.RuleGroups {
+		if group.Name != groupName {
+			continue
+		}
+		if idx < 0 || idx >= len(group.Rules) {
+			return nil, fmt.Errorf("group %s has %d rules, no index %d: %w", groupName, len(group.Rules), idx, ErrRuleNotFound)
+		}
+		return &group.Rules[idx], nil
+	}
+	return nil, fmt.Errorf("group %s does not exist: %w", groupName, ErrRuleNotFound)
+}
+
+// GetGroupLimit returns the limit of the named group, wrapping
+// ErrGroupNotFound if there is no such group
+func (f *File) GetGroupLimit(groupName string) (int, error) {
+	for _, group := range f.RuleGroups {
+		if group.Name == groupName {
+			return group.Limit, nil
+		}
+	}
+	return 0, fmt.Errorf("group %s: %w", groupName, ErrGroupNotFound)
+}
+
+// SetGroupLimit sets the limit of the named group, wrapping ErrGroupNotFound
+// if there is no such group
+func (f *File) SetGroupLimit(groupName string, limit int) error {
+	for idx, group := range f.RuleGroups {
+		if group.Name == groupName {
+			f.RuleGroups[idx].Limit = limit
+			return nil
+		}
+	}
+	return fmt.Errorf("group %s: %w", groupName, ErrGroupNotFound)
+}
+
+// AddRule appends a new rule to the list of rules in the default group of
+// this file
 func (f *File) AddRule(rule rulefmt.Rule) {
-	f.RuleGroups[0].Rules = append(f.RuleGroups[0].Rules, rule)
+	f.AddRuleToGroup("", rule)
+}
+
+// AddRuleToGroup appends a new rule to the group with the given name,
+// creating the group if it doesn't exist. An empty group name refers to the
+// default (first) group of the file.
+func (f *File) AddRuleToGroup(groupName string, rule rulefmt.Rule) {
+	if groupName == "" {
+		f.RuleGroups[0].Rules = append(f.RuleGroups[0].Rules, rule)
+		return
+	}
+	for idx, group := range f.RuleGroups {
+		if group.Name == groupName {
+			f.RuleGroups[idx].Rules = append(group.Rules, rule)
+			return
+		}
+	}
+	f.RuleGroups = append(f.RuleGroups, RuleGroup{
+		Name:  groupName,
+		Rules: []rulefmt.Rule{rule},
+	})
+}
+
+// MergeDuplicateGroups merges the rules of groups sharing a name into the
+// first group with that name, which prometheus requires to be unique, and
+// returns the names of the groups that were merged. The interval and limit of
+// the first group are kept unless it doesn't set them.
+func (f *File) MergeDuplicateGroups() []string {
+	var merged []string
+	groups := make([]RuleGroup, 0, len(f.RuleGroups))
+	firstIdx := map[string]int{}
+	isMerged := map[string]bool{}
+	for _, group := range f.RuleGroups {
+		idx, ok := firstIdx[group.Name]
+		if !ok {
+			firstIdx[group.Name] = len(groups)
+			groups = append(groups, group)
+			continue
+		}
+		first := &groups[idx]
+		if !isMerged[group.Name] {
+			isMerged[group.Name] = true
+			merged = append(merged, group.Name)
+		}
+		first.Rules = append(first.Rules, group.Rules...)
+		if first.Interval == 0 {
+			first.Interval = group.Interval
+		}
+		if first.Limit == 0 {
+			first.Limit = group.Limit
+		}
+	}
+	f.RuleGroups = groups
+	return merged
 }
 
 // ReplaceRule replaces an existing rule. Returns error if rule does not
 // exist already
 func (f *File) ReplaceRule(newRule rulefmt.Rule) error {
-	ruleIdx := -1
-	for idx, rule := range f.RuleGroups[0].Rules {
-		if rule.Alert == newRule.Alert {
-			ruleIdx = idx
+	for groupIdx, group := range f.RuleGroups {
+		for idx, rule := range group.Rules {
+			if getRuleName(rule) == getRuleName(newRule) {
+				f.RuleGroups[groupIdx].Rules[idx] = newRule
+				return nil
+			}
 		}
 	}
-	if ruleIdx < 0 {
-		return fmt.Errorf("rule %s does not exist", newRule.Alert)
-	}
+	return fmt.Errorf("rule %s does not exist", getRuleName(newRule))
+}
 
-	f.RuleGroups[0].Rules[ruleIdx] = newRule
+// ReplaceRuleInGroup replaces an existing rule, moving it to the named group
+// if it is currently in a different one. An empty group name leaves the rule
+// in the group it is already in.
+func (f *File) ReplaceRuleInGroup(groupName string, newRule rulefmt.Rule) error {
+	ruleName := getRuleName(newRule)
+	existing := f.GetGroupedRule(ruleName)
+	if existing == nil {
+		return fmt.Errorf("rule %s does not exist", ruleName)
+	}
+	if groupName == "" || groupName == existing.Group {
+		return f.ReplaceRule(newRule)
+	}
+	err := f.DeleteRule(ruleName)
+	if err != nil {
+		return err
+	}
+	f.AddRuleToGroup(groupName, newRule)
 	return nil
 }
 
 func (f *File) DeleteRule(name string) error {
-	rules := f.RuleGroups[0].Rules
-	for idx, rule := range rules {
-		if rule.Alert == name {
-			f.RuleGroups[0].Rules = append(rules[:idx], rules[idx+1:]...)
-			return nil
+	for groupIdx, group := range f.RuleGroups {
+		for idx, rule := range group.Rules {
+			if getRuleName(rule) == name {
+				f.RuleGroups[groupIdx].Rules = append(group.Rules[:idx], group.Rules[idx+1:]...)
+				return nil
+			}
 		}
 	}
 	return fmt.Errorf("alert with name %s not found", name)
 }
 
+// SkipRestrictionAnnotation marks a rule whose expression isn't restricted to
+// the tenant when it's secured, if the tenancy config allows it
+const SkipRestrictionAnnotation = "configmanager/skip-restriction"
+
+// SkipsRestriction returns whether the rule is annotated to skip restriction
+func SkipsRestriction(rule rulefmt.Rule) bool {
+	return rule.Annotations[SkipRestrictionAnnotation] == "true"
+}
+
 // SecureRule attaches a label for tenantID to the given alert expression to
 // to ensure that only metrics owned by this tenant can be alerted on
 func SecureRule(restrictQueries bool, matcherName, matcherValue string, rule *rulefmt.Rule) error {
+	return SecureRuleWithMatchers(restrictQueries, map[string]string{matcherName: matcherValue}, rule)
+}
+
+// SecureRuleWithMatchers secures the rule like SecureRule for a tenant
+// identified by more than one label, e.g. org and team. The expression is
+// restricted with an equality matcher for each label and the rule is given
+// each label.
+func SecureRuleWithMatchers(restrictQueries bool, matchers map[string]string, rule *rulefmt.Rule) error {
+	names := make([]string, 0, len(matchers))
+	for name := range matchers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := CheckRestrictorLabelCase(*rule, name); err != nil {
+			return err
+		}
+	}
+
 	expr := rule.Expr
 	var err error
 	if restrictQueries {
-		queryRestrictor := restrictor.NewQueryRestrictor(restrictor.DefaultOpts).AddMatcher(matcherName, matcherValue)
+		queryRestrictor := restrictor.NewQueryRestrictor(restrictor.DefaultOpts)
+		for _, name := range names {
+			queryRestrictor.AddMatcher(name, matchers[name])
+		}
 		expr, err = queryRestrictor.RestrictQuery(rule.Expr)
 		if err != nil {
 			return err
@@ -100,10 +286,137 @@ func SecureRule(restrictQueries bool, matcherName, matcherValue string, rule *ru
 	if rule.Labels == nil {
 		rule.Labels = make(map[string]string)
 	}
-	rule.Labels[matcherName] = matcherValue
+	for _, name := range names {
+		rule.Labels[name] = matchers[name]
+	}
+	return nil
+}
+
+// CheckRestrictorLabelCase returns a RuleValidationError if the rule has a
+// label whose name differs from restrictorLabel only in case. Such a label
+// passes validation, but isn't the label the tenant's alerts are matched on.
+func CheckRestrictorLabelCase(rule rulefmt.Rule, restrictorLabel string) error {
+	for _, name := range sortedKeys(rule.Labels) {
+		if name != restrictorLabel && strings.EqualFold(name, restrictorLabel) {
+			return RuleValidationError{Err: fmt.Errorf("label %s differs from the restrictor label %s only in case", name, restrictorLabel)}
+		}
+	}
 	return nil
 }
 
+// RestrictExpr returns expr restricted to the tenant's series the way
+// SecureRule stores it under the given tenancy config. Expressions are left
+// as they are if queries aren't restricted.
+func RestrictExpr(tenancy TenancyConfig, tenantID, expr string) (string, error) {
+	if !tenancy.RestrictQueries || tenancy.RestrictorLabel == "" {
+		return expr, nil
+	}
+	return restrictor.NewQueryRestrictor(restrictor.DefaultOpts).AddMatcher(tenancy.RestrictorLabel, tenantID).RestrictQuery(expr)
+}
+
+// WouldRestrict reports whether restricting expr to the tenant changes it,
+// along with the restricted expression. Expressions are compared in canonical
+// form, so one that already carries the tenant matcher isn't changed no
+// matter how it's formatted.
+func WouldRestrict(expr, restrictorLabel, tenantID string) (bool, string, error) {
+	formatted, err := FormatExpr(expr)
+	if err != nil {
+		return false, "", err
+	}
+	restricted, err := restrictor.NewQueryRestrictor(restrictor.DefaultOpts).AddMatcher(restrictorLabel, tenantID).RestrictQuery(expr)
+	if err != nil {
+		return false, "", err
+	}
+	return restricted != formatted, restricted, nil
+}
+
+// UnsecureRule reverses SecureRule by removing the tenantID label and the
+// tenant matcher from each selector in the rule's expression. Selectors that
+// already matched on the restrictor label before being secured lose that
+// matcher, since SecureRule overwrote its value.
+func UnsecureRule(restrictorLabel, tenantID string, rule *rulefmt.Rule) error {
+	queryRestrictor := restrictor.NewQueryRestrictor(restrictor.DefaultOpts).AddMatcher(restrictorLabel, tenantID)
+	expr, err := queryRestrictor.UnrestrictQuery(rule.Expr)
+	if err != nil {
+		return err
+	}
+
+	rule.Expr = expr
+	delete(rule.Labels, restrictorLabel)
+	return nil
+}
+
+// ExprParseError is an error parsing a PromQL expression, along with the
+// range of positions in the expression it was found at
+type ExprParseError struct {
+	Message string `json:"message"`
+	Start   int    `json:"start"`
+	End     int    `json:"end"`
+}
+
+func (e *ExprParseError) Error() string {
+	return e.Message
+}
+
+// FormatExpr parses a PromQL expression and returns it in canonical form,
+// or an *ExprParseError if it can't be parsed
+func FormatExpr(expr string) (string, error) {
+	parsed, err := parseExpr(expr)
+	if err != nil {
+		return "", err
+	}
+	return parsed.String(), nil
+}
+
+// ExprMetrics returns the sorted, distinct names of the metrics selected
+// anywhere in a PromQL expression, including inside range vectors and
+// subqueries, or an *ExprParseError if it can't be parsed. Selectors that
+// don't match a metric by name, such as {job="api"}, aren't included.
+func ExprMetrics(expr string) ([]string, error) {
+	parsed, err := parseExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]struct{}{}
+	parser.Inspect(parsed, func(node parser.Node, _ []parser.Node) error {
+		selector, ok := node.(*parser.VectorSelector)
+		if !ok {
+			return nil
+		}
+		if selector.Name != "" {
+			names[selector.Name] = struct{}{}
+			return nil
+		}
+		for _, matcher := range selector.LabelMatchers {
+			if matcher.Name == labels.MetricName && matcher.Type == labels.MatchEqual {
+				names[matcher.Value] = struct{}{}
+			}
+		}
+		return nil
+	})
+
+	metrics := make([]string, 0, len(names))
+	for name := range names {
+		metrics = append(metrics, name)
+	}
+	sort.Strings(metrics)
+	return metrics, nil
+}
+
+func parseExpr(expr string) (parser.Expr, error) {
+	parsed, err := parser.ParseExpr(expr)
+	if err != nil {
+		parseErr := &ExprParseError{Message: err.Error()}
+		var parseErrs parser.ParseErrors
+		if errors.As(err, &parseErrs) && len(parseErrs) > 0 {
+			parseErr.Start = int(parseErrs[0].PositionRange.Start)
+			parseErr.End = int(parseErrs[0].PositionRange.End)
+		}
+		return nil, parseErr
+	}
+	return parsed, nil
+}
+
 // RuleJSONWrapper Provides a struct to marshal/unmarshal into a rulefmt.Rule
 // since rulefmt does not support json encoding
 type RuleJSONWrapper struct {
@@ -113,6 +426,7 @@ type RuleJSONWrapper struct {
 	For         string            `json:"for,omitempty"`
 	Labels      map[string]string `json:"labels,omitempty"`
 	Annotations map[string]string `json:"annotations,omitempty"`
+	Group       string            `json:"group,omitempty"`
 }
 
 func (r *RuleJSONWrapper) ToRuleFmt() (rulefmt.Rule, error) {
@@ -8,6 +8,7 @@
 package alert_test
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/facebookincubator/prometheus-configmanager/prometheus/alert"
@@ -47,6 +48,22 @@ func TestFile_GetRule(t *testing.T) {
 	assert.Nil(t, rule)
 }
 
+func TestFile_GetRuleByIndex(t *testing.T) {
+	f := sampleFile()
+	f.AddRuleToGroup("testGroup", sampleRule2)
+
+	rule, err := f.GetRuleByIndex("testGroup", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, sampleRule2, *rule)
+
+	_, err = f.GetRuleByIndex("testGroup", 2)
+	assert.True(t, errors.Is(err, alert.ErrRuleNotFound))
+	_, err = f.GetRuleByIndex("testGroup", -1)
+	assert.True(t, errors.Is(err, alert.ErrRuleNotFound))
+	_, err = f.GetRuleByIndex("missingGroup", 0)
+	assert.EqualError(t, err, "group missingGroup does not exist: rule not found")
+}
+
 func TestFile_AddRule(t *testing.T) {
 	f := sampleFile()
 
@@ -56,6 +73,31 @@ func TestFile_AddRule(t *testing.T) {
 	assert.NotNil(t, f.GetRule(alertName2))
 }
 
+func TestFile_AddRuleToGroup(t *testing.T) {
+	f := sampleFile()
+
+	// empty group name adds to the default group
+	f.AddRuleToGroup("", sampleRule2)
+	assert.Equal(t, 1, len(f.RuleGroups))
+	assert.Equal(t, 2, len(f.RuleGroups[0].Rules))
+
+	// unknown group name creates a new group
+	newRule := rulefmt.Rule{Alert: "newGroupAlert", Expr: "up == 0"}
+	f.AddRuleToGroup("otherGroup", newRule)
+	assert.Equal(t, 2, len(f.RuleGroups))
+	assert.Equal(t, "otherGroup", f.RuleGroups[1].Name)
+	assert.Equal(t, []rulefmt.Rule{newRule}, f.RuleGroups[1].Rules)
+	assert.Equal(t, 3, len(f.Rules()))
+	assert.NotNil(t, f.GetRule("newGroupAlert"))
+
+	// rules in non-default groups can be replaced and deleted
+	newRule.Expr = "up == 1"
+	assert.NoError(t, f.ReplaceRule(newRule))
+	assert.Equal(t, "up == 1", f.GetRule("newGroupAlert").Expr)
+	assert.NoError(t, f.DeleteRule("newGroupAlert"))
+	assert.Nil(t, f.GetRule("newGroupAlert"))
+}
+
 func TestFile_ReplaceRule(t *testing.T) {
 	f := sampleFile()
 	newRule := rulefmt.Rule{
@@ -75,6 +117,42 @@ func TestFile_ReplaceRule(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestFile_ReplaceRuleKeepsPosition(t *testing.T) {
+	f := sampleFile()
+	f.AddRule(sampleRule2)
+	f.AddRule(rulefmt.Rule{Alert: "thirdRule", Expr: "up == 2"})
+	newRule := rulefmt.Rule{Alert: alertName, Expr: "up == 1"}
+
+	assert.NoError(t, f.ReplaceRule(newRule))
+	assert.Equal(t, newRule, f.Rules()[0])
+	assert.Equal(t, alertName2, f.Rules()[1].Alert)
+	assert.Equal(t, "thirdRule", f.Rules()[2].Alert)
+
+	// Naming the group the rule is already in doesn't move it either
+	assert.NoError(t, f.ReplaceRuleInGroup("testGroup", sampleRule))
+	assert.Equal(t, sampleRule, f.Rules()[0])
+}
+
+func TestFile_ReplaceRuleInGroup(t *testing.T) {
+	f := sampleFile()
+	newRule := rulefmt.Rule{
+		Alert: alertName,
+		Expr:  "up == 1",
+	}
+
+	// empty group name replaces the rule where it is
+	assert.NoError(t, f.ReplaceRuleInGroup("", newRule))
+	assert.Equal(t, []alert.GroupedRule{{Group: "testGroup", Rule: newRule}}, f.GroupedRules())
+
+	// different group name moves the rule
+	assert.NoError(t, f.ReplaceRuleInGroup("otherGroup", sampleRule))
+	assert.Equal(t, 0, len(f.RuleGroups[0].Rules))
+	assert.Equal(t, &alert.GroupedRule{Group: "otherGroup", Rule: sampleRule}, f.GetGroupedRule(alertName))
+
+	err := f.ReplaceRuleInGroup("otherGroup", rulefmt.Rule{Alert: "badRule"})
+	assert.EqualError(t, err, "rule badRule does not exist")
+}
+
 func TestFile_DeleteRule(t *testing.T) {
 	f := sampleFile()
 	err := f.DeleteRule(alertName)
@@ -127,6 +205,127 @@ func TestSecureRule(t *testing.T) {
 	assert.Equal(t, "test", rule.Labels["tenantID"])
 }
 
+func TestSecureRuleWithMatchers(t *testing.T) {
+	rule := rulefmt.Rule{
+		Alert:  "test",
+		Expr:   "up == 0",
+		Labels: map[string]string{"name": "value"},
+	}
+	err := alert.SecureRuleWithMatchers(true, map[string]string{"org": "acme", "team": "payments"}, &rule)
+	assert.NoError(t, err)
+	assert.Equal(t, `up{org="acme",team="payments"} == 0`, rule.Expr)
+	assert.Equal(t, map[string]string{"name": "value", "org": "acme", "team": "payments"}, rule.Labels)
+
+	// the expression is left alone when restrictQueries is false
+	rule = rulefmt.Rule{Alert: "test", Expr: "up == 0"}
+	err = alert.SecureRuleWithMatchers(false, map[string]string{"org": "acme", "team": "payments"}, &rule)
+	assert.NoError(t, err)
+	assert.Equal(t, "up == 0", rule.Expr)
+	assert.Equal(t, map[string]string{"org": "acme", "team": "payments"}, rule.Labels)
+}
+
+func TestCheckRestrictorLabelCase(t *testing.T) {
+	rule := rulefmt.Rule{Alert: "test", Expr: "up == 0", Labels: map[string]string{"TenantID": "other"}}
+	err := alert.CheckRestrictorLabelCase(rule, "tenantID")
+	assert.IsType(t, alert.RuleValidationError{}, err)
+	assert.EqualError(t, err, "label TenantID differs from the restrictor label tenantID only in case")
+
+	// Securing the rule fails rather than adding a second tenant label
+	err = alert.SecureRule(true, "tenantID", "test", &rule)
+	assert.EqualError(t, err, "label TenantID differs from the restrictor label tenantID only in case")
+	assert.Equal(t, "up == 0", rule.Expr)
+	assert.Equal(t, map[string]string{"TenantID": "other"}, rule.Labels)
+
+	// The restrictor label itself and unrelated labels are fine
+	rule.Labels = map[string]string{"tenantID": "test", "tenant": "test"}
+	assert.NoError(t, alert.CheckRestrictorLabelCase(rule, "tenantID"))
+	assert.NoError(t, alert.CheckRestrictorLabelCase(rulefmt.Rule{Alert: "test", Expr: "up == 0"}, "tenantID"))
+}
+
+func TestUnsecureRule(t *testing.T) {
+	for _, expr := range []string{
+		`up == 0`,
+		`sum by(job) (rate(http_requests_total{code=~"5.."}[5m])) > 1`,
+		`up{job="node"} == 0 and on(instance) node_load1{mode!="idle"} > 4`,
+	} {
+		rule := rulefmt.Rule{
+			Alert:  alertName2,
+			Expr:   expr,
+			Labels: map[string]string{"name": "value"},
+		}
+		assert.NoError(t, alert.SecureRule(true, "tenantID", "test", &rule))
+		assert.NotEqual(t, expr, rule.Expr)
+
+		assert.NoError(t, alert.UnsecureRule("tenantID", "test", &rule))
+		assert.Equal(t, expr, rule.Expr)
+		assert.Equal(t, map[string]string{"name": "value"}, rule.Labels)
+	}
+
+	// Matcher merged into an existing selector for the restrictor label
+	rule := rulefmt.Rule{Alert: alertName2, Expr: `up{job="node",tenantID=~"other"} == 0`}
+	assert.NoError(t, alert.SecureRule(true, "tenantID", "test", &rule))
+	assert.Equal(t, `up{job="node",tenantID=~"test"} == 0`, rule.Expr)
+	assert.NoError(t, alert.UnsecureRule("tenantID", "test", &rule))
+	assert.Equal(t, `up{job="node"} == 0`, rule.Expr)
+	assert.Empty(t, rule.Labels)
+
+	// Other tenants' matchers are kept
+	rule = rulefmt.Rule{Alert: alertName2, Expr: `up{tenantID="other"} == 0`}
+	assert.NoError(t, alert.UnsecureRule("tenantID", "test", &rule))
+	assert.Equal(t, `up{tenantID="other"} == 0`, rule.Expr)
+
+	rule = rulefmt.Rule{Alert: alertName2, Expr: `up{`}
+	assert.Error(t, alert.UnsecureRule("tenantID", "test", &rule))
+}
+
+func TestWouldRestrict(t *testing.T) {
+	changed, restricted, err := alert.WouldRestrict("up == 0", "tenant", "test")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, `up{tenant="test"} == 0`, restricted)
+
+	// Already restricted expressions aren't changed, regardless of formatting
+	changed, restricted, err = alert.WouldRestrict(`sum(rate(http_requests_total{tenant="test"}[5m]))by(job)`, "tenant", "test")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, `sum by(job) (rate(http_requests_total{tenant="test"}[5m]))`, restricted)
+
+	// A matcher for another tenant is replaced
+	changed, restricted, err = alert.WouldRestrict(`up{tenant="other"}`, "tenant", "test")
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, `up{tenant="test"}`, restricted)
+
+	_, _, err = alert.WouldRestrict("up{", "tenant", "test")
+	assert.Error(t, err)
+}
+
+func TestFormatExpr(t *testing.T) {
+	formatted, err := alert.FormatExpr(`sum(rate(http_requests_total{job="api"}[5m]))by(code)>0`)
+	assert.NoError(t, err)
+	assert.Equal(t, `sum by(code) (rate(http_requests_total{job="api"}[5m])) > 0`, formatted)
+
+	_, err = alert.FormatExpr("sum(up) by (job")
+	assert.Equal(t, &alert.ExprParseError{Message: "1:16: parse error: unclosed left parenthesis", Start: 15, End: 15}, err)
+}
+
+func TestExprMetrics(t *testing.T) {
+	metrics, err := alert.ExprMetrics("up == 0")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"up"}, metrics)
+
+	metrics, err = alert.ExprMetrics(`sum(rate(http_requests_total{code="500"}[5m])) / sum(rate(http_requests_total[5m])) > 0.1 and on() max_over_time(node_load1[1h:5m]) > {__name__="load_threshold"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http_requests_total", "load_threshold", "node_load1"}, metrics)
+
+	metrics, err = alert.ExprMetrics("vector(1)")
+	assert.NoError(t, err)
+	assert.Empty(t, metrics)
+
+	_, err = alert.ExprMetrics("sum(up) by (job")
+	assert.Equal(t, &alert.ExprParseError{Message: "1:16: parse error: unclosed left parenthesis", Start: 15, End: 15}, err)
+}
+
 func TestRuleJSONWrapper_ToRuleFmt(t *testing.T) {
 	jsonRule := alert.RuleJSONWrapper{
 		Record:      "record",
@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package alert
+
+import (
+	"reflect"
+
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"gopkg.in/yaml.v3"
+)
+
+// WithAnchorPreservation keeps the YAML anchors and aliases of hand-maintained
+// rules files when they're written. Rules left unchanged by a write are
+// written back as they were in the file, rather than with their aliases
+// expanded.
+func WithAnchorPreservation(enabled bool) ClientOption {
+	return func(c *client) {
+		c.preserveAnchors = enabled
+	}
+}
+
+// marshalRuleFile marshals ruleFile to be written to filename, keeping the
+// anchors of the file's current contents if WithAnchorPreservation is set
+func (c *client) marshalRuleFile(ruleFile *File, filename string) ([]byte, error) {
+	if !c.preserveAnchors {
+		return yaml.Marshal(ruleFile)
+	}
+	sourceFile := c.sourceFilename(filename)
+	if sourceFile != filename {
+		c.fileLocks.RLock(sourceFile)
+		defer c.fileLocks.RUnlock(sourceFile)
+	}
+	original, err := c.fsClient.ReadFile(sourceFile)
+	if err != nil {
+		return yaml.Marshal(ruleFile)
+	}
+	return marshalPreservingAnchors(ruleFile, original)
+}
+
+// marshalPreservingAnchors marshals ruleFile, reusing the YAML nodes of the
+// rules in original, the file's current contents, that are unchanged.
+// Aliases whose anchor was removed are replaced by the anchored value.
+func marshalPreservingAnchors(ruleFile *File, original []byte) ([]byte, error) {
+	var originalDoc yaml.Node
+	if err := yaml.Unmarshal(original, &originalDoc); err != nil || !hasAnchors(&originalDoc) {
+		return yaml.Marshal(ruleFile)
+	}
+	originalRules := ruleNodesByGroup(&originalDoc)
+
+	var doc yaml.Node
+	if err := doc.Encode(ruleFile); err != nil {
+		return nil, err
+	}
+	groupsNode := mappingValue(&doc, "groups")
+	for i, group := range ruleFile.RuleGroups {
+		rulesNode := mappingValue(groupsNode.Content[i], "rules")
+		for j, rule := range group.Rules {
+			if node := originalRules.take(group.Name, rule); node != nil {
+				rulesNode.Content[j] = node
+			}
+		}
+	}
+	inlineDanglingAliases(&doc, map[string]bool{})
+	return yaml.Marshal(&doc)
+}
+
+// ruleNode is a rule of a rules file along with the node it was decoded from
+type ruleNode struct {
+	rule rulefmt.Rule
+	node *yaml.Node
+}
+
+type groupRuleNodes map[string][]ruleNode
+
+func ruleNodesByGroup(doc *yaml.Node) groupRuleNodes {
+	nodes := groupRuleNodes{}
+	groupsNode := mappingValue(doc, "groups")
+	if groupsNode == nil || groupsNode.Kind != yaml.SequenceNode {
+		return nodes
+	}
+	for _, groupNode := range groupsNode.Content {
+		nameNode, rulesNode := mappingValue(groupNode, "name"), mappingValue(groupNode, "rules")
+		if nameNode == nil || rulesNode == nil || rulesNode.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, node := range rulesNode.Content {
+			var rule rulefmt.Rule
+			if err := node.Decode(&rule); err != nil {
+				continue
+			}
+			nodes[nameNode.Value] = append(nodes[nameNode.Value], ruleNode{rule: rule, node: node})
+		}
+	}
+	return nodes
+}
+
+// take returns the node of a rule in the group equal to rule, which isn't
+// returned again, or nil if there is none
+func (n groupRuleNodes) take(group string, rule rulefmt.Rule) *yaml.Node {
+	for i, candidate := range n[group] {
+		if reflect.DeepEqual(candidate.rule, rule) {
+			n[group] = append(n[group][:i], n[group][i+1:]...)
+			return candidate.node
+		}
+	}
+	return nil
+}
+
+// mappingValue returns the value of key in the mapping node, or in the
+// mapping at the root of the document node, or nil if it has none
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func hasAnchors(node *yaml.Node) bool {
+	if node.Anchor != "" || node.Kind == yaml.AliasNode {
+		return true
+	}
+	for _, child := range node.Content {
+		if hasAnchors(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// inlineDanglingAliases replaces each alias that isn't preceded by its anchor
+// with the anchored value, which then defines the anchor for the aliases
+// after it
+func inlineDanglingAliases(node *yaml.Node, defined map[string]bool) {
+	if node.Kind == yaml.AliasNode && !defined[node.Value] && node.Alias != nil {
+		*node = *node.Alias
+	}
+	if node.Anchor != "" {
+		defined[node.Anchor] = true
+	}
+	for _, child := range node.Content {
+		inlineDanglingAliases(child, defined)
+	}
+}
@@ -9,11 +9,17 @@ package alert
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"os"
+	"reflect"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/pkg/errors"
@@ -29,6 +35,16 @@ import (
 
 const (
 	rulesFilePostfix = "_rules.yml"
+	// stagingFilePostfix names the file staged changes to a tenant's rules
+	// are written to. Prometheus only loads *_rules.yml files, so staged rules
+	// aren't evaluated until they're promoted.
+	stagingFilePostfix = "_rules.staging.yml"
+
+	runbookURLAnnotation = "runbook_url"
+
+	// DefaultRuleFileMode is the permission rules files are written with
+	// unless WithFileMode is given
+	DefaultRuleFileMode os.FileMode = 0666
 )
 
 // PrometheusAlertClient provides thread-safe methods for writing, reading,
@@ -36,37 +52,292 @@ const (
 type PrometheusAlertClient interface {
 	RuleExists(filePrefix, rulename string) bool
 	WriteRule(filePrefix string, rule rulefmt.Rule) error
+	WriteRuleToGroup(filePrefix, groupName string, rule rulefmt.Rule) error
 	UpdateRule(filePrefix string, rule rulefmt.Rule) error
+	UpdateRuleInGroup(filePrefix, groupName string, rule rulefmt.Rule) error
 	ReadRules(filePrefix, ruleName string) ([]rulefmt.Rule, error)
+	ReadRulesWithGroups(filePrefix, ruleName string) ([]GroupedRule, error)
+	// GetRuleByIndex returns the rule at position idx of the named group,
+	// which identifies rules that share a name or have none
+	GetRuleByIndex(filePrefix, groupName string, idx int) (*rulefmt.Rule, error)
+	// ListRuleNames returns the sorted names of all alerting and recording
+	// rules in the tenant's file
+	ListRuleNames(filePrefix string) ([]string, error)
 	DeleteRule(filePrefix, ruleName string) error
 	BulkUpdateRules(filePrefix string, rules []rulefmt.Rule) (BulkUpdateResults, error)
+	BulkUpdateRulesInGroups(filePrefix string, rules []GroupedRule) (BulkUpdateResults, error)
+	// ReplaceRules replaces all of the tenant's rules with the rule groups of
+	// ruleFile in a single write. Rules that aren't in ruleFile are removed.
+	ReplaceRules(filePrefix string, ruleFile File) error
+	MoveRule(srcPrefix, dstPrefix, ruleName string) error
+
+	// GetGroupLimit returns the limit on the number of alerts or series the
+	// named group's rules may produce, zero if it has none
+	GetGroupLimit(filePrefix, groupName string) (int, error)
+	// SetGroupLimit sets the limit of the named group, removing it if limit
+	// is zero
+	SetGroupLimit(filePrefix, groupName string, limit int) error
+
+	// AddLabelToAllRules sets the label on every rule in the tenant's file
+	AddLabelToAllRules(filePrefix, key, value string) error
+	// RemoveLabelFromAllRules removes the label from every rule in the
+	// tenant's file
+	RemoveLabelFromAllRules(filePrefix, key string) error
+
+	// FindRuleTenant returns every tenant that has an alerting rule with the
+	// given name, or an empty list if none do
+	FindRuleTenant(ruleName string) ([]string, error)
+
+	// ListTenants returns the sorted tenants that have a rules file,
+	// filtered and paged by opts
+	ListTenants(opts TenantListOptions) ([]string, error)
+	// RulesModTime returns when the tenant's rules file was last modified,
+	// or the zero time if the tenant has no rules file
+	RulesModTime(filePrefix string) (time.Time, error)
+
+	// CompareRules returns the names of rules that differ between the two
+	// tenants, ignoring the tenant restriction applied to each rule
+	CompareRules(prefixA, prefixB string) (RuleDiff, error)
+
+	// GetVariables returns the tenant's stored rule variables by name
+	GetVariables(filePrefix string) (map[string]string, error)
+	// SetVariable creates or updates a stored rule variable
+	SetVariable(filePrefix, name, value string) error
+	// DeleteVariable removes a stored rule variable
+	DeleteVariable(filePrefix, name string) error
+	// ExpandVariables replaces {{ var "name" }} references in the rule's
+	// expression and annotations with the tenant's stored variables. Rules
+	// are expanded when they're written, so changing a variable doesn't
+	// change rules that were written with it.
+	ExpandVariables(filePrefix string, rule rulefmt.Rule) (rulefmt.Rule, error)
+
+	// Staged returns a client whose rules are read from and written to each
+	// tenant's staging area instead of its live rules file. The staging
+	// area starts out with the live rules, and reloading prometheus through
+	// it does nothing since staged rules aren't loaded.
+	Staged() PrometheusAlertClient
+	// WithRestrictorMatchers returns a client that secures the rules it
+	// writes with the given label matchers in addition to the tenant's, for
+	// tenants identified by more than one label
+	WithRestrictorMatchers(matchers map[string]string) PrometheusAlertClient
+	// PromoteStaging replaces the tenant's live rules with its staged ones
+	// and empties the staging area. Prometheus must be reloaded afterwards.
+	PromoteStaging(filePrefix string) error
+	// DiscardStaging drops the tenant's staged changes
+	DiscardStaging(filePrefix string) error
+
 	ReloadPrometheus() error
+	// ReloadTenant reloads only the prometheus instances that load the
+	// tenant's rules, or all of them if the tenant isn't mapped to any
+	ReloadTenant(filePrefix string) error
 	Tenancy() TenancyConfig
+
+	// Close immediately runs any batched reload and stops batching further
+	// ones. It is safe to call more than once.
+	Close() error
 }
 
 type TenancyConfig struct {
 	RestrictorLabel string `json:"restrictor_label"`
 	RestrictQueries bool   `json:"restrict_queries"`
+	// AllowSkipRestriction lets rules annotated with SkipRestrictionAnnotation
+	// keep their expression unrestricted, e.g. for aggregations across
+	// tenants. Off by default since such rules can see every tenant's series.
+	AllowSkipRestriction bool `json:"allow_skip_restriction"`
+	// SkipRestrictionLabel leaves the tenant label off rules whose
+	// restriction is skipped as well
+	SkipRestrictionLabel bool `json:"skip_restriction_label"`
 }
 
 type client struct {
-	fileLocks     *FileLocker
-	prometheusURL string
-	fsClient      fsclient.FSClient
-	tenancy       TenancyConfig
+	fileLocks  *FileLocker
+	fsClient   fsclient.FSClient
+	tenancy    TenancyConfig
+	defaultFor model.Duration
+	fileMode   os.FileMode
+	fileHeader string
+
+	// restrictorMatchers are set on the view returned by
+	// WithRestrictorMatchers
+	restrictorMatchers map[string]string
+
+	// prometheusURLs are the instances reloaded after rules change. Each
+	// must be reloaded successfully unless reloadQuorum is set.
+	prometheusURLs []string
+	reloadQuorum   int
+	reloadPath     string
+	// reloadCoalescer batches reloads if WithReloadWindow is set
+	reloadWindow    time.Duration
+	reloadMaxDelay  time.Duration
+	reloadCoalescer *ReloadCoalescer
+	// tenantTargets maps tenants to the instances that load their rules if
+	// WithTenantTargets is set
+	tenantTargets  map[string][]string
+	pendingTargets *pendingTargets
+
+	requiredLabels      []string
+	requiredAnnotations []string
+	validateRunbookURL  bool
+
+	legacyCompat    bool
+	preserveAnchors bool
+
+	globalRuleUniqueness bool
+	bulkTenantCheck      bool
+	// uniquenessLock serializes checking a rule name against other tenants'
+	// files with writing it, so two tenants can't claim the same name at once.
+	// It's shared with the client's staged view.
+	uniquenessLock *sync.Mutex
+
+	// staged is set on the view returned by Staged
+	staged bool
+}
+
+// ClientOption configures optional behavior of the alert client
+type ClientOption func(*client)
+
+// WithDefaultFor sets the 'for' duration applied to alerting rules that are
+// written without one. A zero duration disables the default.
+func WithDefaultFor(defaultFor model.Duration) ClientOption {
+	return func(c *client) {
+		c.defaultFor = defaultFor
+	}
+}
+
+// WithRequiredKeys sets the label and annotation names that every alerting
+// rule must carry to be written
+func WithRequiredKeys(labels, annotations []string) ClientOption {
+	return func(c *client) {
+		c.requiredLabels = labels
+		c.requiredAnnotations = annotations
+	}
+}
+
+// WithRunbookURLValidation requires the runbook_url annotation, when a rule
+// has one, to be an absolute http(s) URL
+func WithRunbookURLValidation(enabled bool) ClientOption {
+	return func(c *client) {
+		c.validateRunbookURL = enabled
+	}
+}
+
+// WithLegacyCompat allows rules files in the legacy layout, without rule
+// groups, to be read. They are written back in the current layout.
+func WithLegacyCompat(enabled bool) ClientOption {
+	return func(c *client) {
+		c.legacyCompat = enabled
+	}
 }
 
-func NewClient(fileLocks *FileLocker, prometheusURL string, fsClient fsclient.FSClient, tenancy TenancyConfig) PrometheusAlertClient {
-	return &client{
-		fileLocks:     fileLocks,
-		prometheusURL: prometheusURL,
-		fsClient:      fsClient,
-		tenancy:       tenancy,
+// WithGlobalRuleUniqueness requires alerting rule names to be unique across
+// all tenants rather than just within a single tenant's file
+func WithGlobalRuleUniqueness(enabled bool) ClientOption {
+	return func(c *client) {
+		c.globalRuleUniqueness = enabled
 	}
 }
 
+// WithBulkTenantCheck rejects a bulk update if any of its rules already
+// carries the restrictor label with a value other than the tenant, rather
+// than overwriting the label when the rule is secured
+func WithBulkTenantCheck(enabled bool) ClientOption {
+	return func(c *client) {
+		c.bulkTenantCheck = enabled
+	}
+}
+
+// WithReloadQuorum sets how many of the prometheus instances must reload
+// successfully for ReloadPrometheus to succeed. Zero requires all of them.
+func WithReloadQuorum(quorum int) ClientOption {
+	return func(c *client) {
+		c.reloadQuorum = quorum
+	}
+}
+
+// DefaultReloadPath is the path of prometheus' reload endpoint unless
+// WithReloadPath is given
+const DefaultReloadPath = "/-/reload"
+
+// WithReloadPath sets the path prometheus' reload endpoint is served at, e.g.
+// when prometheus is behind a proxy that rewrites paths
+func WithReloadPath(path string) ClientOption {
+	return func(c *client) {
+		c.reloadPath = path
+	}
+}
+
+// WithReloadWindow batches reloads requested within window of each other
+// into a single reload, delaying none of them by more than maxDelay
+func WithReloadWindow(window, maxDelay time.Duration) ClientOption {
+	return func(c *client) {
+		c.reloadWindow = window
+		c.reloadMaxDelay = maxDelay
+	}
+}
+
+// WithFileMode sets the permission that rules files are written with
+func WithFileMode(mode os.FileMode) ClientOption {
+	return func(c *client) {
+		c.fileMode = mode
+	}
+}
+
+// FileHeaderTimestamp is replaced in the header set by WithFileHeader with the
+// time the file is written
+const FileHeaderTimestamp = "{{timestamp}}"
+
+// WithFileHeader sets a comment that is written at the top of every rules
+// file. Lines of the header that aren't already comments are made into
+// comments, so the file still parses as rules and the header is skipped when
+// it is read back.
+func WithFileHeader(header string) ClientOption {
+	return func(c *client) {
+		c.fileHeader = header
+	}
+}
+
+// NewClient returns a PrometheusAlertClient. prometheusURL may be a
+// comma-separated list of instances, all of which are reloaded. It fails if
+// the tenancy config restricts queries without a restrictor label.
+func NewClient(fileLocks *FileLocker, prometheusURL string, fsClient fsclient.FSClient, tenancy TenancyConfig, opts ...ClientOption) (PrometheusAlertClient, error) {
+	// Restricting by an empty label would match series that have no label at
+	// all rather than the tenant's
+	if tenancy.RestrictQueries && tenancy.RestrictorLabel == "" {
+		return nil, errors.New("restricting queries requires a restrictor label")
+	}
+	c := &client{
+		fileLocks:      fileLocks,
+		prometheusURLs: splitURLs(prometheusURL),
+		fsClient:       fsClient,
+		tenancy:        tenancy,
+		fileMode:       DefaultRuleFileMode,
+		reloadPath:     DefaultReloadPath,
+		uniquenessLock: &sync.Mutex{},
+		pendingTargets: &pendingTargets{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.reloadWindow > 0 {
+		c.reloadCoalescer = NewReloadCoalescer(c.reloadPendingInstances, c.reloadWindow, c.reloadMaxDelay)
+	}
+	return c, nil
+}
+
 // ValidateRule checks that a new alert rule is a valid specification
 func ValidateRule(rule rulefmt.Rule) error {
+	validationErr := ValidateRuleDetailed(rule)
+	if validationErr != nil {
+		glog.Errorf("Invalid rule: %v", validationErr)
+		return validationErr
+	}
+	return nil
+}
+
+// ValidateRuleDetailed checks that a new alert rule is a valid specification
+// like ValidateRule, returning each problem found along with the field it was
+// found in, or nil if the rule is valid
+func ValidateRuleDetailed(rule rulefmt.Rule) *ValidationError {
 	// convert to RuleNode for validation
 	node := rulefmt.RuleNode{
 		Record:      yaml.Node{Value: rule.Record},
@@ -76,71 +347,190 @@ func ValidateRule(rule rulefmt.Rule) error {
 		Labels:      rule.Labels,
 		Annotations: rule.Annotations,
 	}
-	if len(node.Validate()) != 0 {
-		err := validateRuleImpl(node)
-		glog.Errorf("Invalid rule: %v", err)
+	if len(node.Validate()) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: validateRuleImpl(node)}
+}
+
+// FieldError is a problem with a rule found by validation. Field is the name
+// of the rule field, or "labels.<name>" and "annotations.<name>" for a single
+// label or annotation.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every problem found when validating a rule
+type ValidationError struct {
+	Fields []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	msg := "Rule Validation Error"
+	for _, field := range e.Fields {
+		msg += "; " + field.Message
+	}
+	return msg
+}
+
+// MarshalJSON includes the combined message of Error alongside the field
+// errors, so the error is still readable by clients that only look for a
+// message
+func (e *ValidationError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Message string       `json:"message"`
+		Fields  []FieldError `json:"errors"`
+	}{Message: e.Error(), Fields: e.Fields})
+}
+
+// ValidateRequiredKeys checks that an alerting rule carries all of the given
+// labels and annotations. Recording rules are not checked.
+func ValidateRequiredKeys(rule rulefmt.Rule, requiredLabels, requiredAnnotations []string) error {
+	if rule.Alert == "" {
+		return nil
+	}
+	var missingLabels, missingAnnotations []string
+	for _, label := range requiredLabels {
+		if _, ok := rule.Labels[label]; !ok {
+			missingLabels = append(missingLabels, label)
+		}
+	}
+	for _, annotation := range requiredAnnotations {
+		if _, ok := rule.Annotations[annotation]; !ok {
+			missingAnnotations = append(missingAnnotations, annotation)
+		}
+	}
+	if len(missingLabels) == 0 && len(missingAnnotations) == 0 {
+		return nil
+	}
+
+	err := errors.New("Rule Validation Error")
+	if len(missingLabels) > 0 {
+		err = fmt.Errorf("%v; missing required labels: %s", err, strings.Join(missingLabels, ", "))
+	}
+	if len(missingAnnotations) > 0 {
+		err = fmt.Errorf("%v; missing required annotations: %s", err, strings.Join(missingAnnotations, ", "))
+	}
+	return RuleValidationError{Err: err}
+}
+
+// ValidateRunbookURL checks that the runbook_url annotation, if present, is an
+// absolute http or https URL
+func ValidateRunbookURL(rule rulefmt.Rule) error {
+	runbook, ok := rule.Annotations[runbookURLAnnotation]
+	if !ok {
+		return nil
+	}
+	parsed, err := url.Parse(runbook)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return RuleValidationError{Err: fmt.Errorf("Rule Validation Error; %s must be an absolute http(s) URL: %q", runbookURLAnnotation, runbook)}
+	}
+	return nil
+}
+
+// validateConfiguredRules runs the validations enabled through ClientOptions
+func (c *client) validateConfiguredRules(rule rulefmt.Rule) error {
+	err := ValidateRequiredKeys(rule, c.requiredLabels, c.requiredAnnotations)
+	if err != nil {
 		return err
 	}
+	// Checked here as well as when securing, since rules that skip
+	// restriction may not be secured at all
+	if c.tenancy.RestrictorLabel != "" {
+		err = CheckRestrictorLabelCase(rule, c.tenancy.RestrictorLabel)
+		if err != nil {
+			return err
+		}
+	}
+	if c.validateRunbookURL {
+		return ValidateRunbookURL(rule)
+	}
 	return nil
 }
 
+// ErrRuleNotFound is returned by GetRuleByIndex when there is no rule at the
+// requested position
+var ErrRuleNotFound = errors.New("rule not found")
+
+// ErrGroupNotFound is returned when getting or setting a property of a rule
+// group that doesn't exist
+var ErrGroupNotFound = errors.New("rule group not found")
+
+// RuleValidationError is returned when a rule is rejected because of its
+// contents, rather than because of a problem with the rules file
+type RuleValidationError struct {
+	Err error
+}
+
+func (e RuleValidationError) Error() string {
+	return e.Err.Error()
+}
+
 // validateRuleImpl determines the actual causes of the rule validation error.
 // Due to how the underlying prometheus types are made (unexported), we have to copy this code
 // and run it here to make it work. The actual validation is done with the package
 // code.
-func validateRuleImpl(r rulefmt.RuleNode) error {
-	err := errors.New("Rule Validation Error")
+func validateRuleImpl(r rulefmt.RuleNode) []FieldError {
+	var errs []FieldError
 	if r.Record.Value != "" && r.Alert.Value != "" {
-		err = fmt.Errorf("%v; only one of 'record' and 'alert' must be set", err)
+		errs = append(errs, FieldError{Field: "record", Message: "only one of 'record' and 'alert' must be set"})
 	}
 	if r.Record.Value == "" && r.Alert.Value == "" {
-		if r.Record.Value == "0" {
-			err = fmt.Errorf("%v; one of 'record' or 'alert' must be set", err)
-		} else {
-			err = fmt.Errorf("%v; one of 'record' or 'alert' must be set", err)
-		}
+		errs = append(errs, FieldError{Field: "alert", Message: "one of 'record' or 'alert' must be set"})
 	}
 
 	if r.Expr.Value == "" {
-		err = fmt.Errorf("%v; field 'expr' must be set in rule", err)
+		errs = append(errs, FieldError{Field: "expr", Message: "field 'expr' must be set in rule"})
 	} else if _, e := parser.ParseExpr(r.Expr.Value); e != nil {
-		err = fmt.Errorf("%v; could not parse expression: %v", err, e)
+		errs = append(errs, FieldError{Field: "expr", Message: fmt.Sprintf("could not parse expression: %v", e)})
 	}
 	if r.Record.Value != "" {
 		if len(r.Annotations) > 0 {
-			err = fmt.Errorf("%v; invalid field 'annotations' in recording rule", err)
+			errs = append(errs, FieldError{Field: "annotations", Message: "invalid field 'annotations' in recording rule"})
 		}
 		if r.For != 0 {
-			err = fmt.Errorf("%v; invalid field 'for' in recording rule", err)
+			errs = append(errs, FieldError{Field: "for", Message: "invalid field 'for' in recording rule"})
 		}
 		if !model.IsValidMetricName(model.LabelValue(r.Record.Value)) {
-			err = fmt.Errorf("%v; invalid recording rule name: %s", err, r.Record.Value)
+			errs = append(errs, FieldError{Field: "record", Message: fmt.Sprintf("invalid recording rule name: %s", r.Record.Value)})
 		}
 	}
 
-	for k, v := range r.Labels {
+	for _, k := range sortedKeys(r.Labels) {
 		if !model.LabelName(k).IsValid() || k == model.MetricNameLabel {
-			err = fmt.Errorf("%v; invalid label name: %s", err, k)
+			errs = append(errs, FieldError{Field: "labels." + k, Message: fmt.Sprintf("invalid label name: %s", k)})
 		}
 
-		if !model.LabelValue(v).IsValid() {
-			err = fmt.Errorf("%v; invalid label value: %s", err, v)
+		if v := r.Labels[k]; !model.LabelValue(v).IsValid() {
+			errs = append(errs, FieldError{Field: "labels." + k, Message: fmt.Sprintf("invalid label value: %s", v)})
 		}
 	}
 
-	for k := range r.Annotations {
+	for _, k := range sortedKeys(r.Annotations) {
 		if !model.LabelName(k).IsValid() {
-			err = fmt.Errorf("%v; invalid annotation name: %s", err, k)
+			errs = append(errs, FieldError{Field: "annotations." + k, Message: fmt.Sprintf("invalid annotation name: %s", k)})
 		}
 	}
-	return err
+	return errs
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 func (c *client) RuleExists(filePrefix, rulename string) bool {
-	filename := makeFilename(filePrefix)
+	return c.ruleExistsInFile(c.rulesFilename(filePrefix), rulename)
+}
 
-	c.fileLocks.Lock(filename)
-	defer c.fileLocks.Unlock(filename)
+func (c *client) ruleExistsInFile(filename, rulename string) bool {
+	c.fileLocks.RLock(filename)
+	defer c.fileLocks.RUnlock(filename)
 
 	if !c.ruleFileExists(filename) {
 		return false
@@ -155,7 +545,23 @@ func (c *client) RuleExists(filePrefix, rulename string) bool {
 // WriteRule takes an alerting rule and writes it to the rules file for the
 // given filePrefix
 func (c *client) WriteRule(filePrefix string, rule rulefmt.Rule) error {
-	filename := makeFilename(filePrefix)
+	return c.WriteRuleToGroup(filePrefix, "", rule)
+}
+
+// WriteRuleToGroup writes an alerting rule to the named group in the rules
+// file for the given filePrefix. An empty groupName writes to the default group.
+func (c *client) WriteRuleToGroup(filePrefix, groupName string, rule rulefmt.Rule) error {
+	if c.globalRuleUniqueness {
+		c.uniquenessLock.Lock()
+		defer c.uniquenessLock.Unlock()
+
+		err := c.checkRuleNameUnused(filePrefix, getRuleName(rule))
+		if err != nil {
+			return err
+		}
+	}
+
+	filename := c.rulesFilename(filePrefix)
 
 	c.fileLocks.Lock(filename)
 	defer c.fileLocks.Unlock(filename)
@@ -164,11 +570,16 @@ func (c *client) WriteRule(filePrefix string, rule rulefmt.Rule) error {
 	if err != nil {
 		return err
 	}
-	err = SecureRule(c.tenancy.RestrictQueries, c.tenancy.RestrictorLabel, filePrefix, &rule)
+	c.applyRuleDefaults(&rule)
+	err = c.validateConfiguredRules(rule)
+	if err != nil {
+		return err
+	}
+	err = c.secureRule(filePrefix, &rule)
 	if err != nil {
 		return err
 	}
-	ruleFile.AddRule(rule)
+	ruleFile.AddRuleToGroup(groupName, rule)
 
 	err = c.writeRuleFile(ruleFile, filename)
 	if err != nil {
@@ -178,7 +589,13 @@ func (c *client) WriteRule(filePrefix string, rule rulefmt.Rule) error {
 }
 
 func (c *client) UpdateRule(filePrefix string, rule rulefmt.Rule) error {
-	filename := makeFilename(filePrefix)
+	return c.UpdateRuleInGroup(filePrefix, "", rule)
+}
+
+// UpdateRuleInGroup replaces an existing rule, moving it to the named group if
+// it is in a different one. An empty groupName keeps the rule in its group.
+func (c *client) UpdateRuleInGroup(filePrefix, groupName string, rule rulefmt.Rule) error {
+	filename := c.rulesFilename(filePrefix)
 
 	c.fileLocks.Lock(filename)
 	defer c.fileLocks.Unlock(filename)
@@ -188,12 +605,18 @@ func (c *client) UpdateRule(filePrefix string, rule rulefmt.Rule) error {
 		return fmt.Errorf("rule file %s does not exist: %v", filename, err)
 	}
 
-	err = SecureRule(c.tenancy.RestrictQueries, c.tenancy.RestrictorLabel, filePrefix, &rule)
+	c.applyRuleDefaults(&rule)
+	err = c.validateConfiguredRules(rule)
+	if err != nil {
+		return err
+	}
+
+	err = c.secureRule(filePrefix, &rule)
 	if err != nil {
 		return fmt.Errorf("cannot parse expression: \"%s\", %v", rule.Expr, err)
 	}
 
-	err = ruleFile.ReplaceRule(rule)
+	err = ruleFile.ReplaceRuleInGroup(groupName, rule)
 	if err != nil {
 		return err
 	}
@@ -206,30 +629,119 @@ func (c *client) UpdateRule(filePrefix string, rule rulefmt.Rule) error {
 }
 
 func (c *client) ReadRules(filePrefix, ruleName string) ([]rulefmt.Rule, error) {
-	filename := makeFilename(filePrefix)
+	groupedRules, err := c.ReadRulesWithGroups(filePrefix, ruleName)
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]rulefmt.Rule, 0, len(groupedRules))
+	for _, groupedRule := range groupedRules {
+		rules = append(rules, groupedRule.Rule)
+	}
+	return rules, nil
+}
+
+// ReadRulesWithGroups returns the rules for the given filePrefix along with
+// the names of the groups they are in. If ruleName is given only that rule
+// is returned.
+func (c *client) ReadRulesWithGroups(filePrefix, ruleName string) ([]GroupedRule, error) {
+	filename := c.rulesFilename(filePrefix)
 	c.fileLocks.RLock(filename)
 	defer c.fileLocks.RUnlock(filename)
 
 	if !c.ruleFileExists(filename) {
-		return []rulefmt.Rule{}, nil
+		return []GroupedRule{}, nil
 	}
 
-	ruleFile, err := c.readRuleFile(makeFilename(filePrefix))
+	ruleFile, err := c.readRuleFile(filename)
 	if err != nil {
-		return []rulefmt.Rule{}, err
+		return []GroupedRule{}, err
 	}
 	if ruleName == "" {
-		return ruleFile.Rules(), nil
+		return ruleFile.GroupedRules(), nil
 	}
-	foundRule := ruleFile.GetRule(ruleName)
+	foundRule := ruleFile.GetGroupedRule(ruleName)
 	if foundRule == nil {
 		return nil, fmt.Errorf("rule %s not found", ruleName)
 	}
-	return []rulefmt.Rule{*foundRule}, nil
+	return []GroupedRule{*foundRule}, nil
+}
+
+func (c *client) GetRuleByIndex(filePrefix, groupName string, idx int) (*rulefmt.Rule, error) {
+	filename := c.rulesFilename(filePrefix)
+	c.fileLocks.RLock(filename)
+	defer c.fileLocks.RUnlock(filename)
+
+	if !c.ruleFileExists(filename) {
+		return nil, fmt.Errorf("tenant %s has no rules: %w", filePrefix, ErrRuleNotFound)
+	}
+	ruleFile, err := c.readRuleFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ruleFile.GetRuleByIndex(groupName, idx)
+}
+
+func (c *client) GetGroupLimit(filePrefix, groupName string) (int, error) {
+	filename := c.rulesFilename(filePrefix)
+	c.fileLocks.RLock(filename)
+	defer c.fileLocks.RUnlock(filename)
+
+	if !c.ruleFileExists(filename) {
+		return 0, fmt.Errorf("tenant %s has no rules: %w", filePrefix, ErrGroupNotFound)
+	}
+	ruleFile, err := c.readRuleFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	return ruleFile.GetGroupLimit(groupName)
+}
+
+func (c *client) SetGroupLimit(filePrefix, groupName string, limit int) error {
+	if limit < 0 {
+		return RuleValidationError{Err: fmt.Errorf("invalid limit %d: must not be negative", limit)}
+	}
+	filename := c.rulesFilename(filePrefix)
+	c.fileLocks.Lock(filename)
+	defer c.fileLocks.Unlock(filename)
+
+	if !c.ruleFileExists(filename) {
+		return fmt.Errorf("tenant %s has no rules: %w", filePrefix, ErrGroupNotFound)
+	}
+	ruleFile, err := c.readRuleFile(filename)
+	if err != nil {
+		return err
+	}
+	err = ruleFile.SetGroupLimit(groupName, limit)
+	if err != nil {
+		return err
+	}
+	return c.writeRuleFile(ruleFile, filename)
+}
+
+func (c *client) ListRuleNames(filePrefix string) ([]string, error) {
+	filename := c.rulesFilename(filePrefix)
+	c.fileLocks.RLock(filename)
+	defer c.fileLocks.RUnlock(filename)
+
+	if !c.ruleFileExists(filename) {
+		return []string{}, nil
+	}
+
+	ruleFile, err := c.readRuleFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	rules := ruleFile.Rules()
+	names := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		names = append(names, getRuleName(rule))
+	}
+	sort.Strings(names)
+	return names, nil
 }
 
 func (c *client) DeleteRule(filePrefix, ruleName string) error {
-	filename := makeFilename(filePrefix)
+	filename := c.rulesFilename(filePrefix)
 	c.fileLocks.Lock(filename)
 	defer c.fileLocks.Unlock(filename)
 
@@ -251,7 +763,32 @@ func (c *client) DeleteRule(filePrefix, ruleName string) error {
 }
 
 func (c *client) BulkUpdateRules(filePrefix string, rules []rulefmt.Rule) (BulkUpdateResults, error) {
-	filename := makeFilename(filePrefix)
+	groupedRules := make([]GroupedRule, 0, len(rules))
+	for _, rule := range rules {
+		groupedRules = append(groupedRules, GroupedRule{Rule: rule})
+	}
+	return c.BulkUpdateRulesInGroups(filePrefix, groupedRules)
+}
+
+// BulkUpdateRulesInGroups creates or updates each of the given rules in the
+// group named alongside it. New rules with an empty group name are added to
+// the default group, and existing ones stay in their current group.
+func (c *client) BulkUpdateRulesInGroups(filePrefix string, rules []GroupedRule) (BulkUpdateResults, error) {
+	err := c.checkRulesTenant(filePrefix, rules)
+	if err != nil {
+		return BulkUpdateResults{}, err
+	}
+	var usedNames map[string]error
+	if c.globalRuleUniqueness {
+		c.uniquenessLock.Lock()
+		defer c.uniquenessLock.Unlock()
+
+		usedNames, err = c.ruleNamesUsedElsewhere(filePrefix, rules)
+		if err != nil {
+			return BulkUpdateResults{}, err
+		}
+	}
+	filename := c.rulesFilename(filePrefix)
 	c.fileLocks.Lock(filename)
 	defer c.fileLocks.Unlock(filename)
 
@@ -261,24 +798,41 @@ func (c *client) BulkUpdateRules(filePrefix string, rules []rulefmt.Rule) (BulkU
 	}
 
 	results := NewBulkUpdateResults()
-	for _, newRule := range rules {
-		ruleName := newRule.Alert
+	seenRules := make(map[string]bool, len(rules))
+	for _, groupedRule := range rules {
+		newRule := groupedRule.Rule
+		ruleName := getRuleName(newRule)
+		if seenRules[ruleName] {
+			results.Errors[ruleName] = errors.New("duplicate rule name in payload")
+			continue
+		}
+		seenRules[ruleName] = true
 
-		err := SecureRule(c.tenancy.RestrictQueries, c.tenancy.RestrictorLabel, filePrefix, &newRule)
+		c.applyRuleDefaults(&newRule)
+		err := c.validateConfiguredRules(newRule)
+		if err != nil {
+			results.Errors[ruleName] = err
+			continue
+		}
+		err = c.secureRule(filePrefix, &newRule)
 		if err != nil {
 			results.Errors[ruleName] = err
 			continue
 		}
 
 		if ruleFile.GetRule(ruleName) != nil {
-			err := ruleFile.ReplaceRule(newRule)
+			err := ruleFile.ReplaceRuleInGroup(groupedRule.Group, newRule)
 			if err != nil {
 				results.Errors[ruleName] = err
 			} else {
 				results.Statuses[ruleName] = "updated"
 			}
 		} else {
-			ruleFile.AddRule(newRule)
+			if err := usedNames[ruleName]; err != nil {
+				results.Errors[ruleName] = err
+				continue
+			}
+			ruleFile.AddRuleToGroup(groupedRule.Group, newRule)
 			results.Statuses[ruleName] = "created"
 		}
 	}
@@ -290,31 +844,538 @@ func (c *client) BulkUpdateRules(filePrefix string, rules []rulefmt.Rule) (BulkU
 	return results, nil
 }
 
+// ReplaceRules secures and validates every rule of ruleFile for the tenant
+// and writes it over the tenant's rules file. Nothing is written unless all
+// of the rules are valid.
+func (c *client) ReplaceRules(filePrefix string, ruleFile File) error {
+	err := c.checkRulesTenant(filePrefix, ruleFile.GroupedRules())
+	if err != nil {
+		return err
+	}
+	var usedNames map[string]error
+	if c.globalRuleUniqueness {
+		c.uniquenessLock.Lock()
+		defer c.uniquenessLock.Unlock()
+
+		usedNames, err = c.ruleNamesUsedElsewhere(filePrefix, ruleFile.GroupedRules())
+		if err != nil {
+			return err
+		}
+	}
+	filename := c.rulesFilename(filePrefix)
+	c.fileLocks.Lock(filename)
+	defer c.fileLocks.Unlock(filename)
+
+	newFile := File{RuleGroups: make([]RuleGroup, 0, len(ruleFile.RuleGroups))}
+	seenRules := make(map[string]bool)
+	for _, group := range ruleFile.RuleGroups {
+		newGroup := group
+		newGroup.Rules = make([]rulefmt.Rule, 0, len(group.Rules))
+		for _, rule := range group.Rules {
+			ruleName := getRuleName(rule)
+			if seenRules[ruleName] {
+				return RuleValidationError{Err: fmt.Errorf("duplicate rule name in payload: %s", ruleName)}
+			}
+			seenRules[ruleName] = true
+
+			c.applyRuleDefaults(&rule)
+			err := c.validateConfiguredRules(rule)
+			if err != nil {
+				return RuleValidationError{Err: fmt.Errorf("rule %s: %v", ruleName, err)}
+			}
+			if err := usedNames[ruleName]; err != nil {
+				return err
+			}
+			rule.Labels = copyLabels(rule.Labels)
+			err = c.secureRule(filePrefix, &rule)
+			if err != nil {
+				return err
+			}
+			newGroup.Rules = append(newGroup.Rules, rule)
+		}
+		newFile.RuleGroups = append(newFile.RuleGroups, newGroup)
+	}
+	if len(newFile.RuleGroups) == 0 {
+		newFile = *NewFile(filePrefix)
+	}
+	return c.writeRuleFile(&newFile, filename)
+}
+
+// copyLabels returns a copy of labels, so securing a rule doesn't modify the
+// labels of the caller's rule
+func copyLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(labels))
+	for name, value := range labels {
+		copied[name] = value
+	}
+	return copied
+}
+
+// checkRulesTenant returns a RuleValidationError naming the rules that carry
+// the restrictor label with a value other than the tenant, if
+// WithBulkTenantCheck is set
+func (c *client) checkRulesTenant(filePrefix string, rules []GroupedRule) error {
+	label := c.tenancy.RestrictorLabel
+	if !c.bulkTenantCheck || label == "" {
+		return nil
+	}
+	var mismatched []string
+	for _, groupedRule := range rules {
+		if value, ok := groupedRule.Rule.Labels[label]; ok && value != filePrefix {
+			mismatched = append(mismatched, getRuleName(groupedRule.Rule))
+		}
+	}
+	if len(mismatched) == 0 {
+		return nil
+	}
+	sort.Strings(mismatched)
+	return RuleValidationError{Err: fmt.Errorf("rules with a %s label other than %s: %s", label, filePrefix, strings.Join(mismatched, ", "))}
+}
+
+// MoveRule moves a rule from the srcPrefix rules file to the dstPrefix rules
+// file, re-securing it for the destination tenant
+func (c *client) MoveRule(srcPrefix, dstPrefix, ruleName string) error {
+	if srcPrefix == dstPrefix {
+		return fmt.Errorf("cannot move rule %s to the same tenant", ruleName)
+	}
+	srcFilename := c.rulesFilename(srcPrefix)
+	dstFilename := c.rulesFilename(dstPrefix)
+
+	unlock := c.fileLocks.LockAll(srcFilename, dstFilename)
+	defer unlock()
+
+	srcFile, err := c.readRuleFile(srcFilename)
+	if err != nil {
+		return err
+	}
+	foundRule := srcFile.GetRule(ruleName)
+	if foundRule == nil {
+		return fmt.Errorf("rule %s not found", ruleName)
+	}
+	rule := *foundRule
+
+	dstFile, err := c.readOrInitializeRuleFile(dstPrefix, dstFilename)
+	if err != nil {
+		return err
+	}
+	if dstFile.GetRule(ruleName) != nil {
+		return fmt.Errorf("rule %s already exists for tenant %s", ruleName, dstPrefix)
+	}
+
+	err = c.secureRule(dstPrefix, &rule)
+	if err != nil {
+		return err
+	}
+	dstFile.AddRule(rule)
+	err = srcFile.DeleteRule(ruleName)
+	if err != nil {
+		return err
+	}
+
+	// The destination is written first, so the rule isn't lost if either
+	// write fails. If the source can't be written the destination is put
+	// back, rather than leaving the rule with both tenants.
+	var originalDst []byte
+	dstExists := c.ruleFileExists(dstFilename)
+	if dstExists {
+		originalDst, err = c.fsClient.ReadFile(c.sourceFilename(dstFilename))
+		if err != nil {
+			glog.Errorf("error reading rules file: %v", err)
+			return fmt.Errorf("error reading rules file: %v", err)
+		}
+	}
+	err = c.writeRuleFile(dstFile, dstFilename)
+	if err != nil {
+		return err
+	}
+	err = c.writeRuleFile(srcFile, srcFilename)
+	if err != nil {
+		c.restoreRuleFile(dstFilename, originalDst, dstExists)
+		return err
+	}
+	return nil
+}
+
+// restoreRuleFile puts back the contents a rules file had before it was
+// written, or removes it if it didn't exist. A failure to do so is only
+// logged, since it's the original error the caller reports.
+func (c *client) restoreRuleFile(filename string, original []byte, existed bool) {
+	var err error
+	if existed {
+		err = c.fsClient.WriteFile(filename, original, c.fileMode)
+	} else {
+		err = c.fsClient.DeleteFile(filename)
+	}
+	if err != nil {
+		glog.Errorf("error restoring rules file %s: %v", filename, err)
+	}
+}
+
+func (c *client) AddLabelToAllRules(filePrefix, key, value string) error {
+	if !model.LabelName(key).IsValid() {
+		return RuleValidationError{Err: fmt.Errorf("invalid label name: %s", key)}
+	}
+	return c.updateAllRuleLabels(filePrefix, key, func(labels map[string]string) {
+		labels[key] = value
+	})
+}
+
+func (c *client) RemoveLabelFromAllRules(filePrefix, key string) error {
+	return c.updateAllRuleLabels(filePrefix, key, func(labels map[string]string) {
+		delete(labels, key)
+	})
+}
+
+// updateAllRuleLabels applies updateLabels to the labels of every rule in the
+// tenant's file, and writes the file only if all of the updated rules are
+// still valid
+func (c *client) updateAllRuleLabels(filePrefix, key string, updateLabels func(labels map[string]string)) error {
+	if key == c.tenancy.RestrictorLabel {
+		return RuleValidationError{Err: fmt.Errorf("cannot modify tenancy label %s", key)}
+	}
+	filename := c.rulesFilename(filePrefix)
+	c.fileLocks.Lock(filename)
+	defer c.fileLocks.Unlock(filename)
+
+	ruleFile, err := c.readRuleFile(filename)
+	if err != nil {
+		return err
+	}
+
+	for i := range ruleFile.RuleGroups {
+		rules := ruleFile.RuleGroups[i].Rules
+		for j := range rules {
+			if rules[j].Labels == nil {
+				rules[j].Labels = make(map[string]string)
+			}
+			updateLabels(rules[j].Labels)
+			if len(rules[j].Labels) == 0 {
+				rules[j].Labels = nil
+			}
+			err := ValidateRule(rules[j])
+			if err != nil {
+				return RuleValidationError{Err: fmt.Errorf("rule %s: %v", getRuleName(rules[j]), err)}
+			}
+			err = c.validateConfiguredRules(rules[j])
+			if err != nil {
+				return RuleValidationError{Err: fmt.Errorf("rule %s: %v", getRuleName(rules[j]), err)}
+			}
+		}
+	}
+
+	return c.writeRuleFile(ruleFile, filename)
+}
+
+// TenantListOptions filters and pages a list of tenants. Only tenants
+// starting with Prefix are listed, skipping the first Offset of them. A Limit
+// of zero lists all of the remaining tenants. If ModifiedSince is set, only
+// tenants whose rules file changed after it are listed.
+type TenantListOptions struct {
+	Prefix        string
+	Limit         int
+	Offset        int
+	ModifiedSince time.Time
+}
+
+// Apply returns the page of the sorted tenants that opts selects
+func (opts TenantListOptions) Apply(tenants []string) []string {
+	filtered := make([]string, 0, len(tenants))
+	for _, tenant := range tenants {
+		if strings.HasPrefix(tenant, opts.Prefix) {
+			filtered = append(filtered, tenant)
+		}
+	}
+	sort.Strings(filtered)
+
+	if opts.Offset >= len(filtered) {
+		return []string{}
+	}
+	filtered = filtered[opts.Offset:]
+	if opts.Limit > 0 && opts.Limit < len(filtered) {
+		filtered = filtered[:opts.Limit]
+	}
+	return filtered
+}
+
+func (c *client) ListTenants(opts TenantListOptions) ([]string, error) {
+	tenants, err := c.rulesFilePrefixesModifiedSince(opts.ModifiedSince)
+	if err != nil {
+		return nil, err
+	}
+	return opts.Apply(tenants), nil
+}
+
+func (c *client) RulesModTime(filePrefix string) (time.Time, error) {
+	filename := c.rulesFilename(filePrefix)
+	c.fileLocks.RLock(filename)
+	defer c.fileLocks.RUnlock(filename)
+
+	if !c.ruleFileExists(filename) {
+		return time.Time{}, nil
+	}
+	info, err := c.fsClient.Stat(c.sourceFilename(filename))
+	if err != nil {
+		glog.Errorf("error reading rules file info: %v", err)
+		return time.Time{}, fmt.Errorf("error reading rules file info: %v", err)
+	}
+	return info.ModTime(), nil
+}
+
+// FindRuleTenant scans all rules files for alerting rules named ruleName and
+// returns the sorted list of tenants that own one
+func (c *client) FindRuleTenant(ruleName string) ([]string, error) {
+	tenants := make([]string, 0)
+	err := c.forEachRuleFile(func(filePrefix string, ruleFile *File) error {
+		if ruleFile.GetRule(ruleName) != nil {
+			tenants = append(tenants, filePrefix)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(tenants)
+	return tenants, nil
+}
+
+// rulesFilePrefixes returns the prefix of every rules file in the rules
+// directory
+func (c *client) rulesFilePrefixes() ([]string, error) {
+	return c.rulesFilePrefixesModifiedSince(time.Time{})
+}
+
+// rulesFilePrefixesModifiedSince returns the prefix of every rules file in the
+// rules directory that was modified after since, or of all of them if since
+// is the zero time
+func (c *client) rulesFilePrefixesModifiedSince(since time.Time) ([]string, error) {
+	files, err := c.fsClient.ReadDir("")
+	if err != nil {
+		glog.Errorf("error listing rules files: %v", err)
+		return nil, fmt.Errorf("error listing rules files: %v", err)
+	}
+
+	prefixes := make([]string, 0, len(files))
+	for _, file := range files {
+		filePrefix := strings.TrimSuffix(file.Name(), rulesFilePostfix)
+		if file.IsDir() || filePrefix == file.Name() {
+			continue
+		}
+		if !since.IsZero() && !file.ModTime().After(since) {
+			continue
+		}
+		prefixes = append(prefixes, filePrefix)
+	}
+	return prefixes, nil
+}
+
+// forEachRuleFile reads every rules file once, each under its read lock, and
+// calls fn with its prefix and contents after the lock is released. It stops
+// at the first file that can't be read or that fn returns an error for.
+func (c *client) forEachRuleFile(fn func(filePrefix string, ruleFile *File) error) error {
+	prefixes, err := c.rulesFilePrefixes()
+	if err != nil {
+		return err
+	}
+	for _, filePrefix := range prefixes {
+		filename := makeFilename(filePrefix)
+		c.fileLocks.RLock(filename)
+		ruleFile, err := c.readRuleFile(filename)
+		c.fileLocks.RUnlock(filename)
+		if err != nil {
+			return fmt.Errorf("%s: %v", filename, err)
+		}
+		if err = fn(filePrefix, ruleFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CompareRules compares the rules of two tenants by name. Both tenants' rules
+// are re-secured for the same tenant first so that the restrictor label and
+// query matcher don't count as differences.
+func (c *client) CompareRules(prefixA, prefixB string) (RuleDiff, error) {
+	rulesA, err := c.readNormalizedRules(prefixA, prefixA)
+	if err != nil {
+		return RuleDiff{}, err
+	}
+	rulesB, err := c.readNormalizedRules(prefixB, prefixA)
+	if err != nil {
+		return RuleDiff{}, err
+	}
+
+	diff := NewRuleDiff()
+	for name, ruleA := range rulesA {
+		ruleB, ok := rulesB[name]
+		if !ok {
+			diff.OnlyInA = append(diff.OnlyInA, name)
+		} else if !reflect.DeepEqual(ruleA, ruleB) {
+			diff.Differing = append(diff.Differing, name)
+		}
+	}
+	for name := range rulesB {
+		if _, ok := rulesA[name]; !ok {
+			diff.OnlyInB = append(diff.OnlyInB, name)
+		}
+	}
+	sort.Strings(diff.OnlyInA)
+	sort.Strings(diff.OnlyInB)
+	sort.Strings(diff.Differing)
+	return diff, nil
+}
+
 func (c *client) Tenancy() TenancyConfig {
 	return c.tenancy
 }
 
+// ReloadPrometheus reloads every configured prometheus instance concurrently
+// and returns an error listing each failed instance if fewer than the quorum
+// succeeded. With a reload window, concurrent callers share one reload.
 func (c *client) ReloadPrometheus() error {
-	resp, err := http.Post(fmt.Sprintf("http://%s%s", c.prometheusURL, "/-/reload"), "text/plain", &bytes.Buffer{})
+	return c.reloadTargets(c.prometheusURLs)
+}
+
+func (c *client) ReloadTenant(filePrefix string) error {
+	return c.reloadTargets(c.targetsFor(filePrefix))
+}
+
+// reloadTargets reloads the given instances. With a reload window they're
+// added to the batch, which reloads every instance requested by its callers.
+func (c *client) reloadTargets(instances []string) error {
+	if c.staged {
+		return nil
+	}
+	if c.reloadCoalescer != nil {
+		c.pendingTargets.add(instances)
+		return c.reloadCoalescer.Reload()
+	}
+	return c.reloadInstances(instances)
+}
+
+// reloadPendingInstances reloads the instances requested for the current
+// batch
+func (c *client) reloadPendingInstances() error {
+	return c.reloadInstances(c.pendingTargets.take())
+}
+
+func (c *client) Close() error {
+	if c.reloadCoalescer == nil {
+		return nil
+	}
+	return c.reloadCoalescer.Close()
+}
+
+func (c *client) reloadInstances(instances []string) error {
+	errs := make([]error, len(instances))
+	var wg sync.WaitGroup
+	for i, instance := range instances {
+		wg.Add(1)
+		go func(i int, instance string) {
+			defer wg.Done()
+			errs[i] = reloadPrometheusInstance(instance, c.reloadPath)
+		}(i, instance)
+	}
+	wg.Wait()
+
+	var failures []string
+	for i, err := range errs {
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", instances[i], err))
+		}
+	}
+	quorum := c.reloadQuorum
+	if quorum <= 0 || quorum > len(instances) {
+		quorum = len(instances)
+	}
+	if len(failures) == 0 || len(instances)-len(failures) >= quorum {
+		return nil
+	}
+	glog.Errorf("error reloading prometheus: %s", strings.Join(failures, "; "))
+	return fmt.Errorf("error reloading prometheus: %d of %d instances failed: %s", len(failures), len(instances), strings.Join(failures, "; "))
+}
+
+func reloadPrometheusInstance(prometheusURL, reloadPath string) error {
+	resp, err := http.Post(fmt.Sprintf("http://%s%s", prometheusURL, reloadPath), "text/plain", &bytes.Buffer{})
 	if err != nil {
-		glog.Errorf("error reloading prometheus: %v", err)
-		return fmt.Errorf("error reloading prometheus: %v", err)
+		return err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		body, _ := ioutil.ReadAll(resp.Body)
-		glog.Errorf("error reloading prometheus (status %d): %s", resp.StatusCode, string(body))
-		return fmt.Errorf("error reloading prometheus (status %d): %s", resp.StatusCode, string(body))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// checkRuleNameUnused returns an error if any tenant other than filePrefix
+// already has an alerting rule named ruleName. Callers must hold
+// uniquenessLock until the rule is written.
+func (c *client) checkRuleNameUnused(filePrefix, ruleName string) error {
+	if ruleName == "" {
+		return nil
+	}
+	// Callers check before locking their own file, since other tenants' files
+	// are read-locked here and MoveRule locks two files at once. The tenant's
+	// own file is skipped. Other tenants' live rules are checked even when
+	// staging, since staged rules are promoted without another check.
+	prefixes, err := c.rulesFilePrefixes()
+	if err != nil {
+		return err
+	}
+	for _, otherPrefix := range prefixes {
+		if otherPrefix != filePrefix && c.ruleExistsInFile(makeFilename(otherPrefix), ruleName) {
+			return RuleValidationError{Err: fmt.Errorf("rule %s already exists for tenant %s", ruleName, otherPrefix)}
+		}
 	}
 	return nil
 }
 
+// ruleNamesUsedElsewhere runs checkRuleNameUnused for the name of each of the
+// given rules, returning the errors by rule name. Bulk writes call it before
+// locking the tenant's file, and report the errors only for new rules.
+func (c *client) ruleNamesUsedElsewhere(filePrefix string, rules []GroupedRule) (map[string]error, error) {
+	usedNames := make(map[string]error)
+	for _, groupedRule := range rules {
+		ruleName := getRuleName(groupedRule.Rule)
+		if _, ok := usedNames[ruleName]; ok {
+			continue
+		}
+		err := c.checkRuleNameUnused(filePrefix, ruleName)
+		if _, ok := err.(RuleValidationError); err != nil && !ok {
+			return nil, err
+		}
+		usedNames[ruleName] = err
+	}
+	return usedNames, nil
+}
+
+// applyRuleDefaults fills in configured defaults for fields the rule leaves
+// unset. Recording rules cannot have a 'for' duration so are left untouched.
+func (c *client) applyRuleDefaults(rule *rulefmt.Rule) {
+	if c.defaultFor != 0 && rule.Alert != "" && rule.For == 0 {
+		rule.For = c.defaultFor
+	}
+}
+
+// writeRuleFile marshals the rules file and writes it. yaml writes the keys
+// of labels and annotations in sorted order, so the same rules always produce
+// the same file.
 func (c *client) writeRuleFile(ruleFile *File, filename string) error {
-	yamlFile, err := yaml.Marshal(ruleFile)
+	if merged := ruleFile.MergeDuplicateGroups(); len(merged) > 0 {
+		glog.Warningf("merged duplicate rule groups %s in %s", strings.Join(merged, ", "), filename)
+	}
+	yamlFile, err := c.marshalRuleFile(ruleFile, filename)
 	if err != nil {
 		glog.Errorf("error writing rules file: %v", err)
 		return fmt.Errorf("error writing rules file: %v", err)
 	}
-	err = c.fsClient.WriteFile(filename, yamlFile, 0666)
+	if c.fileHeader != "" {
+		yamlFile = append(fileHeaderComment(c.fileHeader, time.Now()), yamlFile...)
+	}
+	err = c.fsClient.WriteFile(filename, yamlFile, c.fileMode)
 	if err != nil {
 		glog.Errorf("error writing rules file: %v", err)
 		return fmt.Errorf("error writing rules file: %v", err)
@@ -322,6 +1383,20 @@ func (c *client) writeRuleFile(ruleFile *File, filename string) error {
 	return nil
 }
 
+// fileHeaderComment returns the header as YAML comment lines, with
+// FileHeaderTimestamp replaced by now
+func fileHeaderComment(header string, now time.Time) []byte {
+	header = strings.ReplaceAll(header, FileHeaderTimestamp, now.UTC().Format(time.RFC3339))
+	var comment strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(header, "\n"), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			line = strings.TrimRight("# "+line, " ")
+		}
+		comment.WriteString(line + "\n")
+	}
+	return []byte(comment.String())
+}
+
 func (c *client) readOrInitializeRuleFile(filePrefix, filename string) (*File, error) {
 	if c.ruleFileExists(filename) {
 		return c.readRuleFile(filename)
@@ -340,20 +1415,121 @@ func (c *client) initializeRuleFile(filePrefix, filename string) (*File, error)
 	return NewFile(filePrefix), nil
 }
 
+// secureRule secures the rule for the tenant with SecureRule, unless its
+// restriction is skipped with SkipRestrictionAnnotation and the tenancy config
+// allows it
+func (c *client) secureRule(tenantID string, rule *rulefmt.Rule) error {
+	matchers, err := c.tenantMatchers(tenantID)
+	if err != nil {
+		return err
+	}
+	if c.tenancy.AllowSkipRestriction && SkipsRestriction(*rule) {
+		if c.tenancy.SkipRestrictionLabel {
+			return nil
+		}
+		return SecureRuleWithMatchers(false, matchers, rule)
+	}
+	return SecureRuleWithMatchers(c.tenancy.RestrictQueries, matchers, rule)
+}
+
+func (c *client) WithRestrictorMatchers(matchers map[string]string) PrometheusAlertClient {
+	view := *c
+	view.restrictorMatchers = make(map[string]string, len(c.restrictorMatchers)+len(matchers))
+	for name, value := range c.restrictorMatchers {
+		view.restrictorMatchers[name] = value
+	}
+	for name, value := range matchers {
+		view.restrictorMatchers[name] = value
+	}
+	return &view
+}
+
+// tenantMatchers returns the labels that rules of the tenant are secured
+// with: the restrictor label along with any set by WithRestrictorMatchers,
+// which may not replace it
+func (c *client) tenantMatchers(tenantID string) (map[string]string, error) {
+	matchers := map[string]string{c.tenancy.RestrictorLabel: tenantID}
+	for name, value := range c.restrictorMatchers {
+		if name == c.tenancy.RestrictorLabel {
+			return nil, RuleValidationError{Err: fmt.Errorf("matcher %s would replace the tenant label", name)}
+		}
+		matchers[name] = value
+	}
+	return matchers, nil
+}
+
+// readNormalizedRules returns a tenant's rules by name, secured as if they
+// belonged to normalizedTenant. A tenant without a rules file has no rules.
+func (c *client) readNormalizedRules(filePrefix, normalizedTenant string) (map[string]rulefmt.Rule, error) {
+	filename := c.rulesFilename(filePrefix)
+	c.fileLocks.RLock(filename)
+	defer c.fileLocks.RUnlock(filename)
+
+	rules := make(map[string]rulefmt.Rule)
+	if !c.ruleFileExists(filename) {
+		return rules, nil
+	}
+	ruleFile, err := c.readRuleFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range ruleFile.Rules() {
+		// rules whose expression can't be restricted are compared as written
+		_ = c.secureRule(normalizedTenant, &rule)
+		rules[getRuleName(rule)] = rule
+	}
+	return rules, nil
+}
+
 func (c *client) ruleFileExists(filename string) bool {
-	_, err := c.fsClient.Stat(filename)
+	_, err := c.fsClient.Stat(c.sourceFilename(filename))
 	return err == nil
 }
 
 func (c *client) readRuleFile(requestedFile string) (*File, error) {
 	ruleFile := File{}
-	file, err := c.fsClient.ReadFile(requestedFile)
+	sourceFile := c.sourceFilename(requestedFile)
+	if sourceFile != requestedFile {
+		c.fileLocks.RLock(sourceFile)
+		defer c.fileLocks.RUnlock(sourceFile)
+	}
+	file, err := c.fsClient.ReadFile(sourceFile)
 	if err != nil {
 		glog.Errorf("error reading rules file: %v", err)
 		return &File{}, fmt.Errorf("error reading rules file: %v", err)
 	}
 	err = yaml.Unmarshal(file, &ruleFile)
-	return &ruleFile, err
+	if err != nil {
+		glog.Errorf("error parsing rules file: %v", err)
+		return &File{}, fmt.Errorf("error parsing rules file: %v", err)
+	}
+	if len(ruleFile.RuleGroups) == 0 {
+		return c.readLegacyRuleFile(sourceFile, file, &ruleFile)
+	}
+	return &ruleFile, nil
+}
+
+// readLegacyRuleFile converts a rules file in the legacy layout, with a
+// single list of rules at the top level, into a File with one group named
+// after the tenant. Files that aren't in the legacy layout are returned as is.
+func (c *client) readLegacyRuleFile(requestedFile string, file []byte, ruleFile *File) (*File, error) {
+	legacyFile := struct {
+		Rules []rulefmt.Rule `yaml:"rules"`
+	}{}
+	err := yaml.Unmarshal(file, &legacyFile)
+	if err != nil || len(legacyFile.Rules) == 0 {
+		return ruleFile, nil
+	}
+	if !c.legacyCompat {
+		glog.Errorf("rules file %s is in the legacy format", requestedFile)
+		return &File{}, fmt.Errorf("error parsing rules file: %s is in the legacy format, which requires compatibility mode", requestedFile)
+	}
+	return &File{
+		RuleGroups: []RuleGroup{{
+			Name:  strings.TrimSuffix(requestedFile, rulesFilePostfix),
+			Rules: legacyFile.Rules,
+		}},
+	}, nil
 }
 
 type BulkUpdateResults struct {
@@ -368,6 +1544,44 @@ func NewBulkUpdateResults() BulkUpdateResults {
 	}
 }
 
+// bulkUpdateResultsJSON is the JSON form of BulkUpdateResults, keeping its
+// field names as keys. Errors are given as their messages since error values
+// marshal to empty objects.
+type bulkUpdateResultsJSON struct {
+	Errors   map[string]string
+	Statuses map[string]string
+}
+
+func (r BulkUpdateResults) MarshalJSON() ([]byte, error) {
+	ret := bulkUpdateResultsJSON{
+		Errors:   make(map[string]string, len(r.Errors)),
+		Statuses: r.Statuses,
+	}
+	for name, err := range r.Errors {
+		ret.Errors[name] = err.Error()
+	}
+	if ret.Statuses == nil {
+		ret.Statuses = map[string]string{}
+	}
+	return json.Marshal(ret)
+}
+
+func (r *BulkUpdateResults) UnmarshalJSON(data []byte) error {
+	results := bulkUpdateResultsJSON{}
+	err := json.Unmarshal(data, &results)
+	if err != nil {
+		return err
+	}
+	*r = NewBulkUpdateResults()
+	for name, msg := range results.Errors {
+		r.Errors[name] = errors.New(msg)
+	}
+	for name, status := range results.Statuses {
+		r.Statuses[name] = status
+	}
+	return nil
+}
+
 func (r BulkUpdateResults) String() string {
 	str := strings.Builder{}
 	if len(r.Errors) > 0 {
@@ -389,6 +1603,44 @@ func (r BulkUpdateResults) String() string {
 	return str.String()
 }
 
+// RuleDiff holds the names of rules that differ between two tenants
+type RuleDiff struct {
+	OnlyInA   []string `json:"only_in_a"`
+	OnlyInB   []string `json:"only_in_b"`
+	Differing []string `json:"differing"`
+}
+
+func NewRuleDiff() RuleDiff {
+	return RuleDiff{
+		OnlyInA:   make([]string, 0),
+		OnlyInB:   make([]string, 0),
+		Differing: make([]string, 0),
+	}
+}
+
+// getRuleName returns the name of an alerting or recording rule
+func getRuleName(rule rulefmt.Rule) string {
+	if rule.Alert != "" {
+		return rule.Alert
+	}
+	return rule.Record
+}
+
+// splitURLs splits a comma-separated list of prometheus URLs
+func splitURLs(urls string) []string {
+	var ret []string
+	for _, instance := range strings.Split(urls, ",") {
+		if instance = strings.TrimSpace(instance); instance != "" {
+			ret = append(ret, instance)
+		}
+	}
+	return ret
+}
+
 func makeFilename(filePrefix string) string {
 	return filePrefix + rulesFilePostfix
 }
+
+func makeStagingFilename(filePrefix string) string {
+	return filePrefix + stagingFilePostfix
+}
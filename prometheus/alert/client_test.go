@@ -8,8 +8,17 @@
 package alert_test
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/facebookincubator/prometheus-configmanager/fsclient/mocks"
 	"github.com/facebookincubator/prometheus-configmanager/prometheus/alert"
@@ -18,6 +27,7 @@ import (
 	"github.com/prometheus/prometheus/pkg/rulefmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"gopkg.in/yaml.v3"
 )
 
 const (
@@ -58,6 +68,19 @@ const (
       tenantID: other
     annotations:
       summary: A test rule`
+
+	legacyNID      = "legacy"
+	legacyRuleFile = `rules:
+- alert: legacy_rule_1
+  expr: up{tenantID="legacy"} == 0
+  for: 5m
+  labels:
+    severity: major
+    tenantID: legacy
+- record: legacy:up:sum
+  expr: sum(up{tenantID="legacy"})
+  labels:
+    tenantID: legacy`
 )
 
 var (
@@ -94,6 +117,18 @@ func (tc *validateRuleTestCase) RunTest(t *testing.T) {
 	assert.EqualError(t, err, tc.expectedError)
 }
 
+func TestNewClient_RestrictQueries(t *testing.T) {
+	fileLocks, _ := alert.NewFileLocker(newHealthyDirClient("test"))
+
+	_, err := alert.NewClient(fileLocks, "prometheus-host.com", healthyFSClient, alert.TenancyConfig{RestrictQueries: true})
+	assert.EqualError(t, err, "restricting queries requires a restrictor label")
+
+	_, err = alert.NewClient(fileLocks, "prometheus-host.com", healthyFSClient, alert.TenancyConfig{RestrictorLabel: "tenantID", RestrictQueries: true})
+	assert.NoError(t, err)
+	_, err = alert.NewClient(fileLocks, "prometheus-host.com", healthyFSClient, alert.TenancyConfig{})
+	assert.NoError(t, err)
+}
+
 func TestValidateRule(t *testing.T) {
 	tests := []validateRuleTestCase{
 		{
@@ -153,6 +188,121 @@ func TestValidateRule(t *testing.T) {
 	}
 }
 
+func TestValidateRuleDetailed(t *testing.T) {
+	assert.Nil(t, alert.ValidateRuleDetailed(rulefmt.Rule{Alert: "test", Expr: "up"}))
+
+	validationErr := alert.ValidateRuleDetailed(rulefmt.Rule{
+		Record:      "1test",
+		Expr:        "up{",
+		Labels:      map[string]string{"1label": "val", "ok": "val"},
+		Annotations: map[string]string{"summary": "a"},
+	})
+	assert.Equal(t, []alert.FieldError{
+		{Field: "expr", Message: "could not parse expression: 1:4: parse error: unexpected end of input inside braces"},
+		{Field: "annotations", Message: "invalid field 'annotations' in recording rule"},
+		{Field: "record", Message: "invalid recording rule name: 1test"},
+		{Field: "labels.1label", Message: "invalid label name: 1label"},
+	}, validationErr.Fields)
+	assert.Equal(t, alert.ValidateRule(rulefmt.Rule{Record: "1test", Expr: "up{"}).Error(),
+		"Rule Validation Error; could not parse expression: 1:4: parse error: unexpected end of input inside braces; invalid recording rule name: 1test")
+
+	body, err := json.Marshal(validationErr)
+	assert.NoError(t, err)
+	decoded := struct {
+		Message string             `json:"message"`
+		Errors  []alert.FieldError `json:"errors"`
+	}{}
+	assert.NoError(t, json.Unmarshal(body, &decoded))
+	assert.Equal(t, validationErr.Error(), decoded.Message)
+	assert.Equal(t, validationErr.Fields, decoded.Errors)
+}
+
+func TestValidateRequiredKeys(t *testing.T) {
+	requiredLabels := []string{"team"}
+	requiredAnnotations := []string{"summary"}
+
+	rule := rulefmt.Rule{
+		Alert:       "test",
+		Expr:        "up",
+		Labels:      map[string]string{"team": "infra"},
+		Annotations: map[string]string{"summary": "up"},
+	}
+	assert.NoError(t, alert.ValidateRequiredKeys(rule, requiredLabels, requiredAnnotations))
+
+	rule = rulefmt.Rule{
+		Alert:       "test",
+		Expr:        "up",
+		Annotations: map[string]string{"summary": "up"},
+	}
+	assert.EqualError(t, alert.ValidateRequiredKeys(rule, requiredLabels, requiredAnnotations), "Rule Validation Error; missing required labels: team")
+
+	rule = rulefmt.Rule{Alert: "test", Expr: "up"}
+	assert.EqualError(t, alert.ValidateRequiredKeys(rule, requiredLabels, requiredAnnotations), "Rule Validation Error; missing required labels: team; missing required annotations: summary")
+
+	// recording rules are not checked
+	rule = rulefmt.Rule{Record: "test", Expr: "up"}
+	assert.NoError(t, alert.ValidateRequiredKeys(rule, requiredLabels, requiredAnnotations))
+}
+
+func TestClient_RequiredKeys(t *testing.T) {
+	client := newTestClient("tenantID", healthyFSClient, alert.WithRequiredKeys([]string{"team"}, []string{"summary"}))
+
+	missingTeam := rulefmt.Rule{
+		Alert:       "missing_team",
+		Expr:        "up == 0",
+		Annotations: map[string]string{"summary": "down"},
+	}
+	err := client.WriteRule(testNID, missingTeam)
+	assert.EqualError(t, err, "Rule Validation Error; missing required labels: team")
+	assert.IsType(t, alert.RuleValidationError{}, err)
+
+	complete := rulefmt.Rule{
+		Alert:       "complete",
+		Expr:        "up == 0",
+		Labels:      map[string]string{"team": "infra"},
+		Annotations: map[string]string{"summary": "down"},
+	}
+	assert.NoError(t, client.WriteRule(testNID, complete))
+
+	results, err := client.BulkUpdateRules(testNID, []rulefmt.Rule{missingTeam, complete})
+	assert.NoError(t, err)
+	assert.EqualError(t, results.Errors["missing_team"], "Rule Validation Error; missing required labels: team")
+	assert.Equal(t, "created", results.Statuses["complete"])
+}
+
+func TestValidateRunbookURL(t *testing.T) {
+	rule := rulefmt.Rule{
+		Alert:       "test",
+		Expr:        "up",
+		Annotations: map[string]string{"runbook_url": "https://runbooks.example.com/test"},
+	}
+	assert.NoError(t, alert.ValidateRunbookURL(rule))
+
+	rule.Annotations["runbook_url"] = "runbooks/test"
+	err := alert.ValidateRunbookURL(rule)
+	assert.EqualError(t, err, `Rule Validation Error; runbook_url must be an absolute http(s) URL: "runbooks/test"`)
+	assert.IsType(t, alert.RuleValidationError{}, err)
+
+	rule = rulefmt.Rule{Alert: "test", Expr: "up"}
+	assert.NoError(t, alert.ValidateRunbookURL(rule))
+}
+
+func TestClient_RunbookURLValidation(t *testing.T) {
+	client := newTestClient("tenantID", healthyFSClient, alert.WithRunbookURLValidation(true))
+
+	relative := rulefmt.Rule{
+		Alert:       "relative_runbook",
+		Expr:        "up == 0",
+		Annotations: map[string]string{"runbook_url": "/runbooks/test"},
+	}
+	err := client.WriteRule(testNID, relative)
+	assert.EqualError(t, err, `Rule Validation Error; runbook_url must be an absolute http(s) URL: "/runbooks/test"`)
+
+	// validation is disabled by default
+	client = newTestClient("tenantID", healthyFSClient)
+	assert.NoError(t, client.WriteRule(testNID, relative))
+}
+
 func TestClient_RuleExists(t *testing.T) {
 	client := newTestClient("tenantID", healthyFSClient)
 	assert.True(t, client.RuleExists(testNID, "test_rule_1"))
@@ -191,6 +341,731 @@ func TestClient_WriteRule(t *testing.T) {
 	assert.EqualError(t, err, "error writing rules file: write err")
 }
 
+func TestClient_FileMode(t *testing.T) {
+	fsClient := newFSClient(nil, nil)
+	client := newTestClient("tenantID", fsClient)
+	assert.NoError(t, client.WriteRule(testNID, sampleRule))
+	fsClient.AssertCalled(t, "WriteFile", "test_rules.yml", mock.Anything, alert.DefaultRuleFileMode)
+
+	fsClient = newFSClient(nil, nil)
+	client = newTestClient("tenantID", fsClient, alert.WithFileMode(0640))
+	assert.NoError(t, client.WriteRule(testNID, sampleRule))
+	assert.NoError(t, client.DeleteRule(testNID, "test_rule_1"))
+	fsClient.AssertCalled(t, "WriteFile", "test_rules.yml", mock.Anything, os.FileMode(0640))
+	fsClient.AssertNotCalled(t, "WriteFile", mock.Anything, mock.Anything, alert.DefaultRuleFileMode)
+}
+
+func TestClient_UpdateRuleKeepsPosition(t *testing.T) {
+	files := map[string][]byte{}
+	client := newTestClient("tenantID", newInMemoryFSClient(files))
+	for _, name := range []string{"first", "second", "third"} {
+		assert.NoError(t, client.WriteRule(testNID, rulefmt.Rule{Alert: name, Expr: "up == 0"}))
+	}
+
+	assert.NoError(t, client.UpdateRule(testNID, rulefmt.Rule{Alert: "first", Expr: "up == 1"}))
+	rules, err := client.ReadRules(testNID, "")
+	assert.NoError(t, err)
+	assert.Len(t, rules, 3)
+	assert.Equal(t, "first", rules[0].Alert)
+	assert.Equal(t, `up{tenantID="test"} == 1`, rules[0].Expr)
+	assert.Equal(t, "second", rules[1].Alert)
+	assert.Equal(t, "third", rules[2].Alert)
+}
+
+func TestClient_DeterministicRuleFile(t *testing.T) {
+	rule := rulefmt.Rule{
+		Alert:       "labelled_rule",
+		Expr:        "up == 0",
+		Labels:      map[string]string{"team": "a", "severity": "major", "component": "db", "region": "us", "env": "prod"},
+		Annotations: map[string]string{"summary": "down", "description": "instance down", "runbook": "none"},
+	}
+	var written [][]byte
+	for i := 0; i < 2; i++ {
+		files := map[string][]byte{}
+		client := newTestClient("tenantID", newInMemoryFSClient(files))
+		assert.NoError(t, client.WriteRule(testNID, rule))
+		written = append(written, files["test_rules.yml"])
+	}
+	assert.Equal(t, string(written[0]), string(written[1]))
+
+	// Keys are sorted
+	text := string(written[0])
+	labelOrder := []string{"component:", "env:", "region:", "severity:", "team:", "tenantID:"}
+	for i := 1; i < len(labelOrder); i++ {
+		assert.Less(t, strings.Index(text, labelOrder[i-1]), strings.Index(text, labelOrder[i]))
+	}
+	assert.Less(t, strings.Index(text, "description:"), strings.Index(text, "runbook:"))
+	assert.Less(t, strings.Index(text, "runbook:"), strings.Index(text, "summary:"))
+}
+
+func TestClient_FileHeader(t *testing.T) {
+	files := map[string][]byte{}
+	header := "owner: alerting-team\ngenerated-by: prometheus-configmanager\n# written " + alert.FileHeaderTimestamp
+	client := newTestClient("tenantID", newInMemoryFSClient(files), alert.WithFileHeader(header))
+	assert.NoError(t, client.WriteRule(testNID, sampleRule))
+
+	written := string(files["test_rules.yml"])
+	lines := strings.SplitN(written, "\n", 4)
+	assert.Equal(t, "# owner: alerting-team", lines[0])
+	assert.Equal(t, "# generated-by: prometheus-configmanager", lines[1])
+	assert.Regexp(t, `^# written \d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}Z$`, lines[2])
+	_, errs := rulefmt.Parse(files["test_rules.yml"])
+	assert.Empty(t, errs)
+
+	// The header is skipped on read and rewritten on the next write
+	rules, err := client.ReadRules(testNID, "")
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+	assert.NoError(t, client.WriteRule(testNID, sampleRule2))
+	assert.Equal(t, 1, strings.Count(string(files["test_rules.yml"]), "# owner: alerting-team"))
+
+	// Files are written as they were without a header
+	files = map[string][]byte{"test_rules.yml": []byte(testRuleFile)}
+	client = newTestClient("tenantID", newInMemoryFSClient(files))
+	assert.NoError(t, client.WriteRule(testNID, sampleRule))
+	assert.False(t, strings.HasPrefix(string(files["test_rules.yml"]), "#"))
+}
+
+func TestClient_Variables(t *testing.T) {
+	files := map[string][]byte{}
+	client := newTestClient("tenantID", newInMemoryFSClient(files))
+
+	vars, err := client.GetVariables(testNID)
+	assert.NoError(t, err)
+	assert.Empty(t, vars)
+
+	assert.NoError(t, client.SetVariable(testNID, "cpu_warn", "80"))
+	vars, err = client.GetVariables(testNID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"cpu_warn": "80"}, vars)
+
+	err = client.SetVariable(testNID, "1cpu", "80")
+	assert.IsType(t, alert.RuleValidationError{}, err)
+
+	// References are expanded in the expression and annotations only
+	rule := rulefmt.Rule{
+		Alert:       "cpu_high",
+		Expr:        `cpu_usage > {{ var "cpu_warn" }}`,
+		Annotations: map[string]string{"summary": `{{ $labels.instance }} over {{var "cpu_warn"}}%`},
+	}
+	assert.True(t, alert.HasVariableReferences(rule))
+	expanded, err := client.ExpandVariables(testNID, rule)
+	assert.NoError(t, err)
+	assert.Equal(t, "cpu_usage > 80", expanded.Expr)
+	assert.Equal(t, "{{ $labels.instance }} over 80%", expanded.Annotations["summary"])
+	assert.Equal(t, `{{ $labels.instance }} over {{var "cpu_warn"}}%`, rule.Annotations["summary"])
+	assert.NoError(t, client.WriteRule(testNID, expanded))
+
+	// Changing the variable doesn't change rules already written
+	assert.NoError(t, client.SetVariable(testNID, "cpu_warn", "90"))
+	rules, err := client.ReadRules(testNID, "cpu_high")
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+	assert.Equal(t, `cpu_usage{tenantID="test"} > 80`, rules[0].Expr)
+
+	_, err = client.ExpandVariables(testNID, rulefmt.Rule{Alert: "mem_high", Expr: `mem > {{ var "mem_warn" }}`})
+	assert.EqualError(t, err, "undefined variable mem_warn")
+
+	// Variables are kept per tenant
+	vars, err = client.GetVariables(otherNID)
+	assert.NoError(t, err)
+	assert.Empty(t, vars)
+
+	assert.NoError(t, client.DeleteVariable(testNID, "cpu_warn"))
+	err = client.DeleteVariable(testNID, "cpu_warn")
+	assert.True(t, errors.Is(err, alert.ErrVariableNotFound))
+	_, hasVarsFile := files["test_vars.yml"]
+	assert.True(t, hasVarsFile)
+}
+
+func TestClient_GroupLimit(t *testing.T) {
+	files := map[string][]byte{}
+	client := newTestClient("tenantID", newInMemoryFSClient(files))
+
+	_, err := client.GetGroupLimit(testNID, "cpu")
+	assert.True(t, errors.Is(err, alert.ErrGroupNotFound))
+
+	assert.NoError(t, client.WriteRuleToGroup(testNID, "cpu", rulefmt.Rule{Alert: "cpu_high", Expr: "cpu_usage > 80"}))
+	limit, err := client.GetGroupLimit(testNID, "cpu")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, limit)
+	assert.NotContains(t, string(files["test_rules.yml"]), "limit:")
+
+	assert.NoError(t, client.SetGroupLimit(testNID, "cpu", 10))
+	assert.Contains(t, string(files["test_rules.yml"]), "limit: 10")
+	limit, err = client.GetGroupLimit(testNID, "cpu")
+	assert.NoError(t, err)
+	assert.Equal(t, 10, limit)
+
+	// The limit is kept when the group's rules change
+	assert.NoError(t, client.WriteRuleToGroup(testNID, "cpu", rulefmt.Rule{Alert: "cpu_low", Expr: "cpu_usage < 5"}))
+	limit, err = client.GetGroupLimit(testNID, "cpu")
+	assert.NoError(t, err)
+	assert.Equal(t, 10, limit)
+
+	err = client.SetGroupLimit(testNID, "cpu", -1)
+	assert.IsType(t, alert.RuleValidationError{}, err)
+	err = client.SetGroupLimit(testNID, "memory", 10)
+	assert.True(t, errors.Is(err, alert.ErrGroupNotFound))
+
+	assert.NoError(t, client.SetGroupLimit(testNID, "cpu", 0))
+	assert.NotContains(t, string(files["test_rules.yml"]), "limit:")
+}
+
+func TestClient_Staging(t *testing.T) {
+	files := map[string][]byte{}
+	fsClient := newInMemoryFSClient(files)
+	fsClient.On("ReadDir", "").Return(func(string) []os.FileInfo {
+		var infos []os.FileInfo
+		for name := range files {
+			infos = append(infos, testFileInfo{name: name})
+		}
+		return infos
+	}, nil)
+	client := newTestClient("tenantID", fsClient)
+	assert.NoError(t, client.WriteRule(testNID, sampleRule))
+	live := string(files["test_rules.yml"])
+
+	// The staging area starts out with the live rules
+	staged := client.Staged()
+	rules, err := staged.ReadRules(testNID, "")
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+
+	assert.NoError(t, staged.WriteRule(testNID, sampleRule2))
+	assert.True(t, staged.RuleExists(testNID, sampleRule2.Alert))
+	assert.False(t, client.RuleExists(testNID, sampleRule2.Alert))
+	assert.Equal(t, live, string(files["test_rules.yml"]))
+	rules, err = staged.ReadRules(testNID, "")
+	assert.NoError(t, err)
+	assert.Len(t, rules, 2)
+	// Prometheus doesn't load staged rules, so there's nothing to reload
+	assert.NoError(t, staged.ReloadPrometheus())
+
+	assert.NoError(t, client.PromoteStaging(testNID))
+	rules, err = client.ReadRules(testNID, "")
+	assert.NoError(t, err)
+	assert.Len(t, rules, 2)
+	_, hasStagingFile := files["test_rules.staging.yml"]
+	assert.False(t, hasStagingFile)
+	assert.True(t, errors.Is(client.PromoteStaging(testNID), alert.ErrNoStagedChanges))
+
+	// Discarding leaves the live rules as they were
+	assert.NoError(t, staged.DeleteRule(testNID, sampleRule.Alert))
+	assert.False(t, staged.RuleExists(testNID, sampleRule.Alert))
+	// Staging files aren't listed as tenants
+	tenants, err := client.ListTenants(alert.TenantListOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{testNID}, tenants)
+
+	assert.NoError(t, client.DiscardStaging(testNID))
+	assert.True(t, client.RuleExists(testNID, sampleRule.Alert))
+	assert.True(t, staged.RuleExists(testNID, sampleRule.Alert))
+	assert.True(t, errors.Is(client.DiscardStaging(testNID), alert.ErrNoStagedChanges))
+}
+
+func TestClient_SkipRestriction(t *testing.T) {
+	globalRule := rulefmt.Rule{
+		Alert:       "global_rule",
+		Expr:        "sum(up) == 0",
+		Annotations: map[string]string{alert.SkipRestrictionAnnotation: "true"},
+	}
+	tenancy := alert.TenancyConfig{RestrictorLabel: "tenantID", RestrictQueries: true, AllowSkipRestriction: true}
+	files := map[string][]byte{}
+	fileLocks, _ := alert.NewFileLocker(newHealthyDirClient("test"))
+	client, _ := alert.NewClient(fileLocks, "prometheus-host.com", newInMemoryFSClient(files), tenancy)
+
+	assert.NoError(t, client.WriteRule(testNID, globalRule))
+	assert.NoError(t, client.WriteRule(testNID, sampleRule))
+	rules, err := client.ReadRules(testNID, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "sum(up) == 0", rules[0].Expr)
+	assert.Equal(t, testNID, rules[0].Labels["tenantID"])
+	assert.Equal(t, `up{tenantID="test"} == 0`, rules[1].Expr)
+
+	// The tenant label can be left off as well
+	tenancy.SkipRestrictionLabel = true
+	files = map[string][]byte{}
+	client, _ = alert.NewClient(fileLocks, "prometheus-host.com", newInMemoryFSClient(files), tenancy)
+	assert.NoError(t, client.WriteRule(testNID, globalRule))
+	rules, err = client.ReadRules(testNID, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "sum(up) == 0", rules[0].Expr)
+	assert.NotContains(t, rules[0].Labels, "tenantID")
+
+	// The annotation is ignored unless the tenancy config allows it
+	tenancy.AllowSkipRestriction = false
+	files = map[string][]byte{}
+	client, _ = alert.NewClient(fileLocks, "prometheus-host.com", newInMemoryFSClient(files), tenancy)
+	assert.NoError(t, client.WriteRule(testNID, globalRule))
+	rules, err = client.ReadRules(testNID, "")
+	assert.NoError(t, err)
+	assert.Equal(t, `sum(up{tenantID="test"}) == 0`, rules[0].Expr)
+	assert.Equal(t, testNID, rules[0].Labels["tenantID"])
+}
+
+func TestClient_RestrictorLabelCase(t *testing.T) {
+	caseRule := func() rulefmt.Rule {
+		return rulefmt.Rule{
+			Alert:       "case_rule",
+			Expr:        "up == 0",
+			Labels:      map[string]string{"TenantID": otherNID},
+			Annotations: map[string]string{alert.SkipRestrictionAnnotation: "true"},
+		}
+	}
+	tenancy := alert.TenancyConfig{RestrictorLabel: "tenantID", RestrictQueries: true}
+	files := map[string][]byte{}
+	fileLocks, _ := alert.NewFileLocker(newHealthyDirClient("test"))
+	client, _ := alert.NewClient(fileLocks, "prometheus-host.com", newInMemoryFSClient(files), tenancy)
+
+	err := client.WriteRule(testNID, caseRule())
+	assert.IsType(t, alert.RuleValidationError{}, err)
+	assert.EqualError(t, err, "label TenantID differs from the restrictor label tenantID only in case")
+	results, err := client.BulkUpdateRules(testNID, []rulefmt.Rule{caseRule(), sampleRule})
+	assert.NoError(t, err)
+	assert.EqualError(t, results.Errors["case_rule"], "label TenantID differs from the restrictor label tenantID only in case")
+	assert.Equal(t, "created", results.Statuses[sampleRule.Alert])
+
+	// Rules left unsecured are checked as well
+	tenancy.AllowSkipRestriction = true
+	tenancy.SkipRestrictionLabel = true
+	client, _ = alert.NewClient(fileLocks, "prometheus-host.com", newInMemoryFSClient(files), tenancy)
+	err = client.WriteRule(testNID, caseRule())
+	assert.EqualError(t, err, "label TenantID differs from the restrictor label tenantID only in case")
+}
+
+func TestClient_WriteRuleToGroup(t *testing.T) {
+	var written []byte
+	fsClient := &mocks.FSClient{}
+	fsClient.On("Stat", "test_rules.yml").Return(nil, nil)
+	fsClient.On("ReadFile", "test_rules.yml").Return([]byte(testRuleFile), nil)
+	fsClient.On("WriteFile", "test_rules.yml", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		written = args.Get(1).([]byte)
+	}).Return(nil)
+
+	client := newTestClient("tenantID", fsClient)
+	err := client.WriteRuleToGroup(testNID, "newGroup", sampleRule)
+	assert.NoError(t, err)
+
+	ruleFile := alert.File{}
+	assert.NoError(t, yaml.Unmarshal(written, &ruleFile))
+	assert.Equal(t, 2, len(ruleFile.RuleGroups))
+	assert.Equal(t, 2, len(ruleFile.RuleGroups[0].Rules))
+	assert.Equal(t, "newGroup", ruleFile.RuleGroups[1].Name)
+	assert.Equal(t, sampleRule.Alert, ruleFile.RuleGroups[1].Rules[0].Alert)
+
+	// empty group writes to the default group
+	err = client.WriteRuleToGroup(testNID, "", sampleRule)
+	assert.NoError(t, err)
+	ruleFile = alert.File{}
+	assert.NoError(t, yaml.Unmarshal(written, &ruleFile))
+	assert.Equal(t, 1, len(ruleFile.RuleGroups))
+	assert.Equal(t, 3, len(ruleFile.RuleGroups[0].Rules))
+}
+
+func TestClient_ReadRulesWithGroups(t *testing.T) {
+	files := map[string][]byte{}
+	client := newTestClient("tenantID", newInMemoryFSClient(files))
+	assert.NoError(t, client.WriteRule(testNID, testRule1))
+	assert.NoError(t, client.WriteRuleToGroup(testNID, "teamGroup", sampleRule))
+
+	rules, err := client.ReadRulesWithGroups(testNID, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(rules))
+	assert.Equal(t, testNID, rules[0].Group)
+	assert.Equal(t, testRule1.Alert, rules[0].Rule.Alert)
+	assert.Equal(t, "teamGroup", rules[1].Group)
+	assert.Equal(t, sampleRule.Alert, rules[1].Rule.Alert)
+
+	rules, err = client.ReadRulesWithGroups(testNID, sampleRule.Alert)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(rules))
+	assert.Equal(t, "teamGroup", rules[0].Group)
+
+	// update moves the rule to the given group
+	assert.NoError(t, client.UpdateRuleInGroup(testNID, "otherGroup", sampleRule))
+	rules, err = client.ReadRulesWithGroups(testNID, sampleRule.Alert)
+	assert.NoError(t, err)
+	assert.Equal(t, "otherGroup", rules[0].Group)
+
+	// update without a group leaves it where it is
+	assert.NoError(t, client.UpdateRule(testNID, sampleRule))
+	rules, err = client.ReadRulesWithGroups(testNID, sampleRule.Alert)
+	assert.NoError(t, err)
+	assert.Equal(t, "otherGroup", rules[0].Group)
+
+	// bulk updates honor groups for new and existing rules
+	newRule := rulefmt.Rule{Alert: "new_rule", Expr: "up == 1"}
+	results, err := client.BulkUpdateRulesInGroups(testNID, []alert.GroupedRule{
+		{Group: "teamGroup", Rule: testRule1},
+		{Group: "teamGroup", Rule: newRule},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"test_rule_1": "updated", "new_rule": "created"}, results.Statuses)
+	rules, err = client.ReadRulesWithGroups(testNID, "")
+	assert.NoError(t, err)
+	groups := map[string]string{}
+	for _, rule := range rules {
+		groups[rule.Rule.Alert] = rule.Group
+	}
+	assert.Equal(t, map[string]string{"test_rule_1": "teamGroup", "new_rule": "teamGroup", sampleRule.Alert: "otherGroup"}, groups)
+}
+
+func TestClient_DefaultFor(t *testing.T) {
+	var written []byte
+	fsClient := &mocks.FSClient{}
+	fsClient.On("Stat", mock.AnythingOfType("string")).Return(nil, errors.New("file not found"))
+	fsClient.On("WriteFile", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		written = args.Get(1).([]byte)
+	}).Return(nil)
+	readWrittenRules := func() []rulefmt.Rule {
+		ruleFile := alert.File{}
+		assert.NoError(t, yaml.Unmarshal(written, &ruleFile))
+		return ruleFile.Rules()
+	}
+	oneMinute, _ := model.ParseDuration("1m")
+	recordingRule := rulefmt.Rule{
+		Record: "job:up:sum",
+		Expr:   "sum(up) by (job)",
+	}
+
+	// default applied to alerting rule without 'for'
+	client := newTestClient("tenantID", fsClient, alert.WithDefaultFor(oneMinute))
+	assert.NoError(t, client.WriteRule(testNID, sampleRule))
+	assert.Equal(t, oneMinute, readWrittenRules()[0].For)
+
+	// default not applied when 'for' is set
+	assert.NoError(t, client.WriteRule(testNID, testRule1))
+	assert.Equal(t, fiveSeconds, readWrittenRules()[0].For)
+
+	// default not applied to recording rules
+	assert.NoError(t, client.WriteRule(testNID, recordingRule))
+	assert.Equal(t, model.Duration(0), readWrittenRules()[0].For)
+
+	// bulk updates apply the default too
+	_, err := client.BulkUpdateRules(testNID, []rulefmt.Rule{sampleRule, testRule1, recordingRule})
+	assert.NoError(t, err)
+	rules := readWrittenRules()
+	assert.Equal(t, oneMinute, rules[0].For)
+	assert.Equal(t, fiveSeconds, rules[1].For)
+	assert.Equal(t, model.Duration(0), rules[2].For)
+
+	// updates apply the default too
+	files := map[string][]byte{}
+	client = newTestClient("tenantID", newInMemoryFSClient(files), alert.WithDefaultFor(oneMinute))
+	assert.NoError(t, client.WriteRule(testNID, testRule1))
+	updatedRule := testRule1
+	updatedRule.For = 0
+	assert.NoError(t, client.UpdateRule(testNID, updatedRule))
+	rules, err = client.ReadRules(testNID, testRule1.Alert)
+	assert.NoError(t, err)
+	assert.Equal(t, oneMinute, rules[0].For)
+
+	// no default configured
+	client = newTestClient("tenantID", fsClient)
+	assert.NoError(t, client.WriteRule(testNID, sampleRule))
+	assert.Equal(t, model.Duration(0), readWrittenRules()[0].For)
+}
+
+func TestClient_GlobalRuleUniqueness(t *testing.T) {
+	fsClient := newFSClient(nil, nil)
+	fsClient.On("ReadDir", "").Return([]os.FileInfo{
+		testFileInfo{name: "test_rules.yml"},
+		testFileInfo{name: "other_rules.yml"},
+		testFileInfo{name: "not_a_rules_file.txt"},
+	}, nil)
+	otherRule := rulefmt.Rule{
+		Alert: "other_rule_1",
+		Expr:  "up == 0",
+	}
+
+	// name used by another tenant is rejected
+	client := newTestClient("tenantID", fsClient, alert.WithGlobalRuleUniqueness(true))
+	err := client.WriteRule(testNID, otherRule)
+	assert.EqualError(t, err, "rule other_rule_1 already exists for tenant other")
+	assert.IsType(t, alert.RuleValidationError{}, err)
+
+	// bulk updates check new rules too
+	results, err := client.BulkUpdateRules(testNID, []rulefmt.Rule{otherRule, sampleRule})
+	assert.NoError(t, err)
+	assert.EqualError(t, results.Errors["other_rule_1"], "rule other_rule_1 already exists for tenant other")
+	assert.Equal(t, map[string]string{sampleRule.Alert: "created"}, results.Statuses)
+
+	// existing rules in the tenant's own file can still be updated in bulk
+	results, err = client.BulkUpdateRules(testNID, []rulefmt.Rule{testRule1})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"test_rule_1": "updated"}, results.Statuses)
+
+	// unused name is allowed
+	err = client.WriteRule(testNID, sampleRule)
+	assert.NoError(t, err)
+
+	// error listing files
+	errFSClient := newFSClient(nil, nil)
+	errFSClient.On("ReadDir", "").Return(nil, errors.New("readdir err"))
+	client = newTestClient("tenantID", errFSClient, alert.WithGlobalRuleUniqueness(true))
+	err = client.WriteRule(testNID, sampleRule)
+	assert.EqualError(t, err, "error listing rules files: readdir err")
+
+	// collisions allowed when mode is off
+	client = newTestClient("tenantID", fsClient)
+	err = client.WriteRule(testNID, otherRule)
+	assert.NoError(t, err)
+}
+
+func TestClient_FindRuleTenant(t *testing.T) {
+	fsClient := newFSClient(nil, nil)
+	fsClient.On("ReadDir", "").Return([]os.FileInfo{
+		testFileInfo{name: "test_rules.yml"},
+		testFileInfo{name: "other_rules.yml"},
+		testFileInfo{name: "not_a_rules_file.txt"},
+	}, nil)
+	client := newTestClient("tenantID", fsClient)
+
+	tenants, err := client.FindRuleTenant("test_rule_1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{testNID}, tenants)
+
+	tenants, err = client.FindRuleTenant("other_rule_1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{otherNID}, tenants)
+
+	// rule owned by both tenants
+	tenants, err = client.FindRuleTenant("test_rule_2")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{otherNID, testNID}, tenants)
+
+	tenants, err = client.FindRuleTenant("no_rule")
+	assert.NoError(t, err)
+	assert.Empty(t, tenants)
+
+	// error listing files
+	errFSClient := newFSClient(nil, nil)
+	errFSClient.On("ReadDir", "").Return(nil, errors.New("readdir err"))
+	client = newTestClient("tenantID", errFSClient)
+	_, err = client.FindRuleTenant("test_rule_1")
+	assert.EqualError(t, err, "error listing rules files: readdir err")
+
+	// error reading one of the files names the file
+	files := map[string][]byte{"test_rules.yml": []byte(testRuleFile)}
+	missingFSClient := newInMemoryFSClient(files)
+	missingFSClient.On("ReadDir", "").Return([]os.FileInfo{
+		testFileInfo{name: "test_rules.yml"},
+		testFileInfo{name: "other_rules.yml"},
+	}, nil)
+	client = newTestClient("tenantID", missingFSClient)
+	_, err = client.FindRuleTenant("test_rule_1")
+	assert.EqualError(t, err, "other_rules.yml: error reading rules file: file does not exist")
+}
+
+func TestClient_GetRuleByIndex(t *testing.T) {
+	files := map[string][]byte{}
+	client := newTestClient("tenantID", newInMemoryFSClient(files))
+	recordingRule := rulefmt.Rule{Record: "job:up:sum", Expr: "sum(up) by (job)"}
+	assert.NoError(t, client.WriteRuleToGroup(testNID, "teamGroup", sampleRule))
+	assert.NoError(t, client.WriteRuleToGroup(testNID, "teamGroup", recordingRule))
+
+	rule, err := client.GetRuleByIndex(testNID, "teamGroup", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, recordingRule.Record, rule.Record)
+	assert.Equal(t, `sum by(job) (up{tenantID="test"})`, rule.Expr)
+
+	_, err = client.GetRuleByIndex(testNID, "teamGroup", 2)
+	assert.True(t, errors.Is(err, alert.ErrRuleNotFound))
+	_, err = client.GetRuleByIndex(otherNID, "teamGroup", 0)
+	assert.True(t, errors.Is(err, alert.ErrRuleNotFound))
+}
+
+func TestClient_ListTenants(t *testing.T) {
+	modTime := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	fsClient := newFSClient(nil, nil)
+	fsClient.On("ReadDir", "").Return([]os.FileInfo{
+		testFileInfo{name: "test_rules.yml", modTime: modTime},
+		testFileInfo{name: "other_rules.yml", modTime: modTime.Add(-time.Hour)},
+		testFileInfo{name: "test2_rules.yml", modTime: modTime.Add(time.Hour)},
+		testFileInfo{name: "not_a_rules_file.txt", modTime: modTime.Add(time.Hour)},
+	}, nil)
+	client := newTestClient("tenantID", fsClient)
+
+	tenants, err := client.ListTenants(alert.TenantListOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{otherNID, testNID, "test2"}, tenants)
+
+	tenants, err = client.ListTenants(alert.TenantListOptions{Prefix: "test"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{testNID, "test2"}, tenants)
+
+	tenants, err = client.ListTenants(alert.TenantListOptions{Limit: 1, Offset: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{testNID}, tenants)
+
+	// Only files modified strictly after the time are listed
+	tenants, err = client.ListTenants(alert.TenantListOptions{ModifiedSince: modTime})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"test2"}, tenants)
+
+	tenants, err = client.ListTenants(alert.TenantListOptions{ModifiedSince: modTime.Add(-2 * time.Hour)})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{otherNID, testNID, "test2"}, tenants)
+}
+
+func TestClient_RulesModTime(t *testing.T) {
+	modTime := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	fsClient := &mocks.FSClient{}
+	fsClient.On("Stat", "test_rules.yml").Return(testFileInfo{name: "test_rules.yml", modTime: modTime}, nil)
+	fsClient.On("Stat", mock.AnythingOfType("string")).Return(nil, errors.New("file not found"))
+	client := newTestClient("tenantID", fsClient)
+
+	mtime, err := client.RulesModTime(testNID)
+	assert.NoError(t, err)
+	assert.Equal(t, modTime, mtime)
+
+	mtime, err = client.RulesModTime(otherNID)
+	assert.NoError(t, err)
+	assert.True(t, mtime.IsZero())
+}
+
+func TestTenantListOptions_Apply(t *testing.T) {
+	tenants := []string{"b2", "a", "b1", "c", "b3"}
+
+	assert.Equal(t, []string{"a", "b1", "b2", "b3", "c"}, alert.TenantListOptions{}.Apply(tenants))
+	assert.Equal(t, []string{"b1", "b2", "b3"}, alert.TenantListOptions{Prefix: "b"}.Apply(tenants))
+	assert.Equal(t, []string{"b2"}, alert.TenantListOptions{Prefix: "b", Limit: 1, Offset: 1}.Apply(tenants))
+	assert.Equal(t, []string{"b3", "c"}, alert.TenantListOptions{Limit: 10, Offset: 3}.Apply(tenants))
+	assert.Equal(t, []string{}, alert.TenantListOptions{Offset: 5}.Apply(tenants))
+	assert.Equal(t, []string{}, alert.TenantListOptions{Prefix: "d"}.Apply(tenants))
+}
+
+func TestClient_CompareRules(t *testing.T) {
+	files := map[string][]byte{
+		"golden_rules.yml": []byte(`groups:
+- name: golden
+  rules:
+  - alert: same
+    expr: up{tenantID="golden"} == 0
+    labels:
+      severity: major
+      tenantID: golden
+  - alert: changed
+    expr: rate(errors_total{tenantID="golden"}[5m]) > 1
+    labels:
+      tenantID: golden
+  - alert: golden_only
+    expr: up{tenantID="golden"} == 1
+    labels:
+      tenantID: golden
+`),
+		"drifted_rules.yml": []byte(`groups:
+- name: drifted
+  rules:
+  - alert: same
+    expr: up{tenantID="drifted"} == 0
+    labels:
+      severity: major
+      tenantID: drifted
+  - alert: changed
+    expr: rate(errors_total{tenantID="drifted"}[5m]) > 5
+    labels:
+      tenantID: drifted
+  - alert: drifted_only
+    expr: up{tenantID="drifted"} == 1
+    labels:
+      tenantID: drifted
+`),
+	}
+	client := newTestClient("tenantID", newInMemoryFSClient(files))
+
+	diff, err := client.CompareRules("golden", "drifted")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"golden_only"}, diff.OnlyInA)
+	assert.Equal(t, []string{"drifted_only"}, diff.OnlyInB)
+	assert.Equal(t, []string{"changed"}, diff.Differing)
+
+	// tenant without a rules file has no rules
+	diff, err = client.CompareRules("golden", "empty")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"changed", "golden_only", "same"}, diff.OnlyInA)
+	assert.Empty(t, diff.OnlyInB)
+	assert.Empty(t, diff.Differing)
+
+	// error reading file
+	client = newTestClient("tenantID", readErrFSClient)
+	_, err = client.CompareRules(testNID, otherNID)
+	assert.EqualError(t, err, "error reading rules file: read err")
+}
+
+func TestClient_GlobalRuleUniquenessConcurrent(t *testing.T) {
+	files := map[string][]byte{}
+	fsClient := newInMemoryFSClient(files)
+	fsClient.On("ReadDir", "").Return(func(string) []os.FileInfo {
+		var infos []os.FileInfo
+		for name := range files {
+			infos = append(infos, testFileInfo{name: name})
+		}
+		return infos
+	}, nil)
+	client := newTestClient("tenantID", fsClient, alert.WithGlobalRuleUniqueness(true))
+
+	// only one of several tenants writing the same name at once succeeds
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = client.WriteRule(fmt.Sprintf("tenant%d", i), sampleRule)
+		}(i)
+	}
+	wg.Wait()
+
+	successes := 0
+	for _, err := range errs {
+		if err == nil {
+			successes++
+		}
+	}
+	assert.Equal(t, 1, successes)
+}
+
+func TestClient_GlobalRuleUniquenessWithMoveRule(t *testing.T) {
+	files := map[string][]byte{}
+	fsClient := newInMemoryFSClient(files)
+	fsClient.On("ReadDir", "").Return([]os.FileInfo{
+		testFileInfo{name: "a_rules.yml"},
+		testFileInfo{name: "b_rules.yml"},
+	}, nil)
+	client := newTestClient("tenantID", fsClient, alert.WithGlobalRuleUniqueness(true))
+	assert.NoError(t, client.WriteRule("a", sampleRule))
+
+	// bulk updates checking other tenants' files don't deadlock with moves
+	// locking both files
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			_ = client.MoveRule("a", "b", sampleRule.Alert)
+			_ = client.MoveRule("b", "a", sampleRule.Alert)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			_, _ = client.BulkUpdateRules("b", []rulefmt.Rule{{Alert: fmt.Sprintf("rule_%d", i), Expr: "up == 0"}})
+		}
+	}()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for concurrent updates")
+	}
+}
+
 func TestClient_UpdateRule(t *testing.T) {
 	client := newTestClient("tenantID", healthyFSClient)
 	err := client.UpdateRule(testNID, testRule1)
@@ -211,6 +1086,55 @@ func TestClient_UpdateRule(t *testing.T) {
 	assert.EqualError(t, err, "error writing rules file: write err")
 }
 
+func TestClient_ListRuleNames(t *testing.T) {
+	files := map[string][]byte{}
+	client := newTestClient("tenantID", newInMemoryFSClient(files))
+	assert.NoError(t, client.WriteRule(testNID, rulefmt.Rule{Alert: "zeta_alert", Expr: "up == 0"}))
+	assert.NoError(t, client.WriteRuleToGroup(testNID, "recordings", rulefmt.Rule{Record: "job:up:sum", Expr: "sum(up) by (job)"}))
+	assert.NoError(t, client.WriteRule(testNID, rulefmt.Rule{Alert: "alpha_alert", Expr: "up == 1"}))
+
+	names, err := client.ListRuleNames(testNID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alpha_alert", "job:up:sum", "zeta_alert"}, names)
+
+	// rule file doesn't exist
+	names, err = client.ListRuleNames("not_a_file")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, names)
+
+	client = newTestClient("tenantID", readErrFSClient)
+	_, err = client.ListRuleNames(testNID)
+	assert.EqualError(t, err, "error reading rules file: read err")
+}
+
+func TestClient_LegacyCompat(t *testing.T) {
+	files := map[string][]byte{"legacy_rules.yml": []byte(legacyRuleFile)}
+	client := newTestClient("tenantID", newInMemoryFSClient(files), alert.WithLegacyCompat(true))
+
+	rules, err := client.ReadRulesWithGroups(legacyNID, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(rules))
+	assert.Equal(t, legacyNID, rules[0].Group)
+	assert.Equal(t, "legacy_rule_1", rules[0].Rule.Alert)
+	assert.Equal(t, `up{tenantID="legacy"} == 0`, rules[0].Rule.Expr)
+	assert.Equal(t, model.Duration(5*time.Minute), rules[0].Rule.For)
+	assert.Equal(t, map[string]string{"severity": "major", "tenantID": "legacy"}, rules[0].Rule.Labels)
+	assert.Equal(t, "legacy:up:sum", rules[1].Rule.Record)
+
+	// Modifying the file rewrites it in the current layout
+	assert.NoError(t, client.WriteRule(legacyNID, rulefmt.Rule{Alert: "new_rule", Expr: "up == 1"}))
+	written := alert.File{}
+	assert.NoError(t, yaml.Unmarshal(files["legacy_rules.yml"], &written))
+	assert.Equal(t, 1, len(written.RuleGroups))
+	assert.Equal(t, 3, len(written.Rules()))
+
+	// Legacy files are rejected without compatibility mode
+	files["legacy_rules.yml"] = []byte(legacyRuleFile)
+	client = newTestClient("tenantID", newInMemoryFSClient(files))
+	_, err = client.ReadRules(legacyNID, "")
+	assert.EqualError(t, err, "error parsing rules file: legacy_rules.yml is in the legacy format, which requires compatibility mode")
+}
+
 func TestClient_ReadRules(t *testing.T) {
 	client := newTestClient("tenantID", healthyFSClient)
 
@@ -239,6 +1163,22 @@ func TestClient_ReadRules(t *testing.T) {
 	rules, err = client.ReadRules("not_a_file", "")
 	assert.NoError(t, err)
 	assert.Equal(t, rules, []rulefmt.Rule{})
+
+	// rule file exists but cannot be read
+	client = newTestClient("tenantID", readErrFSClient)
+	rules, err = client.ReadRules(testNID, "")
+	assert.EqualError(t, err, "error reading rules file: read err")
+	assert.Equal(t, 0, len(rules))
+
+	// rule file exists but is corrupt
+	corruptFSClient := &mocks.FSClient{}
+	corruptFSClient.On("Stat", "test_rules.yml").Return(nil, nil)
+	corruptFSClient.On("ReadFile", "test_rules.yml").Return([]byte("groups: {{"), nil)
+	client = newTestClient("tenantID", corruptFSClient)
+	rules, err = client.ReadRules(testNID, "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "error parsing rules file")
+	assert.Equal(t, 0, len(rules))
 }
 
 func TestClient_DeleteRule(t *testing.T) {
@@ -274,6 +1214,31 @@ func TestClient_BulkUpdateRules(t *testing.T) {
 	// Check results string
 	assert.Equal(t, "Errors: \n\tbad_rule: error parsing query: 1:11: parse error: unexpected character inside braces: '.'\nStatuses: \n\ttestAlert: created\n\ttest_rule_1: updated\n", results.String())
 
+	// Errors keep their messages through JSON
+	body, err := json.Marshal(results)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"Errors": {"bad_rule": "error parsing query: 1:11: parse error: unexpected character inside braces: '.'"}, "Statuses": {"testAlert": "created", "test_rule_1": "updated"}}`, string(body))
+	var decoded alert.BulkUpdateResults
+	assert.NoError(t, json.Unmarshal(body, &decoded))
+	assert.Equal(t, results.String(), decoded.String())
+
+	// duplicate rule names in payload
+	duplicateRule := sampleRule
+	duplicateRule.Expr = "up == 1"
+	results, err = client.BulkUpdateRules(testNID, []rulefmt.Rule{sampleRule, duplicateRule})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(results.Statuses))
+	assert.Equal(t, 1, len(results.Errors))
+	assert.EqualError(t, results.Errors[sampleRule.Alert], "duplicate rule name in payload")
+
+	// distinct recording rules aren't duplicates
+	recordingRule1 := rulefmt.Rule{Record: "job:up:sum", Expr: "sum(up) by (job)"}
+	recordingRule2 := rulefmt.Rule{Record: "job:up:count", Expr: "count(up) by (job)"}
+	results, err = client.BulkUpdateRules(testNID, []rulefmt.Rule{recordingRule1, recordingRule2})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(results.Errors))
+	assert.Equal(t, map[string]string{"job:up:sum": "created", "job:up:count": "created"}, results.Statuses)
+
 	// cannot read file
 	client = newTestClient("tenantID", readErrFSClient)
 	results, err = client.BulkUpdateRules(testNID, []rulefmt.Rule{sampleRule})
@@ -285,14 +1250,505 @@ func TestClient_BulkUpdateRules(t *testing.T) {
 	assert.EqualError(t, err, "error writing rules file: write err")
 }
 
-func newTestClient(multitenantLabel string, fsClient *mocks.FSClient) alert.PrometheusAlertClient {
+func TestClient_BulkUpdateRules_TenantCheck(t *testing.T) {
+	// Securing a rule sets its tenant label, so each call gets new rules
+	tenantRule := func(name, tenant string) rulefmt.Rule {
+		rule := rulefmt.Rule{Alert: name, Expr: "up == 0", Labels: map[string]string{"severity": "major"}}
+		if tenant != "" {
+			rule.Labels["tenantID"] = tenant
+		}
+		return rule
+	}
+
+	// Without the check the label is overwritten with the path tenant
+	client := newTestClient("tenantID", healthyFSClient)
+	results, err := client.BulkUpdateRules(testNID, []rulefmt.Rule{tenantRule("other_rule", otherNID)})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(results.Statuses))
+
+	client = newTestClient("tenantID", healthyFSClient, alert.WithBulkTenantCheck(true))
+	_, err = client.BulkUpdateRules(testNID, []rulefmt.Rule{tenantRule("test_rule", testNID), tenantRule("other_rule", otherNID)})
+	assert.IsType(t, alert.RuleValidationError{}, err)
+	assert.EqualError(t, err, "rules with a tenantID label other than test: other_rule")
+
+	// Rules carrying the path tenant, or no tenant label, are accepted
+	results, err = client.BulkUpdateRules(testNID, []rulefmt.Rule{tenantRule("test_rule", testNID), tenantRule("unlabeled_rule", "")})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(results.Statuses))
+	assert.Equal(t, 0, len(results.Errors))
+}
+
+func TestClient_BulkUpdateMixedRules(t *testing.T) {
+	files := map[string][]byte{}
+	client := newTestClient("tenantID", newInMemoryFSClient(files))
+	assert.NoError(t, client.WriteRule(testNID, rulefmt.Rule{Record: "job:up:sum", Expr: "sum(up) by (job)"}))
+
+	results, err := client.BulkUpdateRules(testNID, []rulefmt.Rule{
+		{Alert: "instance_down", Expr: "up == 0"},
+		{Record: "job:up:sum", Expr: "sum(up) by (job, instance)"},
+		{Record: "job:up:count", Expr: "count(up) by (job)"},
+		{Alert: "job_down", Expr: "job:up:sum == 0"},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, results.Errors)
+	assert.Equal(t, map[string]string{
+		"instance_down": "created",
+		"job:up:sum":    "updated",
+		"job:up:count":  "created",
+		"job_down":      "created",
+	}, results.Statuses)
+
+	// Existing recording rules are replaced in place rather than added again
+	rules, err := client.ReadRules(testNID, "")
+	assert.NoError(t, err)
+	assert.Len(t, rules, 4)
+	assert.Equal(t, "job:up:sum", rules[0].Record)
+	assert.Equal(t, `sum by(job, instance) (up{tenantID="test"})`, rules[0].Expr)
+	assert.Equal(t, "test", rules[0].Labels["tenantID"])
+}
+
+func TestClient_ReplaceRules(t *testing.T) {
+	files := map[string][]byte{}
+	client := newTestClient("tenantID", newInMemoryFSClient(files))
+	assert.NoError(t, client.WriteRule(testNID, rulefmt.Rule{Alert: "removed_rule", Expr: "up == 0"}))
+	assert.NoError(t, client.WriteRuleToGroup(testNID, "kept", rulefmt.Rule{Alert: "kept_rule", Expr: "up == 0"}))
+	assert.NoError(t, client.SetGroupLimit(testNID, "kept", 10))
+
+	err := client.ReplaceRules(testNID, alert.File{RuleGroups: []alert.RuleGroup{
+		{Name: "kept", Interval: model.Duration(time.Minute), Rules: []rulefmt.Rule{{Alert: "kept_rule", Expr: "up == 1"}}},
+		{Name: "new", Rules: []rulefmt.Rule{{Record: "job:up:sum", Expr: "sum(up) by (job)"}}},
+	}})
+	assert.NoError(t, err)
+
+	// Rules that weren't in the payload are gone, and the groups are
+	// written as given
+	names, err := client.ListRuleNames(testNID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"job:up:sum", "kept_rule"}, names)
+	rules, err := client.ReadRulesWithGroups(testNID, "kept_rule")
+	assert.NoError(t, err)
+	assert.Equal(t, "kept", rules[0].Group)
+	assert.Equal(t, `up{tenantID="test"} == 1`, rules[0].Rule.Expr)
+	assert.Equal(t, "test", rules[0].Rule.Labels["tenantID"])
+	limit, err := client.GetGroupLimit(testNID, "kept")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, limit)
+
+	// Nothing is written if any rule is invalid
+	client = newTestClient("tenantID", newInMemoryFSClient(files), alert.WithRequiredKeys([]string{"severity"}, nil))
+	err = client.ReplaceRules(testNID, alert.File{RuleGroups: []alert.RuleGroup{
+		{Name: "kept", Rules: []rulefmt.Rule{{Alert: "kept_rule", Expr: "up == 1", Labels: map[string]string{"severity": "major"}}}},
+		{Name: "new", Rules: []rulefmt.Rule{{Alert: "unlabeled_rule", Expr: "up == 0"}}},
+	}})
+	assert.IsType(t, alert.RuleValidationError{}, err)
+	names, err = client.ListRuleNames(testNID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"job:up:sum", "kept_rule"}, names)
+
+	err = client.ReplaceRules(testNID, alert.File{RuleGroups: []alert.RuleGroup{
+		{Name: "kept", Rules: []rulefmt.Rule{{Alert: "kept_rule", Expr: "up == 1", Labels: map[string]string{"severity": "major"}}}},
+		{Name: "new", Rules: []rulefmt.Rule{{Alert: "kept_rule", Expr: "up == 0", Labels: map[string]string{"severity": "major"}}}},
+	}})
+	assert.EqualError(t, err, "duplicate rule name in payload: kept_rule")
+
+	// Replacing with no rules leaves an empty rules file
+	err = client.ReplaceRules(testNID, alert.File{})
+	assert.NoError(t, err)
+	names, err = client.ListRuleNames(testNID)
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+}
+
+func TestClient_AnchorPreservation(t *testing.T) {
+	anchoredFile := `groups:
+- name: test
+  rules:
+  - alert: first_rule
+    expr: up{tenantID="test"} == 0
+    labels: &team
+      team: infra
+      tenantID: test
+  - alert: second_rule
+    expr: up{tenantID="test"} == 1
+    labels: *team
+`
+	newRule := rulefmt.Rule{Alert: "new_rule", Expr: "up == 2"}
+
+	// Without preservation the alias is expanded
+	files := map[string][]byte{"test_rules.yml": []byte(anchoredFile)}
+	client := newTestClient("tenantID", newInMemoryFSClient(files))
+	assert.NoError(t, client.WriteRule(testNID, newRule))
+	assert.NotContains(t, string(files["test_rules.yml"]), "*team")
+
+	files = map[string][]byte{"test_rules.yml": []byte(anchoredFile)}
+	client = newTestClient("tenantID", newInMemoryFSClient(files), alert.WithAnchorPreservation(true))
+	assert.NoError(t, client.WriteRule(testNID, newRule))
+	written := string(files["test_rules.yml"])
+	assert.Contains(t, written, "labels: &team")
+	assert.Contains(t, written, "labels: *team")
+	assert.Contains(t, written, "new_rule")
+
+	rules, err := client.ReadRules(testNID, "second_rule")
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+	assert.Equal(t, map[string]string{"team": "infra", "tenantID": "test"}, rules[0].Labels)
+
+	// Removing the anchored rule inlines the labels into the rule aliasing them
+	assert.NoError(t, client.DeleteRule(testNID, "first_rule"))
+	assert.NotContains(t, string(files["test_rules.yml"]), "*team")
+	rules, err = client.ReadRules(testNID, "second_rule")
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+	assert.Equal(t, map[string]string{"team": "infra", "tenantID": "test"}, rules[0].Labels)
+}
+
+func TestClient_WithRestrictorMatchers(t *testing.T) {
+	files := map[string][]byte{}
+	client := newTestClient("tenantID", newInMemoryFSClient(files)).WithRestrictorMatchers(map[string]string{"team": "payments"})
+	assert.NoError(t, client.WriteRule(testNID, rulefmt.Rule{Alert: "instance_down", Expr: "up == 0"}))
+
+	rules, err := client.ReadRules(testNID, "instance_down")
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+	assert.Equal(t, `up{team="payments",tenantID="test"} == 0`, rules[0].Expr)
+	assert.Equal(t, map[string]string{"team": "payments", "tenantID": "test"}, rules[0].Labels)
+
+	// The tenant label can't be replaced
+	client = client.WithRestrictorMatchers(map[string]string{"tenantID": otherNID})
+	err = client.WriteRule(testNID, rulefmt.Rule{Alert: "other_down", Expr: "up == 0"})
+	assert.IsType(t, alert.RuleValidationError{}, err)
+	assert.EqualError(t, err, "matcher tenantID would replace the tenant label")
+}
+
+func TestClient_MergeDuplicateGroups(t *testing.T) {
+	files := map[string][]byte{"test_rules.yml": []byte(`groups:
+- name: test
+  rules:
+  - alert: first_rule
+    expr: up{tenantID="test"} == 0
+- name: infra
+  interval: 1m
+  rules:
+  - alert: second_rule
+    expr: up{tenantID="test"} == 1
+- name: test
+  limit: 10
+  rules:
+  - alert: third_rule
+    expr: up{tenantID="test"} == 2
+`)}
+	client := newTestClient("tenantID", newInMemoryFSClient(files))
+	assert.NoError(t, client.WriteRuleToGroup(testNID, "infra", rulefmt.Rule{Alert: "fourth_rule", Expr: "up == 3"}))
+
+	ruleFile := alert.File{}
+	assert.NoError(t, yaml.Unmarshal(files["test_rules.yml"], &ruleFile))
+	assert.Len(t, ruleFile.RuleGroups, 2)
+	assert.Equal(t, "test", ruleFile.RuleGroups[0].Name)
+	assert.Equal(t, 10, ruleFile.RuleGroups[0].Limit)
+	assert.Len(t, ruleFile.RuleGroups[0].Rules, 2)
+	assert.Equal(t, "first_rule", ruleFile.RuleGroups[0].Rules[0].Alert)
+	assert.Equal(t, "third_rule", ruleFile.RuleGroups[0].Rules[1].Alert)
+	assert.Equal(t, "infra", ruleFile.RuleGroups[1].Name)
+	assert.Len(t, ruleFile.RuleGroups[1].Rules, 2)
+	assert.Equal(t, "fourth_rule", ruleFile.RuleGroups[1].Rules[1].Alert)
+}
+
+func TestClient_MoveRule(t *testing.T) {
+	files := map[string][]byte{}
+	client := newTestClient("tenantID", newInMemoryFSClient(files))
+	assert.NoError(t, client.WriteRule("src", rulefmt.Rule{
+		Alert:  "moved_rule",
+		Expr:   "up == 0",
+		Labels: map[string]string{"severity": "major"},
+	}))
+	assert.NoError(t, client.WriteRule("src", sampleRule))
+
+	err := client.MoveRule("src", "dst", "moved_rule")
+	assert.NoError(t, err)
+
+	srcRules, err := client.ReadRules("src", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(srcRules))
+	assert.Equal(t, sampleRule.Alert, srcRules[0].Alert)
+
+	dstRules, err := client.ReadRules("dst", "moved_rule")
+	assert.NoError(t, err)
+	assert.Equal(t, `up{tenantID="dst"} == 0`, dstRules[0].Expr)
+	assert.Equal(t, map[string]string{"severity": "major", "tenantID": "dst"}, dstRules[0].Labels)
+
+	// rule doesn't exist in source
+	err = client.MoveRule("src", "dst", "moved_rule")
+	assert.EqualError(t, err, "rule moved_rule not found")
+
+	// rule already exists in destination
+	assert.NoError(t, client.WriteRule("dst", sampleRule))
+	err = client.MoveRule("src", "dst", sampleRule.Alert)
+	assert.EqualError(t, err, "rule testAlert already exists for tenant dst")
+
+	// same source and destination
+	err = client.MoveRule("src", "src", sampleRule.Alert)
+	assert.EqualError(t, err, "cannot move rule testAlert to the same tenant")
+
+	// cannot read source file
+	client = newTestClient("tenantID", readErrFSClient)
+	err = client.MoveRule(testNID, otherNID, "test_rule_1")
+	assert.EqualError(t, err, "error reading rules file: read err")
+}
+
+func TestClient_MoveRule_SourceWriteError(t *testing.T) {
+	files := map[string][]byte{}
+	client := newTestClient("tenantID", newInMemoryFSClient(files))
+	assert.NoError(t, client.WriteRule("src", rulefmt.Rule{Alert: "moved_rule", Expr: "up == 0"}))
+	assert.NoError(t, client.WriteRule("dst", rulefmt.Rule{Alert: "dst_rule", Expr: "up == 0"}))
+	originalSrc, originalDst := files["src_rules.yml"], files["dst_rules.yml"]
+
+	// The destination is restored when the source can't be written, so the
+	// rule stays with the source tenant only
+	client = newTestClient("tenantID", newFailingInMemoryFSClient(files, map[string]error{"src_rules.yml": errors.New("write err")}))
+	err := client.MoveRule("src", "dst", "moved_rule")
+	assert.EqualError(t, err, "error writing rules file: write err")
+	assert.Equal(t, originalSrc, files["src_rules.yml"])
+	assert.Equal(t, originalDst, files["dst_rules.yml"])
+
+	// A destination file that didn't exist is removed again
+	err = client.MoveRule("src", "new", "moved_rule")
+	assert.EqualError(t, err, "error writing rules file: write err")
+	assert.NotContains(t, files, "new_rules.yml")
+	names, err := client.ListRuleNames("src")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"moved_rule"}, names)
+}
+
+func TestClient_AddLabelToAllRules(t *testing.T) {
+	files := map[string][]byte{}
+	client := newTestClient("tenantID", newInMemoryFSClient(files), alert.WithRequiredKeys([]string{"team"}, nil))
+	assert.NoError(t, client.WriteRule(testNID, rulefmt.Rule{
+		Alert:  "first",
+		Expr:   "up == 0",
+		Labels: map[string]string{"team": "infra"},
+	}))
+	assert.NoError(t, client.WriteRuleToGroup(testNID, "other_group", rulefmt.Rule{
+		Alert:  "second",
+		Expr:   "up == 1",
+		Labels: map[string]string{"team": "infra", "severity": "minor"},
+	}))
+
+	err := client.AddLabelToAllRules(testNID, "env", "prod")
+	assert.NoError(t, err)
+	rules, err := client.ReadRules(testNID, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(rules))
+	for _, rule := range rules {
+		assert.Equal(t, "prod", rule.Labels["env"])
+	}
+
+	err = client.RemoveLabelFromAllRules(testNID, "env")
+	assert.NoError(t, err)
+	rules, err = client.ReadRules(testNID, "")
+	assert.NoError(t, err)
+	for _, rule := range rules {
+		assert.NotContains(t, rule.Labels, "env")
+	}
+
+	// removing a required label leaves the file unchanged
+	err = client.RemoveLabelFromAllRules(testNID, "team")
+	assert.EqualError(t, err, "rule first: Rule Validation Error; missing required labels: team")
+	rules, err = client.ReadRules(testNID, "first")
+	assert.NoError(t, err)
+	assert.Equal(t, "infra", rules[0].Labels["team"])
+
+	// a label value that isn't a valid template leaves the file unchanged
+	written := string(files["test_rules.yml"])
+	err = client.AddLabelToAllRules(testNID, "env", "{{ $x")
+	assert.Error(t, err)
+	assert.IsType(t, alert.RuleValidationError{}, err)
+	assert.Equal(t, written, string(files["test_rules.yml"]))
+
+	err = client.AddLabelToAllRules(testNID, "tenantID", "other")
+	assert.EqualError(t, err, "cannot modify tenancy label tenantID")
+
+	err = client.AddLabelToAllRules(testNID, "not-valid", "prod")
+	assert.EqualError(t, err, "invalid label name: not-valid")
+
+	err = client.AddLabelToAllRules("missing", "env", "prod")
+	assert.EqualError(t, err, "error reading rules file: file does not exist")
+}
+
+func TestClient_ReloadPrometheus(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "reload failed", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	healthyURL := strings.TrimPrefix(healthy.URL, "http://")
+	failingURL := strings.TrimPrefix(failing.URL, "http://")
+	fileLocks, _ := alert.NewFileLocker(newHealthyDirClient("test"))
+	tenancy := alert.TenancyConfig{RestrictorLabel: "tenantID"}
+
+	client, _ := alert.NewClient(fileLocks, healthyURL+","+healthyURL, healthyFSClient, tenancy)
+	assert.NoError(t, client.ReloadPrometheus())
+
+	client, _ = alert.NewClient(fileLocks, healthyURL+", "+failingURL, healthyFSClient, tenancy)
+	err := client.ReloadPrometheus()
+	assert.EqualError(t, err, fmt.Sprintf("error reloading prometheus: 1 of 2 instances failed: %s: status 500: reload failed\n", failingURL))
+
+	// one successful reload is enough with a quorum of 1
+	client, _ = alert.NewClient(fileLocks, healthyURL+","+failingURL, healthyFSClient, tenancy, alert.WithReloadQuorum(1))
+	assert.NoError(t, client.ReloadPrometheus())
+}
+
+func TestClient_ReloadPath(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		paths = append(paths, r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	serverURL := strings.TrimPrefix(server.URL, "http://")
+	fileLocks, _ := alert.NewFileLocker(newHealthyDirClient("test"))
+	tenancy := alert.TenancyConfig{RestrictorLabel: "tenantID"}
+
+	client, _ := alert.NewClient(fileLocks, serverURL, healthyFSClient, tenancy)
+	assert.NoError(t, client.ReloadPrometheus())
+	client, _ = alert.NewClient(fileLocks, serverURL, healthyFSClient, tenancy, alert.WithReloadPath("/prometheus/-/reload"))
+	assert.NoError(t, client.ReloadPrometheus())
+	assert.Equal(t, []string{"/-/reload", "/prometheus/-/reload"}, paths)
+}
+
+func TestClient_ReloadWindow(t *testing.T) {
+	var reloads int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&reloads, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	fileLocks, _ := alert.NewFileLocker(newHealthyDirClient("test"))
+	tenancy := alert.TenancyConfig{RestrictorLabel: "tenantID"}
+	client, _ := alert.NewClient(fileLocks, strings.TrimPrefix(server.URL, "http://"), healthyFSClient, tenancy,
+		alert.WithReloadWindow(50*time.Millisecond, time.Second))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, client.ReloadPrometheus())
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&reloads))
+}
+
+func TestClient_ReloadTenant(t *testing.T) {
+	var lock sync.Mutex
+	reloaded := map[string]int{}
+	reloadedCounts := func() map[string]int {
+		lock.Lock()
+		defer lock.Unlock()
+		counts := map[string]int{}
+		for name, count := range reloaded {
+			counts[name] = count
+		}
+		return counts
+	}
+	newServer := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			reloaded[name]++
+			lock.Unlock()
+			w.WriteHeader(http.StatusOK)
+		}))
+	}
+	serverA := newServer("a")
+	defer serverA.Close()
+	serverB := newServer("b")
+	defer serverB.Close()
+	urlA := strings.TrimPrefix(serverA.URL, "http://")
+	urlB := strings.TrimPrefix(serverB.URL, "http://")
+
+	targets, err := alert.ParseTenantTargets([]byte(fmt.Sprintf("tenantA: [%s]\ntenantB: [%s]\n", urlA, urlB)))
+	assert.NoError(t, err)
+	fileLocks, _ := alert.NewFileLocker(newHealthyDirClient("test"))
+	tenancy := alert.TenancyConfig{RestrictorLabel: "tenantID"}
+	client, _ := alert.NewClient(fileLocks, urlA+","+urlB, healthyFSClient, tenancy, alert.WithTenantTargets(targets))
+
+	// Only the mapped instance is reloaded for a tenant's change
+	assert.NoError(t, client.ReloadTenant("tenantA"))
+	assert.Equal(t, map[string]int{"a": 1}, reloadedCounts())
+	assert.NoError(t, client.ReloadTenant("tenantB"))
+	assert.Equal(t, map[string]int{"a": 1, "b": 1}, reloadedCounts())
+
+	// Tenants that aren't mapped, and full reloads, reload every instance
+	assert.NoError(t, client.ReloadTenant("tenantC"))
+	assert.Equal(t, map[string]int{"a": 2, "b": 2}, reloadedCounts())
+	assert.NoError(t, client.ReloadPrometheus())
+	assert.Equal(t, map[string]int{"a": 3, "b": 3}, reloadedCounts())
+
+	// A batch reloads each instance requested by its callers once
+	client, _ = alert.NewClient(fileLocks, urlA+","+urlB, healthyFSClient, tenancy, alert.WithTenantTargets(targets),
+		alert.WithReloadWindow(50*time.Millisecond, time.Second))
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, client.ReloadTenant("tenantA"))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, map[string]int{"a": 4, "b": 3}, reloadedCounts())
+
+	_, err = alert.ParseTenantTargets([]byte("tenantA: []\n"))
+	assert.EqualError(t, err, "tenant tenantA has no targets")
+}
+
+func TestClient_Close(t *testing.T) {
+	var reloads int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&reloads, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	fileLocks, _ := alert.NewFileLocker(newHealthyDirClient("test"))
+	tenancy := alert.TenancyConfig{RestrictorLabel: "tenantID"}
+	client, _ := alert.NewClient(fileLocks, strings.TrimPrefix(server.URL, "http://"), healthyFSClient, tenancy,
+		alert.WithReloadWindow(time.Hour, time.Hour))
+
+	result := make(chan error)
+	go func() { result <- client.ReloadPrometheus() }()
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&reloads))
+
+	// Close flushes the pending reload
+	assert.NoError(t, client.Close())
+	assert.NoError(t, <-result)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&reloads))
+
+	// Safe to call twice
+	assert.NoError(t, client.Close())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&reloads))
+
+	// Nothing to flush without a reload window
+	client, _ = alert.NewClient(fileLocks, strings.TrimPrefix(server.URL, "http://"), healthyFSClient, tenancy)
+	assert.NoError(t, client.Close())
+}
+
+func newTestClient(multitenantLabel string, fsClient *mocks.FSClient, opts ...alert.ClientOption) alert.PrometheusAlertClient {
 	dClient := newHealthyDirClient("test")
 	fileLocks, _ := alert.NewFileLocker(dClient)
 	tenancy := alert.TenancyConfig{
 		RestrictorLabel: multitenantLabel,
 		RestrictQueries: true,
 	}
-	return alert.NewClient(fileLocks, "prometheus-host.com", fsClient, tenancy)
+	client, _ := alert.NewClient(fileLocks, "prometheus-host.com", fsClient, tenancy, opts...)
+	return client
 }
 
 func newFSClient(readFileErr, writeFileErr error) *mocks.FSClient {
@@ -307,3 +1763,50 @@ func newFSClient(readFileErr, writeFileErr error) *mocks.FSClient {
 	fsClient.On("Root").Return("test_rules/")
 	return fsClient
 }
+
+// newInMemoryFSClient returns a mock FSClient backed by the given map of
+// filenames to file contents
+func newInMemoryFSClient(files map[string][]byte) *mocks.FSClient {
+	return newFailingInMemoryFSClient(files, nil)
+}
+
+// newFailingInMemoryFSClient returns an in-memory FSClient whose writes to
+// the files in writeErrs fail with the given error
+func newFailingInMemoryFSClient(files map[string][]byte, writeErrs map[string]error) *mocks.FSClient {
+	fsClient := &mocks.FSClient{}
+	fsClient.On("Stat", mock.AnythingOfType("string")).Return(nil, func(filename string) error {
+		if _, ok := files[filename]; !ok {
+			return errors.New("file not found")
+		}
+		return nil
+	})
+	fsClient.On("ReadFile", mock.AnythingOfType("string")).Return(func(filename string) []byte {
+		return files[filename]
+	}, func(filename string) error {
+		if _, ok := files[filename]; !ok {
+			return errors.New("file does not exist")
+		}
+		return nil
+	})
+	fsClient.On("WriteFile", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(func(filename string, data []byte, _ os.FileMode) error {
+		if err := writeErrs[filename]; err != nil {
+			return err
+		}
+		files[filename] = data
+		return nil
+	})
+	fsClient.On("DeleteFile", mock.AnythingOfType("string")).Run(func(args mock.Arguments) {
+		delete(files, args.String(0))
+	}).Return(nil)
+	return fsClient
+}
+
+type testFileInfo struct {
+	os.FileInfo
+	name    string
+	modTime time.Time
+}
+
+func (f testFileInfo) Name() string       { return f.name }
+func (f testFileInfo) IsDir() bool        { return false }
+func (f testFileInfo) ModTime() time.Time { return f.modTime }
@@ -10,9 +10,26 @@ package alert
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
 	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
+// fileLockWaitSeconds is how long each lock or read lock waited to be
+// acquired, by filename, to find files that requests contend on
+var fileLockWaitSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "configmanager_file_lock_wait_seconds",
+	Help:    "Time spent waiting to acquire a file lock",
+	Buckets: []float64{.0001, .001, .01, .05, .1, .5, 1, 5, 10},
+}, []string{"file"})
+
+func init() {
+	prometheus.MustRegister(fileLockWaitSeconds)
+}
+
 type FileLocker struct {
 	fileLocks map[string]*sync.RWMutex
 	selfMutex sync.Mutex
@@ -31,7 +48,7 @@ func NewFileLocker(fs DirectoryClient) (*FileLocker, error) {
 		return nil, err
 	}
 	for _, f := range files {
-		fullPath := fs.Dir() + "/" + f.Name()
+		fullPath := filepath.Join(fs.Dir(), f.Name())
 		fileLocks[fullPath] = &sync.RWMutex{}
 	}
 	return &FileLocker{
@@ -42,54 +59,71 @@ func NewFileLocker(fs DirectoryClient) (*FileLocker, error) {
 // Lock locks the mutex associated with the given filename for writing. If
 // mutex does not exist in map yet, create one.
 func (f *FileLocker) Lock(filename string) {
-	mtx, ok := f.fileLocks[filename]
-	if !ok {
-		f.selfMutex.Lock()
-		defer f.selfMutex.Unlock()
-		mtx, ok := f.fileLocks[filename]
-		if !ok {
-			f.fileLocks[filename] = &sync.RWMutex{}
-			f.fileLocks[filename].Lock()
-			return
-		}
-		mtx.Lock()
-		return
-	}
-	mtx.Lock()
+	start := time.Now()
+	f.mutex(filename, true).Lock()
+	fileLockWaitSeconds.WithLabelValues(filename).Observe(time.Since(start).Seconds())
 }
 
 // Unlock unlocks the mutex associated with the given filename for writing.
 // No-op if mutex does not exist in map
 func (f *FileLocker) Unlock(filename string) {
-	if mutex, ok := f.fileLocks[filename]; ok {
-		mutex.Unlock()
+	if mtx := f.mutex(filename, false); mtx != nil {
+		mtx.Unlock()
 	}
 }
 
-// RLock locks the mutex associated with the given filename for reading.
-// No-op if mutex does not exist in map
+// RLock locks the mutex associated with the given filename for reading. If
+// mutex does not exist in map yet, create one.
 func (f *FileLocker) RLock(filename string) {
-	mtx, ok := f.fileLocks[filename]
-	if !ok {
-		f.selfMutex.Lock()
-		defer f.selfMutex.Unlock()
-		mtx, ok := f.fileLocks[filename]
-		if !ok {
-			f.fileLocks[filename] = &sync.RWMutex{}
-			f.fileLocks[filename].RLock()
-			return
-		}
-		mtx.RLock()
-		return
-	}
-	mtx.RLock()
+	start := time.Now()
+	f.mutex(filename, true).RLock()
+	fileLockWaitSeconds.WithLabelValues(filename).Observe(time.Since(start).Seconds())
 }
 
 // RUnlock unlocks the mutex associated with the given filename for reading.
 // No-op if mutex does not exist in map
 func (f *FileLocker) RUnlock(filename string) {
-	if mutex, ok := f.fileLocks[filename]; ok {
-		mutex.RUnlock()
+	if mtx := f.mutex(filename, false); mtx != nil {
+		mtx.RUnlock()
+	}
+}
+
+// mutex returns the mutex associated with the given filename, creating it if
+// create is set. The map itself is guarded by selfMutex, since locks for new
+// files can be created while others are being looked up.
+func (f *FileLocker) mutex(filename string, create bool) *sync.RWMutex {
+	f.selfMutex.Lock()
+	defer f.selfMutex.Unlock()
+	mtx, ok := f.fileLocks[filename]
+	if !ok && create {
+		mtx = &sync.RWMutex{}
+		f.fileLocks[filename] = mtx
+	}
+	return mtx
+}
+
+// LockAll locks the mutexes for all the given filenames for writing and
+// returns a function that unlocks them together. Locks are always taken in
+// sorted order so that operations over the same files can't deadlock no
+// matter what order they list them in.
+func (f *FileLocker) LockAll(filenames ...string) func() {
+	lockOrder := make([]string, 0, len(filenames))
+	seen := make(map[string]bool)
+	for _, filename := range filenames {
+		if !seen[filename] {
+			seen[filename] = true
+			lockOrder = append(lockOrder, filename)
+		}
+	}
+	sort.Strings(lockOrder)
+
+	for _, filename := range lockOrder {
+		f.Lock(filename)
+	}
+	return func() {
+		for i := len(lockOrder) - 1; i >= 0; i-- {
+			f.Unlock(lockOrder[i])
+		}
 	}
 }
 
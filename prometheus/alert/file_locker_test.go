@@ -8,12 +8,14 @@
 package alert_test
 
 import (
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/facebookincubator/prometheus-configmanager/prometheus/alert"
 	"github.com/facebookincubator/prometheus-configmanager/prometheus/alert/mocks"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -108,7 +110,89 @@ func TestFileLocker_RUnlock(t *testing.T) {
 	assert.Equal(t, []int{1, 2, 4, 3}, events)
 }
 
+func TestFileLocker_LockAll(t *testing.T) {
+	locks, err := alert.NewFileLocker(newHealthyDirClient("test"))
+	assert.NoError(t, err)
+	counter := 0
+	// Create both mutexes up front so only the locking itself is concurrent
+	locks.LockAll("file1", "file2")()
+
+	// Lock the same two files in opposite orders from two goroutines
+	var wg sync.WaitGroup
+	for _, order := range [][]string{{"file1", "file2"}, {"file2", "file1"}} {
+		wg.Add(1)
+		go func(filenames []string) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				unlock := locks.LockAll(filenames...)
+				counter++
+				unlock()
+			}
+		}(order)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("deadlock locking files in opposite orders")
+	}
+	assert.Equal(t, 2000, counter)
+
+	// Duplicate filenames are only locked once
+	unlock := locks.LockAll("file1", "file1")
+	unlock()
+	unlock = locks.LockAll("file1")
+	unlock()
+}
+
 // creates mock directory client that doesn't return errors
+func TestFileLocker_WaitMetric(t *testing.T) {
+	locks, err := alert.NewFileLocker(newHealthyDirClient("test"))
+	assert.NoError(t, err)
+	fname := "contended_rules.yml"
+	countBefore, sumBefore := lockWaits(t, fname)
+
+	locks.Lock(fname)
+	acquired := make(chan struct{})
+	go func() {
+		locks.Lock(fname)
+		close(acquired)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	locks.Unlock(fname)
+	<-acquired
+	locks.Unlock(fname)
+
+	// Uncontended and contended acquisitions are both observed
+	count, sum := lockWaits(t, fname)
+	assert.Equal(t, uint64(2), count-countBefore)
+	assert.GreaterOrEqual(t, sum-sumBefore, 0.05)
+}
+
+// lockWaits returns the count and sum of the lock wait histogram for a file
+func lockWaits(t *testing.T, filename string) (uint64, float64) {
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "configmanager_file_lock_wait_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "file" && label.GetValue() == filename {
+					return metric.GetHistogram().GetSampleCount(), metric.GetHistogram().GetSampleSum()
+				}
+			}
+		}
+	}
+	return 0, 0
+}
+
 func newHealthyDirClient(rulesDir string) *mocks.DirectoryClient {
 	client := &mocks.DirectoryClient{}
 	client.On("Stat", mock.AnythingOfType("string")).Return(nil, nil)
@@ -0,0 +1,213 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package alert
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"gopkg.in/yaml.v3"
+)
+
+// GrafanaProvisioning holds the alert rule groups of a Grafana alerting
+// provisioning file
+type GrafanaProvisioning struct {
+	APIVersion int                `yaml:"apiVersion"`
+	Groups     []GrafanaRuleGroup `yaml:"groups"`
+}
+
+type GrafanaRuleGroup struct {
+	OrgID    int64         `yaml:"orgId"`
+	Name     string        `yaml:"name"`
+	Folder   string        `yaml:"folder"`
+	Interval string        `yaml:"interval"`
+	Rules    []GrafanaRule `yaml:"rules"`
+}
+
+// GrafanaRule is a Grafana-managed alert rule. Its Condition is the refId of
+// the query or expression in Data that decides whether the rule fires.
+type GrafanaRule struct {
+	UID          string            `yaml:"uid"`
+	Title        string            `yaml:"title"`
+	Condition    string            `yaml:"condition"`
+	Data         []GrafanaQuery    `yaml:"data"`
+	NoDataState  string            `yaml:"noDataState"`
+	ExecErrState string            `yaml:"execErrState"`
+	For          string            `yaml:"for"`
+	Annotations  map[string]string `yaml:"annotations"`
+	Labels       map[string]string `yaml:"labels"`
+	IsPaused     bool              `yaml:"isPaused"`
+}
+
+// GrafanaQuery is either a datasource query, which has an Expr, or a Grafana
+// server-side expression, which has a Type and refers to other queries by
+// refId in its Expression
+type GrafanaQuery struct {
+	RefID         string            `yaml:"refId"`
+	DatasourceUID string            `yaml:"datasourceUid"`
+	Model         GrafanaQueryModel `yaml:"model"`
+}
+
+type GrafanaQueryModel struct {
+	Expr       string             `yaml:"expr"`
+	Type       string             `yaml:"type"`
+	Expression string             `yaml:"expression"`
+	Reducer    string             `yaml:"reducer"`
+	Conditions []GrafanaCondition `yaml:"conditions"`
+}
+
+type GrafanaCondition struct {
+	Evaluator GrafanaEvaluator `yaml:"evaluator"`
+}
+
+type GrafanaEvaluator struct {
+	Type   string    `yaml:"type"`
+	Params []float64 `yaml:"params"`
+}
+
+const (
+	grafanaExprThreshold = "threshold"
+	grafanaExprReduce    = "reduce"
+
+	grafanaDefaultNoDataState  = "NoData"
+	grafanaDefaultExecErrState = "Error"
+)
+
+var grafanaComparisons = map[string]string{
+	"gt":  ">",
+	"lt":  "<",
+	"gte": ">=",
+	"lte": "<=",
+	"eq":  "==",
+	"ne":  "!=",
+}
+
+// ConvertGrafanaRules parses a Grafana alerting provisioning file, in YAML or
+// JSON, and converts its rules to prometheus alerting rules in groups of the
+// same name. Warnings are returned by rule title for parts of a rule that
+// have no prometheus equivalent. Rules that can't be converted at all are
+// left out, with a warning saying why.
+func ConvertGrafanaRules(data []byte) ([]GroupedRule, map[string][]string, error) {
+	provisioning := GrafanaProvisioning{}
+	err := yaml.Unmarshal(data, &provisioning)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing grafana provisioning file: %v", err)
+	}
+
+	rules := make([]GroupedRule, 0)
+	warnings := make(map[string][]string)
+	for _, group := range provisioning.Groups {
+		for _, grafanaRule := range group.Rules {
+			rule, ruleWarnings, err := convertGrafanaRule(grafanaRule)
+			if err != nil {
+				ruleWarnings = append(ruleWarnings, fmt.Sprintf("rule not imported: %v", err))
+			} else {
+				rules = append(rules, GroupedRule{Group: group.Name, Rule: rule})
+			}
+			if len(ruleWarnings) > 0 {
+				warnings[grafanaRule.Title] = append(warnings[grafanaRule.Title], ruleWarnings...)
+			}
+		}
+	}
+	return rules, warnings, nil
+}
+
+func convertGrafanaRule(grafanaRule GrafanaRule) (rulefmt.Rule, []string, error) {
+	var warnings []string
+	queries := make(map[string]GrafanaQuery, len(grafanaRule.Data))
+	for _, query := range grafanaRule.Data {
+		queries[query.RefID] = query
+	}
+	expr, err := grafanaQueryExpr(queries, grafanaRule.Condition, &warnings, 0)
+	if err != nil {
+		return rulefmt.Rule{}, warnings, err
+	}
+
+	rule := rulefmt.Rule{
+		Alert:       grafanaRule.Title,
+		Expr:        expr,
+		Labels:      grafanaRule.Labels,
+		Annotations: grafanaRule.Annotations,
+	}
+	if grafanaRule.For != "" {
+		forDuration, err := model.ParseDuration(grafanaRule.For)
+		if err != nil {
+			return rulefmt.Rule{}, warnings, fmt.Errorf("invalid for duration %s: %v", grafanaRule.For, err)
+		}
+		rule.For = forDuration
+	}
+
+	if grafanaRule.NoDataState != "" && grafanaRule.NoDataState != grafanaDefaultNoDataState {
+		warnings = append(warnings, fmt.Sprintf("noDataState %s isn't supported, the rule won't fire without data", grafanaRule.NoDataState))
+	}
+	if grafanaRule.ExecErrState != "" && grafanaRule.ExecErrState != grafanaDefaultExecErrState {
+		warnings = append(warnings, fmt.Sprintf("execErrState %s isn't supported, the rule won't fire on query errors", grafanaRule.ExecErrState))
+	}
+	if grafanaRule.IsPaused {
+		warnings = append(warnings, "the rule is paused in grafana but is imported as active")
+	}
+	return rule, warnings, nil
+}
+
+// grafanaQueryExpr returns the PromQL expression equivalent to the query or
+// expression with the given refId. Thresholds become comparisons on the
+// query they refer to, and reductions are dropped since prometheus alerts on
+// the latest value of each series.
+func grafanaQueryExpr(queries map[string]GrafanaQuery, refID string, warnings *[]string, depth int) (string, error) {
+	// Expressions that refer to each other in a loop are invalid in grafana
+	if depth > len(queries) {
+		return "", fmt.Errorf("expression %s refers to itself", refID)
+	}
+	query, ok := queries[refID]
+	if !ok {
+		return "", fmt.Errorf("no query or expression with refId %s", refID)
+	}
+	if query.Model.Expr != "" {
+		return query.Model.Expr, nil
+	}
+
+	switch query.Model.Type {
+	case grafanaExprReduce:
+		if query.Model.Reducer != "" && query.Model.Reducer != "last" {
+			*warnings = append(*warnings, fmt.Sprintf("reducer %s of expression %s isn't supported, the latest value is used instead", query.Model.Reducer, refID))
+		}
+		return grafanaQueryExpr(queries, query.Model.Expression, warnings, depth+1)
+	case grafanaExprThreshold:
+		inner, err := grafanaQueryExpr(queries, query.Model.Expression, warnings, depth+1)
+		if err != nil {
+			return "", err
+		}
+		if len(query.Model.Conditions) == 0 {
+			return "", fmt.Errorf("threshold %s has no condition", refID)
+		}
+		return grafanaThresholdExpr(inner, query.Model.Conditions[0].Evaluator)
+	case "":
+		return "", fmt.Errorf("query %s has no prometheus expression", refID)
+	default:
+		return "", fmt.Errorf("grafana expression type %s of %s isn't supported", query.Model.Type, refID)
+	}
+}
+
+func grafanaThresholdExpr(expr string, evaluator GrafanaEvaluator) (string, error) {
+	params := make([]string, len(evaluator.Params))
+	for i, param := range evaluator.Params {
+		params[i] = strconv.FormatFloat(param, 'f', -1, 64)
+	}
+	if comparison, ok := grafanaComparisons[evaluator.Type]; ok && len(params) >= 1 {
+		return fmt.Sprintf("(%s) %s %s", expr, comparison, params[0]), nil
+	}
+	switch {
+	case evaluator.Type == "within_range" && len(params) >= 2:
+		return fmt.Sprintf("(%s) > %s < %s", expr, params[0], params[1]), nil
+	case evaluator.Type == "outside_range" && len(params) >= 2:
+		return fmt.Sprintf("(%s) < %s or (%s) > %s", expr, params[0], expr, params[1]), nil
+	}
+	return "", fmt.Errorf("threshold evaluator %s with %d params isn't supported", evaluator.Type, len(params))
+}
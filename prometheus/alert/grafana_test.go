@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package alert_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/prometheus-configmanager/prometheus/alert"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"github.com/stretchr/testify/assert"
+)
+
+const grafanaProvisioningFixture = `
+apiVersion: 1
+groups:
+  - orgId: 1
+    name: node
+    folder: infra
+    interval: 1m
+    rules:
+      - uid: cpu
+        title: HighCPU
+        condition: C
+        for: 5m
+        labels:
+          severity: warning
+        annotations:
+          summary: CPU usage is high
+        data:
+          - refId: A
+            datasourceUid: prom
+            model:
+              expr: rate(node_cpu_seconds_total{mode!="idle"}[5m])
+          - refId: B
+            datasourceUid: __expr__
+            model:
+              type: reduce
+              expression: A
+              reducer: mean
+          - refId: C
+            datasourceUid: __expr__
+            model:
+              type: threshold
+              expression: B
+              conditions:
+                - evaluator:
+                    type: gt
+                    params: [0.9]
+      - uid: down
+        title: InstanceDown
+        condition: A
+        noDataState: Alerting
+        isPaused: true
+        data:
+          - refId: A
+            datasourceUid: prom
+            model:
+              expr: up == 0
+      - uid: math
+        title: ErrorRatio
+        condition: B
+        data:
+          - refId: A
+            datasourceUid: prom
+            model:
+              expr: http_errors_total
+          - refId: B
+            datasourceUid: __expr__
+            model:
+              type: math
+              expression: $A / 100
+`
+
+func TestConvertGrafanaRules(t *testing.T) {
+	rules, warnings, err := alert.ConvertGrafanaRules([]byte(grafanaProvisioningFixture))
+	assert.NoError(t, err)
+	assert.Equal(t, []alert.GroupedRule{
+		{
+			Group: "node",
+			Rule: rulefmt.Rule{
+				Alert:       "HighCPU",
+				Expr:        `(rate(node_cpu_seconds_total{mode!="idle"}[5m])) > 0.9`,
+				For:         model.Duration(5 * time.Minute),
+				Labels:      map[string]string{"severity": "warning"},
+				Annotations: map[string]string{"summary": "CPU usage is high"},
+			},
+		},
+		{
+			Group: "node",
+			Rule: rulefmt.Rule{
+				Alert: "InstanceDown",
+				Expr:  "up == 0",
+			},
+		},
+	}, rules)
+
+	assert.Len(t, warnings, 3)
+	assert.Len(t, warnings["HighCPU"], 1)
+	assert.Contains(t, warnings["HighCPU"][0], "reducer mean")
+	assert.Len(t, warnings["InstanceDown"], 2)
+	assert.Equal(t, []string{"rule not imported: grafana expression type math of B isn't supported"}, warnings["ErrorRatio"])
+
+	// JSON provisioning files are accepted too
+	rules, warnings, err = alert.ConvertGrafanaRules([]byte(`{"apiVersion": 1, "groups": [{"name": "g", "rules": [
+		{"title": "Range", "condition": "B", "data": [
+			{"refId": "A", "model": {"expr": "temperature"}},
+			{"refId": "B", "model": {"type": "threshold", "expression": "A",
+				"conditions": [{"evaluator": {"type": "outside_range", "params": [10, 30]}}]}}
+		]}
+	]}]}`))
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+	assert.Equal(t, []alert.GroupedRule{{Group: "g", Rule: rulefmt.Rule{
+		Alert: "Range",
+		Expr:  "(temperature) < 10 or (temperature) > 30",
+	}}}, rules)
+
+	// Conditions referring to a missing or circular refId aren't imported
+	rules, warnings, err = alert.ConvertGrafanaRules([]byte(`{"groups": [{"name": "g", "rules": [
+		{"title": "Missing", "condition": "Z", "data": []},
+		{"title": "Loop", "condition": "A", "data": [{"refId": "A", "model": {"type": "reduce", "expression": "A"}}]}
+	]}]}`))
+	assert.NoError(t, err)
+	assert.Empty(t, rules)
+	assert.Equal(t, []string{"rule not imported: no query or expression with refId Z"}, warnings["Missing"])
+	assert.Equal(t, []string{"rule not imported: expression A refers to itself"}, warnings["Loop"])
+
+	_, _, err = alert.ConvertGrafanaRules([]byte("groups: {"))
+	assert.Error(t, err)
+}
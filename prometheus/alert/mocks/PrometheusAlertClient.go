@@ -7,6 +7,8 @@ import (
 	mock "github.com/stretchr/testify/mock"
 
 	rulefmt "github.com/prometheus/prometheus/pkg/rulefmt"
+
+	time "time"
 )
 
 // PrometheusAlertClient is an autogenerated mock type for the PrometheusAlertClient type
@@ -14,6 +16,20 @@ type PrometheusAlertClient struct {
 	mock.Mock
 }
 
+// AddLabelToAllRules provides a mock function with given fields: filePrefix, key, value
+func (_m *PrometheusAlertClient) AddLabelToAllRules(filePrefix string, key string, value string) error {
+	ret := _m.Called(filePrefix, key, value)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, string) error); ok {
+		r0 = rf(filePrefix, key, value)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // BulkUpdateRules provides a mock function with given fields: filePrefix, rules
 func (_m *PrometheusAlertClient) BulkUpdateRules(filePrefix string, rules []rulefmt.Rule) (alert.BulkUpdateResults, error) {
 	ret := _m.Called(filePrefix, rules)
@@ -35,6 +51,62 @@ func (_m *PrometheusAlertClient) BulkUpdateRules(filePrefix string, rules []rule
 	return r0, r1
 }
 
+// BulkUpdateRulesInGroups provides a mock function with given fields: filePrefix, rules
+func (_m *PrometheusAlertClient) BulkUpdateRulesInGroups(filePrefix string, rules []alert.GroupedRule) (alert.BulkUpdateResults, error) {
+	ret := _m.Called(filePrefix, rules)
+
+	var r0 alert.BulkUpdateResults
+	if rf, ok := ret.Get(0).(func(string, []alert.GroupedRule) alert.BulkUpdateResults); ok {
+		r0 = rf(filePrefix, rules)
+	} else {
+		r0 = ret.Get(0).(alert.BulkUpdateResults)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, []alert.GroupedRule) error); ok {
+		r1 = rf(filePrefix, rules)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Close provides a mock function with given fields:
+func (_m *PrometheusAlertClient) Close() error {
+	ret := _m.Called()
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func() error); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CompareRules provides a mock function with given fields: prefixA, prefixB
+func (_m *PrometheusAlertClient) CompareRules(prefixA string, prefixB string) (alert.RuleDiff, error) {
+	ret := _m.Called(prefixA, prefixB)
+
+	var r0 alert.RuleDiff
+	if rf, ok := ret.Get(0).(func(string, string) alert.RuleDiff); ok {
+		r0 = rf(prefixA, prefixB)
+	} else {
+		r0 = ret.Get(0).(alert.RuleDiff)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(prefixA, prefixB)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // DeleteRule provides a mock function with given fields: filePrefix, ruleName
 func (_m *PrometheusAlertClient) DeleteRule(filePrefix string, ruleName string) error {
 	ret := _m.Called(filePrefix, ruleName)
@@ -49,6 +121,219 @@ func (_m *PrometheusAlertClient) DeleteRule(filePrefix string, ruleName string)
 	return r0
 }
 
+// DeleteVariable provides a mock function with given fields: filePrefix, name
+func (_m *PrometheusAlertClient) DeleteVariable(filePrefix string, name string) error {
+	ret := _m.Called(filePrefix, name)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(filePrefix, name)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DiscardStaging provides a mock function with given fields: filePrefix
+func (_m *PrometheusAlertClient) DiscardStaging(filePrefix string) error {
+	ret := _m.Called(filePrefix)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(filePrefix)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ExpandVariables provides a mock function with given fields: filePrefix, rule
+func (_m *PrometheusAlertClient) ExpandVariables(filePrefix string, rule rulefmt.Rule) (rulefmt.Rule, error) {
+	ret := _m.Called(filePrefix, rule)
+
+	var r0 rulefmt.Rule
+	if rf, ok := ret.Get(0).(func(string, rulefmt.Rule) rulefmt.Rule); ok {
+		r0 = rf(filePrefix, rule)
+	} else {
+		r0 = ret.Get(0).(rulefmt.Rule)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, rulefmt.Rule) error); ok {
+		r1 = rf(filePrefix, rule)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindRuleTenant provides a mock function with given fields: ruleName
+func (_m *PrometheusAlertClient) FindRuleTenant(ruleName string) ([]string, error) {
+	ret := _m.Called(ruleName)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(string) []string); ok {
+		r0 = rf(ruleName)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(ruleName)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetGroupLimit provides a mock function with given fields: filePrefix, groupName
+func (_m *PrometheusAlertClient) GetGroupLimit(filePrefix string, groupName string) (int, error) {
+	ret := _m.Called(filePrefix, groupName)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(string, string) int); ok {
+		r0 = rf(filePrefix, groupName)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(filePrefix, groupName)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetRuleByIndex provides a mock function with given fields: filePrefix, groupName, idx
+func (_m *PrometheusAlertClient) GetRuleByIndex(filePrefix string, groupName string, idx int) (*rulefmt.Rule, error) {
+	ret := _m.Called(filePrefix, groupName, idx)
+
+	var r0 *rulefmt.Rule
+	if rf, ok := ret.Get(0).(func(string, string, int) *rulefmt.Rule); ok {
+		r0 = rf(filePrefix, groupName, idx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*rulefmt.Rule)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, int) error); ok {
+		r1 = rf(filePrefix, groupName, idx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetVariables provides a mock function with given fields: filePrefix
+func (_m *PrometheusAlertClient) GetVariables(filePrefix string) (map[string]string, error) {
+	ret := _m.Called(filePrefix)
+
+	var r0 map[string]string
+	if rf, ok := ret.Get(0).(func(string) map[string]string); ok {
+		r0 = rf(filePrefix)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(filePrefix)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListRuleNames provides a mock function with given fields: filePrefix
+func (_m *PrometheusAlertClient) ListRuleNames(filePrefix string) ([]string, error) {
+	ret := _m.Called(filePrefix)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(string) []string); ok {
+		r0 = rf(filePrefix)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(filePrefix)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListTenants provides a mock function with given fields: opts
+func (_m *PrometheusAlertClient) ListTenants(opts alert.TenantListOptions) ([]string, error) {
+	ret := _m.Called(opts)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(alert.TenantListOptions) []string); ok {
+		r0 = rf(opts)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(alert.TenantListOptions) error); ok {
+		r1 = rf(opts)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MoveRule provides a mock function with given fields: srcPrefix, dstPrefix, ruleName
+func (_m *PrometheusAlertClient) MoveRule(srcPrefix string, dstPrefix string, ruleName string) error {
+	ret := _m.Called(srcPrefix, dstPrefix, ruleName)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, string) error); ok {
+		r0 = rf(srcPrefix, dstPrefix, ruleName)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// PromoteStaging provides a mock function with given fields: filePrefix
+func (_m *PrometheusAlertClient) PromoteStaging(filePrefix string) error {
+	ret := _m.Called(filePrefix)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(filePrefix)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // ReadRules provides a mock function with given fields: filePrefix, ruleName
 func (_m *PrometheusAlertClient) ReadRules(filePrefix string, ruleName string) ([]rulefmt.Rule, error) {
 	ret := _m.Called(filePrefix, ruleName)
@@ -72,6 +357,29 @@ func (_m *PrometheusAlertClient) ReadRules(filePrefix string, ruleName string) (
 	return r0, r1
 }
 
+// ReadRulesWithGroups provides a mock function with given fields: filePrefix, ruleName
+func (_m *PrometheusAlertClient) ReadRulesWithGroups(filePrefix string, ruleName string) ([]alert.GroupedRule, error) {
+	ret := _m.Called(filePrefix, ruleName)
+
+	var r0 []alert.GroupedRule
+	if rf, ok := ret.Get(0).(func(string, string) []alert.GroupedRule); ok {
+		r0 = rf(filePrefix, ruleName)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]alert.GroupedRule)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(filePrefix, ruleName)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // ReloadPrometheus provides a mock function with given fields:
 func (_m *PrometheusAlertClient) ReloadPrometheus() error {
 	ret := _m.Called()
@@ -86,6 +394,48 @@ func (_m *PrometheusAlertClient) ReloadPrometheus() error {
 	return r0
 }
 
+// ReloadTenant provides a mock function with given fields: filePrefix
+func (_m *PrometheusAlertClient) ReloadTenant(filePrefix string) error {
+	ret := _m.Called(filePrefix)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(filePrefix)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RemoveLabelFromAllRules provides a mock function with given fields: filePrefix, key
+func (_m *PrometheusAlertClient) RemoveLabelFromAllRules(filePrefix string, key string) error {
+	ret := _m.Called(filePrefix, key)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(filePrefix, key)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ReplaceRules provides a mock function with given fields: filePrefix, ruleFile
+func (_m *PrometheusAlertClient) ReplaceRules(filePrefix string, ruleFile alert.File) error {
+	ret := _m.Called(filePrefix, ruleFile)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, alert.File) error); ok {
+		r0 = rf(filePrefix, ruleFile)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // RuleExists provides a mock function with given fields: filePrefix, rulename
 func (_m *PrometheusAlertClient) RuleExists(filePrefix string, rulename string) bool {
 	ret := _m.Called(filePrefix, rulename)
@@ -100,6 +450,71 @@ func (_m *PrometheusAlertClient) RuleExists(filePrefix string, rulename string)
 	return r0
 }
 
+// RulesModTime provides a mock function with given fields: filePrefix
+func (_m *PrometheusAlertClient) RulesModTime(filePrefix string) (time.Time, error) {
+	ret := _m.Called(filePrefix)
+
+	var r0 time.Time
+	if rf, ok := ret.Get(0).(func(string) time.Time); ok {
+		r0 = rf(filePrefix)
+	} else {
+		r0 = ret.Get(0).(time.Time)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(filePrefix)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetGroupLimit provides a mock function with given fields: filePrefix, groupName, limit
+func (_m *PrometheusAlertClient) SetGroupLimit(filePrefix string, groupName string, limit int) error {
+	ret := _m.Called(filePrefix, groupName, limit)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, int) error); ok {
+		r0 = rf(filePrefix, groupName, limit)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetVariable provides a mock function with given fields: filePrefix, name, value
+func (_m *PrometheusAlertClient) SetVariable(filePrefix string, name string, value string) error {
+	ret := _m.Called(filePrefix, name, value)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, string) error); ok {
+		r0 = rf(filePrefix, name, value)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Staged provides a mock function with given fields:
+func (_m *PrometheusAlertClient) Staged() alert.PrometheusAlertClient {
+	ret := _m.Called()
+
+	var r0 alert.PrometheusAlertClient
+	if rf, ok := ret.Get(0).(func() alert.PrometheusAlertClient); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(alert.PrometheusAlertClient)
+		}
+	}
+
+	return r0
+}
+
 // Tenancy provides a mock function with given fields:
 func (_m *PrometheusAlertClient) Tenancy() alert.TenancyConfig {
 	ret := _m.Called()
@@ -128,6 +543,36 @@ func (_m *PrometheusAlertClient) UpdateRule(filePrefix string, rule rulefmt.Rule
 	return r0
 }
 
+// UpdateRuleInGroup provides a mock function with given fields: filePrefix, groupName, rule
+func (_m *PrometheusAlertClient) UpdateRuleInGroup(filePrefix string, groupName string, rule rulefmt.Rule) error {
+	ret := _m.Called(filePrefix, groupName, rule)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, rulefmt.Rule) error); ok {
+		r0 = rf(filePrefix, groupName, rule)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// WithRestrictorMatchers provides a mock function with given fields: matchers
+func (_m *PrometheusAlertClient) WithRestrictorMatchers(matchers map[string]string) alert.PrometheusAlertClient {
+	ret := _m.Called(matchers)
+
+	var r0 alert.PrometheusAlertClient
+	if rf, ok := ret.Get(0).(func(map[string]string) alert.PrometheusAlertClient); ok {
+		r0 = rf(matchers)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(alert.PrometheusAlertClient)
+		}
+	}
+
+	return r0
+}
+
 // WriteRule provides a mock function with given fields: filePrefix, rule
 func (_m *PrometheusAlertClient) WriteRule(filePrefix string, rule rulefmt.Rule) error {
 	ret := _m.Called(filePrefix, rule)
@@ -141,3 +586,17 @@ func (_m *PrometheusAlertClient) WriteRule(filePrefix string, rule rulefmt.Rule)
 
 	return r0
 }
+
+// WriteRuleToGroup provides a mock function with given fields: filePrefix, groupName, rule
+func (_m *PrometheusAlertClient) WriteRuleToGroup(filePrefix string, groupName string, rule rulefmt.Rule) error {
+	ret := _m.Called(filePrefix, groupName, rule)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, rulefmt.Rule) error); ok {
+		r0 = rf(filePrefix, groupName, rule)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
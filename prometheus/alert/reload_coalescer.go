@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package alert
+
+import (
+	"sync"
+	"time"
+)
+
+// ReloadCoalescer batches reloads requested in quick succession into a single
+// reload. A reload runs once no new request has arrived for the batch window,
+// or once the first request in the batch has waited maxDelay, whichever comes
+// first. Every caller in the batch waits for that reload and gets its result.
+type ReloadCoalescer struct {
+	reload   func() error
+	window   time.Duration
+	maxDelay time.Duration
+
+	lock    sync.Mutex
+	pending *pendingReload
+	// running is the batch whose reload is in progress, if any
+	running *pendingReload
+	closed  bool
+}
+
+type pendingReload struct {
+	deadline time.Time
+	maxDelay time.Time
+	done     chan struct{}
+	err      error
+}
+
+// NewReloadCoalescer returns a ReloadCoalescer that calls reload for each
+// batch. A maxDelay shorter than window is raised to window.
+func NewReloadCoalescer(reload func() error, window, maxDelay time.Duration) *ReloadCoalescer {
+	if maxDelay < window {
+		maxDelay = window
+	}
+	return &ReloadCoalescer{
+		reload:   reload,
+		window:   window,
+		maxDelay: maxDelay,
+	}
+}
+
+// Reload adds a reload to the current batch and waits for the batch to run.
+// Once the coalescer is closed reloads run immediately.
+func (r *ReloadCoalescer) Reload() error {
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return r.reload()
+	}
+	now := time.Now()
+	pending := r.pending
+	if pending == nil {
+		pending = &pendingReload{
+			deadline: now.Add(r.window),
+			maxDelay: now.Add(r.maxDelay),
+			done:     make(chan struct{}),
+		}
+		r.pending = pending
+		time.AfterFunc(r.window, func() { r.fire(pending) })
+	} else {
+		pending.deadline = now.Add(r.window)
+		if pending.deadline.After(pending.maxDelay) {
+			pending.deadline = pending.maxDelay
+		}
+	}
+	r.lock.Unlock()
+
+	<-pending.done
+	return pending.err
+}
+
+// Close waits for a batch whose reload is in progress and immediately runs any
+// pending batch, so that changes waiting for a reload aren't lost on shutdown,
+// and returns the result of the last of them
+func (r *ReloadCoalescer) Close() error {
+	r.lock.Lock()
+	r.closed = true
+	pending := r.pending
+	running := r.running
+	r.pending = nil
+	r.lock.Unlock()
+
+	var err error
+	if running != nil {
+		<-running.done
+		err = running.err
+	}
+	if pending != nil {
+		r.run(pending)
+		err = pending.err
+	}
+	return err
+}
+
+// fire runs the batch if its deadline has passed, otherwise it checks again
+// at the deadline
+func (r *ReloadCoalescer) fire(pending *pendingReload) {
+	r.lock.Lock()
+	if r.pending != pending {
+		// Already run by Close
+		r.lock.Unlock()
+		return
+	}
+	if remaining := time.Until(pending.deadline); remaining > 0 {
+		time.AfterFunc(remaining, func() { r.fire(pending) })
+		r.lock.Unlock()
+		return
+	}
+	r.pending = nil
+	r.running = pending
+	r.lock.Unlock()
+
+	r.run(pending)
+}
+
+func (r *ReloadCoalescer) run(pending *pendingReload) {
+	pending.err = r.reload()
+	r.lock.Lock()
+	if r.running == pending {
+		r.running = nil
+	}
+	r.lock.Unlock()
+	close(pending.done)
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package alert_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/prometheus-configmanager/prometheus/alert"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloadCoalescer_Batches(t *testing.T) {
+	var reloads int32
+	coalescer := alert.NewReloadCoalescer(func() error {
+		atomic.AddInt32(&reloads, 1)
+		return errors.New("reload err")
+	}, 50*time.Millisecond, time.Second)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.EqualError(t, coalescer.Reload(), "reload err")
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&reloads))
+
+	// A later request starts a new batch
+	assert.Error(t, coalescer.Reload())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&reloads))
+}
+
+func TestReloadCoalescer_MaxDelay(t *testing.T) {
+	var reloads int32
+	coalescer := alert.NewReloadCoalescer(func() error {
+		atomic.AddInt32(&reloads, 1)
+		return nil
+	}, 50*time.Millisecond, 200*time.Millisecond)
+
+	// Requests keep arriving within the window, which would postpone the
+	// reload indefinitely without the cap
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+				go coalescer.Reload()
+			}
+		}
+	}()
+
+	start := time.Now()
+	assert.NoError(t, coalescer.Reload())
+	assert.True(t, time.Since(start) < 600*time.Millisecond, "reload waited %v", time.Since(start))
+	assert.True(t, atomic.LoadInt32(&reloads) >= 1)
+}
+
+func TestReloadCoalescer_Close(t *testing.T) {
+	var reloads int32
+	coalescer := alert.NewReloadCoalescer(func() error {
+		atomic.AddInt32(&reloads, 1)
+		return nil
+	}, time.Hour, time.Hour)
+
+	result := make(chan error)
+	go func() { result <- coalescer.Reload() }()
+	// Wait for the reload to be pending
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&reloads))
+
+	// Close flushes the pending reload instead of waiting for the window
+	assert.NoError(t, coalescer.Close())
+	select {
+	case err := <-result:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("pending reload wasn't flushed on Close")
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&reloads))
+
+	// Nothing left to flush, and reloads after closing run immediately
+	assert.NoError(t, coalescer.Close())
+	assert.NoError(t, coalescer.Reload())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&reloads))
+}
+
+func TestReloadCoalescer_CloseWaitsForRunningReload(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	coalescer := alert.NewReloadCoalescer(func() error {
+		close(started)
+		<-release
+		return errors.New("reload err")
+	}, 10*time.Millisecond, 10*time.Millisecond)
+
+	go coalescer.Reload()
+	<-started
+
+	// The batch has left pending but its reload hasn't finished, so Close
+	// waits for it and returns its result
+	closed := make(chan error)
+	go func() { closed <- coalescer.Close() }()
+	select {
+	case <-closed:
+		t.Fatal("Close returned before the running reload finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case err := <-closed:
+		assert.EqualError(t, err, "reload err")
+	case <-time.After(time.Second):
+		t.Fatal("Close didn't return after the running reload finished")
+	}
+}
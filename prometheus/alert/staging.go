@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package alert
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// ErrNoStagedChanges is returned when promoting or discarding the staging
+// area of a tenant that has nothing staged
+var ErrNoStagedChanges = errors.New("no staged changes")
+
+func (c *client) Staged() PrometheusAlertClient {
+	staged := *c
+	staged.staged = true
+	// Staged rules aren't loaded, so the view never reloads prometheus
+	staged.reloadCoalescer = nil
+	return &staged
+}
+
+// PromoteStaging writes the tenant's staged rules over its live rules file
+// and removes the staging file
+func (c *client) PromoteStaging(filePrefix string) error {
+	filename := makeFilename(filePrefix)
+	stagingFilename := makeStagingFilename(filePrefix)
+	unlock := c.fileLocks.LockAll(filename, stagingFilename)
+	defer unlock()
+
+	if _, err := c.fsClient.Stat(stagingFilename); err != nil {
+		return fmt.Errorf("tenant %s: %w", filePrefix, ErrNoStagedChanges)
+	}
+	staged, err := c.fsClient.ReadFile(stagingFilename)
+	if err != nil {
+		glog.Errorf("error reading staging file: %v", err)
+		return fmt.Errorf("error reading staging file: %v", err)
+	}
+	err = c.fsClient.WriteFile(filename, staged, c.fileMode)
+	if err != nil {
+		glog.Errorf("error writing rules file: %v", err)
+		return fmt.Errorf("error writing rules file: %v", err)
+	}
+	return c.deleteStagingFile(stagingFilename)
+}
+
+func (c *client) DiscardStaging(filePrefix string) error {
+	stagingFilename := makeStagingFilename(filePrefix)
+	c.fileLocks.Lock(stagingFilename)
+	defer c.fileLocks.Unlock(stagingFilename)
+
+	if _, err := c.fsClient.Stat(stagingFilename); err != nil {
+		return fmt.Errorf("tenant %s: %w", filePrefix, ErrNoStagedChanges)
+	}
+	return c.deleteStagingFile(stagingFilename)
+}
+
+func (c *client) deleteStagingFile(stagingFilename string) error {
+	err := c.fsClient.DeleteFile(stagingFilename)
+	if err != nil {
+		glog.Errorf("error deleting staging file: %v", err)
+		return fmt.Errorf("error deleting staging file: %v", err)
+	}
+	return nil
+}
+
+// rulesFilename returns the name of the file the tenant's rules are read from
+// and written to: its staging file for the staged view, and its live rules
+// file otherwise
+func (c *client) rulesFilename(filePrefix string) string {
+	if c.staged {
+		return makeStagingFilename(filePrefix)
+	}
+	return makeFilename(filePrefix)
+}
+
+// sourceFilename returns the file to read for filename. A staging file that
+// hasn't been written yet holds the same rules as the live file, so that one
+// is read instead.
+func (c *client) sourceFilename(filename string) string {
+	if !c.staged {
+		return filename
+	}
+	if _, err := c.fsClient.Stat(filename); err == nil {
+		return filename
+	}
+	if !strings.HasSuffix(filename, stagingFilePostfix) {
+		return filename
+	}
+	return makeFilename(strings.TrimSuffix(filename, stagingFilePostfix))
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package alert
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ParseTenantTargets parses a YAML mapping of tenants to the prometheus
+// instances that load their rules, e.g.
+//
+//	tenantA: [prometheus-a:9090]
+//	tenantB: [prometheus-b:9090, prometheus-c:9090]
+func ParseTenantTargets(data []byte) (map[string][]string, error) {
+	targets := map[string][]string{}
+	err := yaml.Unmarshal(data, &targets)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing tenant targets: %v", err)
+	}
+	for tenant, instances := range targets {
+		if len(instances) == 0 {
+			return nil, fmt.Errorf("tenant %s has no targets", tenant)
+		}
+	}
+	return targets, nil
+}
+
+// WithTenantTargets sets the prometheus instances that load each tenant's
+// rules, so that a change to a tenant's rules only reloads those instances.
+// Tenants that aren't mapped reload every instance.
+func WithTenantTargets(targets map[string][]string) ClientOption {
+	return func(c *client) {
+		c.tenantTargets = targets
+	}
+}
+
+// targetsFor returns the instances to reload after the tenant's rules change
+func (c *client) targetsFor(filePrefix string) []string {
+	if instances, ok := c.tenantTargets[filePrefix]; ok {
+		return instances
+	}
+	return c.prometheusURLs
+}
+
+// pendingTargets collects the instances requested by the callers of a
+// batched reload
+type pendingTargets struct {
+	lock      sync.Mutex
+	instances map[string]bool
+}
+
+func (p *pendingTargets) add(instances []string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.instances == nil {
+		p.instances = map[string]bool{}
+	}
+	for _, instance := range instances {
+		p.instances[instance] = true
+	}
+}
+
+// take returns the sorted instances collected so far and starts a new batch
+func (p *pendingTargets) take() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	instances := make([]string, 0, len(p.instances))
+	for instance := range p.instances {
+		instances = append(instances, instance)
+	}
+	p.instances = nil
+	sort.Strings(instances)
+	return instances
+}
@@ -0,0 +1,180 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package alert
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"gopkg.in/yaml.v3"
+)
+
+// varsFilePostfix is appended to the tenant to name the file its rule
+// variables are stored in. Prometheus only loads *_rules.yml files, so the
+// variables file sits alongside the rules without being read as rules.
+const varsFilePostfix = "_vars.yml"
+
+// ErrVariableNotFound is returned when a variable that doesn't exist is
+// deleted
+var ErrVariableNotFound = errors.New("variable not found")
+
+var (
+	// variableReference matches a reference to a stored variable in a rule,
+	// e.g. {{ var "cpu_warn" }}
+	variableReference = regexp.MustCompile(`{{\s*var\s+"([^"]*)"\s*}}`)
+	variableName      = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// varsFile is the layout of a tenant's variables file
+type varsFile struct {
+	Variables map[string]string `yaml:"variables"`
+}
+
+// HasVariableReferences reports whether the expression or any annotation of
+// the rule references a stored variable
+func HasVariableReferences(rule rulefmt.Rule) bool {
+	if variableReference.MatchString(rule.Expr) {
+		return true
+	}
+	for _, annotation := range rule.Annotations {
+		if variableReference.MatchString(annotation) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandVariables returns the rule with every variable reference in its
+// expression and annotations replaced by the variable's value. Other
+// templating in annotations, such as {{ $labels.instance }}, is left for
+// prometheus.
+func expandVariables(rule rulefmt.Rule, vars map[string]string) (rulefmt.Rule, error) {
+	var undefined []string
+	expand := func(text string) string {
+		return variableReference.ReplaceAllStringFunc(text, func(ref string) string {
+			name := variableReference.FindStringSubmatch(ref)[1]
+			value, ok := vars[name]
+			if !ok {
+				undefined = append(undefined, name)
+			}
+			return value
+		})
+	}
+
+	rule.Expr = expand(rule.Expr)
+	if rule.Annotations != nil {
+		annotations := make(map[string]string, len(rule.Annotations))
+		for key, annotation := range rule.Annotations {
+			annotations[key] = expand(annotation)
+		}
+		rule.Annotations = annotations
+	}
+	if len(undefined) > 0 {
+		return rule, RuleValidationError{Err: fmt.Errorf("undefined variable %s", undefined[0])}
+	}
+	return rule, nil
+}
+
+// GetVariables returns the tenant's stored rule variables by name
+func (c *client) GetVariables(filePrefix string) (map[string]string, error) {
+	filename := makeVarsFilename(filePrefix)
+	c.fileLocks.RLock(filename)
+	defer c.fileLocks.RUnlock(filename)
+
+	return c.readVariables(filename)
+}
+
+// SetVariable creates or updates a stored rule variable. Rules that already
+// reference it keep the value it had when they were written.
+func (c *client) SetVariable(filePrefix, name, value string) error {
+	if !variableName.MatchString(name) {
+		return RuleValidationError{Err: fmt.Errorf("invalid variable name: %s", name)}
+	}
+	filename := makeVarsFilename(filePrefix)
+	c.fileLocks.Lock(filename)
+	defer c.fileLocks.Unlock(filename)
+
+	vars, err := c.readVariables(filename)
+	if err != nil {
+		return err
+	}
+	vars[name] = value
+	return c.writeVariables(filename, vars)
+}
+
+// DeleteVariable removes a stored rule variable, wrapping ErrVariableNotFound
+// if it doesn't exist
+func (c *client) DeleteVariable(filePrefix, name string) error {
+	filename := makeVarsFilename(filePrefix)
+	c.fileLocks.Lock(filename)
+	defer c.fileLocks.Unlock(filename)
+
+	vars, err := c.readVariables(filename)
+	if err != nil {
+		return err
+	}
+	if _, ok := vars[name]; !ok {
+		return fmt.Errorf("variable %s: %w", name, ErrVariableNotFound)
+	}
+	delete(vars, name)
+	return c.writeVariables(filename, vars)
+}
+
+// ExpandVariables returns the rule with references to the tenant's stored
+// variables replaced by their current values. A reference to a variable that
+// doesn't exist is a RuleValidationError.
+func (c *client) ExpandVariables(filePrefix string, rule rulefmt.Rule) (rulefmt.Rule, error) {
+	vars, err := c.GetVariables(filePrefix)
+	if err != nil {
+		return rule, err
+	}
+	return expandVariables(rule, vars)
+}
+
+// readVariables returns the variables in the given file. A tenant without a
+// variables file has none.
+func (c *client) readVariables(filename string) (map[string]string, error) {
+	vars := varsFile{}
+	if _, err := c.fsClient.Stat(filename); err != nil {
+		return map[string]string{}, nil
+	}
+	file, err := c.fsClient.ReadFile(filename)
+	if err != nil {
+		glog.Errorf("error reading variables file: %v", err)
+		return nil, fmt.Errorf("error reading variables file: %v", err)
+	}
+	err = yaml.Unmarshal(file, &vars)
+	if err != nil {
+		glog.Errorf("error parsing variables file: %v", err)
+		return nil, fmt.Errorf("error parsing variables file: %v", err)
+	}
+	if vars.Variables == nil {
+		vars.Variables = map[string]string{}
+	}
+	return vars.Variables, nil
+}
+
+func (c *client) writeVariables(filename string, vars map[string]string) error {
+	yamlFile, err := yaml.Marshal(varsFile{Variables: vars})
+	if err != nil {
+		return fmt.Errorf("error writing variables file: %v", err)
+	}
+	err = c.fsClient.WriteFile(filename, yamlFile, c.fileMode)
+	if err != nil {
+		glog.Errorf("error writing variables file: %v", err)
+		return fmt.Errorf("error writing variables file: %v", err)
+	}
+	return nil
+}
+
+func makeVarsFilename(filePrefix string) string {
+	return filePrefix + varsFilePostfix
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+// Package apiclient provides a Go client for the v1 REST API of the
+// prometheus configmanager
+package apiclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/facebookincubator/prometheus-configmanager/prometheus/alert"
+)
+
+// Client calls the prometheus configmanager API on behalf of a tenant
+type Client interface {
+	// CreateRule creates a new rule. It fails if a rule with the same name
+	// already exists for the tenant.
+	CreateRule(tenantID string, rule alert.RuleJSONWrapper) error
+	// GetRules returns all of the tenant's rules
+	GetRules(tenantID string) ([]alert.RuleJSONWrapper, error)
+	DeleteRule(tenantID, ruleName string) error
+	// BulkUpdate creates or updates each of the given rules, returning the
+	// outcome for each rule by name
+	BulkUpdate(tenantID string, rules []alert.RuleJSONWrapper) (alert.BulkUpdateResults, error)
+}
+
+// Error is returned when the server responds with an error status
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("status %d: %s", e.StatusCode, e.Message)
+}
+
+type client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewClient returns a Client for the configmanager at baseURL, e.g.
+// "http://prometheus-configurer:9100". If httpClient is nil
+// http.DefaultClient is used.
+func NewClient(baseURL string, httpClient *http.Client) Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+func (c *client) CreateRule(tenantID string, rule alert.RuleJSONWrapper) error {
+	return c.do(http.MethodPost, alertPath(tenantID), rule, nil)
+}
+
+func (c *client) GetRules(tenantID string) ([]alert.RuleJSONWrapper, error) {
+	var rules []alert.RuleJSONWrapper
+	err := c.do(http.MethodGet, alertPath(tenantID), nil, &rules)
+	return rules, err
+}
+
+func (c *client) DeleteRule(tenantID, ruleName string) error {
+	return c.do(http.MethodDelete, alertPath(tenantID)+"/"+url.PathEscape(ruleName), nil, nil)
+}
+
+func (c *client) BulkUpdate(tenantID string, rules []alert.RuleJSONWrapper) (alert.BulkUpdateResults, error) {
+	results := alert.NewBulkUpdateResults()
+	err := c.do(http.MethodPost, alertPath(tenantID)+"/bulk", rules, &results)
+	return results, err
+}
+
+func alertPath(tenantID string) string {
+	return "/v1/" + url.PathEscape(tenantID) + "/alert"
+}
+
+// do sends a request with body encoded as JSON, if given, and decodes the
+// response into out, if given
+func (c *client) do(method, path string, body, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("error marshaling request: %v", err)
+		}
+		reqBody = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, c.baseURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response: %v", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return newError(resp.StatusCode, respBody)
+	}
+	if out == nil {
+		return nil
+	}
+	err = json.Unmarshal(respBody, out)
+	if err != nil {
+		return fmt.Errorf("error unmarshaling response: %v", err)
+	}
+	return nil
+}
+
+// newError returns the error for a response, using the message of the JSON
+// error body the server responds with if there is one
+func newError(statusCode int, body []byte) *Error {
+	errBody := struct {
+		Message string `json:"message"`
+	}{}
+	if json.Unmarshal(body, &errBody) != nil || errBody.Message == "" {
+		errBody.Message = strings.TrimSpace(string(body))
+	}
+	return &Error{StatusCode: statusCode, Message: errBody.Message}
+}
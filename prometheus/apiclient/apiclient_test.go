@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package apiclient_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/facebookincubator/prometheus-configmanager/fsclient"
+	"github.com/facebookincubator/prometheus-configmanager/prometheus/alert"
+	"github.com/facebookincubator/prometheus-configmanager/prometheus/apiclient"
+	"github.com/facebookincubator/prometheus-configmanager/prometheus/handlers"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+const testNID = "test"
+
+var (
+	sampleRule = alert.RuleJSONWrapper{
+		Alert:  "testAlert",
+		Expr:   "up == 0",
+		For:    "5m",
+		Labels: map[string]string{"severity": "critical"},
+	}
+	otherRule = alert.RuleJSONWrapper{
+		Alert: "otherAlert",
+		Expr:  "up == 1",
+	}
+)
+
+func TestClient(t *testing.T) {
+	client, cleanup := newTestServer(t)
+	defer cleanup()
+
+	rules, err := client.GetRules(testNID)
+	assert.NoError(t, err)
+	assert.Empty(t, rules)
+
+	assert.NoError(t, client.CreateRule(testNID, sampleRule))
+	rules, err = client.GetRules(testNID)
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+	assert.Equal(t, sampleRule.Alert, rules[0].Alert)
+	assert.Equal(t, sampleRule.Expr, rules[0].Expr)
+	assert.Equal(t, sampleRule.For, rules[0].For)
+	assert.Equal(t, "critical", rules[0].Labels["severity"])
+
+	// Server errors carry the status and the server's message
+	err = client.CreateRule(testNID, sampleRule)
+	assert.EqualError(t, err, "status 400: Rule 'testAlert' already exists")
+	assert.Equal(t, http.StatusBadRequest, err.(*apiclient.Error).StatusCode)
+
+	updated := sampleRule
+	updated.Expr = "up == 2"
+	badRule := alert.RuleJSONWrapper{Alert: "badAlert", Expr: "up{"}
+	results, err := client.BulkUpdate(testNID, []alert.RuleJSONWrapper{updated, otherRule})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"testAlert": "updated", "otherAlert": "created"}, results.Statuses)
+	assert.Empty(t, results.Errors)
+	_, err = client.BulkUpdate(testNID, []alert.RuleJSONWrapper{badRule})
+	assert.Error(t, err)
+
+	assert.NoError(t, client.DeleteRule(testNID, "testAlert"))
+	rules, err = client.GetRules(testNID)
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+	assert.Equal(t, "otherAlert", rules[0].Alert)
+
+	err = client.DeleteRule(testNID, "testAlert")
+	assert.Error(t, err)
+}
+
+func TestClient_Unreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	client := apiclient.NewClient(server.URL, nil)
+
+	_, err := client.GetRules(testNID)
+	assert.Error(t, err)
+}
+
+// newTestServer runs the real v1 handlers, writing rules to a temporary
+// directory, and returns a client for them
+func newTestServer(t *testing.T) (apiclient.Client, func()) {
+	dir, err := ioutil.TempDir("", "rules")
+	assert.NoError(t, err)
+
+	prometheus := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	fileLocks, err := alert.NewFileLocker(alert.NewDirectoryClient(dir))
+	assert.NoError(t, err)
+	alertClient, err := alert.NewClient(fileLocks, strings.TrimPrefix(prometheus.URL, "http://"), fsclient.NewFSClient(dir), alert.TenancyConfig{RestrictorLabel: "tenant"})
+	assert.NoError(t, err)
+
+	e := echo.New()
+	handlers.RegisterV1Handlers(e, alertClient, false)
+	server := httptest.NewServer(e)
+
+	return apiclient.NewClient(server.URL, server.Client()), func() {
+		server.Close()
+		prometheus.Close()
+		os.RemoveAll(dir)
+	}
+}
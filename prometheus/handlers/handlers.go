@@ -8,46 +8,129 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/facebookincubator/prometheus-configmanager/prometheus/alert"
+	"github.com/facebookincubator/prometheus-configmanager/version"
 	"github.com/golang/glog"
 	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"gopkg.in/yaml.v3"
 )
 
 const (
+	routesInfoPath = "/v1/routes-info"
+	versionPath    = "/version"
+	metricsPath    = "/metrics"
+
 	v0rootPath        = "/:tenant_id"
 	v0alertPath       = "/alert"
 	v0alertUpdatePath = v0alertPath + "/:" + ruleNameParam
 	v0alertBulkPath   = v0alertPath + "/bulk"
 
-	ruleNameParam = "alert_name"
+	ruleNameParam  = "alert_name"
+	groupParam     = "group"
+	ruleIndexParam = "idx"
+	variableParam  = "variable_name"
 
 	tenantIDParam = "tenant_id"
+	unsecureParam = "unsecure"
+	groupedParam  = "grouped"
+	rawParam      = "raw"
+	stagedParam   = "staged"
+	prefixParam   = "prefix"
+	limitParam    = "limit"
+	offsetParam   = "offset"
+	sinceParam    = "since"
+	matcherParam  = "matcher"
+
+	// rulesFileField is the form field of a rules file uploaded to the bulk
+	// endpoints as multipart/form-data
+	rulesFileField = "rules"
 
 	v1rootPath       = "/v1"
 	v1TenantRootPath = v1rootPath + "/:tenant_id"
 
-	v1alertPath     = "/alert"
-	v1alertBulkPath = v1alertPath + "/bulk"
-	v1alertNamePath = v1alertPath + "/:" + ruleNameParam
-	v1TenancyPath   = "/tenancy"
+	v1alertPath              = "/alert"
+	v1alertBulkPath          = v1alertPath + "/bulk"
+	v1alertNamePath          = v1alertPath + "/:" + ruleNameParam
+	v1alertNamesPath         = v1alertPath + "/names"
+	v1TenancyPath            = "/tenancy"
+	v1TenantsPath            = "/tenants"
+	v1alertTenantPath        = v1alertNamePath + "/tenant"
+	v1RulesPath              = "/rules"
+	v1RulesComparePath       = "/rules/compare"
+	v1RulesLabelsPath        = "/rules/labels"
+	v1RulesImportGrafanaPath = "/rules/import-grafana"
+	v1GroupRuleIndexPath     = "/group/:" + groupParam + "/rule/:" + ruleIndexParam
+	v1GroupLimitPath         = "/group/:" + groupParam + "/limit"
+	v1VariablesPath          = "/variables"
+	v1VariableNamePath       = v1VariablesPath + "/:" + variableParam
+	v1StagingPromotePath     = "/staging/promote"
+	v1StagingDiscardPath     = "/staging/discard"
+	v1PromQLFormatPath       = v1rootPath + "/promql/format"
+	v1PromQLRestrictPath     = v1TenantRootPath + "/promql/restrict"
+	v1alertMetricsPath       = v1TenantRootPath + v1alertPath + "/metrics"
 )
 
+// serviceStatus is the JSON body of the status handler
+type serviceStatus struct {
+	Service string `json:"service"`
+	Status  string `json:"status"`
+}
+
+// statusHandler responds with plain text to browsers and with JSON to
+// anything else, such as programmatic health checks
 func statusHandler(c echo.Context) error {
-	return c.String(http.StatusOK, "Prometheus Config server")
+	accept := c.Request().Header.Get(echo.HeaderAccept)
+	if strings.Contains(accept, echo.MIMETextPlain) || strings.Contains(accept, echo.MIMETextHTML) {
+		return c.String(http.StatusOK, "Prometheus Config server")
+	}
+	return c.JSON(http.StatusOK, serviceStatus{Service: "prometheus-config-manager", Status: "ok"})
 }
 
 func RegisterBaseHandlers(e *echo.Echo) {
 	e.GET("/", statusHandler)
+	e.GET(routesInfoPath, GetRoutesInfoHandler(e))
+	e.GET(versionPath, versionHandler)
+	e.GET(metricsPath, echo.WrapHandler(promhttp.Handler()))
+}
+
+func versionHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, version.Get())
 }
 
-func RegisterV0Handlers(e *echo.Echo, alertClient alert.PrometheusAlertClient) {
+// GetRoutesInfoHandler returns a handler that lists the method, path, and
+// handler name of every route registered on e
+func GetRoutesInfoHandler(e *echo.Echo) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		routes := e.Routes()
+		sort.Slice(routes, func(i, j int) bool {
+			if routes[i].Path != routes[j].Path {
+				return routes[i].Path < routes[j].Path
+			}
+			return routes[i].Method < routes[j].Method
+		})
+		return c.JSON(http.StatusOK, routes)
+	}
+}
+
+func RegisterV0Handlers(e *echo.Echo, alertClient alert.PrometheusAlertClient, readOnly bool) {
 	v0 := e.Group(v0rootPath)
+	v0.Use(readOnlyMiddlewareProvider(readOnly))
 	v0.Use(tenancyMiddlewareProvider(pathTenantProvider))
 
 	v0.POST(v0alertPath, GetConfigureAlertHandler(alertClient))
@@ -59,22 +142,47 @@ func RegisterV0Handlers(e *echo.Echo, alertClient alert.PrometheusAlertClient) {
 	v0.PUT(v0alertBulkPath, GetBulkAlertUpdateHandler(alertClient))
 }
 
-func RegisterV1Handlers(e *echo.Echo, alertClient alert.PrometheusAlertClient) {
+func RegisterV1Handlers(e *echo.Echo, alertClient alert.PrometheusAlertClient, readOnly bool) {
 	v1 := e.Group(v1rootPath)
+	v1.Use(readOnlyMiddlewareProvider(readOnly))
 
 	v1.GET(v1TenancyPath, GetGetTenancyHandler(alertClient))
+	v1.GET(v1TenantsPath, GetListTenantsHandler(alertClient))
+	v1.GET(v1alertTenantPath, GetFindRuleTenantHandler(alertClient))
+	v1.GET(v1RulesComparePath, GetCompareRulesHandler(alertClient))
+	// Formatting, restriction previews, and metric listings don't modify the
+	// config, so they stay available in read-only mode
+	e.POST(v1PromQLFormatPath, FormatExprHandler)
+	e.POST(v1PromQLRestrictPath, GetRestrictExprHandler(alertClient), tenancyMiddlewareProvider(pathTenantProvider))
+	e.POST(v1alertMetricsPath, ExprMetricsHandler)
 
 	v1Tenant := e.Group(v1TenantRootPath)
+	v1Tenant.Use(readOnlyMiddlewareProvider(readOnly))
 	v1Tenant.Use(tenancyMiddlewareProvider(pathTenantProvider))
 
-	v1Tenant.POST(v1alertPath, GetConfigureAlertHandler(alertClient))
+	v1Tenant.POST(v1alertPath, GetCreateAlertHandler(alertClient))
 	v1Tenant.GET(v1alertPath, GetRetrieveAlertHandler(alertClient))
 
 	v1Tenant.DELETE(v1alertNamePath, GetDeleteAlertHandler(alertClient, pathAlertNameProvider))
 	v1Tenant.PUT(v1alertNamePath, GetUpdateAlertHandler(alertClient))
 	v1Tenant.GET(v1alertNamePath, GetRetrieveAlertHandler(alertClient))
+	v1Tenant.GET(v1alertNamesPath, GetListRuleNamesHandler(alertClient))
+	v1Tenant.GET(v1GroupRuleIndexPath, GetRuleByIndexHandler(alertClient))
+	v1Tenant.GET(v1GroupLimitPath, GetGroupLimitHandler(alertClient))
+	v1Tenant.PUT(v1GroupLimitPath, GetSetGroupLimitHandler(alertClient))
 
 	v1Tenant.POST(v1alertBulkPath, GetBulkAlertUpdateHandler(alertClient))
+
+	v1Tenant.PUT(v1RulesPath, GetReplaceRulesHandler(alertClient))
+	v1Tenant.POST(v1RulesLabelsPath, GetUpdateRuleLabelsHandler(alertClient))
+	v1Tenant.POST(v1RulesImportGrafanaPath, GetImportGrafanaRulesHandler(alertClient))
+
+	v1Tenant.GET(v1VariablesPath, GetGetVariablesHandler(alertClient))
+	v1Tenant.PUT(v1VariableNamePath, GetSetVariableHandler(alertClient))
+	v1Tenant.DELETE(v1VariableNamePath, GetDeleteVariableHandler(alertClient))
+
+	v1Tenant.POST(v1StagingPromotePath, GetPromoteStagingHandler(alertClient))
+	v1Tenant.POST(v1StagingDiscardPath, GetDiscardStagingHandler(alertClient))
 }
 
 // Returns middleware func to check for tenant_id
@@ -91,6 +199,23 @@ func tenancyMiddlewareProvider(getTenantID paramProvider) echo.MiddlewareFunc {
 	}
 }
 
+// Returns middleware func that rejects any request that would modify the
+// config with a 403 when the server is read-only
+func readOnlyMiddlewareProvider(readOnly bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !readOnly {
+				return next(c)
+			}
+			switch c.Request().Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+				return echo.NewHTTPError(http.StatusForbidden, "server is in read-only mode")
+			}
+			return next(c)
+		}
+	}
+}
+
 type paramProvider func(c echo.Context) string
 
 // V0 tenantID is a path parameter
@@ -110,48 +235,345 @@ var queryAlertNameProvider = func(c echo.Context) string {
 // write the alert configuration from the body of this request
 func GetConfigureAlertHandler(client alert.PrometheusAlertClient) func(c echo.Context) error {
 	return func(c echo.Context) error {
-		defer glog.Flush()
-		rule, err := decodeRulePostRequest(c)
+		_, err := configureAlert(c, client)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			return err
+		}
+		return c.NoContent(http.StatusOK)
+	}
+}
+
+// GetCreateAlertHandler returns a handler that writes the alert configuration
+// from the body of this request like GetConfigureAlertHandler, but responds
+// with 201 Created and the location of the new rule.
+func GetCreateAlertHandler(client alert.PrometheusAlertClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		rule, err := configureAlert(c, client)
+		if err != nil {
+			return err
 		}
 		tenantID := c.Get(tenantIDParam).(string)
-		glog.Infof("Configure Alert: Tenant: %s, %+v", tenantID, rule)
+		c.Response().Header().Set(echo.HeaderLocation, makeRuleLocation(tenantID, rule))
+		return c.NoContent(http.StatusCreated)
+	}
+}
+
+// configureAlert validates the rule in the body of this request and writes it
+// for the request's tenant, returning the written rule
+func configureAlert(c echo.Context, client alert.PrometheusAlertClient) (rulefmt.Rule, error) {
+	defer glog.Flush()
+	rule, group, err := decodeRulePostRequest(c)
+	if err != nil {
+		return rule, decodeError(err, http.StatusBadRequest)
+	}
+	tenantID := c.Get(tenantIDParam).(string)
+	glog.Infof("Configure Alert: Tenant: %s, Group: %s, %+v", tenantID, group, rule)
+
+	client, err = ruleClient(c, client)
+	if err != nil {
+		return rule, err
+	}
+
+	rule, err = expandRuleVariables(client, tenantID, rule)
+	if err != nil {
+		return rule, err
+	}
+
+	if validationErr := alert.ValidateRuleDetailed(rule); validationErr != nil {
+		return rule, validationHTTPError(validationErr)
+	}
+
+	if client.RuleExists(tenantID, rule.Alert) {
+		return rule, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Rule '%s' already exists", rule.Alert))
+	}
+
+	err = client.WriteRuleToGroup(tenantID, group, rule)
+	if err != nil {
+		return rule, echo.NewHTTPError(clientErrorStatus(err), err.Error())
+	}
 
-		err = alert.ValidateRule(rule)
+	err = client.ReloadTenant(tenantID)
+	if err != nil {
+		return rule, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return rule, nil
+}
+
+// makeRuleLocation returns the v1 API path of the given rule, using its
+// record name if it is a recording rule
+func makeRuleLocation(tenantID string, rule rulefmt.Rule) string {
+	ruleName := rule.Alert
+	if ruleName == "" {
+		ruleName = rule.Record
+	}
+	return fmt.Sprintf("%s/%s%s/%s", v1rootPath, url.PathEscape(tenantID), v1alertPath, url.PathEscape(ruleName))
+}
+
+func GetRetrieveAlertHandler(client alert.PrometheusAlertClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		defer glog.Flush()
+		// v1 names the rule in the path, v0 in the query
+		ruleName := pathAlertNameProvider(c)
+		if ruleName == "" {
+			ruleName = queryAlertNameProvider(c)
+		}
+		tenantID := c.Get(tenantIDParam).(string)
+		glog.Infof("Get Rule: Tenant: %s, rule: %s", tenantID, ruleName)
+
+		client, err := ruleClient(c, client)
+		if err != nil {
+			return err
+		}
+		unsecure, err := boolQueryParam(c, unsecureParam)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		grouped, err := boolQueryParam(c, groupedParam)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		raw, err := boolQueryParam(c, rawParam)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 		}
+		if raw {
+			if unsecure {
+				return echo.NewHTTPError(http.StatusBadRequest, "raw and unsecure parameters can't be combined")
+			}
+			return retrieveRawRule(c, client, tenantID, ruleName)
+		}
 
-		if client.RuleExists(tenantID, rule.Alert) {
-			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Rule '%s' already exists", rule.Alert))
+		// Rules don't carry their own timestamps, so the full set is
+		// cached by when the tenant's rules file last changed
+		if ruleName == "" {
+			modTime, err := client.RulesModTime(tenantID)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			}
+			if notModified(c, modTime) {
+				return c.NoContent(http.StatusNotModified)
+			}
 		}
 
-		err = client.WriteRule(tenantID, rule)
+		rules, err := client.ReadRulesWithGroups(tenantID, ruleName)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 		}
+		if unsecure {
+			err = unsecureRules(client.Tenancy(), tenantID, rules)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			}
+		}
+		if grouped {
+			return c.JSON(http.StatusOK, rulesToGroupedJSON(rules))
+		}
+		return c.JSON(http.StatusOK, rulesToJSON(rules))
+	}
+}
+
+// retrieveRawRule responds with a single rule exactly as it is stored, with
+// the tenant label and query restriction that prometheus evaluates it with
+func retrieveRawRule(c echo.Context, client alert.PrometheusAlertClient, tenantID, ruleName string) error {
+	if ruleName == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "No rule name provided")
+	}
+	rules, err := client.ReadRulesWithGroups(tenantID, ruleName)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if len(rules) == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Rule '%s' does not exist", ruleName))
+	}
+	return c.JSON(http.StatusOK, rulefmtToJSON(rules[0].Rule, rules[0].Group))
+}
+
+// boolQueryParam returns the value of an optional boolean query parameter,
+// which is false if it isn't provided
+func boolQueryParam(c echo.Context, name string) (bool, error) {
+	param := c.QueryParam(name)
+	if param == "" {
+		return false, nil
+	}
+	value, err := strconv.ParseBool(param)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s parameter: %s", name, param)
+	}
+	return value, nil
+}
+
+// intQueryParam returns the value of an optional non-negative integer query
+// parameter, which is zero if it isn't provided
+func intQueryParam(c echo.Context, name string) (int, error) {
+	param := c.QueryParam(name)
+	if param == "" {
+		return 0, nil
+	}
+	value, err := strconv.Atoi(param)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid %s parameter: %s", name, param)
+	}
+	return value, nil
+}
+
+// timeQueryParam parses the named query parameter as an RFC 3339 timestamp,
+// returning the zero time if it isn't set
+func timeQueryParam(c echo.Context, name string) (time.Time, error) {
+	param := c.QueryParam(name)
+	if param == "" {
+		return time.Time{}, nil
+	}
+	value, err := time.Parse(time.RFC3339, param)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s parameter: %s", name, param)
+	}
+	return value, nil
+}
+
+// matcherQueryParams returns the label matchers given in the repeatable
+// matcher query parameter, each of the form name=value
+func matcherQueryParams(c echo.Context) (map[string]string, error) {
+	matchers := map[string]string{}
+	for _, param := range c.QueryParams()[matcherParam] {
+		parts := strings.SplitN(param, "=", 2)
+		if len(parts) != 2 || !model.LabelName(parts[0]).IsValid() {
+			return nil, fmt.Errorf("invalid %s parameter: %s", matcherParam, param)
+		}
+		matchers[parts[0]] = parts[1]
+	}
+	return matchers, nil
+}
 
-		err = client.ReloadPrometheus()
+// notModified sets the Last-Modified header of the response to modTime and
+// reports whether the request's If-Modified-Since header shows the client
+// already has this version. HTTP dates only have second precision, so modTime
+// is truncated before comparing. A zero modTime is never reported unmodified.
+func notModified(c echo.Context, modTime time.Time) bool {
+	if modTime.IsZero() {
+		return false
+	}
+	modTime = modTime.UTC().Truncate(time.Second)
+	c.Response().Header().Set(echo.HeaderLastModified, modTime.Format(http.TimeFormat))
+	since, err := http.ParseTime(c.Request().Header.Get(echo.HeaderIfModifiedSince))
+	if err != nil {
+		return false
+	}
+	return !modTime.After(since)
+}
+
+// unsecureRules strips the tenant label and query restriction from rules so
+// they can be exported to a prometheus that isn't multi-tenant
+func unsecureRules(tenancy alert.TenancyConfig, tenantID string, rules []alert.GroupedRule) error {
+	if tenancy.RestrictorLabel == "" {
+		return nil
+	}
+	for i := range rules {
+		rule := &rules[i].Rule
+		// Expressions were only restricted if queries are restricted
+		if !tenancy.RestrictQueries {
+			delete(rule.Labels, tenancy.RestrictorLabel)
+			continue
+		}
+		err := alert.UnsecureRule(tenancy.RestrictorLabel, tenantID, rule)
+		if err != nil {
+			return fmt.Errorf("error unsecuring rule %s: %v", rule.Alert, err)
+		}
+	}
+	return nil
+}
+
+// GetRuleByIndexHandler returns a handler that retrieves a rule by its
+// position within a group rather than by name
+func GetRuleByIndexHandler(client alert.PrometheusAlertClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		defer glog.Flush()
+		tenantID := c.Get(tenantIDParam).(string)
+		groupName := c.Param(groupParam)
+		idx, err := strconv.Atoi(c.Param(ruleIndexParam))
+		if err != nil || idx < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid rule index: %s", c.Param(ruleIndexParam)))
+		}
+		glog.Infof("Get Rule By Index: Tenant: %s, group: %s, index: %d", tenantID, groupName, idx)
+
+		rule, err := client.GetRuleByIndex(tenantID, groupName, idx)
+		if errors.Is(err, alert.ErrRuleNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 		}
-		return c.NoContent(http.StatusOK)
+		return c.JSON(http.StatusOK, rulefmtToJSON(*rule, groupName))
 	}
 }
 
-func GetRetrieveAlertHandler(client alert.PrometheusAlertClient) func(c echo.Context) error {
+// groupLimit is the JSON body of requests and responses for a rule group's
+// limit
+type groupLimit struct {
+	Limit int `json:"limit"`
+}
+
+// GetGroupLimitHandler returns a handler that retrieves the limit on the
+// number of alerts or series a rule group may produce
+func GetGroupLimitHandler(client alert.PrometheusAlertClient) func(c echo.Context) error {
 	return func(c echo.Context) error {
 		defer glog.Flush()
-		ruleName := c.QueryParam(ruleNameParam)
 		tenantID := c.Get(tenantIDParam).(string)
-		glog.Infof("Get Rule: Tenant: %s, rule: %s", tenantID, ruleName)
+		groupName := c.Param(groupParam)
+		glog.Infof("Get Group Limit: Tenant: %s, group: %s", tenantID, groupName)
 
-		rules, err := client.ReadRules(tenantID, ruleName)
+		limit, err := client.GetGroupLimit(tenantID, groupName)
+		if errors.Is(err, alert.ErrGroupNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 		}
-		return c.JSON(http.StatusOK, rulesToJSON(rules))
+		return c.JSON(http.StatusOK, groupLimit{Limit: limit})
+	}
+}
+
+// GetSetGroupLimitHandler returns a handler that sets the limit of a rule
+// group and reloads prometheus. A limit of zero removes it.
+func GetSetGroupLimitHandler(client alert.PrometheusAlertClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		defer glog.Flush()
+		tenantID := c.Get(tenantIDParam).(string)
+		groupName := c.Param(groupParam)
+		payload := groupLimit{}
+		err := json.NewDecoder(c.Request().Body).Decode(&payload)
+		if err != nil {
+			return decodeError(fmt.Errorf("error unmarshalling payload: %w", err), http.StatusBadRequest)
+		}
+		glog.Infof("Set Group Limit: Tenant: %s, group: %s, limit: %d", tenantID, groupName, payload.Limit)
+
+		err = client.SetGroupLimit(tenantID, groupName, payload.Limit)
+		if errors.Is(err, alert.ErrGroupNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		if err != nil {
+			return echo.NewHTTPError(clientErrorStatus(err), err.Error())
+		}
+		err = client.ReloadTenant(tenantID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// GetListRuleNamesHandler returns a handler that lists the names of a
+// tenant's rules without their contents
+func GetListRuleNamesHandler(client alert.PrometheusAlertClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		defer glog.Flush()
+		tenantID := c.Get(tenantIDParam).(string)
+		glog.Infof("List Rule Names: Tenant: %s", tenantID)
+
+		names, err := client.ListRuleNames(tenantID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(http.StatusOK, names)
 	}
 }
 
@@ -165,11 +587,15 @@ func GetDeleteAlertHandler(client alert.PrometheusAlertClient, getRuleName param
 		if ruleName == "" {
 			return echo.NewHTTPError(http.StatusBadRequest, "No rule name provided")
 		}
-		err := client.DeleteRule(tenantID, ruleName)
+		client, err := ruleClient(c, client)
+		if err != nil {
+			return err
+		}
+		err = client.DeleteRule(tenantID, ruleName)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 		}
-		err = client.ReloadPrometheus()
+		err = client.ReloadTenant(tenantID)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 		}
@@ -187,27 +613,34 @@ func GetUpdateAlertHandler(client alert.PrometheusAlertClient) func(c echo.Conte
 		if ruleName == "" {
 			return echo.NewHTTPError(http.StatusBadRequest, "No rule name provided")
 		}
+		client, err := ruleClient(c, client)
+		if err != nil {
+			return err
+		}
 
 		if !client.RuleExists(tenantID, ruleName) {
 			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Rule '%s' does not exist", ruleName))
 		}
 
-		rule, err := decodeRulePostRequest(c)
+		rule, group, err := decodeRulePostRequest(c)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			return decodeError(err, http.StatusBadRequest)
 		}
-
-		err = alert.ValidateRule(rule)
+		rule, err = expandRuleVariables(client, tenantID, rule)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			return err
 		}
 
-		err = client.UpdateRule(tenantID, rule)
+		if validationErr := alert.ValidateRuleDetailed(rule); validationErr != nil {
+			return validationHTTPError(validationErr)
+		}
+
+		err = client.UpdateRuleInGroup(tenantID, group, rule)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			return echo.NewHTTPError(clientErrorStatus(err), err.Error())
 		}
 
-		err = client.ReloadPrometheus()
+		err = client.ReloadTenant(tenantID)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 		}
@@ -221,23 +654,34 @@ func GetBulkAlertUpdateHandler(client alert.PrometheusAlertClient) func(c echo.C
 		tenantID := c.Get(tenantIDParam).(string)
 		rules, err := decodeBulkRulesPostRequest(c)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			return decodeError(err, http.StatusBadRequest)
 		}
 		glog.Infof("Bulk Update Rules: Tenant: %s, rules: %d", tenantID, len(rules))
+		client, err := ruleClient(c, client)
+		if err != nil {
+			return err
+		}
+		// Nothing would change, so neither the file nor prometheus is touched
+		if len(rules) == 0 {
+			return c.JSON(http.StatusOK, alert.NewBulkUpdateResults())
+		}
 
-		for _, rule := range rules {
-			err = alert.ValidateRule(rule)
+		for idx := range rules {
+			rules[idx].Rule, err = expandRuleVariables(client, tenantID, rules[idx].Rule)
 			if err != nil {
-				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+				return err
+			}
+			if validationErr := alert.ValidateRuleDetailed(rules[idx].Rule); validationErr != nil {
+				return validationHTTPError(validationErr)
 			}
 		}
 
-		results, err := client.BulkUpdateRules(tenantID, rules)
+		results, err := client.BulkUpdateRulesInGroups(tenantID, rules)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 		}
 
-		err = client.ReloadPrometheus()
+		err = client.ReloadTenant(tenantID)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 		}
@@ -245,77 +689,672 @@ func GetBulkAlertUpdateHandler(client alert.PrometheusAlertClient) func(c echo.C
 	}
 }
 
+// GetReplaceRulesHandler returns a handler that replaces all of a tenant's
+// rules with those of the request. Unlike a bulk update, rules that aren't in
+// the request are removed.
+func GetReplaceRulesHandler(client alert.PrometheusAlertClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		defer glog.Flush()
+		tenantID := c.Get(tenantIDParam).(string)
+		ruleFile, err := decodeRulesPutRequest(c, tenantID)
+		if err != nil {
+			return decodeError(err, http.StatusBadRequest)
+		}
+		glog.Infof("Replace Rules: Tenant: %s, rules: %d", tenantID, len(ruleFile.Rules()))
+		client, err := ruleClient(c, client)
+		if err != nil {
+			return err
+		}
+
+		for groupIdx, group := range ruleFile.RuleGroups {
+			for ruleIdx := range group.Rules {
+				rule, err := expandRuleVariables(client, tenantID, group.Rules[ruleIdx])
+				if err != nil {
+					return err
+				}
+				if validationErr := alert.ValidateRuleDetailed(rule); validationErr != nil {
+					return validationHTTPError(validationErr)
+				}
+				ruleFile.RuleGroups[groupIdx].Rules[ruleIdx] = rule
+			}
+		}
+
+		err = client.ReplaceRules(tenantID, *ruleFile)
+		if err != nil {
+			return echo.NewHTTPError(clientErrorStatus(err), err.Error())
+		}
+
+		err = client.ReloadTenant(tenantID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.NoContent(http.StatusOK)
+	}
+}
+
+// grafanaImportResponse is the outcome of a Grafana rule import. Warnings
+// are listed by rule title.
+type grafanaImportResponse struct {
+	Results  alert.BulkUpdateResults `json:"results"`
+	Warnings map[string][]string     `json:"warnings"`
+}
+
+// GetImportGrafanaRulesHandler returns a handler that converts the alert
+// rules of a Grafana alerting provisioning file and creates or updates them
+// for the tenant
+func GetImportGrafanaRulesHandler(client alert.PrometheusAlertClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		defer glog.Flush()
+		tenantID := c.Get(tenantIDParam).(string)
+		body, err := ioutil.ReadAll(c.Request().Body)
+		if err != nil {
+			return decodeError(fmt.Errorf("error reading request body: %w", err), http.StatusBadRequest)
+		}
+		converted, warnings, err := alert.ConvertGrafanaRules(body)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		glog.Infof("Import Grafana Rules: Tenant: %s, rules: %d", tenantID, len(converted))
+
+		// Rules that don't convert to valid prometheus rules are reported
+		// alongside the others instead of failing the whole import
+		invalid := make(map[string]error)
+		rules := make([]alert.GroupedRule, 0, len(converted))
+		for _, rule := range converted {
+			err = alert.ValidateRule(rule.Rule)
+			if err != nil {
+				invalid[rule.Rule.Alert] = err
+				continue
+			}
+			rules = append(rules, rule)
+		}
+		// Nothing would change, so neither the file nor prometheus is touched
+		if len(rules) == 0 {
+			results := alert.NewBulkUpdateResults()
+			for ruleName, err := range invalid {
+				results.Errors[ruleName] = err
+			}
+			return c.JSON(http.StatusOK, grafanaImportResponse{Results: results, Warnings: warnings})
+		}
+
+		results, err := client.BulkUpdateRulesInGroups(tenantID, rules)
+		if err != nil {
+			return echo.NewHTTPError(clientErrorStatus(err), err.Error())
+		}
+		for ruleName, err := range invalid {
+			results.Errors[ruleName] = err
+		}
+
+		err = client.ReloadTenant(tenantID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(http.StatusOK, grafanaImportResponse{Results: results, Warnings: warnings})
+	}
+}
+
+// ruleLabelsPayload sets the label Key to Value on every rule of a tenant,
+// or removes it from every rule if Remove is set
+type ruleLabelsPayload struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Remove bool   `json:"remove"`
+}
+
+// GetUpdateRuleLabelsHandler returns a handler that adds a label to, or
+// removes it from, all of a tenant's rules at once
+func GetUpdateRuleLabelsHandler(client alert.PrometheusAlertClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		defer glog.Flush()
+		tenantID := c.Get(tenantIDParam).(string)
+		payload := ruleLabelsPayload{}
+		err := json.NewDecoder(c.Request().Body).Decode(&payload)
+		if err != nil {
+			return decodeError(fmt.Errorf("error unmarshalling payload: %w", err), http.StatusBadRequest)
+		}
+		if payload.Key == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "No label key provided")
+		}
+		glog.Infof("Update Rule Labels: Tenant: %s, key: %s, remove: %t", tenantID, payload.Key, payload.Remove)
+
+		if payload.Remove {
+			err = client.RemoveLabelFromAllRules(tenantID, payload.Key)
+		} else {
+			err = client.AddLabelToAllRules(tenantID, payload.Key, payload.Value)
+		}
+		if err != nil {
+			return echo.NewHTTPError(clientErrorStatus(err), err.Error())
+		}
+
+		err = client.ReloadTenant(tenantID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.NoContent(http.StatusOK)
+	}
+}
+
+// validationHTTPError returns a 400 error whose body has the message of the
+// validation error along with each problem found, keyed by field
+func validationHTTPError(validationErr *alert.ValidationError) *echo.HTTPError {
+	glog.Errorf("Invalid rule: %v", validationErr)
+	return echo.NewHTTPError(http.StatusBadRequest, validationErr)
+}
+
+// clientErrorStatus returns the status code to respond with for an error
+// from the alert client. Rules rejected for their contents are the caller's
+// fault, anything else is treated as a server error.
+func clientErrorStatus(err error) int {
+	var validationErr alert.RuleValidationError
+	if errors.As(err, &validationErr) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// GetListTenantsHandler returns a handler that lists the tenants with a
+// rules file, optionally filtered by the prefix query parameter and paged by
+// limit and offset
+func GetListTenantsHandler(client alert.PrometheusAlertClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		defer glog.Flush()
+		opts := alert.TenantListOptions{Prefix: c.QueryParam(prefixParam)}
+		var err error
+		opts.Limit, err = intQueryParam(c, limitParam)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		opts.Offset, err = intQueryParam(c, offsetParam)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		opts.ModifiedSince, err = timeQueryParam(c, sinceParam)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		tenants, err := client.ListTenants(opts)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(http.StatusOK, tenants)
+	}
+}
+
+// GetFindRuleTenantHandler returns a handler that lists the tenants owning
+// an alerting rule with the given name
+func GetFindRuleTenantHandler(client alert.PrometheusAlertClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		defer glog.Flush()
+		ruleName := c.Param(ruleNameParam)
+		glog.Infof("Find Rule Tenant: rule: %s", ruleName)
+
+		tenants, err := client.FindRuleTenant(ruleName)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if len(tenants) == 0 {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("rule %s not found", ruleName))
+		}
+		return c.JSON(http.StatusOK, tenants)
+	}
+}
+
+// GetCompareRulesHandler returns a handler that compares the rules of the
+// tenants given by the "a" and "b" query parameters
+func GetCompareRulesHandler(client alert.PrometheusAlertClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		defer glog.Flush()
+		prefixA, prefixB := c.QueryParam("a"), c.QueryParam("b")
+		if prefixA == "" || prefixB == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "Must provide tenants to compare as a and b parameters")
+		}
+		glog.Infof("Compare Rules: Tenants: %s, %s", prefixA, prefixB)
+
+		diff, err := client.CompareRules(prefixA, prefixB)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(http.StatusOK, diff)
+	}
+}
+
+// exprPayload holds a PromQL expression
+type exprPayload struct {
+	Expr string `json:"expr"`
+}
+
+// FormatExprHandler responds with the canonical form of the PromQL expression
+// in the request, or with the position of the error if it can't be parsed
+func FormatExprHandler(c echo.Context) error {
+	payload := exprPayload{}
+	err := json.NewDecoder(c.Request().Body).Decode(&payload)
+	if err != nil {
+		return decodeError(fmt.Errorf("error unmarshalling payload: %w", err), http.StatusBadRequest)
+	}
+	formatted, err := alert.FormatExpr(payload.Expr)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	return c.JSON(http.StatusOK, exprPayload{Expr: formatted})
+}
+
+// exprMetrics is the JSON body of the response listing the metrics an
+// expression depends on
+type exprMetrics struct {
+	Metrics []string `json:"metrics"`
+}
+
+// ExprMetricsHandler responds with the names of the metrics selected by the
+// PromQL expression in the request, such as the expr of a rule, or with the
+// position of the error if it can't be parsed
+func ExprMetricsHandler(c echo.Context) error {
+	payload := exprPayload{}
+	err := json.NewDecoder(c.Request().Body).Decode(&payload)
+	if err != nil {
+		return decodeError(fmt.Errorf("error unmarshalling payload: %w", err), http.StatusBadRequest)
+	}
+	metrics, err := alert.ExprMetrics(payload.Expr)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	return c.JSON(http.StatusOK, exprMetrics{Metrics: metrics})
+}
+
+// GetRestrictExprHandler returns a handler that responds with the PromQL
+// expression in the request as it would be restricted for the tenant, without
+// creating a rule
+func GetRestrictExprHandler(client alert.PrometheusAlertClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		tenantID := c.Get(tenantIDParam).(string)
+		payload := exprPayload{}
+		err := json.NewDecoder(c.Request().Body).Decode(&payload)
+		if err != nil {
+			return decodeError(fmt.Errorf("error unmarshalling payload: %w", err), http.StatusBadRequest)
+		}
+		restricted, err := alert.RestrictExpr(client.Tenancy(), tenantID, payload.Expr)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return c.JSON(http.StatusOK, exprPayload{Expr: restricted})
+	}
+}
+
+// ruleClient returns the client that the request's rules are read and
+// written through, which is the tenant's staging area if the staged query
+// parameter is set, and secures rules with the request's matcher parameters
+func ruleClient(c echo.Context, client alert.PrometheusAlertClient) (alert.PrometheusAlertClient, error) {
+	staged, err := boolQueryParam(c, stagedParam)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	matchers, err := matcherQueryParams(c)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if staged {
+		client = client.Staged()
+	}
+	if len(matchers) > 0 {
+		client = client.WithRestrictorMatchers(matchers)
+	}
+	return client, nil
+}
+
+// GetPromoteStagingHandler returns a handler that replaces the tenant's live
+// rules with its staged ones and reloads prometheus
+func GetPromoteStagingHandler(client alert.PrometheusAlertClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		defer glog.Flush()
+		tenantID := c.Get(tenantIDParam).(string)
+		glog.Infof("Promote Staging: Tenant: %s", tenantID)
+
+		err := client.PromoteStaging(tenantID)
+		if err != nil {
+			return echo.NewHTTPError(stagingErrorStatus(err), err.Error())
+		}
+		err = client.ReloadTenant(tenantID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// GetDiscardStagingHandler returns a handler that drops the tenant's staged
+// rule changes. Prometheus isn't reloaded since staged rules aren't loaded.
+func GetDiscardStagingHandler(client alert.PrometheusAlertClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		defer glog.Flush()
+		tenantID := c.Get(tenantIDParam).(string)
+		glog.Infof("Discard Staging: Tenant: %s", tenantID)
+
+		err := client.DiscardStaging(tenantID)
+		if err != nil {
+			return echo.NewHTTPError(stagingErrorStatus(err), err.Error())
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// stagingErrorStatus returns 404 if the tenant has nothing staged, and 500
+// for any other error
+func stagingErrorStatus(err error) int {
+	if errors.Is(err, alert.ErrNoStagedChanges) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// expandRuleVariables replaces references to the tenant's stored variables in
+// the rule, so that it's validated and written with their current values
+func expandRuleVariables(client alert.PrometheusAlertClient, tenantID string, rule rulefmt.Rule) (rulefmt.Rule, error) {
+	if !alert.HasVariableReferences(rule) {
+		return rule, nil
+	}
+	expanded, err := client.ExpandVariables(tenantID, rule)
+	if err != nil {
+		return rule, echo.NewHTTPError(clientErrorStatus(err), err.Error())
+	}
+	return expanded, nil
+}
+
+// variablePayload is the JSON body of a request setting a rule variable
+type variablePayload struct {
+	Value string `json:"value"`
+}
+
+// GetGetVariablesHandler returns a handler that responds with the tenant's
+// stored rule variables by name
+func GetGetVariablesHandler(client alert.PrometheusAlertClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		defer glog.Flush()
+		tenantID := c.Get(tenantIDParam).(string)
+		vars, err := client.GetVariables(tenantID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(http.StatusOK, vars)
+	}
+}
+
+// GetSetVariableHandler returns a handler that creates or updates one of the
+// tenant's rule variables. Rules already written with the variable keep its
+// old value until they're written again.
+func GetSetVariableHandler(client alert.PrometheusAlertClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		defer glog.Flush()
+		tenantID := c.Get(tenantIDParam).(string)
+		name := c.Param(variableParam)
+		payload := variablePayload{}
+		err := json.NewDecoder(c.Request().Body).Decode(&payload)
+		if err != nil {
+			return decodeError(fmt.Errorf("error unmarshalling payload: %w", err), http.StatusBadRequest)
+		}
+		glog.Infof("Set Variable: Tenant: %s, variable: %s, value: %s", tenantID, name, payload.Value)
+
+		err = client.SetVariable(tenantID, name, payload.Value)
+		if err != nil {
+			return echo.NewHTTPError(clientErrorStatus(err), err.Error())
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// GetDeleteVariableHandler returns a handler that removes one of the tenant's
+// rule variables
+func GetDeleteVariableHandler(client alert.PrometheusAlertClient) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		defer glog.Flush()
+		tenantID := c.Get(tenantIDParam).(string)
+		name := c.Param(variableParam)
+		glog.Infof("Delete Variable: Tenant: %s, variable: %s", tenantID, name)
+
+		err := client.DeleteVariable(tenantID, name)
+		if errors.Is(err, alert.ErrVariableNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
 func GetGetTenancyHandler(client alert.PrometheusAlertClient) func(c echo.Context) error {
 	return func(c echo.Context) error {
 		return c.JSON(http.StatusOK, client.Tenancy())
 	}
 }
 
-func decodeRulePostRequest(c echo.Context) (rulefmt.Rule, error) {
+// decodeRulePostRequest decodes a single rule from the request body, along
+// with the group it should be written to. The group is empty if not given.
+func decodeRulePostRequest(c echo.Context) (rulefmt.Rule, string, error) {
 	body, err := ioutil.ReadAll(c.Request().Body)
 	if err != nil {
 		glog.Errorf("Error reading rule payload: %v", err)
-		return rulefmt.Rule{}, fmt.Errorf("error reading request body: %v", err)
+		return rulefmt.Rule{}, "", fmt.Errorf("error reading request body: %w", err)
 	}
 	// First try unmarshaling into prometheus rulefmt.Rule{}
 	payload := rulefmt.Rule{}
 	err = json.Unmarshal(body, &payload)
 	if err == nil {
-		return payload, nil
+		return payload, decodeRuleGroup(body), nil
 	}
 	// Try to unmarshal into the RuleJSONWrapper struct if prometheus struct doesn't work
 	jsonPayload := alert.RuleJSONWrapper{}
 	err = json.Unmarshal(body, &jsonPayload)
 	if err != nil {
 		glog.Errorf("Error unmarshaling rule payload: %v", err)
-		return payload, fmt.Errorf("error unmarshalling payload: %v", err)
+		return payload, "", fmt.Errorf("error unmarshalling payload: %v", err)
 	}
-	return jsonPayload.ToRuleFmt()
+	rule, err := jsonPayload.ToRuleFmt()
+	return rule, jsonPayload.Group, err
 }
 
-func decodeBulkRulesPostRequest(c echo.Context) ([]rulefmt.Rule, error) {
+// decodeRuleGroup returns the optional group field of a rule payload, since
+// rulefmt.Rule has no notion of the group it belongs to
+func decodeRuleGroup(body []byte) string {
+	groupPayload := struct {
+		Group string `json:"group"`
+	}{}
+	_ = json.Unmarshal(body, &groupPayload)
+	return groupPayload.Group
+}
+
+// decodeBulkRulesPostRequest decodes a list of rules from the request body,
+// or from a rules file uploaded as multipart/form-data, each with the group it
+// should be written to
+func decodeBulkRulesPostRequest(c echo.Context) ([]alert.GroupedRule, error) {
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+		return decodeBulkRulesFile(c)
+	}
 	body, err := ioutil.ReadAll(c.Request().Body)
 	if err != nil {
 		glog.Errorf("Error reading bulk rules payload: %v", err)
-		return []rulefmt.Rule{}, fmt.Errorf("error reading request body: %v", err)
+		return []alert.GroupedRule{}, fmt.Errorf("error reading request body: %w", err)
+	}
+	return decodeBulkRules(body)
+}
+
+// decodeRulesPutRequest decodes the rules replacing a tenant's rules, given
+// either as a JSON list of rules like a bulk request body, or as the groups of
+// a prometheus rules file in YAML or JSON
+func decodeRulesPutRequest(c echo.Context, tenantID string) (*alert.File, error) {
+	body, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		glog.Errorf("Error reading rules payload: %v", err)
+		return nil, fmt.Errorf("error reading request body: %w", err)
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+		rules, err := decodeBulkRules(body)
+		if err != nil {
+			return nil, err
+		}
+		ruleFile := alert.NewFile(tenantID)
+		for _, rule := range rules {
+			ruleFile.AddRuleToGroup(rule.Group, rule.Rule)
+		}
+		return ruleFile, nil
+	}
+	ruleFile := alert.File{}
+	err = yaml.Unmarshal(body, &ruleFile)
+	if err != nil {
+		glog.Errorf("Error unmarshaling rule groups: %v", err)
+		return nil, fmt.Errorf("error unmarshalling payload: %v", err)
+	}
+	for _, group := range ruleFile.RuleGroups {
+		if group.Name == "" {
+			return nil, errors.New("rule group has no name")
+		}
+	}
+	return &ruleFile, nil
+}
+
+// decodeBulkRulesFile decodes the rules of an uploaded file. JSON lists of
+// rules are decoded like a bulk request body, and anything else is parsed as
+// a prometheus rules file, in YAML or JSON.
+func decodeBulkRulesFile(c echo.Context) ([]alert.GroupedRule, error) {
+	fileHeader, err := c.FormFile(rulesFileField)
+	if err != nil {
+		return nil, fmt.Errorf("error reading uploaded rules file: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(fileHeader.Filename)) {
+	case "", ".yml", ".yaml", ".json":
+	default:
+		return nil, fmt.Errorf("unsupported rules file %s, must be .yml, .yaml or .json", fileHeader.Filename)
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, fmt.Errorf("error reading uploaded rules file: %w", err)
 	}
+	defer file.Close()
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading uploaded rules file: %w", err)
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		return decodeBulkRules(data)
+	}
+	ruleGroups, errs := rulefmt.Parse(data)
+	if len(errs) > 0 {
+		msgs := make([]string, 0, len(errs))
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		return nil, fmt.Errorf("error parsing rules file %s: %s", fileHeader.Filename, strings.Join(msgs, "; "))
+	}
+	rules := make([]alert.GroupedRule, 0)
+	for _, group := range ruleGroups.Groups {
+		for _, node := range group.Rules {
+			rules = append(rules, alert.GroupedRule{Group: group.Name, Rule: rulefmt.Rule{
+				Record:      node.Record.Value,
+				Alert:       node.Alert.Value,
+				Expr:        node.Expr.Value,
+				For:         node.For,
+				Labels:      node.Labels,
+				Annotations: node.Annotations,
+			}})
+		}
+	}
+	return rules, nil
+}
+
+// decodeBulkRules decodes a JSON list of rules in either the prometheus or
+// the RuleJSONWrapper format
+func decodeBulkRules(body []byte) ([]alert.GroupedRule, error) {
 	var payload []rulefmt.Rule
-	err = json.Unmarshal(body, &payload)
+	err := json.Unmarshal(body, &payload)
 	if err == nil {
-		return payload, nil
+		groups := decodeBulkRuleGroups(body)
+		ret := make([]alert.GroupedRule, 0, len(payload))
+		for idx, rule := range payload {
+			ret = append(ret, alert.GroupedRule{Group: groups[idx], Rule: rule})
+		}
+		return ret, nil
 	}
 	// Try to unmarshal into the RuleJSONWrapper struct if prometheus struct doesn't work
 	jsonPayload := []alert.RuleJSONWrapper{}
 	err = json.Unmarshal(body, &jsonPayload)
 	if err != nil {
 		glog.Errorf("Error unmarshaling bulk rules: %v", err)
-		return []rulefmt.Rule{}, fmt.Errorf("error unmarshalling payload: %v", err)
+		return []alert.GroupedRule{}, fmt.Errorf("error unmarshalling payload: %v", err)
 	}
 	return rulesFromJSON(jsonPayload)
 }
 
-func rulesToJSON(rules []rulefmt.Rule) []alert.RuleJSONWrapper {
+// decodeBulkRuleGroups returns the optional group field of each rule in a
+// bulk payload, in the same order as the rules
+func decodeBulkRuleGroups(body []byte) []string {
+	var groupPayload []struct {
+		Group string `json:"group"`
+	}
+	_ = json.Unmarshal(body, &groupPayload)
+	groups := make([]string, len(groupPayload))
+	for idx, payload := range groupPayload {
+		groups[idx] = payload.Group
+	}
+	return groups
+}
+
+// decodeError returns the HTTP error for a request body that couldn't be
+// decoded. Bodies over the server's size limit are rejected with 413 instead
+// of the given status.
+func decodeError(err error, status int) *echo.HTTPError {
+	if errors.Is(err, echo.ErrStatusRequestEntityTooLarge) {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+	}
+	return echo.NewHTTPError(status, err.Error())
+}
+
+func rulesToJSON(rules []alert.GroupedRule) []alert.RuleJSONWrapper {
 	ret := make([]alert.RuleJSONWrapper, 0)
 	for _, rule := range rules {
-		ret = append(ret, *rulefmtToJSON(rule))
+		ret = append(ret, *rulefmtToJSON(rule.Rule, rule.Group))
+	}
+	return ret
+}
+
+// ruleGroupJSON is a rule group as returned by the retrieve handler when
+// grouping is requested
+type ruleGroupJSON struct {
+	Name  string                  `json:"name"`
+	Rules []alert.RuleJSONWrapper `json:"rules"`
+}
+
+// rulesToGroupedJSON groups rules by their group name, keeping the order in
+// which groups and rules appear in the file
+func rulesToGroupedJSON(rules []alert.GroupedRule) []ruleGroupJSON {
+	ret := make([]ruleGroupJSON, 0)
+	groupIdx := map[string]int{}
+	for _, rule := range rules {
+		idx, ok := groupIdx[rule.Group]
+		if !ok {
+			idx = len(ret)
+			groupIdx[rule.Group] = idx
+			ret = append(ret, ruleGroupJSON{Name: rule.Group, Rules: []alert.RuleJSONWrapper{}})
+		}
+		ret[idx].Rules = append(ret[idx].Rules, *rulefmtToJSON(rule.Rule, ""))
 	}
 	return ret
 }
 
-func rulesFromJSON(rules []alert.RuleJSONWrapper) ([]rulefmt.Rule, error) {
-	ret := make([]rulefmt.Rule, 0)
+func rulesFromJSON(rules []alert.RuleJSONWrapper) ([]alert.GroupedRule, error) {
+	ret := make([]alert.GroupedRule, 0)
 	for _, rule := range rules {
 		jsonRule, err := rule.ToRuleFmt()
 		if err != nil {
 			return ret, err
 		}
-		ret = append(ret, jsonRule)
+		ret = append(ret, alert.GroupedRule{Group: rule.Group, Rule: jsonRule})
 	}
 	return ret, nil
 }
 
-func rulefmtToJSON(rule rulefmt.Rule) *alert.RuleJSONWrapper {
+func rulefmtToJSON(rule rulefmt.Rule, group string) *alert.RuleJSONWrapper {
 	return &alert.RuleJSONWrapper{
+		Group:       group,
 		Record:      rule.Record,
 		Alert:       rule.Alert,
 		Expr:        rule.Expr,
@@ -8,20 +8,28 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/facebookincubator/prometheus-configmanager/prometheus/alert"
 	"github.com/facebookincubator/prometheus-configmanager/prometheus/alert/mocks"
+	"github.com/facebookincubator/prometheus-configmanager/restrictor"
+	"github.com/facebookincubator/prometheus-configmanager/version"
 
 	"github.com/labstack/echo"
+	"github.com/labstack/echo/middleware"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/pkg/rulefmt"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 var (
@@ -75,13 +83,28 @@ func TestGetConfigureAlertHandler(t *testing.T) {
 	// Successful Post
 	client := &mocks.PrometheusAlertClient{}
 	client.On("RuleExists", testNID, sampleAlert1.Alert).Return(false)
-	client.On("WriteRule", testNID, sampleAlert1).Return(nil)
-	client.On("ReloadPrometheus").Return(nil)
+	client.On("WriteRuleToGroup", testNID, "", sampleAlert1).Return(nil)
+	client.On("ReloadTenant", testNID).Return(nil)
 	c, rec := buildContext(sampleAlert1, http.MethodPost, "/", v1alertPath, testNID)
 
 	err := GetConfigureAlertHandler(client)(c)
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "", rec.Header().Get(echo.HeaderLocation))
+	client.AssertExpectations(t)
+
+	// Successful Post to group
+	groupedRule := sampleJSONRule1
+	groupedRule.Group = "testGroup"
+	client = &mocks.PrometheusAlertClient{}
+	client.On("RuleExists", testNID, sampleAlert1.Alert).Return(false)
+	client.On("WriteRuleToGroup", testNID, "testGroup", sampleAlert1).Return(nil)
+	client.On("ReloadTenant", testNID).Return(nil)
+	c, rec = buildContext(groupedRule, http.MethodPost, "/", v1alertPath, testNID)
+
+	err = GetConfigureAlertHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
 	client.AssertExpectations(t)
 
 	// Rule validation fails
@@ -93,6 +116,15 @@ func TestGetConfigureAlertHandler(t *testing.T) {
 	assert.EqualError(t, err, `code=400, message=Rule Validation Error; could not parse expression: 1:9: parse error: unexpected end of input inside braces`)
 	client.AssertExpectations(t)
 
+	// Validation errors are returned by field
+	c, rec = buildContext(sampleInvalidAlert, http.MethodPost, "/", v1alertPath, testNID)
+	c.Echo().HTTPErrorHandler(GetConfigureAlertHandler(client)(c), c)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	var validationErr alert.ValidationError
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &validationErr))
+	assert.Len(t, validationErr.Fields, 1)
+	assert.Equal(t, "expr", validationErr.Fields[0].Field)
+
 	// Rule already exists
 	client = &mocks.PrometheusAlertClient{}
 	client.On("RuleExists", testNID, sampleAlert1.Alert).Return(true)
@@ -106,7 +138,7 @@ func TestGetConfigureAlertHandler(t *testing.T) {
 	// Write fails
 	client = &mocks.PrometheusAlertClient{}
 	client.On("RuleExists", testNID, sampleAlert1.Alert).Return(false)
-	client.On("WriteRule", testNID, sampleAlert1).Return(errors.New("error"))
+	client.On("WriteRuleToGroup", testNID, "", sampleAlert1).Return(errors.New("error"))
 	c, _ = buildContext(sampleAlert1, http.MethodPost, "/", v1alertPath, testNID)
 
 	err = GetConfigureAlertHandler(client)(c)
@@ -114,11 +146,33 @@ func TestGetConfigureAlertHandler(t *testing.T) {
 	assert.EqualError(t, err, `code=500, message=error`)
 	client.AssertExpectations(t)
 
+	// Write rejects rule for missing required keys
+	client = &mocks.PrometheusAlertClient{}
+	client.On("RuleExists", testNID, sampleAlert1.Alert).Return(false)
+	client.On("WriteRuleToGroup", testNID, "", sampleAlert1).Return(alert.RuleValidationError{Err: errors.New("Rule Validation Error; missing required labels: team")})
+	c, _ = buildContext(sampleAlert1, http.MethodPost, "/", v1alertPath, testNID)
+
+	err = GetConfigureAlertHandler(client)(c)
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	assert.EqualError(t, err, `code=400, message=Rule Validation Error; missing required labels: team`)
+	client.AssertExpectations(t)
+
+	// Rule name already used by another tenant
+	client = &mocks.PrometheusAlertClient{}
+	client.On("RuleExists", testNID, sampleAlert1.Alert).Return(false)
+	client.On("WriteRuleToGroup", testNID, "", sampleAlert1).Return(alert.RuleValidationError{Err: errors.New("rule testAlert1 already exists for tenant other")})
+	c, _ = buildContext(sampleAlert1, http.MethodPost, "/", v1alertPath, testNID)
+
+	err = GetConfigureAlertHandler(client)(c)
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	assert.EqualError(t, err, `code=400, message=rule testAlert1 already exists for tenant other`)
+	client.AssertExpectations(t)
+
 	// Reload Prometheus fails
 	client = &mocks.PrometheusAlertClient{}
 	client.On("RuleExists", testNID, sampleAlert1.Alert).Return(false)
-	client.On("WriteRule", testNID, sampleAlert1).Return(nil)
-	client.On("ReloadPrometheus").Return(errors.New("error"))
+	client.On("WriteRuleToGroup", testNID, "", sampleAlert1).Return(nil)
+	client.On("ReloadTenant", testNID).Return(errors.New("error"))
 	c, _ = buildContext(sampleAlert1, http.MethodPost, "/", v1alertPath, testNID)
 
 	err = GetConfigureAlertHandler(client)(c)
@@ -127,10 +181,53 @@ func TestGetConfigureAlertHandler(t *testing.T) {
 	client.AssertExpectations(t)
 }
 
+func TestGetCreateAlertHandler(t *testing.T) {
+	// Successful Post
+	client := &mocks.PrometheusAlertClient{}
+	client.On("RuleExists", testNID, sampleAlert1.Alert).Return(false)
+	client.On("WriteRuleToGroup", testNID, "", sampleAlert1).Return(nil)
+	client.On("ReloadTenant", testNID).Return(nil)
+	c, rec := buildContext(sampleAlert1, http.MethodPost, "/", v1alertPath, testNID)
+
+	err := GetCreateAlertHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "/v1/test/alert/testAlert1", rec.Header().Get(echo.HeaderLocation))
+	client.AssertExpectations(t)
+
+	// Recording rule location uses the record name
+	recordingRule := rulefmt.Rule{
+		Record: "job:up:sum",
+		Expr:   "sum(up) by (job)",
+	}
+	client = &mocks.PrometheusAlertClient{}
+	client.On("RuleExists", testNID, "").Return(false)
+	client.On("WriteRuleToGroup", testNID, "", mock.Anything).Return(nil)
+	client.On("ReloadTenant", testNID).Return(nil)
+	c, rec = buildContext(recordingRule, http.MethodPost, "/", v1alertPath, testNID)
+
+	err = GetCreateAlertHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "/v1/test/alert/job:up:sum", rec.Header().Get(echo.HeaderLocation))
+	client.AssertExpectations(t)
+
+	// Errors are returned without a location
+	client = &mocks.PrometheusAlertClient{}
+	client.On("RuleExists", testNID, sampleAlert1.Alert).Return(true)
+	c, rec = buildContext(sampleAlert1, http.MethodPost, "/", v1alertPath, testNID)
+
+	err = GetCreateAlertHandler(client)(c)
+	assert.EqualError(t, err, `code=400, message=Rule 'testAlert1' already exists`)
+	assert.Equal(t, "", rec.Header().Get(echo.HeaderLocation))
+	client.AssertExpectations(t)
+}
+
 func TestGetRetrieveAlertHandler(t *testing.T) {
 	// Successful Get
 	client := &mocks.PrometheusAlertClient{}
-	client.On("ReadRules", testNID, "").Return([]rulefmt.Rule{sampleAlert1}, nil)
+	client.On("RulesModTime", testNID).Return(time.Time{}, nil)
+	client.On("ReadRulesWithGroups", testNID, "").Return([]alert.GroupedRule{{Group: "testGroup", Rule: sampleAlert1}}, nil)
 	c, rec := buildContext(sampleAlert1, http.MethodPost, "/", v1alertPath, testNID)
 
 	err := GetRetrieveAlertHandler(client)(c)
@@ -138,8 +235,15 @@ func TestGetRetrieveAlertHandler(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rec.Code)
 	client.AssertExpectations(t)
 
+	// group is returned with the rule
+	var rules []alert.RuleJSONWrapper
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &rules))
+	groupedRule := sampleJSONRule1
+	groupedRule.Group = "testGroup"
+	assert.Equal(t, []alert.RuleJSONWrapper{groupedRule}, rules)
+
 	// reads rule with long duration
-	client.On("ReadRules", testNID, "").Return([]rulefmt.Rule{sampleLongDurationRule}, nil)
+	client.On("ReadRulesWithGroups", testNID, "").Return([]alert.GroupedRule{{Rule: sampleLongDurationRule}}, nil)
 	c, rec = buildContext(sampleAlert1, http.MethodPost, "/", v1alertPath, testNID)
 
 	err = GetRetrieveAlertHandler(client)(c)
@@ -149,7 +253,8 @@ func TestGetRetrieveAlertHandler(t *testing.T) {
 
 	// Error reading rules
 	client = &mocks.PrometheusAlertClient{}
-	client.On("ReadRules", testNID, "").Return(nil, errors.New("error"))
+	client.On("RulesModTime", testNID).Return(time.Time{}, nil)
+	client.On("ReadRulesWithGroups", testNID, "").Return(nil, errors.New("error"))
 	c, _ = buildContext(sampleAlert1, http.MethodPost, "/", v1alertPath, testNID)
 
 	err = GetRetrieveAlertHandler(client)(c)
@@ -158,11 +263,361 @@ func TestGetRetrieveAlertHandler(t *testing.T) {
 	client.AssertExpectations(t)
 }
 
+func TestGetRetrieveAlertHandler_NotModified(t *testing.T) {
+	modTime := time.Date(2020, 6, 1, 12, 0, 0, 500, time.UTC)
+	client := &mocks.PrometheusAlertClient{}
+	client.On("RulesModTime", testNID).Return(modTime, nil)
+	client.On("ReadRulesWithGroups", testNID, "").Return([]alert.GroupedRule{{Rule: sampleAlert1}}, nil)
+
+	// Without If-Modified-Since the rules are returned along with their
+	// modification time
+	c, rec := buildContext(nil, http.MethodGet, "/", v1alertPath, testNID)
+	err := GetRetrieveAlertHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "Mon, 01 Jun 2020 12:00:00 GMT", rec.Header().Get(echo.HeaderLastModified))
+
+	for ifModifiedSince, expectedCode := range map[string]int{
+		"Mon, 01 Jun 2020 12:00:00 GMT": http.StatusNotModified,
+		"Mon, 01 Jun 2020 13:00:00 GMT": http.StatusNotModified,
+		"Mon, 01 Jun 2020 11:59:59 GMT": http.StatusOK,
+		"yesterday":                     http.StatusOK,
+	} {
+		c, rec = buildContext(nil, http.MethodGet, "/", v1alertPath, testNID)
+		c.Request().Header.Set(echo.HeaderIfModifiedSince, ifModifiedSince)
+		err = GetRetrieveAlertHandler(client)(c)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedCode, rec.Code, ifModifiedSince)
+	}
+	client.AssertNumberOfCalls(t, "ReadRulesWithGroups", 3)
+
+	// Tenants without a rules file have no modification time
+	client = &mocks.PrometheusAlertClient{}
+	client.On("RulesModTime", testNID).Return(time.Time{}, nil)
+	client.On("ReadRulesWithGroups", testNID, "").Return([]alert.GroupedRule{}, nil)
+	c, rec = buildContext(nil, http.MethodGet, "/", v1alertPath, testNID)
+	c.Request().Header.Set(echo.HeaderIfModifiedSince, "Mon, 01 Jun 2020 12:00:00 GMT")
+	err = GetRetrieveAlertHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "", rec.Header().Get(echo.HeaderLastModified))
+	client.AssertExpectations(t)
+}
+
+func TestGetRetrieveAlertHandler_Grouped(t *testing.T) {
+	client := &mocks.PrometheusAlertClient{}
+	client.On("RulesModTime", testNID).Return(time.Time{}, nil)
+	client.On("ReadRulesWithGroups", testNID, "").Return([]alert.GroupedRule{
+		{Group: "groupA", Rule: sampleAlert1},
+		{Group: "groupB", Rule: sampleAlert2},
+		{Group: "groupA", Rule: sampleAlert2},
+	}, nil)
+	c, rec := buildContext(nil, http.MethodGet, "/?grouped=true", v1alertPath, testNID)
+
+	err := GetRetrieveAlertHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	client.AssertExpectations(t)
+
+	var groups []ruleGroupJSON
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &groups))
+	assert.Len(t, groups, 2)
+	assert.Equal(t, "groupA", groups[0].Name)
+	assert.Len(t, groups[0].Rules, 2)
+	assert.Equal(t, sampleAlert1.Alert, groups[0].Rules[0].Alert)
+	assert.Equal(t, sampleAlert2.Alert, groups[0].Rules[1].Alert)
+	assert.Equal(t, "", groups[0].Rules[0].Group)
+	assert.Equal(t, "groupB", groups[1].Name)
+	assert.Len(t, groups[1].Rules, 1)
+	assert.Equal(t, sampleAlert2.Alert, groups[1].Rules[0].Alert)
+
+	// Invalid parameter
+	c, _ = buildContext(nil, http.MethodGet, "/?grouped=sometimes", v1alertPath, testNID)
+	err = GetRetrieveAlertHandler(client)(c)
+	assert.EqualError(t, err, `code=400, message=invalid grouped parameter: sometimes`)
+}
+
+func TestGetRetrieveAlertHandler_Unsecure(t *testing.T) {
+	securedRule := rulefmt.Rule{
+		Alert:  "testAlert1",
+		Expr:   `up{job="node",tenant="test"} == 0`,
+		Labels: map[string]string{"severity": "major", "tenant": "test"},
+	}
+	client := &mocks.PrometheusAlertClient{}
+	client.On("Tenancy").Return(alert.TenancyConfig{RestrictorLabel: "tenant", RestrictQueries: true})
+	client.On("RulesModTime", testNID).Return(time.Time{}, nil)
+	client.On("ReadRulesWithGroups", testNID, "").Return([]alert.GroupedRule{{Group: "testGroup", Rule: securedRule}}, nil)
+	c, rec := buildContext(nil, http.MethodGet, "/?unsecure=true", v1alertPath, testNID)
+
+	err := GetRetrieveAlertHandler(client)(c)
+	assert.NoError(t, err)
+	var rules []alert.RuleJSONWrapper
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &rules))
+	assert.Len(t, rules, 1)
+	assert.Equal(t, `up{job="node"} == 0`, rules[0].Expr)
+	assert.Equal(t, map[string]string{"severity": "major"}, rules[0].Labels)
+	client.AssertExpectations(t)
+
+	// Invalid parameter
+	client = &mocks.PrometheusAlertClient{}
+	c, _ = buildContext(nil, http.MethodGet, "/?unsecure=maybe", v1alertPath, testNID)
+
+	err = GetRetrieveAlertHandler(client)(c)
+	assert.EqualError(t, err, `code=400, message=invalid unsecure parameter: maybe`)
+	client.AssertNotCalled(t, "ReadRulesWithGroups", mock.Anything, mock.Anything)
+}
+
+func TestGetRetrieveAlertHandler_Raw(t *testing.T) {
+	submitted := rulefmt.Rule{
+		Alert:  "testAlert1",
+		Expr:   `up{job="node"} == 0`,
+		Labels: map[string]string{"severity": "major"},
+	}
+	secured := submitted
+	secured.Labels = map[string]string{"severity": "major"}
+	assert.NoError(t, alert.SecureRule(true, "tenant", testNID, &secured))
+
+	client := &mocks.PrometheusAlertClient{}
+	client.On("ReadRulesWithGroups", testNID, "testAlert1").Return([]alert.GroupedRule{{Group: "testGroup", Rule: secured}}, nil)
+	client.On("ReadRulesWithGroups", testNID, "missing").Return([]alert.GroupedRule{}, nil)
+	c, rec := buildContext(nil, http.MethodGet, "/?raw=true", v1alertNamePath, testNID)
+	c.SetParamNames(tenantIDParam, ruleNameParam)
+	c.SetParamValues(testNID, "testAlert1")
+
+	err := GetRetrieveAlertHandler(client)(c)
+	assert.NoError(t, err)
+	var rule alert.RuleJSONWrapper
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &rule))
+	assert.Equal(t, secured.Expr, rule.Expr)
+	assert.Equal(t, secured.Labels, rule.Labels)
+	assert.Equal(t, "testGroup", rule.Group)
+	assert.NotEqual(t, submitted.Expr, rule.Expr)
+
+	// Missing rule
+	c, _ = buildContext(nil, http.MethodGet, "/?raw=true", v1alertNamePath, testNID)
+	c.SetParamNames(tenantIDParam, ruleNameParam)
+	c.SetParamValues(testNID, "missing")
+	err = GetRetrieveAlertHandler(client)(c)
+	assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+	client.AssertExpectations(t)
+
+	// Raw can't be combined with unsecure
+	client = &mocks.PrometheusAlertClient{}
+	c, _ = buildContext(nil, http.MethodGet, "/?raw=true&unsecure=true", v1alertNamePath, testNID)
+	c.SetParamNames(tenantIDParam, ruleNameParam)
+	c.SetParamValues(testNID, "testAlert1")
+	err = GetRetrieveAlertHandler(client)(c)
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	client.AssertNotCalled(t, "ReadRulesWithGroups", mock.Anything, mock.Anything)
+}
+
+func TestGetRuleByIndexHandler(t *testing.T) {
+	client := &mocks.PrometheusAlertClient{}
+	client.On("GetRuleByIndex", testNID, "testGroup", 1).Return(&sampleAlert2, nil)
+	client.On("GetRuleByIndex", testNID, "testGroup", 5).Return(nil, fmt.Errorf("group testGroup has 2 rules, no index 5: %w", alert.ErrRuleNotFound))
+	for _, tc := range []struct {
+		idx          string
+		expectedCode int
+	}{
+		{idx: "1", expectedCode: http.StatusOK},
+		{idx: "5", expectedCode: http.StatusNotFound},
+		{idx: "-1", expectedCode: http.StatusBadRequest},
+		{idx: "first", expectedCode: http.StatusBadRequest},
+	} {
+		c, rec := buildContext(nil, http.MethodGet, "/", v1GroupRuleIndexPath, testNID)
+		c.SetParamNames(tenantIDParam, groupParam, ruleIndexParam)
+		c.SetParamValues(testNID, "testGroup", tc.idx)
+
+		err := GetRuleByIndexHandler(client)(c)
+		if tc.expectedCode != http.StatusOK {
+			assert.Equal(t, tc.expectedCode, err.(*echo.HTTPError).Code, tc.idx)
+			continue
+		}
+		assert.NoError(t, err)
+		var rule alert.RuleJSONWrapper
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &rule))
+		assert.Equal(t, sampleAlert2.Alert, rule.Alert)
+		assert.Equal(t, "testGroup", rule.Group)
+	}
+	client.AssertExpectations(t)
+}
+
+func TestGetListRuleNamesHandler(t *testing.T) {
+	client := &mocks.PrometheusAlertClient{}
+	client.On("ListRuleNames", testNID).Return([]string{"job:up:sum", "testAlert1"}, nil)
+	c, rec := buildContext(nil, http.MethodGet, "/", v1alertNamesPath, testNID)
+
+	err := GetListRuleNamesHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var names []string
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &names))
+	assert.Equal(t, []string{"job:up:sum", "testAlert1"}, names)
+	client.AssertExpectations(t)
+
+	// Error reading rules
+	client = &mocks.PrometheusAlertClient{}
+	client.On("ListRuleNames", testNID).Return(nil, errors.New("error"))
+	c, _ = buildContext(nil, http.MethodGet, "/", v1alertNamesPath, testNID)
+
+	err = GetListRuleNamesHandler(client)(c)
+	assert.EqualError(t, err, `code=500, message=error`)
+	client.AssertExpectations(t)
+}
+
+func TestGetFindRuleTenantHandler(t *testing.T) {
+	// Rule owned by two tenants
+	client := &mocks.PrometheusAlertClient{}
+	client.On("FindRuleTenant", "testAlert1").Return([]string{"other", testNID}, nil)
+	c, rec := buildContext(nil, http.MethodGet, "/", v1alertTenantPath, "")
+	c.SetParamNames(ruleNameParam)
+	c.SetParamValues("testAlert1")
+
+	err := GetFindRuleTenantHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var tenants []string
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tenants))
+	assert.Equal(t, []string{"other", testNID}, tenants)
+	client.AssertExpectations(t)
+
+	// Rule not found
+	client = &mocks.PrometheusAlertClient{}
+	client.On("FindRuleTenant", "testAlert1").Return([]string{}, nil)
+	c, _ = buildContext(nil, http.MethodGet, "/", v1alertTenantPath, "")
+	c.SetParamNames(ruleNameParam)
+	c.SetParamValues("testAlert1")
+
+	err = GetFindRuleTenantHandler(client)(c)
+	assert.EqualError(t, err, `code=404, message=rule testAlert1 not found`)
+
+	// Error scanning rules files
+	client = &mocks.PrometheusAlertClient{}
+	client.On("FindRuleTenant", "testAlert1").Return(nil, errors.New("error"))
+	c, _ = buildContext(nil, http.MethodGet, "/", v1alertTenantPath, "")
+	c.SetParamNames(ruleNameParam)
+	c.SetParamValues("testAlert1")
+
+	err = GetFindRuleTenantHandler(client)(c)
+	assert.EqualError(t, err, `code=500, message=error`)
+	client.AssertExpectations(t)
+}
+
+func TestGetListTenantsHandler(t *testing.T) {
+	client := &mocks.PrometheusAlertClient{}
+	client.On("ListTenants", alert.TenantListOptions{Prefix: "te", Limit: 2, Offset: 1}).Return([]string{"test2", "test3"}, nil)
+	c, rec := buildContext(nil, http.MethodGet, "/?prefix=te&limit=2&offset=1", v1TenantsPath, "")
+
+	err := GetListTenantsHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var tenants []string
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tenants))
+	assert.Equal(t, []string{"test2", "test3"}, tenants)
+	client.AssertExpectations(t)
+
+	since := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	client = &mocks.PrometheusAlertClient{}
+	client.On("ListTenants", alert.TenantListOptions{ModifiedSince: since}).Return([]string{"test2"}, nil)
+	c, rec = buildContext(nil, http.MethodGet, "/?since=2020-06-01T12:00:00Z", v1TenantsPath, "")
+
+	err = GetListTenantsHandler(client)(c)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `["test2"]`, rec.Body.String())
+	client.AssertExpectations(t)
+
+	// Invalid paging and filtering parameters
+	client = &mocks.PrometheusAlertClient{}
+	for _, query := range []string{"/?limit=-1", "/?offset=two", "/?since=yesterday"} {
+		c, _ = buildContext(nil, http.MethodGet, query, v1TenantsPath, "")
+		err = GetListTenantsHandler(client)(c)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	}
+	client.AssertNotCalled(t, "ListTenants", mock.Anything)
+}
+
+func TestGetCompareRulesHandler(t *testing.T) {
+	diff := alert.RuleDiff{OnlyInA: []string{"a_rule"}, OnlyInB: []string{}, Differing: []string{"testAlert1"}}
+
+	// Successful compare
+	client := &mocks.PrometheusAlertClient{}
+	client.On("CompareRules", testNID, "other").Return(diff, nil)
+	c, rec := buildContext(nil, http.MethodGet, "/?a=test&b=other", v1RulesComparePath, "")
+
+	err := GetCompareRulesHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var retrievedDiff alert.RuleDiff
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &retrievedDiff))
+	assert.Equal(t, diff, retrievedDiff)
+	client.AssertExpectations(t)
+
+	// Missing tenant
+	c, _ = buildContext(nil, http.MethodGet, "/?a=test", v1RulesComparePath, "")
+	err = GetCompareRulesHandler(client)(c)
+	assert.EqualError(t, err, `code=400, message=Must provide tenants to compare as a and b parameters`)
+
+	// Client error
+	client = &mocks.PrometheusAlertClient{}
+	client.On("CompareRules", testNID, "other").Return(alert.RuleDiff{}, errors.New("error"))
+	c, _ = buildContext(nil, http.MethodGet, "/?a=test&b=other", v1RulesComparePath, "")
+
+	err = GetCompareRulesHandler(client)(c)
+	assert.EqualError(t, err, `code=500, message=error`)
+	client.AssertExpectations(t)
+}
+
+func TestGetUpdateRuleLabelsHandler(t *testing.T) {
+	// Add label
+	client := &mocks.PrometheusAlertClient{}
+	client.On("AddLabelToAllRules", testNID, "env", "prod").Return(nil)
+	client.On("ReloadTenant", testNID).Return(nil)
+	c, rec := buildContext(ruleLabelsPayload{Key: "env", Value: "prod"}, http.MethodPost, "/", v1RulesLabelsPath, testNID)
+
+	err := GetUpdateRuleLabelsHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	client.AssertExpectations(t)
+
+	// Remove label
+	client = &mocks.PrometheusAlertClient{}
+	client.On("RemoveLabelFromAllRules", testNID, "env").Return(nil)
+	client.On("ReloadTenant", testNID).Return(nil)
+	c, rec = buildContext(ruleLabelsPayload{Key: "env", Remove: true}, http.MethodPost, "/", v1RulesLabelsPath, testNID)
+
+	err = GetUpdateRuleLabelsHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	client.AssertExpectations(t)
+
+	// Missing key
+	c, _ = buildContext(ruleLabelsPayload{Value: "prod"}, http.MethodPost, "/", v1RulesLabelsPath, testNID)
+	err = GetUpdateRuleLabelsHandler(client)(c)
+	assert.EqualError(t, err, `code=400, message=No label key provided`)
+
+	// Updated rule fails validation
+	client = &mocks.PrometheusAlertClient{}
+	client.On("RemoveLabelFromAllRules", testNID, "team").Return(alert.RuleValidationError{Err: errors.New("missing required labels: team")})
+	c, _ = buildContext(ruleLabelsPayload{Key: "team", Remove: true}, http.MethodPost, "/", v1RulesLabelsPath, testNID)
+
+	err = GetUpdateRuleLabelsHandler(client)(c)
+	assert.EqualError(t, err, `code=400, message=missing required labels: team`)
+
+	// Client error
+	client = &mocks.PrometheusAlertClient{}
+	client.On("AddLabelToAllRules", testNID, "env", "prod").Return(errors.New("error"))
+	c, _ = buildContext(ruleLabelsPayload{Key: "env", Value: "prod"}, http.MethodPost, "/", v1RulesLabelsPath, testNID)
+
+	err = GetUpdateRuleLabelsHandler(client)(c)
+	assert.EqualError(t, err, `code=500, message=error`)
+	client.AssertExpectations(t)
+}
+
 func TestGetDeleteAlertHandler(t *testing.T) {
 	// Successful Delete
 	client := &mocks.PrometheusAlertClient{}
 	client.On("DeleteRule", testNID, sampleAlert1.Alert).Return(nil)
-	client.On("ReloadPrometheus").Return(nil)
+	client.On("ReloadTenant", testNID).Return(nil)
 
 	c, rec := buildContext(nil, http.MethodDelete, "/", v1alertPath, testNID)
 	c.SetParamNames(ruleNameParam)
@@ -196,7 +651,7 @@ func TestGetDeleteAlertHandler(t *testing.T) {
 	// Prometheus reload failed
 	client = &mocks.PrometheusAlertClient{}
 	client.On("DeleteRule", testNID, sampleAlert1.Alert).Return(nil)
-	client.On("ReloadPrometheus").Return(errors.New("error"))
+	client.On("ReloadTenant", testNID).Return(errors.New("error"))
 	c, _ = buildContext(nil, http.MethodDelete, "/", v1alertPath, testNID)
 	c.SetParamNames(ruleNameParam)
 	c.SetParamValues(sampleAlert1.Alert)
@@ -211,8 +666,8 @@ func TestUpdateAlertHandler(t *testing.T) {
 	// Successful Update
 	client := &mocks.PrometheusAlertClient{}
 	client.On("RuleExists", testNID, sampleAlert1.Alert).Return(true)
-	client.On("UpdateRule", testNID, sampleAlert1).Return(nil)
-	client.On("ReloadPrometheus").Return(nil)
+	client.On("UpdateRuleInGroup", testNID, "", sampleAlert1).Return(nil)
+	client.On("ReloadTenant", testNID).Return(nil)
 	c, rec := buildContext(sampleAlert1, http.MethodPut, "/", v1alertPath, testNID)
 	c.SetParamNames("file_prefix", ruleNameParam)
 	c.SetParamValues(testNID, sampleAlert1.Alert)
@@ -222,6 +677,22 @@ func TestUpdateAlertHandler(t *testing.T) {
 	assert.Equal(t, http.StatusNoContent, rec.Code)
 	client.AssertExpectations(t)
 
+	// Successful Update with group
+	groupedRule := sampleJSONRule1
+	groupedRule.Group = "testGroup"
+	client = &mocks.PrometheusAlertClient{}
+	client.On("RuleExists", testNID, sampleAlert1.Alert).Return(true)
+	client.On("UpdateRuleInGroup", testNID, "testGroup", sampleAlert1).Return(nil)
+	client.On("ReloadTenant", testNID).Return(nil)
+	c, rec = buildContext(groupedRule, http.MethodPut, "/", v1alertPath, testNID)
+	c.SetParamNames("file_prefix", ruleNameParam)
+	c.SetParamValues(testNID, sampleAlert1.Alert)
+
+	err = GetUpdateAlertHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	client.AssertExpectations(t)
+
 	// No rule name provided
 	client = &mocks.PrometheusAlertClient{}
 	c, _ = buildContext(sampleAlert1, http.MethodPut, "/", v1alertPath, testNID)
@@ -258,7 +729,7 @@ func TestUpdateAlertHandler(t *testing.T) {
 	// Update rule fails
 	client = &mocks.PrometheusAlertClient{}
 	client.On("RuleExists", testNID, sampleAlert1.Alert).Return(true)
-	client.On("UpdateRule", testNID, sampleAlert1).Return(errors.New("error"))
+	client.On("UpdateRuleInGroup", testNID, "", sampleAlert1).Return(errors.New("error"))
 	c, _ = buildContext(sampleAlert1, http.MethodPut, "/", v1alertPath, testNID)
 	c.SetParamNames("file_prefix", ruleNameParam)
 	c.SetParamValues(testNID, sampleAlert1.Alert)
@@ -268,11 +739,24 @@ func TestUpdateAlertHandler(t *testing.T) {
 	assert.EqualError(t, err, `code=500, message=error`)
 	client.AssertExpectations(t)
 
+	// Update rejects rule for missing required keys
+	client = &mocks.PrometheusAlertClient{}
+	client.On("RuleExists", testNID, sampleAlert1.Alert).Return(true)
+	client.On("UpdateRuleInGroup", testNID, "", sampleAlert1).Return(alert.RuleValidationError{Err: errors.New("Rule Validation Error; missing required annotations: summary")})
+	c, _ = buildContext(sampleAlert1, http.MethodPut, "/", v1alertPath, testNID)
+	c.SetParamNames("file_prefix", ruleNameParam)
+	c.SetParamValues(testNID, sampleAlert1.Alert)
+
+	err = GetUpdateAlertHandler(client)(c)
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	assert.EqualError(t, err, `code=400, message=Rule Validation Error; missing required annotations: summary`)
+	client.AssertExpectations(t)
+
 	// Reload Prometheus fails
 	client = &mocks.PrometheusAlertClient{}
 	client.On("RuleExists", testNID, sampleAlert1.Alert).Return(true)
-	client.On("UpdateRule", testNID, sampleAlert1).Return(nil)
-	client.On("ReloadPrometheus").Return(errors.New("error"))
+	client.On("UpdateRuleInGroup", testNID, "", sampleAlert1).Return(nil)
+	client.On("ReloadTenant", testNID).Return(errors.New("error"))
 	c, _ = buildContext(sampleAlert1, http.MethodPut, "/", v1alertPath, testNID)
 	c.SetParamNames("file_prefix", ruleNameParam)
 	c.SetParamValues(testNID, sampleAlert1.Alert)
@@ -286,13 +770,13 @@ func TestUpdateAlertHandler(t *testing.T) {
 func TestGetBulkAlertUpdateHandler(t *testing.T) {
 	// Successful Bulk Update
 	client := &mocks.PrometheusAlertClient{}
-	bulkAlerts := []rulefmt.Rule{sampleAlert1, sampleAlert2}
+	bulkAlerts := []alert.GroupedRule{{Rule: sampleAlert1}, {Rule: sampleAlert2}}
 	sampleUpdateResult := alert.BulkUpdateResults{
 		Errors:   map[string]error{},
 		Statuses: map[string]string{"testAlert1": "created", "testAlert2": "created"},
 	}
-	client.On("BulkUpdateRules", testNID, bulkAlerts).Return(sampleUpdateResult, nil)
-	client.On("ReloadPrometheus").Return(nil)
+	client.On("BulkUpdateRulesInGroups", testNID, bulkAlerts).Return(sampleUpdateResult, nil)
+	client.On("ReloadTenant", testNID).Return(nil)
 
 	c, rec := buildContext([]rulefmt.Rule{sampleAlert1, sampleAlert2}, http.MethodPut, "/", "/:file_prefix/alert/bulk", testNID)
 
@@ -316,6 +800,202 @@ func TestGetBulkAlertUpdateHandler(t *testing.T) {
 	err = json.Unmarshal(rec.Body.Bytes(), &results)
 	assert.NoError(t, err)
 	assert.Equal(t, sampleUpdateResult, results)
+
+	// Empty payloads neither write nor reload
+	client = &mocks.PrometheusAlertClient{}
+	c, rec = buildContext([]rulefmt.Rule{}, http.MethodPut, "/", "/:file_prefix/alert/bulk", testNID)
+	err = GetBulkAlertUpdateHandler(client)(c)
+	assert.NoError(t, err)
+	client.AssertNotCalled(t, "BulkUpdateRulesInGroups", mock.Anything, mock.Anything)
+	client.AssertNotCalled(t, "ReloadTenant", mock.Anything)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"Errors": {}, "Statuses": {}}`, rec.Body.String())
+
+	// Bulk update with groups
+	groupedRule := sampleJSONRule2
+	groupedRule.Group = "testGroup"
+	client = &mocks.PrometheusAlertClient{}
+	client.On("BulkUpdateRulesInGroups", testNID, []alert.GroupedRule{{Rule: sampleAlert1}, {Group: "testGroup", Rule: sampleAlert2}}).Return(sampleUpdateResult, nil)
+	client.On("ReloadTenant", testNID).Return(nil)
+	c, rec = buildContext([]alert.RuleJSONWrapper{sampleJSONRule1, groupedRule}, http.MethodPut, "/", "/:file_prefix/alert/bulk", testNID)
+	err = GetBulkAlertUpdateHandler(client)(c)
+	assert.NoError(t, err)
+	client.AssertExpectations(t)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestGetBulkAlertUpdateHandler_FileUpload(t *testing.T) {
+	const rulesFile = `groups:
+  - name: testGroup
+    rules:
+      - alert: testAlert1
+        expr: up == 0
+        for: 5s
+        labels:
+          label: value
+        annotations:
+          annotation: value
+      - record: job:up:sum
+        expr: sum(up) by (job)
+`
+	client := &mocks.PrometheusAlertClient{}
+	expected := []alert.GroupedRule{
+		{Group: "testGroup", Rule: sampleAlert1},
+		{Group: "testGroup", Rule: rulefmt.Rule{Record: "job:up:sum", Expr: "sum(up) by (job)"}},
+	}
+	client.On("BulkUpdateRulesInGroups", testNID, expected).Return(alert.NewBulkUpdateResults(), nil)
+	client.On("ReloadTenant", testNID).Return(nil)
+	c, rec := buildUploadContext(t, "rules.yml", rulesFile)
+	err := GetBulkAlertUpdateHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	client.AssertExpectations(t)
+
+	// JSON lists of rules are accepted as they are in a request body
+	client = &mocks.PrometheusAlertClient{}
+	client.On("BulkUpdateRulesInGroups", testNID, []alert.GroupedRule{{Rule: sampleAlert1}}).Return(alert.NewBulkUpdateResults(), nil)
+	client.On("ReloadTenant", testNID).Return(nil)
+	body, _ := json.Marshal([]alert.RuleJSONWrapper{sampleJSONRule1})
+	c, rec = buildUploadContext(t, "rules.json", string(body))
+	err = GetBulkAlertUpdateHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	client.AssertExpectations(t)
+
+	client = &mocks.PrometheusAlertClient{}
+	c, _ = buildUploadContext(t, "rules.yml", "groups:\n  - name: g\n    rules:\n      - alert: a\n        expr: up{\n")
+	err = GetBulkAlertUpdateHandler(client)(c)
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	assert.Contains(t, err.Error(), "error parsing rules file rules.yml")
+
+	c, _ = buildUploadContext(t, "rules.txt", rulesFile)
+	err = GetBulkAlertUpdateHandler(client)(c)
+	assert.EqualError(t, err, "code=400, message=unsupported rules file rules.txt, must be .yml, .yaml or .json")
+	client.AssertNotCalled(t, "BulkUpdateRulesInGroups", mock.Anything, mock.Anything)
+}
+
+func TestGetReplaceRulesHandler(t *testing.T) {
+	// List of rules, without a group, go to the tenant's default group
+	client := &mocks.PrometheusAlertClient{}
+	client.On("ReplaceRules", testNID, alert.File{RuleGroups: []alert.RuleGroup{
+		{Name: testNID, Rules: []rulefmt.Rule{sampleAlert1}},
+		{Name: "testGroup", Rules: []rulefmt.Rule{sampleAlert2}},
+	}}).Return(nil)
+	client.On("ReloadTenant", testNID).Return(nil)
+	groupedRule := sampleJSONRule2
+	groupedRule.Group = "testGroup"
+	c, rec := buildContext([]alert.RuleJSONWrapper{sampleJSONRule1, groupedRule}, http.MethodPut, "/", v1RulesPath, testNID)
+	err := GetReplaceRulesHandler(client)(c)
+	assert.NoError(t, err)
+	client.AssertExpectations(t)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Rule groups, as in a prometheus rules file
+	const rulesFile = `groups:
+  - name: testGroup
+    interval: 1m
+    rules:
+      - alert: testAlert1
+        expr: up == 0
+`
+	client = &mocks.PrometheusAlertClient{}
+	client.On("ReplaceRules", testNID, alert.File{RuleGroups: []alert.RuleGroup{
+		{Name: "testGroup", Interval: model.Duration(time.Minute), Rules: []rulefmt.Rule{{Alert: "testAlert1", Expr: "up == 0"}}},
+	}}).Return(nil)
+	client.On("ReloadTenant", testNID).Return(nil)
+	req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(rulesFile))
+	rec = httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.Set(tenantIDParam, testNID)
+	err = GetReplaceRulesHandler(client)(c)
+	assert.NoError(t, err)
+	client.AssertExpectations(t)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Invalid rules fail the whole request
+	client = &mocks.PrometheusAlertClient{}
+	c, _ = buildContext([]rulefmt.Rule{sampleAlert1, sampleInvalidAlert}, http.MethodPut, "/", v1RulesPath, testNID)
+	err = GetReplaceRulesHandler(client)(c)
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	client.AssertNotCalled(t, "ReplaceRules", mock.Anything, mock.Anything)
+
+	req = httptest.NewRequest(http.MethodPut, "/", strings.NewReader("groups:\n  - rules: []\n"))
+	c = echo.New().NewContext(req, httptest.NewRecorder())
+	c.Set(tenantIDParam, testNID)
+	err = GetReplaceRulesHandler(client)(c)
+	assert.EqualError(t, err, "code=400, message=rule group has no name")
+
+	client = &mocks.PrometheusAlertClient{}
+	client.On("ReplaceRules", testNID, mock.Anything).Return(alert.RuleValidationError{Err: errors.New("duplicate rule name in payload: testAlert1")})
+	c, _ = buildContext([]rulefmt.Rule{sampleAlert1, sampleAlert1}, http.MethodPut, "/", v1RulesPath, testNID)
+	err = GetReplaceRulesHandler(client)(c)
+	assert.EqualError(t, err, "code=400, message=duplicate rule name in payload: testAlert1")
+	client.AssertNotCalled(t, "ReloadTenant", mock.Anything)
+}
+
+func TestGetImportGrafanaRulesHandler(t *testing.T) {
+	provisioning := `{"groups": [{"name": "grafana", "rules": [
+		{"title": "testAlert1", "condition": "A", "isPaused": true, "data": [{"refId": "A", "model": {"expr": "up == 0"}}]},
+		{"title": "badAlert", "condition": "A", "data": [{"refId": "A", "model": {"expr": "up{"}}]},
+		{"title": "mathAlert", "condition": "A", "data": [{"refId": "A", "model": {"type": "math", "expression": "1"}}]}
+	]}]}`
+	client := &mocks.PrometheusAlertClient{}
+	client.On("BulkUpdateRulesInGroups", testNID, []alert.GroupedRule{{Group: "grafana", Rule: rulefmt.Rule{Alert: "testAlert1", Expr: "up == 0"}}}).
+		Return(alert.BulkUpdateResults{Errors: map[string]error{}, Statuses: map[string]string{"testAlert1": "created"}}, nil)
+	client.On("ReloadTenant", testNID).Return(nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(provisioning))
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.Set(tenantIDParam, testNID)
+	err := GetImportGrafanaRulesHandler(client)(c)
+	assert.NoError(t, err)
+	client.AssertExpectations(t)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response struct {
+		Results  alert.BulkUpdateResults `json:"results"`
+		Warnings map[string][]string     `json:"warnings"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, map[string]string{"testAlert1": "created"}, response.Results.Statuses)
+	assert.Contains(t, response.Results.Errors, "badAlert")
+	assert.Len(t, response.Warnings["testAlert1"], 1)
+	assert.Len(t, response.Warnings["mathAlert"], 1)
+
+	// Files with no valid rules neither write nor reload
+	client = &mocks.PrometheusAlertClient{}
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"groups": [{"name": "grafana", "rules": [
+		{"title": "badAlert", "condition": "A", "data": [{"refId": "A", "model": {"expr": "up{"}}]}
+	]}]}`))
+	rec = httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.Set(tenantIDParam, testNID)
+	err = GetImportGrafanaRulesHandler(client)(c)
+	assert.NoError(t, err)
+	client.AssertNotCalled(t, "BulkUpdateRulesInGroups", mock.Anything, mock.Anything)
+	client.AssertNotCalled(t, "ReloadTenant", mock.Anything)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Empty(t, response.Results.Statuses)
+	assert.Contains(t, response.Results.Errors, "badAlert")
+
+	// Server errors from the client aren't reported as bad requests
+	client = &mocks.PrometheusAlertClient{}
+	client.On("BulkUpdateRulesInGroups", testNID, mock.Anything).Return(alert.BulkUpdateResults{}, errors.New("write err"))
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(provisioning))
+	c = echo.New().NewContext(req, httptest.NewRecorder())
+	c.Set(tenantIDParam, testNID)
+	err = GetImportGrafanaRulesHandler(client)(c)
+	assert.Equal(t, http.StatusInternalServerError, err.(*echo.HTTPError).Code)
+	client.AssertNotCalled(t, "ReloadTenant", mock.Anything)
+
+	// Unparseable file
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("groups: {"))
+	c = echo.New().NewContext(req, httptest.NewRecorder())
+	c.Set(tenantIDParam, testNID)
+	err = GetImportGrafanaRulesHandler(&mocks.PrometheusAlertClient{})(c)
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
 }
 
 type tenancyTestCase struct {
@@ -338,6 +1018,305 @@ func (tc *tenancyTestCase) RunTest(t *testing.T) {
 	}
 }
 
+func TestGetConfigureAlertHandler_Variables(t *testing.T) {
+	templated := sampleAlert1
+	templated.Expr = `up == {{ var "down" }}`
+
+	// References are expanded before the rule is validated and written
+	client := &mocks.PrometheusAlertClient{}
+	client.On("ExpandVariables", testNID, templated).Return(sampleAlert1, nil)
+	client.On("RuleExists", testNID, sampleAlert1.Alert).Return(false)
+	client.On("WriteRuleToGroup", testNID, "", sampleAlert1).Return(nil)
+	client.On("ReloadTenant", testNID).Return(nil)
+	c, rec := buildContext(templated, http.MethodPost, "/", v1alertPath, testNID)
+
+	err := GetConfigureAlertHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	client.AssertExpectations(t)
+
+	// Undefined variable
+	client = &mocks.PrometheusAlertClient{}
+	client.On("ExpandVariables", testNID, templated).Return(templated, alert.RuleValidationError{Err: errors.New("undefined variable down")})
+	c, _ = buildContext(templated, http.MethodPost, "/", v1alertPath, testNID)
+
+	err = GetConfigureAlertHandler(client)(c)
+	assert.EqualError(t, err, `code=400, message=undefined variable down`)
+	client.AssertExpectations(t)
+}
+
+func TestRestrictorMatcherParams(t *testing.T) {
+	matched := &mocks.PrometheusAlertClient{}
+	matched.On("RuleExists", testNID, sampleAlert1.Alert).Return(false)
+	matched.On("WriteRuleToGroup", testNID, "", sampleAlert1).Return(nil)
+	matched.On("ReloadTenant", testNID).Return(nil)
+	client := &mocks.PrometheusAlertClient{}
+	client.On("WithRestrictorMatchers", map[string]string{"org": "acme", "team": "payments"}).Return(matched)
+
+	c, rec := buildContext(sampleAlert1, http.MethodPost, "/?matcher=org=acme&matcher=team=payments", v1alertPath, testNID)
+	err := GetConfigureAlertHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	client.AssertExpectations(t)
+	matched.AssertExpectations(t)
+
+	for _, target := range []string{"/?matcher=team", "/?matcher=1team=payments"} {
+		c, _ = buildContext(sampleAlert1, http.MethodPost, target, v1alertPath, testNID)
+		err = GetConfigureAlertHandler(client)(c)
+		assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	}
+}
+
+func TestStagedRuleHandlers(t *testing.T) {
+	// Writes with staged=true go through the staged client, which doesn't
+	// reload prometheus
+	staged := &mocks.PrometheusAlertClient{}
+	staged.On("RuleExists", testNID, sampleAlert1.Alert).Return(false)
+	staged.On("WriteRuleToGroup", testNID, "", sampleAlert1).Return(nil)
+	staged.On("ReloadTenant", testNID).Return(nil)
+	staged.On("RulesModTime", testNID).Return(time.Time{}, nil)
+	staged.On("ReadRulesWithGroups", testNID, "").Return([]alert.GroupedRule{{Rule: sampleAlert1}}, nil)
+	client := &mocks.PrometheusAlertClient{}
+	client.On("Staged").Return(staged)
+
+	c, rec := buildContext(sampleAlert1, http.MethodPost, "/?staged=true", v1alertPath, testNID)
+	err := GetConfigureAlertHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	c, rec = buildContext(nil, http.MethodGet, "/?staged=true", v1alertPath, testNID)
+	err = GetRetrieveAlertHandler(client)(c)
+	assert.NoError(t, err)
+	var rules []alert.RuleJSONWrapper
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &rules))
+	assert.Len(t, rules, 1)
+	client.AssertExpectations(t)
+	staged.AssertExpectations(t)
+
+	c, _ = buildContext(nil, http.MethodGet, "/?staged=maybe", v1alertPath, testNID)
+	err = GetRetrieveAlertHandler(client)(c)
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+
+	// Promote
+	client = &mocks.PrometheusAlertClient{}
+	client.On("PromoteStaging", testNID).Return(nil)
+	client.On("ReloadTenant", testNID).Return(nil)
+	c, rec = buildContext(nil, http.MethodPost, "/", v1StagingPromotePath, testNID)
+	err = GetPromoteStagingHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	client.AssertExpectations(t)
+
+	client = &mocks.PrometheusAlertClient{}
+	client.On("PromoteStaging", testNID).Return(fmt.Errorf("tenant test: %w", alert.ErrNoStagedChanges))
+	c, _ = buildContext(nil, http.MethodPost, "/", v1StagingPromotePath, testNID)
+	err = GetPromoteStagingHandler(client)(c)
+	assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+	client.AssertNotCalled(t, "ReloadTenant", mock.Anything)
+
+	// Discard
+	client = &mocks.PrometheusAlertClient{}
+	client.On("DiscardStaging", testNID).Return(nil)
+	c, rec = buildContext(nil, http.MethodPost, "/", v1StagingDiscardPath, testNID)
+	err = GetDiscardStagingHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	client.AssertExpectations(t)
+}
+
+func TestVariableHandlers(t *testing.T) {
+	client := &mocks.PrometheusAlertClient{}
+	client.On("GetVariables", testNID).Return(map[string]string{"cpu_warn": "80"}, nil)
+	c, rec := buildContext(nil, http.MethodGet, "/", v1VariablesPath, testNID)
+
+	err := GetGetVariablesHandler(client)(c)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"cpu_warn": "80"}`, rec.Body.String())
+	client.AssertExpectations(t)
+
+	// Set
+	client = &mocks.PrometheusAlertClient{}
+	client.On("SetVariable", testNID, "cpu_warn", "90").Return(nil)
+	client.On("SetVariable", testNID, "1cpu", "90").Return(alert.RuleValidationError{Err: errors.New("invalid variable name: 1cpu")})
+	c, rec = buildContext(variablePayload{Value: "90"}, http.MethodPut, "/", v1VariableNamePath, testNID)
+	c.SetParamNames(tenantIDParam, variableParam)
+	c.SetParamValues(testNID, "cpu_warn")
+
+	err = GetSetVariableHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	c, _ = buildContext(variablePayload{Value: "90"}, http.MethodPut, "/", v1VariableNamePath, testNID)
+	c.SetParamNames(tenantIDParam, variableParam)
+	c.SetParamValues(testNID, "1cpu")
+	err = GetSetVariableHandler(client)(c)
+	assert.EqualError(t, err, `code=400, message=invalid variable name: 1cpu`)
+	client.AssertExpectations(t)
+
+	// Delete
+	client = &mocks.PrometheusAlertClient{}
+	client.On("DeleteVariable", testNID, "cpu_warn").Return(nil)
+	client.On("DeleteVariable", testNID, "missing").Return(fmt.Errorf("variable missing: %w", alert.ErrVariableNotFound))
+	c, rec = buildContext(nil, http.MethodDelete, "/", v1VariableNamePath, testNID)
+	c.SetParamNames(tenantIDParam, variableParam)
+	c.SetParamValues(testNID, "cpu_warn")
+
+	err = GetDeleteVariableHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	c, _ = buildContext(nil, http.MethodDelete, "/", v1VariableNamePath, testNID)
+	c.SetParamNames(tenantIDParam, variableParam)
+	c.SetParamValues(testNID, "missing")
+	err = GetDeleteVariableHandler(client)(c)
+	assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+	client.AssertExpectations(t)
+}
+
+func TestGroupLimitHandlers(t *testing.T) {
+	client := &mocks.PrometheusAlertClient{}
+	client.On("GetGroupLimit", testNID, "cpu").Return(10, nil)
+	client.On("GetGroupLimit", testNID, "missing").Return(0, fmt.Errorf("group missing: %w", alert.ErrGroupNotFound))
+	c, rec := buildContext(nil, http.MethodGet, "/", v1GroupLimitPath, testNID)
+	c.SetParamNames(tenantIDParam, groupParam)
+	c.SetParamValues(testNID, "cpu")
+
+	err := GetGroupLimitHandler(client)(c)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"limit": 10}`, rec.Body.String())
+
+	c, _ = buildContext(nil, http.MethodGet, "/", v1GroupLimitPath, testNID)
+	c.SetParamNames(tenantIDParam, groupParam)
+	c.SetParamValues(testNID, "missing")
+	err = GetGroupLimitHandler(client)(c)
+	assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+	client.AssertExpectations(t)
+
+	// Set
+	client = &mocks.PrometheusAlertClient{}
+	client.On("SetGroupLimit", testNID, "cpu", 10).Return(nil)
+	client.On("SetGroupLimit", testNID, "cpu", -1).Return(alert.RuleValidationError{Err: errors.New("invalid limit -1: must not be negative")})
+	client.On("ReloadTenant", testNID).Return(nil)
+	c, rec = buildContext(groupLimit{Limit: 10}, http.MethodPut, "/", v1GroupLimitPath, testNID)
+	c.SetParamNames(tenantIDParam, groupParam)
+	c.SetParamValues(testNID, "cpu")
+
+	err = GetSetGroupLimitHandler(client)(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	c, _ = buildContext(groupLimit{Limit: -1}, http.MethodPut, "/", v1GroupLimitPath, testNID)
+	c.SetParamNames(tenantIDParam, groupParam)
+	c.SetParamValues(testNID, "cpu")
+	err = GetSetGroupLimitHandler(client)(c)
+	assert.EqualError(t, err, `code=400, message=invalid limit -1: must not be negative`)
+	client.AssertExpectations(t)
+}
+
+func TestFormatExprHandler(t *testing.T) {
+	// Formatting is available in read-only mode
+	e := echo.New()
+	RegisterV1Handlers(e, &mocks.PrometheusAlertClient{}, true)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, v1PromQLFormatPath, strings.NewReader(`{"expr": "sum(up)by(job)>0"}`)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"expr": "sum by(job) (up) > 0"}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, v1PromQLFormatPath, strings.NewReader(`{"expr": "up{"}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"message": "1:4: parse error: unexpected end of input inside braces", "start": 3, "end": 3}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, v1PromQLFormatPath, strings.NewReader(`not json`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestExprMetricsHandler(t *testing.T) {
+	// Listing metrics is available in read-only mode
+	e := echo.New()
+	RegisterV1Handlers(e, &mocks.PrometheusAlertClient{}, true)
+	metricsPath := strings.Replace(v1alertMetricsPath, ":"+tenantIDParam, testNID, 1)
+
+	// A whole rule can be posted, only its expression is used
+	rec := httptest.NewRecorder()
+	body, _ := json.Marshal(alert.RuleJSONWrapper{Alert: "errors", Expr: `rate(errors_total[5m]) / rate(requests_total[5m]) > 0.1`, For: "5m"})
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, metricsPath, bytes.NewReader(body)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"metrics": ["errors_total", "requests_total"]}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, metricsPath, strings.NewReader(`{"expr": "up{"}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"message": "1:4: parse error: unexpected end of input inside braces", "start": 3, "end": 3}`, rec.Body.String())
+}
+
+func TestGetRestrictExprHandler(t *testing.T) {
+	tenancy := alert.TenancyConfig{RestrictorLabel: "tenant", RestrictQueries: true}
+	client := &mocks.PrometheusAlertClient{}
+	client.On("Tenancy").Return(tenancy)
+	e := echo.New()
+	RegisterV1Handlers(e, client, true)
+
+	restrictPath := strings.Replace(v1PromQLRestrictPath, ":"+tenantIDParam, testNID, 1)
+	for _, expr := range []string{
+		"up == 0",
+		`sum by(job) (rate(http_requests_total{code="500"}[5m])) > 1`,
+		`up{tenant="test"}`,
+	} {
+		expected, err := restrictor.NewQueryRestrictor(restrictor.DefaultOpts).AddMatcher("tenant", testNID).RestrictQuery(expr)
+		assert.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		body, _ := json.Marshal(exprPayload{Expr: expr})
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, restrictPath, bytes.NewReader(body)))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var restricted exprPayload
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &restricted))
+		assert.Equal(t, expected, restricted.Expr)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, restrictPath, strings.NewReader(`{"expr": "up{"}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Expressions are returned as they are when queries aren't restricted
+	unrestricted := &mocks.PrometheusAlertClient{}
+	unrestricted.On("Tenancy").Return(alert.TenancyConfig{RestrictorLabel: "tenant"})
+	e = echo.New()
+	RegisterV1Handlers(e, unrestricted, false)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, restrictPath, strings.NewReader(`{"expr": "up == 0"}`)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"expr": "up == 0"}`, rec.Body.String())
+}
+
+func TestBodyLimit(t *testing.T) {
+	client := &mocks.PrometheusAlertClient{}
+	client.On("Tenancy").Return(alert.TenancyConfig{RestrictorLabel: "tenant"})
+	e := echo.New()
+	e.Use(middleware.BodyLimit("1K"))
+	RegisterV1Handlers(e, client, false)
+	oversized := fmt.Sprintf(`{"alert": "testAlert1", "expr": "%s"}`, strings.Repeat("a", 2048))
+
+	// Bodies with a known length are rejected before reaching the handler
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/test/alert", strings.NewReader(oversized)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	// Bodies of unknown length are rejected while they're decoded
+	for _, path := range []string{"/v1/test/alert", "/v1/test/alert/bulk", v1PromQLFormatPath} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(oversized))
+		req.ContentLength = -1
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code, path)
+	}
+	client.AssertNotCalled(t, "WriteRuleToGroup", mock.Anything, mock.Anything, mock.Anything)
+	client.AssertNotCalled(t, "BulkUpdateRulesInGroups", mock.Anything, mock.Anything)
+}
+
 func TestTenancyMiddleware(t *testing.T) {
 	e := echo.New()
 	rec := httptest.NewRecorder()
@@ -369,24 +1348,138 @@ func TestTenancyMiddleware(t *testing.T) {
 	}
 }
 
+func TestStatusHandler(t *testing.T) {
+	e := echo.New()
+	RegisterBaseHandlers(e)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"service": "prometheus-config-manager", "status": "ok"}`, rec.Body.String())
+
+	// Browsers get plain text
+	for _, accept := range []string{"text/plain", "text/html,application/xhtml+xml,*/*;q=0.8"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderAccept, accept)
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "Prometheus Config server", rec.Body.String())
+	}
+}
+
+func TestVersionHandler(t *testing.T) {
+	defer func(v, commit, date string) {
+		version.Version, version.Commit, version.BuildDate = v, commit, date
+	}(version.Version, version.Commit, version.BuildDate)
+	version.Version, version.Commit, version.BuildDate = "1.2.3", "abc123", "2020-09-01"
+
+	e := echo.New()
+	RegisterBaseHandlers(e)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, versionPath, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var info version.Info
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &info))
+	assert.Equal(t, version.Info{Version: "1.2.3", Commit: "abc123", BuildDate: "2020-09-01"}, info)
+}
+
+func TestGetRoutesInfoHandler(t *testing.T) {
+	e := echo.New()
+	RegisterBaseHandlers(e)
+	RegisterV0Handlers(e, &mocks.PrometheusAlertClient{}, false)
+	RegisterV1Handlers(e, &mocks.PrometheusAlertClient{}, false)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, routesInfoPath, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var routes []echo.Route
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &routes))
+	registered := map[string]bool{}
+	for _, route := range routes {
+		registered[route.Method+" "+route.Path] = true
+	}
+	for _, expected := range []string{
+		"POST /:tenant_id/alert",
+		"PUT /:tenant_id/alert/bulk",
+		"POST /v1/:tenant_id/alert",
+		"POST /v1/:tenant_id/alert/bulk",
+		"GET /v1/tenancy",
+		"GET /v1/routes-info",
+	} {
+		assert.True(t, registered[expected], "missing route %s", expected)
+	}
+}
+
+func TestReadOnlyMode(t *testing.T) {
+	client := &mocks.PrometheusAlertClient{}
+	client.On("Tenancy").Return(alert.TenancyConfig{RestrictorLabel: "tenant"})
+	client.On("RulesModTime", testNID).Return(time.Time{}, nil)
+	client.On("ReadRulesWithGroups", testNID, "").Return([]alert.GroupedRule{}, nil)
+
+	e := echo.New()
+	RegisterV0Handlers(e, client, true)
+	RegisterV1Handlers(e, client, true)
+
+	// Modifications are rejected before reaching the client
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(method, "/v1/test/alert/testAlert1", strings.NewReader("{}")))
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/test/alert", strings.NewReader("{}")))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/test/alert", strings.NewReader("{}")))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	// Reads are still served
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/test/alert", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/tenancy", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	client.AssertExpectations(t)
+
+	// Nothing is rejected when not read-only
+	handler := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	c := e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+	assert.NoError(t, readOnlyMiddlewareProvider(false)(handler)(c))
+}
+
 func TestDecodeRulePostRequest(t *testing.T) {
 	// Successful Decode
 	c, _ := buildContext(sampleAlert1, http.MethodPost, "/", v1alertPath, testNID)
-	conf, err := decodeRulePostRequest(c)
+	conf, group, err := decodeRulePostRequest(c)
 	assert.NoError(t, err)
 	assert.Equal(t, sampleAlert1, conf)
+	assert.Equal(t, "", group)
 
 	// Decode JSONWrapped Route
 	c, _ = buildContext(sampleJSONRule1, http.MethodPost, "/", v1alertPath, testNID)
-	conf, err = decodeRulePostRequest(c)
+	conf, group, err = decodeRulePostRequest(c)
 	assert.NoError(t, err)
 	assert.Equal(t, sampleAlert1, conf)
+	assert.Equal(t, "", group)
+
+	// Decode JSONWrapped Route with group
+	groupedRule := sampleJSONRule1
+	groupedRule.Group = "testGroup"
+	c, _ = buildContext(groupedRule, http.MethodPost, "/", v1alertPath, testNID)
+	conf, group, err = decodeRulePostRequest(c)
+	assert.NoError(t, err)
+	assert.Equal(t, sampleAlert1, conf)
+	assert.Equal(t, "testGroup", group)
 
 	// error decoding route
 	c, _ = buildContext(struct {
 		Alert int `json:"alert"`
 	}{0}, http.MethodPost, "/", v1alertPath, testNID)
-	_, err = decodeRulePostRequest(c)
+	_, _, err = decodeRulePostRequest(c)
 	assert.EqualError(t, err, `error unmarshalling payload: json: cannot unmarshal number into Go struct field RuleJSONWrapper.alert of type string`)
 }
 
@@ -414,6 +1507,25 @@ func TestRuleValidate(t *testing.T) {
 	assert.EqualError(t, err, "Rule Validation Error; invalid label name: 1label")
 }
 
+// buildUploadContext builds the context of a bulk request uploading a rules
+// file as multipart/form-data
+func buildUploadContext(t *testing.T, filename, fileText string) (echo.Context, *httptest.ResponseRecorder) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile(rulesFileField, filename)
+	assert.NoError(t, err)
+	_, err = part.Write([]byte(fileText))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.Set(tenantIDParam, testNID)
+	return c, rec
+}
+
 func buildContext(body interface{}, method, target, path, tenantID string) (echo.Context, *httptest.ResponseRecorder) {
 	bytes, _ := json.Marshal(body)
 	req := httptest.NewRequest(method, target, strings.NewReader(string(bytes)))
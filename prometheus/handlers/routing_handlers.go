@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	amconfig "github.com/facebookincubator/prometheus-configmanager/alertmanager/config"
+	"github.com/facebookincubator/prometheus-configmanager/prometheus/alert"
+
+	"github.com/golang/glog"
+	"github.com/labstack/echo"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	v1alertRoutePath = v1TenantRootPath + v1alertNamePath + "/route"
+)
+
+// ErrTenantRouteNotFound is returned by a TenantRouteProvider when the tenant
+// has no route in the alertmanager config
+var ErrTenantRouteNotFound = errors.New("tenant has no alertmanager route")
+
+// TenantRouteProvider returns the alertmanager routing tree of a tenant
+type TenantRouteProvider func(tenantID string) (*amconfig.Route, error)
+
+// NewAlertmanagerRouteProvider returns a TenantRouteProvider that reads each
+// tenant's route from the alertmanager configurer at baseURL, e.g.
+// "http://alertmanager-configurer:9101". If httpClient is nil
+// http.DefaultClient is used, which never times out, so servers should pass a
+// client with a Timeout.
+func NewAlertmanagerRouteProvider(baseURL string, httpClient *http.Client) TenantRouteProvider {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	baseURL = strings.TrimRight(baseURL, "/")
+	return func(tenantID string) (*amconfig.Route, error) {
+		resp, err := httpClient.Get(fmt.Sprintf("%s/v1/%s/route", baseURL, url.PathEscape(tenantID)))
+		if err != nil {
+			return nil, fmt.Errorf("error getting tenant route: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("tenant %s: %w", tenantID, ErrTenantRouteNotFound)
+		}
+		if resp.StatusCode != http.StatusOK {
+			body, _ := ioutil.ReadAll(resp.Body)
+			return nil, fmt.Errorf("error getting tenant route: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+		route := amconfig.Route{}
+		err = json.NewDecoder(resp.Body).Decode(&route)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding tenant route: %v", err)
+		}
+		return &route, nil
+	}
+}
+
+// RegisterRuleRoutingHandlers adds the endpoint simulating how alerts of a
+// tenant's rules are routed by alertmanager, using routes to read the
+// tenant's routing tree
+func RegisterRuleRoutingHandlers(e *echo.Echo, alertClient alert.PrometheusAlertClient, routes TenantRouteProvider) {
+	e.GET(v1alertRoutePath, GetRuleRouteHandler(alertClient, routes), tenancyMiddlewareProvider(pathTenantProvider))
+}
+
+// ruleRouting is the JSON body of the response describing where the alerts
+// of a rule are routed
+type ruleRouting struct {
+	Receivers []string `json:"receivers"`
+	// Unrouted is set when every receiver is the tenant's base route
+	// receiver, which doesn't notify anyone
+	Unrouted bool `json:"unrouted"`
+}
+
+// GetRuleRouteHandler returns a handler that routes the labels of an alerting
+// rule through the tenant's alertmanager routing tree and responds with the
+// receivers its alerts would be sent to
+func GetRuleRouteHandler(client alert.PrometheusAlertClient, routes TenantRouteProvider) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		defer glog.Flush()
+		ruleName := c.Param(ruleNameParam)
+		tenantID := c.Get(tenantIDParam).(string)
+		glog.Infof("Get Rule Route: Tenant: %s, rule: %s", tenantID, ruleName)
+
+		rules, err := client.ReadRulesWithGroups(tenantID, ruleName)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if len(rules) == 0 {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Rule '%s' does not exist", ruleName))
+		}
+		rule := rules[0].Rule
+		if rule.Alert == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Rule '%s' is a recording rule and sends no alerts", ruleName))
+		}
+
+		route, err := routes(tenantID)
+		if errors.Is(err, ErrTenantRouteNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		// Alerts carry the rule's labels, including the tenant label the rule
+		// is stored with, and their alert name
+		labels := map[string]string{model.AlertNameLabel: rule.Alert}
+		for name, value := range rule.Labels {
+			labels[name] = value
+		}
+		receivers := route.Receivers(labels)
+		unrouted := true
+		for _, receiver := range receivers {
+			if !strings.HasSuffix(receiver, amconfig.TenantBaseRoutePostfix) {
+				unrouted = false
+			}
+		}
+		return c.JSON(http.StatusOK, ruleRouting{Receivers: receivers, Unrouted: unrouted})
+	}
+}
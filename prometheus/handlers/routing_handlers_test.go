@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	amconfig "github.com/facebookincubator/prometheus-configmanager/alertmanager/config"
+	"github.com/facebookincubator/prometheus-configmanager/prometheus/alert"
+	"github.com/facebookincubator/prometheus-configmanager/prometheus/alert/mocks"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetRuleRouteHandler(t *testing.T) {
+	baseReceiver := amconfig.MakeBaseRouteName(testNID)
+	route := &amconfig.Route{
+		Receiver: baseReceiver,
+		Match:    map[string]string{"tenant": testNID},
+		Routes: []*amconfig.Route{
+			{Receiver: "pager", Match: map[string]string{"severity": "critical"}},
+		},
+	}
+	routes := func(tenantID string) (*amconfig.Route, error) {
+		if tenantID != testNID {
+			return nil, fmt.Errorf("tenant %s: %w", tenantID, ErrTenantRouteNotFound)
+		}
+		return route, nil
+	}
+	critical := rulefmt.Rule{Alert: "critical", Expr: "up == 0", Labels: map[string]string{"severity": "critical", "tenant": testNID}}
+	minor := rulefmt.Rule{Alert: "minor", Expr: "up == 0", Labels: map[string]string{"severity": "minor", "tenant": testNID}}
+	recording := rulefmt.Rule{Record: "job:up:sum", Expr: "sum(up) by (job)"}
+
+	client := &mocks.PrometheusAlertClient{}
+	client.On("ReadRulesWithGroups", testNID, "critical").Return([]alert.GroupedRule{{Rule: critical}}, nil)
+	client.On("ReadRulesWithGroups", testNID, "minor").Return([]alert.GroupedRule{{Rule: minor}}, nil)
+	client.On("ReadRulesWithGroups", testNID, "job:up:sum").Return([]alert.GroupedRule{{Rule: recording}}, nil)
+	client.On("ReadRulesWithGroups", testNID, "missing").Return([]alert.GroupedRule{}, nil)
+	client.On("ReadRulesWithGroups", "other", "critical").Return([]alert.GroupedRule{{Rule: critical}}, nil)
+	e := echo.New()
+	RegisterRuleRoutingHandlers(e, client, routes)
+
+	get := func(tenantID, ruleName string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		path := fmt.Sprintf("/v1/%s/alert/%s/route", tenantID, ruleName)
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	// Matches a route by severity
+	rec := get(testNID, "critical")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"receivers": ["pager"], "unrouted": false}`, rec.Body.String())
+
+	// Falls through to the tenant's base route
+	rec = get(testNID, "minor")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, fmt.Sprintf(`{"receivers": [%q], "unrouted": true}`, baseReceiver), rec.Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, get(testNID, "job:up:sum").Code)
+	assert.Equal(t, http.StatusNotFound, get(testNID, "missing").Code)
+	assert.Equal(t, http.StatusNotFound, get("other", "critical").Code)
+}
+
+func TestNewAlertmanagerRouteProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/test/route":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"receiver": "test_tenant_base_route", "routes": [{"receiver": "pager", "match_re": {"severity": "crit.*"}}]}`)
+		case "/v1/missing/route":
+			http.Error(w, `{"message": "not found"}`, http.StatusNotFound)
+		default:
+			http.Error(w, "config unreadable", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	routes := NewAlertmanagerRouteProvider(server.URL+"/", nil)
+
+	route, err := routes(testNID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pager"}, route.Receivers(map[string]string{"severity": "critical"}))
+
+	_, err = routes("missing")
+	assert.True(t, errors.Is(err, ErrTenantRouteNotFound))
+
+	_, err = routes("broken")
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "config unreadable"))
+}
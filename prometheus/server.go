@@ -8,37 +8,83 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/facebookincubator/prometheus-configmanager/envflag"
 	"github.com/facebookincubator/prometheus-configmanager/fsclient"
+	"github.com/facebookincubator/prometheus-configmanager/idempotency"
 	"github.com/facebookincubator/prometheus-configmanager/prometheus/alert"
 	"github.com/facebookincubator/prometheus-configmanager/prometheus/handlers"
 
 	"github.com/golang/glog"
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/middleware"
+	"github.com/prometheus/common/model"
 )
 
 const (
 	defaultPort          = "9100"
 	defaultPrometheusURL = "prometheus:9090"
 	defaultTenancyLabel  = "tenant"
+	defaultBodyLimit     = "10M"
+
+	// shutdownTimeout is how long in-flight requests have to finish on
+	// shutdown
+	shutdownTimeout = 30 * time.Second
+	// routeRequestTimeout is how long reading a tenant's route from the
+	// alertmanager configurer may take
+	routeRequestTimeout = 10 * time.Second
 )
 
 func main() {
+	// Only the server's own flags are read from the environment, not those
+	// registered by imported packages, e.g. glog's
+	libraryFlags := envflag.Names(flag.CommandLine)
 	port := flag.String("port", defaultPort, fmt.Sprintf("Port to listen for requests. Default is %s", defaultPort))
 	rulesDir := flag.String("rules-dir", ".", "Directory to write rules files. Default is '.'")
 	prometheusURL := flag.String("prometheusURL", defaultPrometheusURL, fmt.Sprintf("URL of the prometheus instance that is reading these rules. Default is %s", defaultPrometheusURL))
+	prometheusURLs := flag.String("prometheusURLs", "", "Comma-separated list of URLs of prometheus instances reading these rules, all of which are reloaded after a change. Overrides prometheusURL")
+	reloadPath := flag.String("reload-path", alert.DefaultReloadPath, fmt.Sprintf("Path of the reload endpoint of the prometheus instances, e.g. when behind a path-rewriting proxy. Default is %s", alert.DefaultReloadPath))
+	reloadQuorum := flag.Int("reload-quorum", 0, "Number of prometheus instances that must reload successfully for a change to succeed. Default is all of them")
+	reloadWindow := flag.Duration("reload-window", 0, "Batch reloads requested within this duration of each other into a single prometheus reload. Zero reloads on every change")
+	reloadMaxDelay := flag.Duration("reload-max-delay", 10*time.Second, "Longest a change waits for its batched reload when reload-window is set. Default is 10s")
+	tenantTargetsFile := flag.String("tenant-targets-file", "", "Path to a YAML file mapping each tenant to the list of prometheus instances that load its rules, e.g. tenantA: [prometheus-a:9090]. A change to a tenant's rules only reloads its instances. Tenants that aren't listed reload every instance")
 	multitenancyLabel := flag.String("multitenant-label", "tenant", fmt.Sprintf("The label name to segment alerting rules to enable multi-tenant support, having each tenant's alerts in a separate file. Default is %s", defaultTenancyLabel))
 	restrictQueries := flag.Bool("restrict-queries", false, "If this flag is set all alert rule expressions will be restricted to only match series with {<multitenant-label>=<tenant>}")
+	allowSkipRestriction := flag.Bool("allow-skip-restriction", false, fmt.Sprintf("If this flag is set alert rules annotated with %s: \"true\" aren't restricted by restrict-queries", alert.SkipRestrictionAnnotation))
+	skipRestrictionLabel := flag.Bool("skip-restriction-label", false, "If this flag is set alert rules that skip restriction don't get the <multitenant-label> label either")
+	defaultFor := flag.String("default-for", "", "Duration to use as 'for' in alerting rules written without one, e.g. 5m. Default is no default")
+	requiredLabels := flag.String("required-labels", "", "Comma-separated list of label names every alerting rule must have")
+	requiredAnnotations := flag.String("required-annotations", "", "Comma-separated list of annotation names every alerting rule must have")
+	validateRunbookURL := flag.Bool("validate-runbook-url", false, "If this flag is set the runbook_url annotation of alerting rules must be an absolute http(s) URL")
+	compat := flag.Bool("compat", false, "If this flag is set rules files in the legacy layout, without rule groups, can be read. They are rewritten in the current layout when modified")
+	preserveAnchors := flag.Bool("preserve-anchors", false, "If this flag is set the YAML anchors and aliases of rules files are kept when they're modified, rather than expanded")
+	globalRuleUniqueness := flag.Bool("global-rule-uniqueness", false, "If this flag is set alerting rule names must be unique across all tenants")
+	bulkTenantCheck := flag.Bool("bulk-tenant-check", false, "If this flag is set bulk updates are rejected if any rule carries the <multitenant-label> label with a value other than the tenant, instead of overwriting it")
+	fileMode := flag.String("file-mode", "0666", "Permission bits, in octal, that rules files are written with. Default is 0666")
+	fileHeader := flag.String("file-header", "", fmt.Sprintf("Comment written at the top of every rules file, e.g. owner and generated-by. Lines are separated by \\n and %s is replaced with the time the file was written", alert.FileHeaderTimestamp))
+	readOnly := flag.Bool("read-only", false, "If this flag is set all requests that modify the configuration are rejected")
+	idempotencyTTL := flag.Duration("idempotency-ttl", 24*time.Hour, "How long responses to requests with an Idempotency-Key header are kept for replay. Zero disables idempotency keys")
+	alertmanagerConfigurerURL := flag.String("alertmanager-configurer-url", "", "URL of the alertmanager configurer whose tenant routes are used to show where the alerts of a rule are sent, e.g. http://alertmanager-configurer:9101. Rule routing isn't available if unset")
+	tempFileMaxAge := flag.Duration("temp-file-max-age", 0, "Temp files left in rules-dir by interrupted writes are removed at startup once they are older than this. Zero keeps them. Default is 0")
+	bodyLimit := flag.String("body-limit", defaultBodyLimit, fmt.Sprintf("Largest request body accepted, e.g. 512K or 10M. Larger requests are rejected with 413. Default is %s", defaultBodyLimit))
 	flag.Parse()
-
-	if !strings.HasSuffix(*rulesDir, "/") {
-		*rulesDir += "/"
+	if err := envflag.SetFromEnv(flag.CommandLine, libraryFlags); err != nil {
+		glog.Fatalf("Invalid configuration: %v", err)
+	}
+	if *restrictQueries && *multitenancyLabel == "" {
+		glog.Fatalf("Invalid configuration: restrict-queries requires a multitenant-label")
 	}
 
 	// Check if rulesDir exists and create it if not
@@ -54,12 +100,84 @@ func main() {
 		}
 	}
 
+	rulesFS := fsclient.NewFSClient(*rulesDir)
+	if *tempFileMaxAge > 0 {
+		if _, err := fsclient.RemoveStaleTempFiles(rulesFS, "", *tempFileMaxAge); err != nil {
+			glog.Errorf("Could not remove stale temp files: %v", err)
+		}
+	}
+
+	var clientOpts []alert.ClientOption
+	if *defaultFor != "" {
+		forDuration, err := model.ParseDuration(*defaultFor)
+		if err != nil {
+			glog.Fatalf("Invalid default-for duration: %v", err)
+		}
+		clientOpts = append(clientOpts, alert.WithDefaultFor(forDuration))
+	}
+	if *requiredLabels != "" || *requiredAnnotations != "" {
+		clientOpts = append(clientOpts, alert.WithRequiredKeys(splitList(*requiredLabels), splitList(*requiredAnnotations)))
+	}
+
+	ruleFileMode, err := strconv.ParseUint(*fileMode, 8, 32)
+	if err != nil {
+		glog.Fatalf("Invalid file-mode: %v", err)
+	}
+	clientOpts = append(clientOpts, alert.WithFileMode(os.FileMode(ruleFileMode)))
+
+	if *validateRunbookURL {
+		clientOpts = append(clientOpts, alert.WithRunbookURLValidation(true))
+	}
+	if *reloadPath != alert.DefaultReloadPath {
+		clientOpts = append(clientOpts, alert.WithReloadPath(*reloadPath))
+	}
+	if *reloadQuorum > 0 {
+		clientOpts = append(clientOpts, alert.WithReloadQuorum(*reloadQuorum))
+	}
+	if *reloadWindow > 0 {
+		clientOpts = append(clientOpts, alert.WithReloadWindow(*reloadWindow, *reloadMaxDelay))
+	}
+	if *tenantTargetsFile != "" {
+		data, err := ioutil.ReadFile(*tenantTargetsFile)
+		if err != nil {
+			glog.Fatalf("Could not read tenant-targets-file: %v", err)
+		}
+		targets, err := alert.ParseTenantTargets(data)
+		if err != nil {
+			glog.Fatalf("Invalid tenant-targets-file: %v", err)
+		}
+		clientOpts = append(clientOpts, alert.WithTenantTargets(targets))
+	}
+	if *compat {
+		clientOpts = append(clientOpts, alert.WithLegacyCompat(true))
+	}
+	if *preserveAnchors {
+		clientOpts = append(clientOpts, alert.WithAnchorPreservation(true))
+	}
+	if *globalRuleUniqueness {
+		clientOpts = append(clientOpts, alert.WithGlobalRuleUniqueness(true))
+	}
+	if *bulkTenantCheck {
+		clientOpts = append(clientOpts, alert.WithBulkTenantCheck(true))
+	}
+	if *fileHeader != "" {
+		clientOpts = append(clientOpts, alert.WithFileHeader(strings.ReplaceAll(*fileHeader, `\n`, "\n")))
+	}
+
 	fileLocks, err := alert.NewFileLocker(alert.NewDirectoryClient(*rulesDir))
+	if err != nil {
+		glog.Fatalf("error creating file locks: %v", err)
+	}
 	clientTenancy := alert.TenancyConfig{
-		RestrictQueries: *restrictQueries,
-		RestrictorLabel: *multitenancyLabel,
+		RestrictQueries:      *restrictQueries,
+		RestrictorLabel:      *multitenancyLabel,
+		AllowSkipRestriction: *allowSkipRestriction,
+		SkipRestrictionLabel: *skipRestrictionLabel,
 	}
-	alertClient := alert.NewClient(fileLocks, *prometheusURL, fsclient.NewFSClient(*rulesDir), clientTenancy)
+	if *prometheusURLs != "" {
+		*prometheusURL = *prometheusURLs
+	}
+	alertClient, err := alert.NewClient(fileLocks, *prometheusURL, rulesFS, clientTenancy, clientOpts...)
 	if err != nil {
 		glog.Fatalf("error creating alert client: %v", err)
 	}
@@ -67,11 +185,54 @@ func main() {
 	e := echo.New()
 	e.Use(middleware.CORS())
 	e.Use(middleware.Logger())
+	e.Use(middleware.BodyLimit(*bodyLimit))
+	if *idempotencyTTL > 0 {
+		e.Use(idempotency.NewCache(*idempotencyTTL).Middleware())
+	}
 
 	handlers.RegisterBaseHandlers(e)
-	handlers.RegisterV0Handlers(e, alertClient)
-	handlers.RegisterV1Handlers(e, alertClient)
+	handlers.RegisterV0Handlers(e, alertClient, *readOnly)
+	handlers.RegisterV1Handlers(e, alertClient, *readOnly)
+	if *alertmanagerConfigurerURL != "" {
+		handlers.RegisterRuleRoutingHandlers(e, alertClient, handlers.NewAlertmanagerRouteProvider(*alertmanagerConfigurerURL, &http.Client{Timeout: routeRequestTimeout}))
+	}
 
 	glog.Infof("Prometheus Config server listening on port: %s\n", *port)
-	e.Logger.Fatal(e.Start(fmt.Sprintf(":%s", *port)))
+	go func() {
+		err := e.Start(fmt.Sprintf(":%s", *port))
+		if err != nil && err != http.ErrServerClosed {
+			e.Logger.Fatal(err)
+		}
+	}()
+	waitForShutdown(e, alertClient)
+}
+
+// waitForShutdown blocks until the server is interrupted or terminated, then
+// stops accepting requests and closes the client so no pending work is lost
+func waitForShutdown(e *echo.Echo, client io.Closer) {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+
+	glog.Info("Shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		glog.Errorf("error shutting down server: %v", err)
+	}
+	if err := client.Close(); err != nil {
+		glog.Errorf("error closing client: %v", err)
+	}
+	glog.Flush()
+}
+
+// splitList splits a comma-separated flag value, ignoring empty entries
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
@@ -72,6 +72,23 @@ func (q *QueryRestrictor) RestrictQuery(query string) (string, error) {
 	return promQuery.String(), nil
 }
 
+// UnrestrictQuery removes the restrictor's label selectors from each metric in
+// a given query, reversing RestrictQuery. This is best-effort: a selector that
+// held a different value for the label before being restricted can't be
+// recovered, and a matcher is kept if it is the only one in its selector.
+func (q *QueryRestrictor) UnrestrictQuery(query string) (string, error) {
+	if query == "" {
+		return "", fmt.Errorf("empty query string")
+	}
+
+	promQuery, err := parser.ParseExpr(query)
+	if err != nil {
+		return "", fmt.Errorf("error parsing query: %v", err)
+	}
+	parser.Inspect(promQuery, q.removeRestrictorLabels())
+	return promQuery.String(), nil
+}
+
 // Matchers returns the list of label matchers for the restrictor
 func (q *QueryRestrictor) Matchers() []labels.Matcher {
 	return q.matchers
@@ -94,6 +111,36 @@ func (q *QueryRestrictor) addRestrictorLabels() func(n parser.Node, path []parse
 	}
 }
 
+func (q *QueryRestrictor) removeRestrictorLabels() func(n parser.Node, path []parser.Node) error {
+	return func(n parser.Node, path []parser.Node) error {
+		if n == nil {
+			return nil
+		}
+		for _, matcher := range q.matchers {
+			switch n := n.(type) {
+			case *parser.VectorSelector:
+				n.LabelMatchers = removeMatcher(n.LabelMatchers, matcher)
+			case *parser.MatrixSelector:
+				n.VectorSelector.(*parser.VectorSelector).LabelMatchers = removeMatcher(n.VectorSelector.(*parser.VectorSelector).LabelMatchers, matcher)
+			}
+		}
+		return nil
+	}
+}
+
+func removeMatcher(matchers []*labels.Matcher, oldMatcher labels.Matcher) []*labels.Matcher {
+	idx := getMatcherIndex(matchers, oldMatcher.Name)
+	if idx < 0 || len(matchers) == 1 {
+		return matchers
+	}
+	// The matcher type isn't compared since RestrictQuery keeps the type of
+	// a matcher whose value it replaces
+	if matchers[idx].Value != oldMatcher.Value {
+		return matchers
+	}
+	return append(matchers[:idx], matchers[idx+1:]...)
+}
+
 func appendOrReplaceMatcher(matchers []*labels.Matcher, newMatcher labels.Matcher, replaceExistingLabel bool) []*labels.Matcher {
 	if replaceExistingLabel && getMatcherIndex(matchers, newMatcher.Name) >= 0 {
 		return replaceLabelValue(matchers, newMatcher.Name, newMatcher.Value)
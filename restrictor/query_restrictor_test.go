@@ -130,3 +130,29 @@ func TestQueryRestrictor_RestrictQuery(t *testing.T) {
 		t.Run(test.name, test.RunTest)
 	}
 }
+
+func TestQueryRestrictor_UnrestrictQuery(t *testing.T) {
+	restrictor := NewQueryRestrictor(DefaultOpts).AddMatcher("networkID", "test")
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "basic query", input: `up{networkID="test"}`, expected: `up`},
+		{name: "query with function", input: `sum(up{networkID="test"})`, expected: `sum(up)`},
+		{name: "query with labels", input: `up{label="value",networkID="test"}`, expected: `up{label="value"}`},
+		{name: "range query", input: `rate(http_requests_total{networkID="test"}[5m])`, expected: `rate(http_requests_total[5m])`},
+		{name: "other value kept", input: `up{networkID="other"}`, expected: `up{networkID="other"}`},
+		{name: "only matcher kept", input: `{networkID="test"}`, expected: `{networkID="test"}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			output, err := restrictor.UnrestrictQuery(tc.input)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, output)
+		})
+	}
+
+	_, err := restrictor.UnrestrictQuery("")
+	assert.EqualError(t, err, "empty query string")
+}